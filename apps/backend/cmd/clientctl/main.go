@@ -0,0 +1,153 @@
+// Command clientctl manages the apps that log users in through this service
+// when it acts as an OpenID Connect provider.
+//
+// Usage:
+//
+//	clientctl list
+//	clientctl create -name Docs -redirect-uri https://docs.example.com/callback [-public]
+//	clientctl delete <client_id>
+//
+// create prints the new client ID and, unless -public is given, a client
+// secret. The secret is stored hashed and cannot be shown again. Public
+// clients, such as single-page and mobile apps, cannot keep a secret and
+// rely on PKCE alone.
+//
+// delete also removes the client's pending codes and users' consents. Tokens
+// already issued to it stay valid until they expire.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+)
+
+func main() {
+	databaseURL := flag.String("database", os.Getenv("DATABASE_URL"), "database URL (default: $DATABASE_URL)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: clientctl [-database url] <list|create|delete> [flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *databaseURL == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	db, err := database.NewDB(ctx, *databaseURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clientctl: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	repo := repository.NewOAuthRepository(db)
+
+	switch flag.Arg(0) {
+	case "list":
+		err = list(ctx, repo)
+	case "create":
+		err = create(ctx, repo, flag.Args()[1:])
+	case "delete":
+		err = remove(ctx, repo, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clientctl: %v\n", err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func list(ctx context.Context, repo *repository.OAuthRepository) error {
+	clients, err := repo.ListClients(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, client := range clients {
+		kind := "confidential"
+		if client.IsPublic() {
+			kind = "public"
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", client.ClientID, kind, client.Name, strings.Join(client.RedirectURIs, " "))
+	}
+	return nil
+}
+
+// stringList collects a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func create(ctx context.Context, repo *repository.OAuthRepository, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	name := fs.String("name", "", "name shown to users on the consent screen")
+	public := fs.Bool("public", false, "create a public client without a secret")
+	var redirectURIs stringList
+	fs.Var(&redirectURIs, "redirect-uri", "allowed redirect URI (repeatable)")
+	fs.Parse(args)
+
+	if *name == "" || len(redirectURIs) == 0 {
+		return fmt.Errorf("create requires -name and at least one -redirect-uri")
+	}
+
+	clientID, err := auth.GenerateClientID()
+	if err != nil {
+		return err
+	}
+	client := &models.OAuthClient{ClientID: clientID, Name: *name, RedirectURIs: redirectURIs}
+
+	var secret string
+	if !*public {
+		secret, err = auth.GenerateOpaqueToken()
+		if err != nil {
+			return err
+		}
+		client.ClientSecretHash = auth.HashToken(secret)
+	}
+
+	if err := repo.CreateClient(ctx, client); err != nil {
+		return err
+	}
+
+	fmt.Printf("Client ID:     %s\n", client.ClientID)
+	if secret != "" {
+		fmt.Printf("Client secret: %s\n", secret)
+		fmt.Println("Store the secret now; it cannot be shown again.")
+	}
+	return nil
+}
+
+func remove(ctx context.Context, repo *repository.OAuthRepository, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("delete requires a client ID")
+	}
+
+	deleted, err := repo.DeleteClient(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("no client %s", args[0])
+	}
+
+	fmt.Printf("Deleted %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,155 @@
+// Command keyctl manages the JWT signing key directory loaded via JWT_KEYS_DIR.
+//
+// Usage:
+//
+//	keyctl -dir keys list
+//	keyctl -dir keys rotate [-alg EdDSA] [-publish-for 10m]
+//	keyctl -dir keys retire [-max-token-lifetime 15m]
+//
+// rotate adds a new key that is published in the JWKS straight away but only
+// starts signing after -publish-for, so every instance and every verifier
+// caching our JWKS knows about it before tokens signed with it appear. The
+// first key in an empty directory is active immediately.
+//
+// retire deletes keys whose successor has been signing for longer than
+// -max-token-lifetime, after which no unexpired token can reference them. It
+// defaults to the longer of ACCESS_TOKEN_TTL and MFA_PENDING_TTL, read from
+// the environment the same way the server reads them, so run it with the
+// server's configuration.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+)
+
+func main() {
+	dir := flag.String("dir", os.Getenv("JWT_KEYS_DIR"), "key directory (default: $JWT_KEYS_DIR)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: keyctl [-dir path] <list|rotate|retire> [flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dir == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "list":
+		err = list(*dir)
+	case "rotate":
+		err = rotate(*dir, flag.Args()[1:])
+	case "retire":
+		err = retire(*dir, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keyctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func list(dir string) error {
+	manifest, err := auth.ReadKeyManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, entry := range manifest.Keys {
+		status := "verify-only"
+		switch {
+		case entry.ActiveFrom.After(now):
+			status = "pending"
+		case i+1 == len(manifest.Keys) || manifest.Keys[i+1].ActiveFrom.After(now):
+			status = "signing"
+		}
+		fmt.Printf("%s\t%s\tactive from %s\n", entry.ID, status, entry.ActiveFrom.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func rotate(dir string, args []string) error {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	alg := fs.String("alg", auth.AlgEdDSA, "signing algorithm (RS256 or EdDSA)")
+	publishFor := fs.Duration("publish-for", 10*time.Minute, "how long the new key is published before it signs")
+	fs.Parse(args)
+
+	manifest, err := auth.ReadKeyManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	activeFrom := time.Now().Add(*publishFor)
+	if len(manifest.Keys) == 0 {
+		activeFrom = time.Now()
+	}
+
+	entry, err := auth.AddGeneratedKey(dir, *alg, activeFrom)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %s key %s, signing from %s\n", *alg, entry.ID, entry.ActiveFrom.Format(time.RFC3339))
+	return nil
+}
+
+func retire(dir string, args []string) error {
+	defaultLifetime, err := longestTokenLifetime()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("retire", flag.ExitOnError)
+	maxLifetime := fs.Duration("max-token-lifetime", defaultLifetime, "longest lifetime of any token signed with these keys, per $ACCESS_TOKEN_TTL and $MFA_PENDING_TTL")
+	fs.Parse(args)
+
+	retired, err := auth.RetireKeys(dir, *maxLifetime, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(retired) == 0 {
+		fmt.Println("No keys to retire")
+	}
+	for _, kid := range retired {
+		fmt.Printf("Retired %s\n", kid)
+	}
+	return nil
+}
+
+// longestTokenLifetime returns the longest lifetime the server gives a signed
+// token, honouring the same environment variables it does.
+func longestTokenLifetime() (time.Duration, error) {
+	ttls := []struct {
+		key      string
+		fallback time.Duration
+	}{
+		{"ACCESS_TOKEN_TTL", auth.AccessTokenTTL},
+		{"MFA_PENDING_TTL", auth.MFAPendingTTL},
+	}
+
+	var longest time.Duration
+	for _, ttl := range ttls {
+		lifetime := ttl.fallback
+		if value := os.Getenv(ttl.key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s: %w", ttl.key, err)
+			}
+			lifetime = d
+		}
+		longest = max(longest, lifetime)
+	}
+	return longest, nil
+}
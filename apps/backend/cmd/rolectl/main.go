@@ -0,0 +1,144 @@
+// Command rolectl lists roles and assigns them to users from the command
+// line, which is how the first admin is created.
+//
+// Usage:
+//
+//	rolectl list
+//	rolectl grant <email> <role>
+//	rolectl revoke <email> <role>
+//
+// Like the admin API, revoke also revokes the user's access tokens so the
+// role stops working immediately.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+)
+
+func main() {
+	databaseURL := flag.String("database", os.Getenv("DATABASE_URL"), "database URL (default: $DATABASE_URL)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: rolectl [-database url] <list|grant|revoke> [args]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *databaseURL == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	db, err := database.NewDB(ctx, *databaseURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rolectl: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	switch flag.Arg(0) {
+	case "list":
+		err = list(ctx, db)
+	case "grant":
+		err = grant(ctx, db, flag.Args()[1:])
+	case "revoke":
+		err = revoke(ctx, db, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rolectl: %v\n", err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func list(ctx context.Context, db *database.DB) error {
+	roles, err := repository.NewRoleRepository(db).ListRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		fmt.Printf("%s\t%s\t%s\n", role.Name, strings.Join(role.Permissions, " "), role.Description)
+	}
+	return nil
+}
+
+// lookup resolves the <email> <role> arguments of grant and revoke.
+func lookup(ctx context.Context, db *database.DB, command string, args []string) (*models.User, *models.Role, error) {
+	if len(args) != 2 {
+		return nil, nil, fmt.Errorf("%s requires an email and a role", command)
+	}
+
+	user, err := repository.NewUserRepository(db).GetByEmail(ctx, args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, fmt.Errorf("no user %s", args[0])
+	}
+
+	role, err := repository.NewRoleRepository(db).GetRoleByName(ctx, args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	if role == nil {
+		return nil, nil, fmt.Errorf("no role %s", args[1])
+	}
+
+	return user, role, nil
+}
+
+func grant(ctx context.Context, db *database.DB, args []string) error {
+	user, role, err := lookup(ctx, db, "grant", args)
+	if err != nil {
+		return err
+	}
+
+	assigned, err := repository.NewRoleRepository(db).AssignRole(ctx, user.ID, role.ID)
+	if err != nil {
+		return err
+	}
+
+	if !assigned {
+		fmt.Printf("%s already has %s\n", user.Email, role.Name)
+		return nil
+	}
+	fmt.Printf("Granted %s to %s\n", role.Name, user.Email)
+	return nil
+}
+
+func revoke(ctx context.Context, db *database.DB, args []string) error {
+	user, role, err := lookup(ctx, db, "revoke", args)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := repository.NewRoleRepository(db).RevokeRole(ctx, user.ID, role.ID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("%s does not have %s", user.Email, role.Name)
+	}
+
+	revocations := auth.NewRevocationStore(repository.NewRevocationRepository(db))
+	if err := revocations.RevokeAll(ctx, user.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Revoked %s from %s\n", role.Name, user.Email)
+	return nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// deleteAccount deletes the account of the holder of token and waits for the
+// restore link to be sent to email
+func (suite *AuthHandlerTestSuite) deleteAccount(token, email string) string {
+	body, _ := json.Marshal(models.DeleteAccountRequest{Password: "password123"})
+	w := suite.authedRequest("DELETE", "/me", token, body)
+	suite.Require().Equal(http.StatusNoContent, w.Code, w.Body.String())
+
+	suite.Require().Eventually(func() bool {
+		return suite.notifier.restoreToken(email) != ""
+	}, time.Second, 10*time.Millisecond, "Restore link should be sent")
+	return suite.notifier.restoreToken(email)
+}
+
+func (suite *AuthHandlerTestSuite) TestDeleteAccount() {
+	registered := suite.register("deleteme@example.com", "password123")
+
+	suite.deleteAccount(registered.Token, "deleteme@example.com")
+
+	w := suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, "Deleting logs the user out")
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(registered.RefreshToken).Code)
+	w = suite.postJSON("/login", models.LoginRequest{Email: "deleteme@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w = suite.postJSON("/register", models.RegisterRequest{Email: "deleteme@example.com", Password: "password123", Name: "Someone Else"})
+	assert.Equal(suite.T(), http.StatusConflict, w.Code, "The address is kept until the account is purged")
+}
+
+func (suite *AuthHandlerTestSuite) TestDeleteAccount_WrongPassword() {
+	registered := suite.register("deletewrong@example.com", "password123")
+
+	body, _ := json.Marshal(models.DeleteAccountRequest{Password: "wrongpassword"})
+	w := suite.authedRequest("DELETE", "/me", registered.Token, body)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	w = suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestRestoreAccount() {
+	registered := suite.register("restoreme@example.com", "password123")
+	token := suite.deleteAccount(registered.Token, "restoreme@example.com")
+
+	w := suite.postJSON("/restore-account", models.RestoreAccountRequest{Token: token})
+
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(suite.T(), w.Body.String(), "restoreme@example.com")
+	w = suite.postJSON("/login", models.LoginRequest{Email: "restoreme@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.postJSON("/restore-account", models.RestoreAccountRequest{Token: token})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code, "Restore links are single use")
+}
+
+func (suite *AuthHandlerTestSuite) TestRestoreAccount_InvalidToken() {
+	w := suite.postJSON("/restore-account", models.RestoreAccountRequest{Token: "not-a-real-token"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
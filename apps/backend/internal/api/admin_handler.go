@@ -0,0 +1,218 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves the admin API. Each route is guarded by
+// RequirePermission in SetupRoutes rather than by the handler itself.
+type AdminHandler struct {
+	userRepo    *repository.UserRepository
+	roleRepo    *repository.RoleRepository
+	revocations *auth.RevocationStore
+	throttle    *LoginThrottle
+	audit       *repository.AuditRepository
+}
+
+func NewAdminHandler(
+	userRepo *repository.UserRepository,
+	roleRepo *repository.RoleRepository,
+	revocations *auth.RevocationStore,
+	throttle *LoginThrottle,
+	audit *repository.AuditRepository,
+) *AdminHandler {
+	return &AdminHandler{
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		revocations: revocations,
+		throttle:    throttle,
+		audit:       audit,
+	}
+}
+
+// GetUser returns any user's account.
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UnlockUser lifts a login lockout on a user's account.
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.throttle.Unlock(c, user, "admin"); err != nil {
+		log.Printf("Error unlocking account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListAuditEvents returns the audit log entries concerning a user, newest
+// first.
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.audit.ListForUser(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// ListRoles returns every role with the permissions it grants.
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleRepo.ListRoles(c.Request.Context())
+	if err != nil {
+		log.Printf("Error listing roles: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetUserRoles returns a user's roles and the permissions they grant.
+func (h *AdminHandler) GetUserRoles(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	roles, err := h.roleRepo.ListUserRoles(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error listing user roles: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+	permissions, err := h.roleRepo.ListUserPermissions(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error listing user permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserRolesResponse{Roles: roles, Permissions: permissions})
+}
+
+// AssignRole gives a user a role. The user's next access token carries it.
+func (h *AdminHandler) AssignRole(c *gin.Context) {
+	var req models.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	role, ok := h.role(c, req.Role)
+	if !ok {
+		return
+	}
+
+	if _, err := h.roleRepo.AssignRole(c.Request.Context(), user.ID, role.ID); err != nil {
+		log.Printf("Error assigning role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeRole takes a role away from a user. Their access tokens are revoked
+// so that the permissions stop working immediately; their sessions survive
+// and the next refresh issues a token without the role.
+func (h *AdminHandler) RevokeRole(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	role, ok := h.role(c, c.Param("role"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	revoked, err := h.roleRepo.RevokeRole(ctx, user.ID, role.ID)
+	if err != nil {
+		log.Printf("Error revoking role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User does not have this role"})
+		return
+	}
+
+	if err := h.revocations.RevokeAll(ctx, user.ID); err != nil {
+		log.Printf("Error revoking tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// targetUser loads the user named by the :id parameter, writing the error
+// response itself if there is none.
+func (h *AdminHandler) targetUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// role loads the named role, writing the error response itself if there is
+// none.
+func (h *AdminHandler) role(c *gin.Context, name string) (*models.Role, bool) {
+	role, err := h.roleRepo.GetRoleByName(c.Request.Context(), name)
+	if err != nil {
+		log.Printf("Error getting role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get role"})
+		return nil, false
+	}
+	if role == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return nil, false
+	}
+
+	return role, true
+}
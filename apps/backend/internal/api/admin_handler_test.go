@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// registerWithRole registers a user, assigns them role directly in the
+// database and logs them in again so that their token carries it.
+func (suite *AuthHandlerTestSuite) registerWithRole(email, role string) models.AuthResponse {
+	registered := suite.register(email, "password123")
+
+	roleRepo := repository.NewRoleRepository(suite.db)
+	found, err := roleRepo.GetRoleByName(suite.ctx, role)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(found)
+	_, err = roleRepo.AssignRole(suite.ctx, registered.User.ID, found.ID)
+	suite.Require().NoError(err)
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: email, Password: "password123"})
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var response models.AuthResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_TokenCarriesRoles() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+
+	claims, err := auth.ValidateToken(admin.Token)
+
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []string{"admin"}, claims.Roles)
+	assert.True(suite.T(), claims.HasPermission(auth.PermissionRolesWrite))
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_RequiresPermission() {
+	registered := suite.register("not-admin@example.com", "password123")
+
+	w := suite.authedRequest("GET", "/admin/roles", registered.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_ListRoles() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+
+	w := suite.authedRequest("GET", "/admin/roles", admin.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var roles []models.Role
+	json.Unmarshal(w.Body.Bytes(), &roles)
+	suite.Require().NotEmpty(roles)
+	assert.Equal(suite.T(), "admin", roles[0].Name)
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_GetUser() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	other := suite.register("someone@example.com", "password123")
+
+	w := suite.authedRequest("GET", fmt.Sprintf("/admin/users/%d", other.User.ID), admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "someone@example.com")
+
+	w = suite.authedRequest("GET", "/admin/users/0", admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_AssignRole() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	other := suite.register("promoted@example.com", "password123")
+	rolesPath := fmt.Sprintf("/admin/users/%d/roles", other.User.ID)
+
+	body, _ := json.Marshal(models.AssignRoleRequest{Role: "admin"})
+	w := suite.authedRequest("POST", rolesPath, admin.Token, body)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code, w.Body.String())
+
+	w = suite.authedRequest("GET", rolesPath, admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var roles models.UserRolesResponse
+	json.Unmarshal(w.Body.Bytes(), &roles)
+	assert.Equal(suite.T(), []string{"admin"}, roles.Roles)
+	assert.Contains(suite.T(), roles.Permissions, auth.PermissionUsersRead)
+
+	// The role applies from the user's next token
+	w = suite.authedRequest("GET", "/admin/roles", other.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	w = suite.postJSON("/refresh", models.RefreshRequest{RefreshToken: other.RefreshToken})
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var refreshed models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	w = suite.authedRequest("GET", "/admin/roles", refreshed.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_AssignRole_NotFound() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	other := suite.register("someone@example.com", "password123")
+
+	body, _ := json.Marshal(models.AssignRoleRequest{Role: "missing"})
+	w := suite.authedRequest("POST", fmt.Sprintf("/admin/users/%d/roles", other.User.ID), admin.Token, body)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	body, _ = json.Marshal(models.AssignRoleRequest{Role: "admin"})
+	w = suite.authedRequest("POST", "/admin/users/0/roles", admin.Token, body)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_RevokeRole_EndsAccessImmediately() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	other := suite.registerWithRole("demoted@example.com", "admin")
+	path := fmt.Sprintf("/admin/users/%d/roles/admin", other.User.ID)
+
+	w := suite.authedRequest("DELETE", path, admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code, w.Body.String())
+
+	w = suite.authedRequest("GET", "/admin/roles", other.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	// The session survives without the role
+	w = suite.postJSON("/refresh", models.RefreshRequest{RefreshToken: other.RefreshToken})
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var refreshed models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	claims, err := auth.ValidateToken(refreshed.Token)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), claims.Roles)
+	assert.False(suite.T(), claims.HasPermission(auth.PermissionRolesRead))
+
+	w = suite.authedRequest("DELETE", path, admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
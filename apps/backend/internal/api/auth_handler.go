@@ -1,8 +1,11 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/dwfennell/monorepo-scaffold/internal/auth"
 	"github.com/dwfennell/monorepo-scaffold/internal/models"
@@ -11,11 +14,39 @@ import (
 )
 
 type AuthHandler struct {
-	userRepo *repository.UserRepository
+	userRepo    *repository.UserRepository
+	refreshRepo *repository.RefreshTokenRepository
+	sessionRepo *repository.SessionRepository
+	tokenRepo   *repository.UserTokenRepository
+	revocations *auth.RevocationStore
+	issuer      *TokenIssuer
+	notifier    Notifier
+	throttle    *LoginThrottle
+	passwords   *auth.PasswordPolicy
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository) *AuthHandler {
-	return &AuthHandler{userRepo: userRepo}
+func NewAuthHandler(
+	userRepo *repository.UserRepository,
+	refreshRepo *repository.RefreshTokenRepository,
+	sessionRepo *repository.SessionRepository,
+	tokenRepo *repository.UserTokenRepository,
+	revocations *auth.RevocationStore,
+	issuer *TokenIssuer,
+	notifier Notifier,
+	throttle *LoginThrottle,
+	passwords *auth.PasswordPolicy,
+) *AuthHandler {
+	return &AuthHandler{
+		userRepo:    userRepo,
+		refreshRepo: refreshRepo,
+		sessionRepo: sessionRepo,
+		tokenRepo:   tokenRepo,
+		revocations: revocations,
+		issuer:      issuer,
+		notifier:    notifier,
+		throttle:    throttle,
+		passwords:   passwords,
+	}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -25,6 +56,10 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if !h.checkPassword(c, req.Password, req.Email, req.Name) {
+		return
+	}
+
 	// Check if user already exists
 	existingUser, err := h.userRepo.GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
@@ -39,6 +74,10 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Hash password
 	passwordHash, err := auth.HashPassword(req.Password)
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
@@ -51,22 +90,31 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Name:         req.Name,
 	}
 
-	if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
+	// A deleted account keeps its address until it is purged
+	err = h.userRepo.Create(c.Request.Context(), user)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(user.ID, user.Email)
+	// The account exists either way; the user can ask for another link
+	if err := h.sendVerification(c.Request.Context(), user); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+
+	// Generate tokens
+	response, err := h.issuer.Issue(c, user, nil)
 	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.AuthResponse{
-		Token: token,
-		User:  *user,
-	})
+	h.issuer.Respond(c, http.StatusCreated, response)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -76,6 +124,11 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Refuse attempts while the address or client is throttled
+	if !h.throttle.Allow(c, req.Email) {
+		return
+	}
+
 	// Get user by email
 	user, err := h.userRepo.GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
@@ -83,27 +136,387 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 	if user == nil {
+		h.throttle.Failure(c, req.Email, nil)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
 	// Check password
 	if !auth.CheckPassword(req.Password, user.PasswordHash) {
+		h.throttle.Failure(c, req.Email, user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
+	h.throttle.Success(c, req.Email)
+
+	// Move the hash to the current algorithm and parameters while the
+	// password is at hand
+	if auth.PasswordNeedsRehash(user.PasswordHash) {
+		h.rehashPassword(c.Request.Context(), user, req.Password)
+	}
+
+	// Issue tokens, or ask for a second factor
+	h.issuer.Login(c, user)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token can be used once; presenting one that has already
+// been rotated revokes every token in its family. Passing org_id switches the
+// session to another organization. In cookie mode the refresh token may
+// come from its cookie instead of the body.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		refreshToken = h.issuer.cookies.refreshToken(c)
+	}
+	if refreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	stored, err := h.refreshRepo.GetByHash(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		log.Printf("Error getting refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get refresh token"})
+		return
+	}
+	if stored == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if stored.RevokedAt != nil {
+		h.revokeReusedFamily(ctx, stored)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
 
-	// Generate token
-	token, err := auth.GenerateToken(user.ID, user.Email)
+	var response *models.AuthResponse
+	if req.OrgID != nil {
+		response, err = h.issuer.SwitchOrg(c, user, stored, *req.OrgID)
+	} else {
+		response, err = h.issuer.Issue(c, user, stored)
+	}
+	if errors.Is(err, ErrNotOrgMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization"})
+		return
+	}
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		// Another request rotated this token between our read and write.
+		h.revokeReusedFamily(ctx, stored)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
 	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, models.AuthResponse{
-		Token: token,
-		User:  *user,
-	})
+	h.issuer.Respond(c, http.StatusOK, response)
+}
+
+// Logout revokes the access token used to make the request and ends the
+// session it was issued for. If a refresh token is supplied, the login it
+// belongs to is ended as well, which covers tokens issued before sessions
+// were recorded. In cookie mode the token cookies are deleted.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		refreshToken = h.issuer.cookies.refreshToken(c)
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	ctx := c.Request.Context()
+
+	if err := h.revocations.Revoke(ctx, claims); err != nil {
+		log.Printf("Error revoking token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	if claims.SessionID != "" {
+		if err := endSession(ctx, h.revocations, h.refreshRepo, claims.SessionID); err != nil {
+			log.Printf("Error ending session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	if refreshToken != "" {
+		stored, err := h.refreshRepo.GetByHash(ctx, auth.HashToken(refreshToken))
+		if err != nil {
+			log.Printf("Error getting refresh token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+		// Ignore refresh tokens belonging to someone else rather than
+		// revealing that they exist.
+		if stored != nil && stored.UserID == claims.UserID {
+			if err := h.refreshRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+				log.Printf("Error revoking refresh token family: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+				return
+			}
+		}
+	}
+
+	h.issuer.cookies.clear(c)
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll revokes every access and refresh token issued to the current user.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	if err := h.endAllSessions(c.Request.Context(), c.GetInt("userID")); err != nil {
+		log.Printf("Error revoking tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	h.issuer.cookies.clear(c)
+	c.Status(http.StatusNoContent)
+}
+
+// VerifyEmail consumes an emailed verification token and marks the user's
+// address as verified.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.tokenRepo.Consume(ctx, models.TokenPurposeEmailVerification, auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("Error consuming verification token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if token == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	if err := h.userRepo.MarkEmailVerified(ctx, user); err != nil {
+		log.Printf("Error marking email verified: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ResendVerification sends the current user a new verification link,
+// invalidating any earlier ones.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := h.userRepo.GetByID(ctx, c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already verified"})
+		return
+	}
+
+	if err := h.sendVerification(ctx, user); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// ForgotPassword emails a password reset link if an account exists for the
+// address. It always responds 202, and does its work after responding, so
+// that neither the status nor the timing reveals whether the account exists.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	go func() {
+		if err := h.sendPasswordReset(ctx, req.Email); err != nil {
+			log.Printf("Error sending password reset: %v", err)
+		}
+	}()
+
+	c.Status(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password using an emailed reset token. Every
+// existing access and refresh token for the user is revoked.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The token is only consumed once the new password has been accepted, so
+	// that the user can try another with the same link
+	ctx := c.Request.Context()
+	tokenHash := auth.HashToken(req.Token)
+	token, err := h.tokenRepo.Get(ctx, models.TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		log.Printf("Error getting password reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if token == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	if !h.checkPassword(c, req.Password, user.Email, user.Name) {
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Consuming the token is what makes each link single use
+	token, err = h.tokenRepo.Consume(ctx, models.TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		log.Printf("Error consuming password reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if token == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err := h.userRepo.UpdatePassword(ctx, user.ID, passwordHash); err != nil {
+		log.Printf("Error updating password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := h.endAllSessions(ctx, user.ID); err != nil {
+		log.Printf("Error revoking sessions after password reset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Other reset links sent before this one are no longer needed
+	if err := h.tokenRepo.DeleteForUser(ctx, user.ID, models.TokenPurposePasswordReset); err != nil {
+		log.Printf("Error deleting password reset tokens: %v", err)
+	}
+
+	// Receiving the link proves the user controls the address
+	if user.EmailVerifiedAt == nil {
+		if err := h.userRepo.MarkEmailVerified(ctx, user); err != nil {
+			log.Printf("Error marking email verified: %v", err)
+		}
+	}
+
+	// and the new password can be used straight away
+	if err := h.throttle.Unlock(c, user, "password_reset"); err != nil {
+		log.Printf("Error unlocking account after password reset: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnlockAccount lifts a login lockout using the token emailed when the
+// account was locked.
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	var req models.UnlockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.tokenRepo.Consume(ctx, models.TokenPurposeAccountUnlock, auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("Error consuming account unlock token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+	if token == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired unlock token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired unlock token"})
+		return
+	}
+
+	if err := h.throttle.Unlock(c, user, "email"); err != nil {
+		log.Printf("Error unlocking account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
@@ -125,3 +538,489 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+// UpdateProfile changes the current user's name.
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be blank"})
+			return
+		}
+		user.Name = name
+		if err := h.userRepo.UpdateName(c.Request.Context(), user); err != nil {
+			log.Printf("Error updating name: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword sets a new password for the current user, who must enter
+// their current one. Every other session is ended, and outstanding reset
+// links stop working.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.PasswordHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account has no password; use a password reset to set one"})
+		return
+	}
+	if !h.confirmPassword(c, user, req.CurrentPassword) {
+		return
+	}
+	if !h.checkPassword(c, req.NewPassword, user.Email, user.Name) {
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.NewPassword)
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.userRepo.UpdatePassword(ctx, user.ID, passwordHash); err != nil {
+		log.Printf("Error updating password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	if err := h.endOtherSessions(ctx, user.ID, claims.SessionID); err != nil {
+		log.Printf("Error ending sessions after password change: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	if err := h.tokenRepo.DeleteForUser(ctx, user.ID, models.TokenPurposePasswordReset); err != nil {
+		log.Printf("Error deleting password reset tokens: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ChangeEmail emails a confirmation link to the address the current user
+// wants to change to. Their address only changes once the link is followed,
+// with ConfirmEmailChange. Users with a password must enter it.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if req.Email == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+	if user.PasswordHash != "" && !h.confirmPassword(c, user, req.Password) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	existingUser, err := h.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		log.Printf("Error checking existing user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+		return
+	}
+	if existingUser != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		return
+	}
+
+	if err := h.sendEmailChange(ctx, user, req.Email); err != nil {
+		log.Printf("Error sending email change confirmation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// ConfirmEmailChange consumes an emailed email change token and moves the
+// user to the address it was sent to, which is then verified. It needs no
+// access token, so the link can be opened anywhere.
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	var req models.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.tokenRepo.Consume(ctx, models.TokenPurposeEmailChange, auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("Error consuming email change token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+	if token == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation token"})
+		return
+	}
+
+	// Someone may have registered the address since the link was sent
+	err = h.userRepo.UpdateEmail(ctx, user, token.Email)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	// Links sent to either address before the change no longer apply
+	for _, purpose := range []string{models.TokenPurposeEmailChange, models.TokenPurposePasswordReset} {
+		if err := h.tokenRepo.DeleteForUser(ctx, user.ID, purpose); err != nil {
+			log.Printf("Error deleting %s tokens: %v", purpose, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteAccount deletes the current user's account and logs them out
+// everywhere. For auth.AccountDeletionGracePeriod the account can be brought
+// back with the restore link emailed to the user; after that it is purged.
+// Users with a password must enter it.
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	var req models.DeleteAccountRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.PasswordHash != "" && !h.confirmPassword(c, user, req.Password) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.userRepo.SoftDelete(ctx, user.ID)
+	if errors.Is(err, repository.ErrSoleOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transfer ownership of your organizations before deleting your account"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := h.endAllSessions(ctx, user.ID); err != nil {
+		log.Printf("Error revoking tokens of deleted user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// The account is deleted either way; the email only offers a way back
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := h.sendAccountRestore(ctx, user); err != nil {
+			log.Printf("Error sending account restore link: %v", err)
+		}
+	}()
+
+	h.issuer.cookies.clear(c)
+	c.Status(http.StatusNoContent)
+}
+
+// RestoreAccount consumes the link emailed when an account was deleted and
+// restores the account, if it has not been purged yet. The user then logs in
+// as usual.
+func (h *AuthHandler) RestoreAccount(c *gin.Context) {
+	var req models.RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.tokenRepo.Consume(ctx, models.TokenPurposeAccountRestore, auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("Error consuming account restore token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+	if token == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired restore token"})
+		return
+	}
+
+	restored, err := h.userRepo.Restore(ctx, token.UserID)
+	if err != nil {
+		log.Printf("Error restoring user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+	if !restored {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired restore token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, token.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// revokeReusedFamily is called when an already-rotated refresh token is
+// presented. The legitimate holder and the attacker cannot be told apart, so
+// every token in the family is revoked, along with the access tokens of its
+// session, and both must log in again.
+func (h *AuthHandler) revokeReusedFamily(ctx context.Context, token *models.RefreshToken) {
+	log.Printf("Refresh token reuse detected for user %d, revoking family", token.UserID)
+	if err := endSession(ctx, h.revocations, h.refreshRepo, token.FamilyID); err != nil {
+		log.Printf("Error revoking refresh token family: %v", err)
+	}
+}
+
+// currentUser loads the user the request is authenticated as. If it can't,
+// it writes the error response.
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := h.userRepo.GetByID(c.Request.Context(), c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// confirmPassword checks the password of a logged in user before a
+// sensitive change. Wrong passwords are throttled like failed logins, so
+// that a stolen access token can't be used to guess it. If the password is
+// wrong it writes the error response.
+func (h *AuthHandler) confirmPassword(c *gin.Context, user *models.User, password string) bool {
+	if !h.throttle.Allow(c, user.Email) {
+		return false
+	}
+	if !auth.CheckPassword(password, user.PasswordHash) {
+		h.throttle.Failure(c, user.Email, user)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Incorrect password"})
+		return false
+	}
+	h.throttle.Success(c, user.Email)
+	return true
+}
+
+// checkPassword applies the password policy to a password the user is
+// choosing, given what else they have told us about themselves. If the
+// password is refused it writes a 400 response listing every reason.
+func (h *AuthHandler) checkPassword(c *gin.Context, password string, context ...string) bool {
+	violations, err := h.passwords.Check(password, context...)
+	if err != nil {
+		log.Printf("Error checking password policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password"})
+		return false
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password does not meet the requirements", "reasons": violations})
+		return false
+	}
+	return true
+}
+
+// rehashPassword replaces user's password hash with one made by the current
+// hasher. Failing to do so doesn't stop the login, so errors are only logged.
+func (h *AuthHandler) rehashPassword(ctx context.Context, user *models.User, password string) {
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %v", err)
+		return
+	}
+	if _, err := h.userRepo.RehashPassword(ctx, user.ID, user.PasswordHash, passwordHash); err != nil {
+		log.Printf("Error rehashing password: %v", err)
+		return
+	}
+	user.PasswordHash = passwordHash
+}
+
+// sendVerification replaces any outstanding verification tokens for user with
+// a new one and sends it.
+func (h *AuthHandler) sendVerification(ctx context.Context, user *models.User) error {
+	if err := h.tokenRepo.DeleteForUser(ctx, user.ID, models.TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	stored := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeEmailVerification,
+		TokenHash: auth.HashToken(token),
+	}
+	if err := h.tokenRepo.Create(ctx, stored, auth.EmailVerificationTTL); err != nil {
+		return err
+	}
+
+	return h.notifier.SendEmailVerification(ctx, user, token)
+}
+
+// sendEmailChange replaces any outstanding email change tokens for user with
+// one confirming email, and sends it to that address.
+func (h *AuthHandler) sendEmailChange(ctx context.Context, user *models.User, email string) error {
+	if err := h.tokenRepo.DeleteForUser(ctx, user.ID, models.TokenPurposeEmailChange); err != nil {
+		return err
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	stored := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeEmailChange,
+		TokenHash: auth.HashToken(token),
+		Email:     email,
+	}
+	if err := h.tokenRepo.Create(ctx, stored, auth.EmailVerificationTTL); err != nil {
+		return err
+	}
+
+	return h.notifier.SendEmailChange(ctx, user, email, token)
+}
+
+// sendAccountRestore replaces any outstanding restore tokens for user with
+// one lasting the deletion grace period, and sends it.
+func (h *AuthHandler) sendAccountRestore(ctx context.Context, user *models.User) error {
+	if err := h.tokenRepo.DeleteForUser(ctx, user.ID, models.TokenPurposeAccountRestore); err != nil {
+		return err
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	stored := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeAccountRestore,
+		TokenHash: auth.HashToken(token),
+	}
+	if err := h.tokenRepo.Create(ctx, stored, auth.AccountDeletionGracePeriod); err != nil {
+		return err
+	}
+
+	return h.notifier.SendAccountDeleted(ctx, user, token)
+}
+
+// sendPasswordReset emails a reset link to the account with the given
+// address. A missing account is not an error.
+func (h *AuthHandler) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := h.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	stored := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposePasswordReset,
+		TokenHash: auth.HashToken(token),
+	}
+	if err := h.tokenRepo.Create(ctx, stored, auth.PasswordResetTTL); err != nil {
+		return err
+	}
+
+	return h.notifier.SendPasswordReset(ctx, user, token)
+}
+
+// endOtherSessions ends every session of userID's but current, as when the
+// user changes their password. Access and refresh tokens that are not tied to
+// a session are revoked too, so with no current session nothing survives.
+func (h *AuthHandler) endOtherSessions(ctx context.Context, userID int, current string) error {
+	sessions, err := h.sessionRepo.ListForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.ID == current {
+			continue
+		}
+		if err := endSession(ctx, h.revocations, h.refreshRepo, session.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := h.revocations.RevokeSessionless(ctx, userID); err != nil {
+		return err
+	}
+	return h.refreshRepo.RevokeAllForUserExcept(ctx, userID, current)
+}
+
+// endAllSessions revokes every access and refresh token issued to userID and
+// ends all of their sessions.
+func (h *AuthHandler) endAllSessions(ctx context.Context, userID int) error {
+	if err := h.revocations.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+	if err := h.sessionRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return h.refreshRepo.RevokeAllForUser(ctx, userID)
+}
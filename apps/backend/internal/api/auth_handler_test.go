@@ -7,23 +7,152 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
 	"github.com/dwfennell/monorepo-scaffold/internal/database"
 	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc/oidctest"
 	"github.com/dwfennell/monorepo-scaffold/internal/repository"
 	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandlerTestSuite struct {
 	suite.Suite
-	db      *database.DB
-	handler *AuthHandler
-	router  *gin.Engine
-	ctx     context.Context
+	db       *database.DB
+	handler  *AuthHandler
+	mfa      *MFAHandler
+	webauthn *WebAuthnHandler
+	oidc     *OIDCHandler
+	provider *oidctest.Provider
+	oauth    *OAuthProviderHandler
+	admin    *AdminHandler
+	orgs     *OrgHandler
+	tokens   *PersonalAccessTokenHandler
+	sessions *SessionHandler
+	magic    *MagicLinkHandler
+	accounts *ServiceAccountHandler
+	server   *httptest.Server
+	notifier *recordingNotifier
+	router   *gin.Engine
+	ctx      context.Context
+}
+
+// recordingNotifier keeps the last token of each kind sent to each address.
+// Password resets are sent in the background, so access is synchronized.
+type recordingNotifier struct {
+	mu           sync.Mutex
+	verification map[string]string
+	reset        map[string]string
+	magicLink    map[string]string
+	emailChange  map[string]string
+	restore      map[string]string
+	invitation   map[string]string
+	unlock       map[string]string
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{verification: map[string]string{}, reset: map[string]string{}, magicLink: map[string]string{}, emailChange: map[string]string{}, restore: map[string]string{}, invitation: map[string]string{}, unlock: map[string]string{}}
+}
+
+func (n *recordingNotifier) SendEmailVerification(ctx context.Context, user *models.User, token string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.verification[user.Email] = token
+	return nil
+}
+
+func (n *recordingNotifier) SendPasswordReset(ctx context.Context, user *models.User, token string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reset[user.Email] = token
+	return nil
+}
+
+func (n *recordingNotifier) SendMagicLink(ctx context.Context, user *models.User, token string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.magicLink[user.Email] = token
+	return nil
+}
+
+func (n *recordingNotifier) SendEmailChange(ctx context.Context, user *models.User, email, token string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.emailChange[email] = token
+	return nil
+}
+
+func (n *recordingNotifier) SendAccountLocked(ctx context.Context, user *models.User, token string, lockedFor time.Duration) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.unlock[user.Email] = token
+	return nil
+}
+
+func (n *recordingNotifier) SendAccountDeleted(ctx context.Context, user *models.User, token string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.restore[user.Email] = token
+	return nil
+}
+
+func (n *recordingNotifier) SendOrgInvitation(ctx context.Context, invitation *models.OrgInvitation, org *models.Organization, inviter *models.User, token string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.invitation[invitation.Email] = token
+	return nil
+}
+
+func (n *recordingNotifier) verificationToken(email string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.verification[email]
+}
+
+func (n *recordingNotifier) resetToken(email string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.reset[email]
+}
+
+func (n *recordingNotifier) magicLinkToken(email string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.magicLink[email]
+}
+
+func (n *recordingNotifier) emailChangeToken(email string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.emailChange[email]
+}
+
+func (n *recordingNotifier) restoreToken(email string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.restore[email]
+}
+
+func (n *recordingNotifier) invitationToken(email string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.invitation[email]
+}
+
+func (n *recordingNotifier) unlockToken(email string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.unlock[email]
 }
 
 func (suite *AuthHandlerTestSuite) SetupSuite() {
@@ -41,16 +170,140 @@ func (suite *AuthHandlerTestSuite) SetupSuite() {
 
 	// Setup handler and router
 	userRepo := repository.NewUserRepository(suite.db)
-	suite.handler = NewAuthHandler(userRepo)
+	refreshRepo := repository.NewRefreshTokenRepository(suite.db)
+	tokenRepo := repository.NewUserTokenRepository(suite.db)
+	mfaRepo := repository.NewMFARepository(suite.db)
+	revocations := auth.NewRevocationStore(repository.NewRevocationRepository(suite.db))
+	roleRepo := repository.NewRoleRepository(suite.db)
+	orgRepo := repository.NewOrganizationRepository(suite.db)
+	sessionRepo := repository.NewSessionRepository(suite.db)
+	issuer := NewTokenIssuer(refreshRepo, mfaRepo, roleRepo, orgRepo, sessionRepo, testLocationHeader, CookieMode{})
+	auditRepo := repository.NewAuditRepository(suite.db)
+	suite.notifier = newRecordingNotifier()
+	throttleRepo := repository.NewLoginThrottleRepository(suite.db)
+	throttle := NewLoginThrottle(throttleRepo, auditRepo, tokenRepo, suite.notifier, testLoginLimits)
+	suite.handler = NewAuthHandler(userRepo, refreshRepo, sessionRepo, tokenRepo, revocations, issuer, suite.notifier, throttle, testPasswordPolicy)
+	suite.mfa = NewMFAHandler(userRepo, mfaRepo, revocations, issuer, throttleRepo, "Test App")
+	wa, err := NewWebAuthn("Test App", testRPID, []string{testOrigin})
+	suite.Require().NoError(err)
+	suite.webauthn = NewWebAuthnHandler(wa, userRepo, repository.NewWebAuthnRepository(suite.db), issuer, suite.handler.sendVerification)
+	suite.admin = NewAdminHandler(userRepo, roleRepo, revocations, throttle, auditRepo)
+	suite.orgs = NewOrgHandler(orgRepo, userRepo, suite.notifier)
+	patRepo := repository.NewPersonalAccessTokenRepository(suite.db)
+	suite.tokens = NewPersonalAccessTokenHandler(patRepo, roleRepo)
+	suite.sessions = NewSessionHandler(sessionRepo, refreshRepo, revocations)
+	suite.magic = NewMagicLinkHandler(userRepo, repository.NewMagicLinkRepository(suite.db), issuer, suite.notifier, false)
+	suite.provider = oidctest.NewProvider()
+	suite.oidc = NewOIDCHandler(testOIDCProviders(suite.provider), userRepo, repository.NewIdentityRepository(suite.db), issuer, suite.handler.sendVerification)
+	// The provider's endpoints are also served over HTTP so that relying
+	// parties can discover and call them
+	suite.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.router.ServeHTTP(w, r)
+	}))
+	serviceAccountRepo := repository.NewServiceAccountRepository(suite.db)
+	suite.accounts = NewServiceAccountHandler(serviceAccountRepo, suite.server.URL)
+	suite.oauth = NewOAuthProviderHandler(repository.NewOAuthRepository(suite.db), userRepo, suite.server.URL, "http://localhost:3000")
+	patVerifier := NewPersonalAccessTokenVerifier(patRepo, userRepo, roleRepo)
+	requireAuth := AuthMiddleware(AuthMiddlewareConfig{Revocations: revocations, PersonalAccessTokens: patVerifier})
+	requireAdmin := AuthMiddleware(AuthMiddlewareConfig{
+		Revocations:          revocations,
+		PersonalAccessTokens: patVerifier,
+		ServiceAccounts:      serviceAccountRepo,
+	})
+	requireOAuth := AuthMiddleware(AuthMiddlewareConfig{Revocations: revocations, Purpose: auth.PurposeOAuthAccess})
+	requireVerified := AuthMiddleware(AuthMiddlewareConfig{Revocations: revocations, RequireVerifiedEmail: true})
 
 	suite.router = gin.New()
 	suite.router.POST("/register", suite.handler.Register)
 	suite.router.POST("/login", suite.handler.Login)
-	suite.router.GET("/me", AuthMiddleware(), suite.handler.GetCurrentUser)
+	suite.router.POST("/refresh", suite.handler.Refresh)
+	suite.router.POST("/logout", requireAuth, suite.handler.Logout)
+	suite.router.POST("/logout-all", requireAuth, suite.handler.LogoutAll)
+	suite.router.GET("/me", requireAuth, suite.handler.GetCurrentUser)
+	suite.router.PATCH("/me", requireAuth, RequireSession(), suite.handler.UpdateProfile)
+	suite.router.POST("/me/password", requireAuth, RequireSession(), suite.handler.ChangePassword)
+	suite.router.POST("/me/email", requireAuth, RequireSession(), suite.handler.ChangeEmail)
+	suite.router.POST("/confirm-email-change", suite.handler.ConfirmEmailChange)
+	suite.router.DELETE("/me", requireAuth, RequireSession(), suite.handler.DeleteAccount)
+	suite.router.POST("/restore-account", suite.handler.RestoreAccount)
+	suite.router.GET("/verified/me", requireVerified, suite.handler.GetCurrentUser)
+	suite.router.POST("/verify-email", suite.handler.VerifyEmail)
+	suite.router.POST("/forgot-password", suite.handler.ForgotPassword)
+	suite.router.POST("/reset-password", suite.handler.ResetPassword)
+	suite.router.POST("/unlock", suite.handler.UnlockAccount)
+	suite.router.POST("/magic-link", suite.magic.Send)
+	suite.router.POST("/magic-link/consume", suite.magic.Consume)
+	suite.router.POST("/resend-verification", requireAuth, suite.handler.ResendVerification)
+	suite.router.POST("/mfa/verify", suite.mfa.Verify)
+	suite.router.GET("/me/mfa", requireAuth, suite.mfa.Status)
+	suite.router.POST("/me/mfa/totp", requireAuth, RequireSession(), suite.mfa.BeginTOTP)
+	suite.router.POST("/me/mfa/totp/confirm", requireAuth, RequireSession(), suite.mfa.ConfirmTOTP)
+	suite.router.DELETE("/me/mfa/totp", requireAuth, RequireSession(), suite.mfa.DisableTOTP)
+	suite.router.POST("/me/mfa/recovery-codes", requireAuth, RequireSession(), suite.mfa.RegenerateRecoveryCodes)
+	suite.router.GET("/me/tokens", requireAuth, RequireSession(), suite.tokens.List)
+	suite.router.POST("/me/tokens", requireAuth, RequireSession(), suite.tokens.Create)
+	suite.router.DELETE("/me/tokens/:id", requireAuth, RequireSession(), suite.tokens.Delete)
+	suite.router.GET("/me/sessions", requireAuth, RequireSession(), suite.sessions.List)
+	suite.router.DELETE("/me/sessions/:id", requireAuth, RequireSession(), suite.sessions.Delete)
+	suite.router.POST("/webauthn/signup/begin", suite.webauthn.BeginSignup)
+	suite.router.POST("/webauthn/signup/finish", suite.webauthn.FinishSignup)
+	suite.router.POST("/webauthn/login/begin", suite.webauthn.BeginLogin)
+	suite.router.POST("/webauthn/login/finish", suite.webauthn.FinishLogin)
+	suite.router.POST("/webauthn/register/begin", requireAuth, suite.webauthn.BeginRegistration)
+	suite.router.POST("/webauthn/register/finish", requireAuth, suite.webauthn.FinishRegistration)
+	suite.router.GET("/webauthn/credentials", requireAuth, suite.webauthn.ListCredentials)
+	suite.router.DELETE("/webauthn/credentials/:id", requireAuth, suite.webauthn.DeleteCredential)
+	suite.router.GET("/oidc/providers", suite.oidc.ListProviders)
+	suite.router.POST("/oidc/:provider/start", suite.oidc.Start)
+	suite.router.POST("/oidc/:provider/link/start", requireAuth, suite.oidc.StartLink)
+	suite.router.POST("/oidc/:provider/callback", suite.oidc.Callback)
+	suite.router.GET("/identities", requireAuth, suite.oidc.ListIdentities)
+	suite.router.DELETE("/identities/:id", requireAuth, suite.oidc.DeleteIdentity)
+	suite.router.GET("/.well-known/openid-configuration", suite.oauth.Discovery)
+	suite.router.GET("/.well-known/jwks.json", JWKS)
+	suite.router.GET("/oauth/authorize", suite.oauth.Authorize)
+	suite.router.POST("/oauth/token", TokenEndpoint(suite.oauth, suite.accounts))
+	suite.router.GET("/oauth/userinfo", requireOAuth, suite.oauth.UserInfo)
+	suite.router.GET("/oauth/requests/:id", requireAuth, RequireSession(), suite.oauth.GetAuthorizationRequest)
+	suite.router.POST("/oauth/requests/:id/approve", requireAuth, RequireSession(), suite.oauth.Approve)
+	suite.router.POST("/oauth/requests/:id/deny", requireAuth, RequireSession(), suite.oauth.Deny)
+	suite.router.GET("/admin/roles", requireAdmin, RequirePermission(auth.PermissionRolesRead), suite.admin.ListRoles)
+	suite.router.GET("/admin/users/:id", requireAdmin, RequirePermission(auth.PermissionUsersRead), suite.admin.GetUser)
+	suite.router.POST("/admin/users/:id/unlock", requireAdmin, RequirePermission(auth.PermissionUsersWrite), suite.admin.UnlockUser)
+	suite.router.GET("/admin/users/:id/audit-events", requireAdmin, RequirePermission(auth.PermissionUsersRead), suite.admin.ListAuditEvents)
+	suite.router.GET("/admin/users/:id/roles", requireAdmin, RequirePermission(auth.PermissionRolesRead), suite.admin.GetUserRoles)
+	suite.router.POST("/admin/users/:id/roles", requireAdmin, RequirePermission(auth.PermissionRolesWrite), suite.admin.AssignRole)
+	suite.router.DELETE("/admin/users/:id/roles/:role", requireAdmin, RequirePermission(auth.PermissionRolesWrite), suite.admin.RevokeRole)
+	suite.router.GET("/admin/service-accounts", requireAdmin, RequirePermission(auth.PermissionServiceAccountsRead), suite.accounts.List)
+	suite.router.POST("/admin/service-accounts", requireAdmin, RequirePermission(auth.PermissionServiceAccountsWrite), suite.accounts.Create)
+	suite.router.GET("/admin/service-accounts/:id", requireAdmin, RequirePermission(auth.PermissionServiceAccountsRead), suite.accounts.Get)
+	suite.router.POST("/admin/service-accounts/:id/rotate-secret", requireAdmin, RequirePermission(auth.PermissionServiceAccountsWrite), suite.accounts.RotateSecret)
+	suite.router.POST("/admin/service-accounts/:id/disable", requireAdmin, RequirePermission(auth.PermissionServiceAccountsWrite), suite.accounts.Disable)
+	suite.router.POST("/admin/service-accounts/:id/enable", requireAdmin, RequirePermission(auth.PermissionServiceAccountsWrite), suite.accounts.Enable)
+	suite.router.GET("/orgs", requireAuth, suite.orgs.List)
+	suite.router.POST("/orgs", requireAuth, RequireSession(), suite.orgs.Create)
+	suite.router.POST("/invitations/accept", requireAuth, RequireSession(), suite.orgs.AcceptInvitation)
+	suite.router.POST("/invitations/decline", suite.orgs.DeclineInvitation)
+	org := suite.router.Group("/orgs/:orgID", requireAuth, RequireOrgMember(orgRepo), TenantScope(suite.db))
+	org.GET("", suite.orgs.Get)
+	org.PATCH("", RequireSession(), RequireOrgRole(models.OrgRoleAdmin), suite.orgs.Update)
+	org.DELETE("", RequireSession(), RequireOrgRole(models.OrgRoleOwner), suite.orgs.Delete)
+	org.GET("/members", suite.orgs.ListMembers)
+	org.PATCH("/members/:userID", RequireSession(), RequireOrgRole(models.OrgRoleOwner), suite.orgs.UpdateMember)
+	org.DELETE("/members/:userID", RequireSession(), suite.orgs.RemoveMember)
+	org.GET("/invitations", RequireOrgRole(models.OrgRoleAdmin), suite.orgs.ListInvitations)
+	org.POST("/invitations", RequireSession(), RequireOrgRole(models.OrgRoleAdmin), suite.orgs.CreateInvitation)
+	org.DELETE("/invitations/:id", RequireSession(), RequireOrgRole(models.OrgRoleAdmin), suite.orgs.DeleteInvitation)
 }
 
 func (suite *AuthHandlerTestSuite) TearDownSuite() {
 	os.Unsetenv("JWT_SECRET")
+	if suite.provider != nil {
+		suite.provider.Close()
+	}
+	if suite.server != nil {
+		suite.server.Close()
+	}
 	if suite.db != nil {
 		suite.db.Close()
 	}
@@ -60,6 +313,16 @@ func (suite *AuthHandlerTestSuite) SetupTest() {
 	// Clean up users table before each test
 	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
 	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM oauth_clients")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM organizations")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM service_accounts")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM login_throttles")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM audit_events")
+	suite.Require().NoError(err, "Failed to clean up test data")
 }
 
 func (suite *AuthHandlerTestSuite) TestRegister_Success() {
@@ -253,6 +516,347 @@ func (suite *AuthHandlerTestSuite) TestGetCurrentUser_InvalidToken() {
 	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
 }
 
+// register creates a user through the API and returns the auth response
+func (suite *AuthHandlerTestSuite) register(email, password string) models.AuthResponse {
+	body, _ := json.Marshal(models.RegisterRequest{
+		Email:    email,
+		Password: password,
+		Name:     "Test User",
+	})
+	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	var response models.AuthResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+// refresh posts a refresh token and returns the recorder
+func (suite *AuthHandlerTestSuite) refresh(refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.RefreshRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest("POST", "/refresh", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AuthHandlerTestSuite) TestRegister_ReturnsRefreshToken() {
+	response := suite.register("refreshreg@example.com", "password123")
+
+	assert.NotEmpty(suite.T(), response.RefreshToken)
+}
+
+func (suite *AuthHandlerTestSuite) TestRefresh_Success() {
+	registered := suite.register("refresh@example.com", "password123")
+
+	w := suite.refresh(registered.RefreshToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response models.AuthResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), response.Token)
+	assert.NotEmpty(suite.T(), response.RefreshToken)
+	assert.NotEqual(suite.T(), registered.RefreshToken, response.RefreshToken, "Refresh token should be rotated")
+	assert.Equal(suite.T(), "refresh@example.com", response.User.Email)
+}
+
+func (suite *AuthHandlerTestSuite) TestRefresh_UnknownToken() {
+	w := suite.refresh("not-a-real-refresh-token")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestRefresh_MissingToken() {
+	req := httptest.NewRequest("POST", "/refresh", bytes.NewBuffer([]byte("{}")))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestRefresh_ReuseRevokesFamily() {
+	registered := suite.register("reuse@example.com", "password123")
+
+	first := suite.refresh(registered.RefreshToken)
+	suite.Require().Equal(http.StatusOK, first.Code)
+	var rotated models.AuthResponse
+	json.Unmarshal(first.Body.Bytes(), &rotated)
+
+	// Replaying the original token is rejected...
+	replay := suite.refresh(registered.RefreshToken)
+	assert.Equal(suite.T(), http.StatusUnauthorized, replay.Code)
+
+	// ...and revokes the token that replaced it
+	afterReplay := suite.refresh(rotated.RefreshToken)
+	assert.Equal(suite.T(), http.StatusUnauthorized, afterReplay.Code)
+}
+
+// authedRequest sends a request with a bearer token and returns the recorder
+func (suite *AuthHandlerTestSuite) authedRequest(method, path, token string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AuthHandlerTestSuite) TestLogout_RevokesAccessToken() {
+	registered := suite.register("logout@example.com", "password123")
+
+	w := suite.authedRequest("POST", "/logout", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	me := suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, me.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogout_RevokesRefreshToken() {
+	registered := suite.register("logoutrefresh@example.com", "password123")
+	body, _ := json.Marshal(models.LogoutRequest{RefreshToken: registered.RefreshToken})
+
+	w := suite.authedRequest("POST", "/logout", registered.Token, body)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	refreshed := suite.refresh(registered.RefreshToken)
+	assert.Equal(suite.T(), http.StatusUnauthorized, refreshed.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogout_RequiresToken() {
+	req := httptest.NewRequest("POST", "/logout", nil)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogoutAll_RevokesEverySession() {
+	first := suite.register("everywhere@example.com", "password123")
+	loginJSON, _ := json.Marshal(models.LoginRequest{Email: "everywhere@example.com", Password: "password123"})
+	loginReq := httptest.NewRequest("POST", "/login", bytes.NewBuffer(loginJSON))
+	loginReq.Header.Set("Content-Type", "application/json")
+	loginW := httptest.NewRecorder()
+	suite.router.ServeHTTP(loginW, loginReq)
+	var second models.AuthResponse
+	json.Unmarshal(loginW.Body.Bytes(), &second)
+
+	w := suite.authedRequest("POST", "/logout-all", second.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.authedRequest("GET", "/me", first.Token, nil).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.authedRequest("GET", "/me", second.Token, nil).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(first.RefreshToken).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(second.RefreshToken).Code)
+}
+
+// verifyEmail posts a verification token and returns the recorder
+func (suite *AuthHandlerTestSuite) verifyEmail(token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.VerifyEmailRequest{Token: token})
+	req := httptest.NewRequest("POST", "/verify-email", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AuthHandlerTestSuite) TestRegister_SendsVerificationEmail() {
+	registered := suite.register("verifyme@example.com", "password123")
+
+	assert.Nil(suite.T(), registered.User.EmailVerifiedAt)
+	assert.NotEmpty(suite.T(), suite.notifier.verificationToken("verifyme@example.com"))
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyEmail_Success() {
+	suite.register("verified@example.com", "password123")
+
+	w := suite.verifyEmail(suite.notifier.verificationToken("verified@example.com"))
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var user models.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	assert.NotNil(suite.T(), user.EmailVerifiedAt)
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyEmail_SingleUse() {
+	suite.register("once@example.com", "password123")
+	token := suite.notifier.verificationToken("once@example.com")
+
+	suite.Require().Equal(http.StatusOK, suite.verifyEmail(token).Code)
+	w := suite.verifyEmail(token)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestVerifyEmail_InvalidToken() {
+	w := suite.verifyEmail("not-a-real-token")
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestResendVerification_InvalidatesPreviousLink() {
+	registered := suite.register("resend@example.com", "password123")
+	first := suite.notifier.verificationToken("resend@example.com")
+
+	w := suite.authedRequest("POST", "/resend-verification", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+
+	second := suite.notifier.verificationToken("resend@example.com")
+	assert.NotEqual(suite.T(), first, second)
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.verifyEmail(first).Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.verifyEmail(second).Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestResendVerification_AlreadyVerified() {
+	registered := suite.register("already@example.com", "password123")
+	suite.verifyEmail(suite.notifier.verificationToken("already@example.com"))
+
+	w := suite.authedRequest("POST", "/resend-verification", registered.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestRequireVerifiedEmail() {
+	registered := suite.register("policy@example.com", "password123")
+
+	// Unverified users can log in but not reach verified-only routes
+	w := suite.authedRequest("GET", "/verified/me", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	// After verifying, a refreshed token carries the verified claim
+	suite.verifyEmail(suite.notifier.verificationToken("policy@example.com"))
+	refreshed := suite.refresh(registered.RefreshToken)
+	var response models.AuthResponse
+	json.Unmarshal(refreshed.Body.Bytes(), &response)
+
+	w = suite.authedRequest("GET", "/verified/me", response.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+// postJSON sends an unauthenticated JSON request and returns the recorder
+func (suite *AuthHandlerTestSuite) postJSON(path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// requestReset asks for a reset link and waits for it to be sent
+func (suite *AuthHandlerTestSuite) requestReset(email string) string {
+	w := suite.postJSON("/forgot-password", models.ForgotPasswordRequest{Email: email})
+	suite.Require().Equal(http.StatusAccepted, w.Code)
+
+	suite.Require().Eventually(func() bool {
+		return suite.notifier.resetToken(email) != ""
+	}, time.Second, 10*time.Millisecond, "Reset link should be sent")
+	return suite.notifier.resetToken(email)
+}
+
+func (suite *AuthHandlerTestSuite) TestForgotPassword_UnknownEmail() {
+	w := suite.postJSON("/forgot-password", models.ForgotPasswordRequest{Email: "nobody@example.com"})
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code, "Unknown addresses must look the same as known ones")
+}
+
+func (suite *AuthHandlerTestSuite) TestForgotPassword_InvalidEmail() {
+	w := suite.postJSON("/forgot-password", models.ForgotPasswordRequest{Email: "not-an-email"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_Success() {
+	registered := suite.register("forgetful@example.com", "oldpassword")
+	token := suite.requestReset("forgetful@example.com")
+
+	w := suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: token, Password: "newpassword"})
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	oldLogin := suite.postJSON("/login", models.LoginRequest{Email: "forgetful@example.com", Password: "oldpassword"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, oldLogin.Code)
+	newLogin := suite.postJSON("/login", models.LoginRequest{Email: "forgetful@example.com", Password: "newpassword"})
+	assert.Equal(suite.T(), http.StatusOK, newLogin.Code)
+
+	// Existing sessions are ended
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.authedRequest("GET", "/me", registered.Token, nil).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(registered.RefreshToken).Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_SingleUse() {
+	suite.register("resetonce@example.com", "oldpassword")
+	token := suite.requestReset("resetonce@example.com")
+
+	first := suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: token, Password: "newpassword"})
+	suite.Require().Equal(http.StatusNoContent, first.Code)
+	second := suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: token, Password: "anotherpassword"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, second.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_InvalidToken() {
+	w := suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: "bogus", Password: "newpassword"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_ShortPassword() {
+	w := suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: "whatever", Password: "short"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func TestAuthMiddleware_RejectsNonAccessTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key")
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(AuthMiddlewareConfig{}), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	idToken, err := auth.SignIDToken(auth.IDTokenClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "1", Audience: jwt.ClaimStrings{"client"}}})
+	require.NoError(t, err)
+	tests := []struct {
+		name   string
+		claims auth.Claims
+		want   int
+	}{
+		{"access token", auth.Claims{UserID: 1}, http.StatusNoContent},
+		{"other purpose", auth.Claims{UserID: 1, Purpose: auth.PurposeMFAPending}, http.StatusUnauthorized},
+		{"audience", auth.Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"client"}}}, http.StatusUnauthorized},
+		{"no subject", auth.Claims{Email: "nobody@example.com"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := auth.SignClaims(tt.claims)
+			require.NoError(t, err)
+			req := httptest.NewRequest("GET", "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	t.Run("ID token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+idToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
 func TestAuthHandlerTestSuite(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration tests in short mode")
@@ -260,3 +864,22 @@ func TestAuthHandlerTestSuite(t *testing.T) {
 
 	suite.Run(t, new(AuthHandlerTestSuite))
 }
+
+func (suite *AuthHandlerTestSuite) TestLogin_RehashesPassword() {
+	registered := suite.register("rehash@example.com", "password123")
+	legacy, err := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("password123")
+	suite.Require().NoError(err)
+	userRepo := repository.NewUserRepository(suite.db)
+	suite.Require().NoError(userRepo.UpdatePassword(suite.ctx, registered.User.ID, legacy))
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "rehash@example.com", Password: "password123"})
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	user, err := userRepo.GetByID(suite.ctx, registered.User.ID)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), strings.HasPrefix(user.PasswordHash, "$argon2id$"), "The bcrypt hash is replaced")
+	assert.False(suite.T(), auth.PasswordNeedsRehash(user.PasswordHash))
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "rehash@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
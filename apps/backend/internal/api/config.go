@@ -0,0 +1,68 @@
+package api
+
+import (
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/mail"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc"
+)
+
+// Config holds deployment settings for the API, read from the environment in
+// main.go.
+type Config struct {
+	// AppName identifies the service to users, for example in authenticator apps.
+	AppName string
+
+	// FrontendURL is where links sent to users point.
+	FrontendURL string
+
+	// Mailer delivers email to users.
+	Mailer mail.Mailer
+
+	// WebAuthnRPID is the domain passkeys are bound to, and WebAuthnOrigins
+	// the origins allowed to use them.
+	WebAuthnRPID    string
+	WebAuthnOrigins []string
+
+	// OIDCProviders are the external identity providers users can log in
+	// with.
+	OIDCProviders []oidc.Config
+
+	// Issuer is this service's public base URL. When set, the service acts
+	// as an OpenID Connect provider for the clients registered with clientctl.
+	Issuer string
+
+	// SessionLocationHeader is a request header in which a proxy in front of
+	// the service reports where the client is, such as Cloudflare's
+	// CF-IPCountry. It is recorded with users' sessions. Only set it if the
+	// proxy always overwrites the header, since clients can send it too.
+	SessionLocationHeader string
+
+	// Cookies, when enabled, sets tokens as cookies for browsers instead of
+	// returning them in response bodies, and checks CSRF tokens.
+	Cookies CookieMode
+
+	// RequireEmailVerification blocks protected routes until the user has
+	// verified their email address. Unverified users can still log in.
+	RequireEmailVerification bool
+
+	// MagicLinkSignup lets magic links create an account for an address that
+	// doesn't have one yet.
+	MagicLinkSignup bool
+
+	// LoginLimits throttle failed password logins. DefaultLoginLimits are
+	// used if it is left empty.
+	LoginLimits LoginLimits
+
+	// PasswordPolicy decides which passwords users may choose when they
+	// register or reset their password. auth.DefaultPasswordPolicy is used
+	// if it is nil.
+	PasswordPolicy *auth.PasswordPolicy
+
+	// RateLimitStore is where rate limits are counted: RateLimitStoreMemory,
+	// the default, or RateLimitStorePostgres to share the counts between
+	// instances.
+	RateLimitStore string
+
+	// RateLimits are the request rate limits to apply.
+	RateLimits RateLimits
+}
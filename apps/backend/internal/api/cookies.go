@@ -0,0 +1,163 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Cookies and header used in cookie mode.
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// refreshCookiePath limits the refresh token cookie to the endpoints that
+// read it.
+const refreshCookiePath = "/api/v1/auth"
+
+// CookieMode delivers tokens to browsers in HttpOnly cookies rather than in
+// response bodies, out of reach of scripts. Unsafe requests authenticated by
+// cookie must then pass CSRFProtection.
+type CookieMode struct {
+	Enabled bool
+
+	// Domain is the domain the cookies are sent to. Empty limits them to the
+	// API's own host.
+	Domain string
+
+	// SameSite defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+// setTokens moves response's tokens into cookies, and puts the CSRF token in
+// their place.
+func (m CookieMode) setTokens(c *gin.Context, response *models.AuthResponse) error {
+	csrfToken, err := m.csrfToken(c)
+	if err != nil {
+		return err
+	}
+
+	m.set(c, AccessTokenCookie, response.Token, "/", auth.AccessTokenTTL, true)
+	m.set(c, RefreshTokenCookie, response.RefreshToken, refreshCookiePath, auth.RefreshTokenTTL, true)
+	m.set(c, CSRFCookie, csrfToken, "/", auth.RefreshTokenTTL, false)
+
+	response.Token = ""
+	response.RefreshToken = ""
+	response.CSRFToken = csrfToken
+	return nil
+}
+
+// csrfToken returns the client's CSRF token, or a new one if it has none.
+// Tokens are kept across logins so that other tabs holding one carry on
+// working.
+func (m CookieMode) csrfToken(c *gin.Context) (string, error) {
+	if token, err := c.Cookie(CSRFCookie); err == nil && token != "" {
+		return token, nil
+	}
+	return auth.GenerateOpaqueToken()
+}
+
+// refreshToken returns the refresh token cookie, or "" outside cookie mode.
+func (m CookieMode) refreshToken(c *gin.Context) string {
+	if !m.Enabled {
+		return ""
+	}
+	token, _ := c.Cookie(RefreshTokenCookie)
+	return token
+}
+
+// clear deletes the token cookies, in cookie mode.
+func (m CookieMode) clear(c *gin.Context) {
+	if !m.Enabled {
+		return
+	}
+	m.set(c, AccessTokenCookie, "", "/", -1, true)
+	m.set(c, RefreshTokenCookie, "", refreshCookiePath, -1, true)
+	m.set(c, CSRFCookie, "", "/", -1, false)
+}
+
+// set sets a Secure cookie lasting ttl, or deletes it if ttl is negative.
+func (m CookieMode) set(c *gin.Context, name, value, path string, ttl time.Duration, httpOnly bool) {
+	sameSite := m.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   m.Domain,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
+
+// CSRFToken returns the client's CSRF token, setting the cookie if it has
+// none, so that a page loaded after logging in can find the token to send.
+func CSRFToken(cookies CookieMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := cookies.csrfToken(c)
+		if err != nil {
+			log.Printf("Error generating CSRF token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
+			return
+		}
+		cookies.set(c, CSRFCookie, token, "/", auth.RefreshTokenTTL, false)
+
+		c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+	}
+}
+
+// CSRFProtection rejects unsafe requests that carry token cookies unless
+// they repeat the CSRF cookie in the X-CSRF-Token header, which other sites
+// can neither read nor set. Requests with an Authorization header are let
+// through, since browsers never add one to a cross-site request.
+func CSRFProtection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if c.GetHeader("Authorization") != "" || !hasTokenCookie(c) {
+			c.Next()
+			return
+		}
+
+		cookie, err := c.Cookie(CSRFCookie)
+		header := c.GetHeader(CSRFHeader)
+		if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// hasTokenCookie reports whether the request carries an access or refresh
+// token cookie.
+func hasTokenCookie(c *gin.Context) bool {
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie} {
+		if token, err := c.Cookie(name); err == nil && token != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRFProtection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CSRFProtection())
+	router.Any("/protected", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tokenCookie := &http.Cookie{Name: AccessTokenCookie, Value: "token"}
+	csrfCookie := &http.Cookie{Name: CSRFCookie, Value: "csrf"}
+	tests := []struct {
+		name          string
+		method        string
+		cookies       []*http.Cookie
+		csrfHeader    string
+		authorization string
+		want          int
+	}{
+		{"safe method", "GET", []*http.Cookie{tokenCookie, csrfCookie}, "", "", http.StatusNoContent},
+		{"no token cookie", "POST", []*http.Cookie{csrfCookie}, "", "", http.StatusNoContent},
+		{"bearer token", "POST", []*http.Cookie{tokenCookie, csrfCookie}, "", "Bearer token", http.StatusNoContent},
+		{"matching header", "POST", []*http.Cookie{tokenCookie, csrfCookie}, "csrf", "", http.StatusNoContent},
+		{"missing header", "POST", []*http.Cookie{tokenCookie, csrfCookie}, "", "", http.StatusForbidden},
+		{"wrong header", "DELETE", []*http.Cookie{tokenCookie, csrfCookie}, "other", "", http.StatusForbidden},
+		{"missing cookie", "POST", []*http.Cookie{tokenCookie}, "csrf", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/protected", nil)
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(CSRFHeader, tt.csrfHeader)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+// cookieRouter serves the login routes in cookie mode, under the paths the
+// refresh token cookie is scoped to.
+func (suite *AuthHandlerTestSuite) cookieRouter() *gin.Engine {
+	userRepo := repository.NewUserRepository(suite.db)
+	refreshRepo := repository.NewRefreshTokenRepository(suite.db)
+	tokenRepo := repository.NewUserTokenRepository(suite.db)
+	sessionRepo := repository.NewSessionRepository(suite.db)
+	revocations := auth.NewRevocationStore(repository.NewRevocationRepository(suite.db))
+	cookies := CookieMode{Enabled: true}
+	issuer := NewTokenIssuer(refreshRepo, repository.NewMFARepository(suite.db), repository.NewRoleRepository(suite.db), repository.NewOrganizationRepository(suite.db), sessionRepo, "", cookies)
+	throttle := NewLoginThrottle(repository.NewLoginThrottleRepository(suite.db), repository.NewAuditRepository(suite.db), tokenRepo, suite.notifier, testLoginLimits)
+	handler := NewAuthHandler(userRepo, refreshRepo, sessionRepo, tokenRepo, revocations, issuer, suite.notifier, throttle, testPasswordPolicy)
+	requireAuth := AuthMiddleware(AuthMiddlewareConfig{Revocations: revocations, Cookies: true})
+
+	router := gin.New()
+	v1 := router.Group("/api/v1", CSRFProtection())
+	v1.POST("/auth/login", handler.Login)
+	v1.POST("/auth/refresh", handler.Refresh)
+	v1.POST("/auth/logout", requireAuth, handler.Logout)
+	v1.GET("/auth/csrf", CSRFToken(cookies))
+	v1.GET("/me", requireAuth, handler.GetCurrentUser)
+	return router
+}
+
+// cookieRequest sends a request as a browser holding cookies would, adding
+// the CSRF header if csrfToken is set.
+func cookieRequest(router *gin.Engine, method, path string, cookies []*http.Cookie, csrfToken string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if csrfToken != "" {
+		req.Header.Set(CSRFHeader, csrfToken)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// cookieLogin logs in through router and returns the response and the
+// cookies set
+func (suite *AuthHandlerTestSuite) cookieLogin(router *gin.Engine, email string) (models.AuthResponse, map[string]*http.Cookie) {
+	body, _ := json.Marshal(models.LoginRequest{Email: email, Password: "password123"})
+	w := cookieRequest(router, "POST", "/api/v1/auth/login", nil, "", body)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var response models.AuthResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response, responseCookies(w)
+}
+
+func responseCookies(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func (suite *AuthHandlerTestSuite) TestCookieMode_Login() {
+	suite.register("cookies@example.com", "password123")
+	router := suite.cookieRouter()
+
+	response, cookies := suite.cookieLogin(router, "cookies@example.com")
+
+	assert.Empty(suite.T(), response.Token, "Tokens are kept from scripts")
+	assert.Empty(suite.T(), response.RefreshToken)
+	assert.NotEmpty(suite.T(), response.CSRFToken)
+	suite.Require().Contains(cookies, AccessTokenCookie)
+	suite.Require().Contains(cookies, RefreshTokenCookie)
+	suite.Require().Contains(cookies, CSRFCookie)
+	access := cookies[AccessTokenCookie]
+	assert.True(suite.T(), access.HttpOnly)
+	assert.True(suite.T(), access.Secure)
+	assert.Equal(suite.T(), http.SameSiteLaxMode, access.SameSite)
+	assert.Equal(suite.T(), "/", access.Path)
+	assert.True(suite.T(), cookies[RefreshTokenCookie].HttpOnly)
+	assert.Equal(suite.T(), refreshCookiePath, cookies[RefreshTokenCookie].Path)
+	assert.False(suite.T(), cookies[CSRFCookie].HttpOnly, "Scripts must be able to send the CSRF token")
+	assert.Equal(suite.T(), response.CSRFToken, cookies[CSRFCookie].Value)
+
+	w := cookieRequest(router, "GET", "/api/v1/me", []*http.Cookie{access}, "", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "cookies@example.com")
+}
+
+func (suite *AuthHandlerTestSuite) TestCookieMode_BearerStillAccepted() {
+	registered := suite.register("cookiebearer@example.com", "password123")
+	router := suite.cookieRouter()
+
+	req := httptest.NewRequest("GET", "/api/v1/me", nil)
+	req.Header.Set("Authorization", "Bearer "+registered.Token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestCookieMode_Refresh() {
+	suite.register("cookierefresh@example.com", "password123")
+	router := suite.cookieRouter()
+	login, cookies := suite.cookieLogin(router, "cookierefresh@example.com")
+	sent := []*http.Cookie{cookies[RefreshTokenCookie], cookies[CSRFCookie]}
+
+	w := cookieRequest(router, "POST", "/api/v1/auth/refresh", sent, "", nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "Refreshing needs the CSRF token")
+
+	w = cookieRequest(router, "POST", "/api/v1/auth/refresh", sent, login.CSRFToken, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	rotated := responseCookies(w)
+	suite.Require().Contains(rotated, RefreshTokenCookie)
+	assert.NotEqual(suite.T(), cookies[RefreshTokenCookie].Value, rotated[RefreshTokenCookie].Value)
+	assert.Equal(suite.T(), login.CSRFToken, rotated[CSRFCookie].Value, "The CSRF token is kept")
+}
+
+func (suite *AuthHandlerTestSuite) TestCookieMode_Logout() {
+	suite.register("cookielogout@example.com", "password123")
+	router := suite.cookieRouter()
+	login, cookies := suite.cookieLogin(router, "cookielogout@example.com")
+	sent := []*http.Cookie{cookies[AccessTokenCookie], cookies[RefreshTokenCookie], cookies[CSRFCookie]}
+
+	w := cookieRequest(router, "POST", "/api/v1/auth/logout", sent, "", nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "Other sites can't log the user out")
+
+	w = cookieRequest(router, "POST", "/api/v1/auth/logout", sent, login.CSRFToken, nil)
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+	cleared := responseCookies(w)
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie, CSRFCookie} {
+		suite.Require().Contains(cleared, name)
+		assert.Negative(suite.T(), cleared[name].MaxAge, name)
+	}
+
+	w = cookieRequest(router, "POST", "/api/v1/auth/refresh", sent, login.CSRFToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestCookieMode_CSRFToken() {
+	router := suite.cookieRouter()
+
+	w := cookieRequest(router, "GET", "/api/v1/auth/csrf", nil, "", nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var body struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	cookies := responseCookies(w)
+	suite.Require().Contains(cookies, CSRFCookie)
+	assert.Equal(suite.T(), cookies[CSRFCookie].Value, body.CSRFToken)
+
+	w = cookieRequest(router, "GET", "/api/v1/auth/csrf", []*http.Cookie{cookies[CSRFCookie]}, "", nil)
+	assert.Contains(suite.T(), w.Body.String(), body.CSRFToken, "An existing token is returned")
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS serves the public keys other services use to verify our access tokens.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.PublicJWKS())
+}
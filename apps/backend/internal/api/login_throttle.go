@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// LoginLimits configure how failed password logins are throttled. Failures
+// are counted per email address and per client IP address, and forgotten
+// after Window passes without another one.
+type LoginLimits struct {
+	Window time.Duration
+
+	// After DelayAfter failures for an email address, each further failure
+	// blocks the next attempt for Delay, doubling every time.
+	DelayAfter int
+	Delay      time.Duration
+
+	// LockAfter failures lock an email address out for LockoutDuration.
+	LockAfter       int
+	LockoutDuration time.Duration
+
+	// IPLockAfter failures from one IP address, whichever accounts they are
+	// against, block it for LockoutDuration.
+	IPLockAfter int
+}
+
+// DefaultLoginLimits are used when Config.LoginLimits is not set.
+var DefaultLoginLimits = LoginLimits{
+	Window:          15 * time.Minute,
+	DelayAfter:      3,
+	Delay:           time.Second,
+	LockAfter:       10,
+	LockoutDuration: 15 * time.Minute,
+	IPLockAfter:     100,
+}
+
+// LoginThrottle slows down and then locks out repeated failed password
+// logins, and records lockouts in the audit log. Locked out users are emailed
+// a link to unlock their account.
+type LoginThrottle struct {
+	throttles *repository.LoginThrottleRepository
+	audit     *repository.AuditRepository
+	tokenRepo *repository.UserTokenRepository
+	notifier  Notifier
+	limits    LoginLimits
+}
+
+func NewLoginThrottle(
+	throttles *repository.LoginThrottleRepository,
+	audit *repository.AuditRepository,
+	tokenRepo *repository.UserTokenRepository,
+	notifier Notifier,
+	limits LoginLimits,
+) *LoginThrottle {
+	return &LoginThrottle{
+		throttles: throttles,
+		audit:     audit,
+		tokenRepo: tokenRepo,
+		notifier:  notifier,
+		limits:    limits,
+	}
+}
+
+// Throttles are keyed by email address whether or not an account exists, so
+// that a lockout doesn't reveal which addresses have one.
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Allow reports whether a login for email may be attempted from the
+// request's IP address. If not, it writes the 429 response itself.
+func (t *LoginThrottle) Allow(c *gin.Context, email string) bool {
+	throttle, err := t.throttles.Blocked(c.Request.Context(), emailThrottleKey(email), ipThrottleKey(c.ClientIP()))
+	if err != nil {
+		log.Printf("Error checking login throttle: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return false
+	}
+	if throttle == nil {
+		return true
+	}
+
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(throttle.RetryAfter)))
+	if throttle.Locked && strings.HasPrefix(throttle.Key, "email:") {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Account temporarily locked after too many failed login attempts"})
+	} else {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+	}
+	return false
+}
+
+// Failure records a failed login for email from the request's IP address.
+// user is the account with that address, or nil if there is none.
+func (t *LoginThrottle) Failure(c *gin.Context, email string, user *models.User) {
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+
+	key := emailThrottleKey(email)
+	failures, err := t.throttles.RecordFailure(ctx, key, t.limits.Window)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	} else if failures >= t.limits.LockAfter {
+		t.lockAccount(ctx, email, user, ip)
+	} else if failures >= t.limits.DelayAfter {
+		if err := t.throttles.Block(ctx, key, t.delay(failures), false); err != nil {
+			log.Printf("Error delaying login: %v", err)
+		}
+	}
+
+	key = ipThrottleKey(ip)
+	failures, err = t.throttles.RecordFailure(ctx, key, t.limits.Window)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	} else if failures >= t.limits.IPLockAfter {
+		if err := t.throttles.Block(ctx, key, t.limits.LockoutDuration, true); err != nil {
+			log.Printf("Error blocking IP address: %v", err)
+		}
+		t.record(ctx, &models.AuditEvent{
+			Event:     models.AuditEventIPBlocked,
+			IPAddress: ip,
+			Details:   map[string]any{"failures": failures, "blocked_for": t.limits.LockoutDuration.String()},
+		})
+	}
+}
+
+// Success forgets the failed logins for email. Failures from the IP address
+// still count, so that one valid account can't be used to reset them.
+func (t *LoginThrottle) Success(c *gin.Context, email string) {
+	if _, err := t.throttles.Clear(c.Request.Context(), emailThrottleKey(email)); err != nil {
+		log.Printf("Error clearing login throttle: %v", err)
+	}
+}
+
+// Unlock lifts any lockout or delay on logins to user's account. method
+// records in the audit log how it was unlocked, for example "email".
+func (t *LoginThrottle) Unlock(c *gin.Context, user *models.User, method string) error {
+	ctx := c.Request.Context()
+	locked, err := t.throttles.Clear(ctx, emailThrottleKey(user.Email))
+	if err != nil {
+		return err
+	}
+
+	// Unlock links sent before this are no longer needed
+	if err := t.tokenRepo.DeleteForUser(ctx, user.ID, models.TokenPurposeAccountUnlock); err != nil {
+		log.Printf("Error deleting account unlock tokens: %v", err)
+	}
+
+	if locked {
+		event := &models.AuditEvent{
+			Event:     models.AuditEventAccountUnlocked,
+			UserID:    &user.ID,
+			IPAddress: c.ClientIP(),
+			Details:   map[string]any{"method": method},
+		}
+		if claims, ok := c.Get("claims"); ok && claims.(*auth.Claims).UserID != 0 {
+			event.ActorID = &claims.(*auth.Claims).UserID
+		}
+		t.record(ctx, event)
+	}
+
+	return nil
+}
+
+// delay is how long to block attempts after the given number of failures:
+// Delay, doubling with each failure after DelayAfter, but never longer than
+// a lockout.
+func (t *LoginThrottle) delay(failures int) time.Duration {
+	d := t.limits.Delay << min(failures-t.limits.DelayAfter, 30)
+	if d <= 0 || d > t.limits.LockoutDuration {
+		return t.limits.LockoutDuration
+	}
+	return d
+}
+
+// lockAccount locks logins to email out, and if there is an account with the
+// address emails its owner a link to unlock it.
+func (t *LoginThrottle) lockAccount(ctx context.Context, email string, user *models.User, ip string) {
+	if err := t.throttles.Block(ctx, emailThrottleKey(email), t.limits.LockoutDuration, true); err != nil {
+		log.Printf("Error locking account: %v", err)
+		return
+	}
+
+	event := &models.AuditEvent{
+		Event:     models.AuditEventAccountLocked,
+		IPAddress: ip,
+		Details:   map[string]any{"email": email, "locked_for": t.limits.LockoutDuration.String()},
+	}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	t.record(ctx, event)
+
+	if user == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := t.sendUnlock(ctx, user); err != nil {
+			log.Printf("Error sending account unlock link: %v", err)
+		}
+	}()
+}
+
+// sendUnlock replaces any outstanding unlock tokens for user with a new one
+// and sends it.
+func (t *LoginThrottle) sendUnlock(ctx context.Context, user *models.User) error {
+	if err := t.tokenRepo.DeleteForUser(ctx, user.ID, models.TokenPurposeAccountUnlock); err != nil {
+		return err
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	stored := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeAccountUnlock,
+		TokenHash: auth.HashToken(token),
+	}
+	if err := t.tokenRepo.Create(ctx, stored, auth.AccountUnlockTTL); err != nil {
+		return err
+	}
+
+	return t.notifier.SendAccountLocked(ctx, user, token, t.limits.LockoutDuration)
+}
+
+// record adds an event to the audit log. Failing to do so is logged rather
+// than failing the request.
+func (t *LoginThrottle) record(ctx context.Context, event *models.AuditEvent) {
+	if err := t.audit.Record(ctx, event); err != nil {
+		log.Printf("Error recording audit event: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// testLoginLimits lock accounts out quickly. Delays are long enough to
+// observe, and tests that need to get past them call liftLoginDelays.
+var testLoginLimits = LoginLimits{
+	Window:          15 * time.Minute,
+	DelayAfter:      3,
+	Delay:           time.Minute,
+	LockAfter:       5,
+	LockoutDuration: 15 * time.Minute,
+	IPLockAfter:     8,
+}
+
+func TestLoginThrottle_Delay(t *testing.T) {
+	throttle := &LoginThrottle{limits: testLoginLimits}
+
+	assert.Equal(t, time.Minute, throttle.delay(3))
+	assert.Equal(t, 2*time.Minute, throttle.delay(4))
+	assert.Equal(t, 8*time.Minute, throttle.delay(6))
+	assert.Equal(t, 15*time.Minute, throttle.delay(7), "Delays never exceed a lockout")
+	assert.Equal(t, 15*time.Minute, throttle.delay(100))
+}
+
+// failLogins tries a wrong password for email n times, lifting delays between
+// attempts, and expects each to be rejected as invalid.
+func (suite *AuthHandlerTestSuite) failLogins(email string, n int) {
+	for i := 0; i < n; i++ {
+		suite.liftLoginDelays()
+		w := suite.postJSON("/login", models.LoginRequest{Email: email, Password: "wrong-password"})
+		suite.Require().Equal(http.StatusUnauthorized, w.Code)
+	}
+}
+
+// liftLoginDelays ends the progressive delays, but not the lockouts, that
+// failed logins have caused.
+func (suite *AuthHandlerTestSuite) liftLoginDelays() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "UPDATE login_throttles SET blocked_until = NULL WHERE NOT locked")
+	suite.Require().NoError(err)
+}
+
+// lockoutEmailed waits for the unlock link sent when email is locked out
+func (suite *AuthHandlerTestSuite) lockoutEmailed(email string) string {
+	suite.Require().Eventually(func() bool {
+		return suite.notifier.unlockToken(email) != ""
+	}, time.Second, 10*time.Millisecond, "Unlock link should be sent")
+	return suite.notifier.unlockToken(email)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_DelaysAfterFailures() {
+	suite.register("delayed@example.com", "password123")
+	for i := 0; i < testLoginLimits.DelayAfter; i++ {
+		w := suite.postJSON("/login", models.LoginRequest{Email: "delayed@example.com", Password: "wrong-password"})
+		suite.Require().Equal(http.StatusUnauthorized, w.Code)
+	}
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "delayed@example.com", Password: "password123"})
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code, "Even the right password must wait")
+	assert.Equal(suite.T(), "60", w.Header().Get("Retry-After"))
+	assert.Contains(suite.T(), w.Body.String(), "Too many failed login attempts")
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_SuccessClearsFailures() {
+	suite.register("clears@example.com", "password123")
+	suite.failLogins("clears@example.com", testLoginLimits.LockAfter-1)
+	suite.liftLoginDelays()
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "clears@example.com", Password: "password123"})
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	// The count starts over, so one more failure doesn't lock the account
+	suite.failLogins("clears@example.com", 1)
+	w = suite.postJSON("/login", models.LoginRequest{Email: "clears@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_LocksOutAccount() {
+	registered := suite.register("locked@example.com", "password123")
+	suite.failLogins("locked@example.com", testLoginLimits.LockAfter)
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "locked@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Account temporarily locked")
+	assert.Equal(suite.T(), "900", w.Header().Get("Retry-After"))
+
+	suite.lockoutEmailed("locked@example.com")
+
+	events, err := suite.admin.audit.ListForUser(suite.ctx, registered.User.ID)
+	suite.Require().NoError(err)
+	suite.Require().Len(events, 1)
+	assert.Equal(suite.T(), models.AuditEventAccountLocked, events[0].Event)
+	assert.NotEmpty(suite.T(), events[0].IPAddress)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_LocksOutUnknownEmail() {
+	suite.failLogins("nobody@example.com", testLoginLimits.LockAfter)
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "nobody@example.com", Password: "password123"})
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Account temporarily locked", "Lockouts don't reveal which accounts exist")
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_LockoutIgnoresEmailCase() {
+	suite.register("case@example.com", "password123")
+	suite.failLogins("CASE@example.com", testLoginLimits.LockAfter)
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "case@example.com", Password: "password123"})
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_BlocksIPAddress() {
+	suite.register("bystander@example.com", "password123")
+	for i := 0; i < testLoginLimits.IPLockAfter; i++ {
+		suite.failLogins(fmt.Sprintf("target%d@example.com", i), 1)
+	}
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "bystander@example.com", Password: "password123"})
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Too many failed login attempts")
+}
+
+func (suite *AuthHandlerTestSuite) TestUnlockAccount() {
+	registered := suite.register("unlock@example.com", "password123")
+	suite.failLogins("unlock@example.com", testLoginLimits.LockAfter)
+	token := suite.lockoutEmailed("unlock@example.com")
+
+	w := suite.postJSON("/unlock", models.UnlockAccountRequest{Token: token})
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "unlock@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.postJSON("/unlock", models.UnlockAccountRequest{Token: token})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code, "Unlock links are single use")
+
+	events, err := suite.admin.audit.ListForUser(suite.ctx, registered.User.ID)
+	suite.Require().NoError(err)
+	suite.Require().Len(events, 2)
+	assert.Equal(suite.T(), models.AuditEventAccountUnlocked, events[0].Event)
+	assert.Equal(suite.T(), "email", events[0].Details["method"])
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_UnlocksAccount() {
+	suite.register("resetlock@example.com", "password123")
+	suite.failLogins("resetlock@example.com", testLoginLimits.LockAfter)
+	suite.lockoutEmailed("resetlock@example.com")
+
+	token := suite.requestReset("resetlock@example.com")
+	w := suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: token, Password: "newpassword123"})
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "resetlock@example.com", Password: "newpassword123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_UnlockUser() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	user := suite.register("adminunlock@example.com", "password123")
+	suite.failLogins("adminunlock@example.com", testLoginLimits.LockAfter)
+	suite.lockoutEmailed("adminunlock@example.com")
+
+	w := suite.authedRequest("POST", fmt.Sprintf("/admin/users/%d/unlock", user.User.ID), admin.Token, nil)
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "adminunlock@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.authedRequest("GET", fmt.Sprintf("/admin/users/%d/audit-events", user.User.ID), admin.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var events []models.AuditEvent
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &events))
+	suite.Require().Len(events, 2)
+	assert.Equal(suite.T(), models.AuditEventAccountUnlocked, events[0].Event)
+	assert.Equal(suite.T(), "admin", events[0].Details["method"])
+	suite.Require().NotNil(events[0].ActorID)
+	assert.Equal(suite.T(), admin.User.ID, *events[0].ActorID)
+	assert.Equal(suite.T(), models.AuditEventAccountLocked, events[1].Event)
+}
+
+func (suite *AuthHandlerTestSuite) TestAdmin_UnlockUser_RequiresPermission() {
+	member := suite.register("member@example.com", "password123")
+
+	w := suite.authedRequest("POST", fmt.Sprintf("/admin/users/%d/unlock", member.User.ID), member.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
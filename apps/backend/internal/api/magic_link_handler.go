@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// MagicLinkHandler logs users in with single-use links emailed to them, for
+// those who would rather not have a password.
+type MagicLinkHandler struct {
+	userRepo *repository.UserRepository
+	linkRepo *repository.MagicLinkRepository
+	issuer   *TokenIssuer
+	notifier Notifier
+	// signup creates an account the first time an unknown address logs in
+	signup bool
+}
+
+func NewMagicLinkHandler(
+	userRepo *repository.UserRepository,
+	linkRepo *repository.MagicLinkRepository,
+	issuer *TokenIssuer,
+	notifier Notifier,
+	signup bool,
+) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		userRepo: userRepo,
+		linkRepo: linkRepo,
+		issuer:   issuer,
+		notifier: notifier,
+		signup:   signup,
+	}
+}
+
+// Send emails a login link to the address if it has an account, or to any
+// address when sign up is enabled. Like ForgotPassword, it always responds
+// 202 and does its work after responding, so that neither the status nor the
+// timing reveals whether the account exists.
+func (h *MagicLinkHandler) Send(c *gin.Context) {
+	var req models.MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	go func() {
+		if err := h.send(ctx, req.Email); err != nil {
+			log.Printf("Error sending magic link: %v", err)
+		}
+	}()
+
+	c.Status(http.StatusAccepted)
+}
+
+func (h *MagicLinkHandler) send(ctx context.Context, email string) error {
+	user, err := h.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		if !h.signup {
+			return nil
+		}
+		user = &models.User{Email: email}
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	link := &models.MagicLink{Email: email, TokenHash: auth.HashToken(token)}
+	if err := h.linkRepo.Create(ctx, link, auth.MagicLinkTTL); err != nil {
+		return err
+	}
+
+	return h.notifier.SendMagicLink(ctx, user, token)
+}
+
+// Consume exchanges an emailed login link for the same response Login gives,
+// which is an MFA challenge if the user has a second factor. Each link works
+// once, and using one invalidates the others sent to the address. Following
+// the link proves the user controls the address, so it is marked verified.
+func (h *MagicLinkHandler) Consume(c *gin.Context) {
+	var req models.ConsumeMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	link, err := h.linkRepo.Consume(ctx, auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("Error consuming magic link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if link == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+
+	user, err := h.userRepo.GetByEmail(ctx, link.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		// Sign up may have been turned off since the link was sent
+		if !h.signup {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login link"})
+			return
+		}
+		user = &models.User{Email: link.Email, Name: link.Email}
+		// A deleted account keeps its address until it is purged
+		err := h.userRepo.Create(ctx, user)
+		if errors.Is(err, repository.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error creating user from magic link: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := h.userRepo.MarkEmailVerified(ctx, user); err != nil {
+			log.Printf("Error marking email verified: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+	}
+
+	if err := h.linkRepo.DeleteForEmail(ctx, link.Email); err != nil {
+		log.Printf("Error deleting magic links: %v", err)
+	}
+
+	h.issuer.Login(c, user)
+}
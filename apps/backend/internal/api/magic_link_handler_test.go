@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestMagicLink asks router for a login link and waits for it to be sent
+func (suite *AuthHandlerTestSuite) requestMagicLink(router *gin.Engine, email string) string {
+	body, _ := json.Marshal(models.MagicLinkRequest{Email: email})
+	req := httptest.NewRequest("POST", "/magic-link", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusAccepted, w.Code)
+
+	suite.Require().Eventually(func() bool {
+		return suite.notifier.magicLinkToken(email) != ""
+	}, time.Second, 10*time.Millisecond, "Login link should be sent")
+	return suite.notifier.magicLinkToken(email)
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_Login() {
+	suite.register("magic@example.com", "password123")
+	token := suite.requestMagicLink(suite.router, "magic@example.com")
+
+	w := suite.postJSON("/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token})
+
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var response models.AuthResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(suite.T(), response.Token)
+	assert.NotEmpty(suite.T(), response.RefreshToken)
+	assert.Equal(suite.T(), "magic@example.com", response.User.Email)
+	assert.NotNil(suite.T(), response.User.EmailVerifiedAt, "Following the link verifies the address")
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_SingleUse() {
+	suite.register("magicreplay@example.com", "password123")
+	token := suite.requestMagicLink(suite.router, "magicreplay@example.com")
+	suite.Require().Equal(http.StatusOK, suite.postJSON("/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token}).Code)
+
+	w := suite.postJSON("/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_UsingOneInvalidatesOthers() {
+	suite.register("magicmany@example.com", "password123")
+	first := suite.requestMagicLink(suite.router, "magicmany@example.com")
+	suite.notifier.mu.Lock()
+	delete(suite.notifier.magicLink, "magicmany@example.com")
+	suite.notifier.mu.Unlock()
+	second := suite.requestMagicLink(suite.router, "magicmany@example.com")
+	suite.Require().NotEqual(first, second)
+
+	suite.Require().Equal(http.StatusOK, suite.postJSON("/magic-link/consume", models.ConsumeMagicLinkRequest{Token: second}).Code)
+	w := suite.postJSON("/magic-link/consume", models.ConsumeMagicLinkRequest{Token: first})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_InvalidToken() {
+	w := suite.postJSON("/magic-link/consume", models.ConsumeMagicLinkRequest{Token: "not-a-real-token"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_RequiresSecondFactor() {
+	suite.enrollTOTP("magicmfa@example.com")
+	token := suite.requestMagicLink(suite.router, "magicmfa@example.com")
+
+	w := suite.postJSON("/magic-link/consume", models.ConsumeMagicLinkRequest{Token: token})
+
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var challenge models.MFAChallengeResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &challenge))
+	assert.True(suite.T(), challenge.MFARequired)
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_UnknownEmail() {
+	w := suite.postJSON("/magic-link", models.MagicLinkRequest{Email: "magicnobody@example.com"})
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code, "Unknown addresses must look the same as known ones")
+	suite.Never(func() bool {
+		return suite.notifier.magicLinkToken("magicnobody@example.com") != ""
+	}, 100*time.Millisecond, 10*time.Millisecond, "Nothing is sent without sign up")
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_Signup() {
+	userRepo := repository.NewUserRepository(suite.db)
+	handler := NewMagicLinkHandler(userRepo, repository.NewMagicLinkRepository(suite.db), suite.handler.issuer, suite.notifier, true)
+	router := gin.New()
+	router.POST("/magic-link", handler.Send)
+	router.POST("/magic-link/consume", handler.Consume)
+	token := suite.requestMagicLink(router, "magicnew@example.com")
+
+	body, _ := json.Marshal(models.ConsumeMagicLinkRequest{Token: token})
+	req := httptest.NewRequest("POST", "/magic-link/consume", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	user, err := userRepo.GetByEmail(suite.ctx, "magicnew@example.com")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(user, "The account is created on first use")
+	assert.Empty(suite.T(), user.PasswordHash)
+	assert.NotNil(suite.T(), user.EmailVerifiedAt)
+}
+
+func (suite *AuthHandlerTestSuite) TestMagicLink_SignupWithDeletedAccountsEmail() {
+	registered := suite.register("magicdeleted@example.com", "password123")
+	suite.deleteAccount(registered.Token, "magicdeleted@example.com")
+	handler := NewMagicLinkHandler(repository.NewUserRepository(suite.db), repository.NewMagicLinkRepository(suite.db), suite.handler.issuer, suite.notifier, true)
+	router := gin.New()
+	router.POST("/magic-link", handler.Send)
+	router.POST("/magic-link/consume", handler.Consume)
+	token := suite.requestMagicLink(router, "magicdeleted@example.com")
+
+	body, _ := json.Marshal(models.ConsumeMagicLinkRequest{Token: token})
+	req := httptest.NewRequest("POST", "/magic-link/consume", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code, "The address is kept until the account is purged")
+}
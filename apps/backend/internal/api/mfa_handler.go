@@ -0,0 +1,366 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMFAAttempts is how many wrong codes can be tried with one MFA token
+// before it is revoked and the user has to enter their password again.
+const maxMFAAttempts = 5
+
+// MFAHandler manages second factors and completes logins that need one.
+type MFAHandler struct {
+	userRepo    *repository.UserRepository
+	mfaRepo     *repository.MFARepository
+	revocations *auth.RevocationStore
+	issuer      *TokenIssuer
+	throttles   *repository.LoginThrottleRepository
+	appName     string
+}
+
+func NewMFAHandler(
+	userRepo *repository.UserRepository,
+	mfaRepo *repository.MFARepository,
+	revocations *auth.RevocationStore,
+	issuer *TokenIssuer,
+	throttles *repository.LoginThrottleRepository,
+	appName string,
+) *MFAHandler {
+	return &MFAHandler{
+		userRepo:    userRepo,
+		mfaRepo:     mfaRepo,
+		revocations: revocations,
+		issuer:      issuer,
+		throttles:   throttles,
+		appName:     appName,
+	}
+}
+
+// Verify exchanges the MFA token returned by login, together with a TOTP code
+// or a recovery code, for an access token and a refresh token.
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	claims, err := auth.ValidateToken(req.MFAToken)
+	if err != nil || claims.Purpose != auth.PurposeMFAPending {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	revoked, err := h.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		log.Printf("Error checking token revocation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	totp, err := h.mfaRepo.GetTOTP(ctx, claims.UserID)
+	if err != nil {
+		log.Printf("Error getting TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if totp == nil || totp.ConfirmedAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var ok bool
+	if req.Code != "" {
+		ok, err = h.useTOTPCode(ctx, totp, req.Code)
+	} else {
+		ok, err = h.mfaRepo.UseRecoveryCode(ctx, totp.UserID, auth.HashRecoveryCode(req.RecoveryCode))
+	}
+	if err != nil {
+		log.Printf("Error verifying second factor: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		h.recordFailure(ctx, claims)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	// The MFA token has done its job and must not be exchanged again
+	h.clearFailures(ctx, claims.ID)
+	if err := h.revocations.Revoke(ctx, claims); err != nil {
+		log.Printf("Error revoking MFA token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	response, err := h.issuer.Issue(c, user, nil)
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.issuer.Respond(c, http.StatusOK, response)
+}
+
+// Status reports which second factors the current user has enabled.
+func (h *MFAHandler) Status(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.GetInt("userID")
+
+	totp, err := h.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MFA status"})
+		return
+	}
+	remaining, err := h.mfaRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		log.Printf("Error counting recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MFA status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFAStatusResponse{
+		TOTPEnabled:            totp != nil && totp.ConfirmedAt != nil,
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+// BeginTOTP generates a new secret for the current user. It does not protect
+// logins until confirmed with ConfirmTOTP.
+func (h *MFAHandler) BeginTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.GetInt("userID")
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	err = h.mfaRepo.SaveUnconfirmedTOTP(ctx, userID, secret)
+	if errors.Is(err, repository.ErrTOTPAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication already enabled"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPURI(h.appName, c.GetString("email"), secret),
+	})
+}
+
+// ConfirmTOTP enables the current user's new authenticator once they have
+// shown it produces valid codes, and returns their recovery codes. This is
+// the only time the recovery codes are shown.
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := c.GetInt("userID")
+
+	totp, err := h.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm enrollment"})
+		return
+	}
+	if totp == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No enrollment in progress"})
+		return
+	}
+	if totp.ConfirmedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication already enabled"})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	confirmed, err := h.mfaRepo.ConfirmTOTP(ctx, userID, step, hashes)
+	if err != nil {
+		log.Printf("Error confirming TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm enrollment"})
+		return
+	}
+	if !confirmed {
+		// Confirmed or restarted by a concurrent request
+		c.JSON(http.StatusConflict, gin.H{"error": "Enrollment changed, please try again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP removes the current user's authenticator and recovery codes. It
+// requires a current TOTP code or a recovery code.
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	totp, ok := h.requireSecondFactor(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaRepo.DeleteTOTP(c.Request.Context(), totp.UserID); err != nil {
+		log.Printf("Error deleting TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes. It
+// requires a current TOTP code or a recovery code.
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	totp, ok := h.requireSecondFactor(c)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if err := h.mfaRepo.ReplaceRecoveryCodes(c.Request.Context(), totp.UserID, hashes); err != nil {
+		log.Printf("Error replacing recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// requireSecondFactor checks the code in the request body against the current
+// user's enabled authenticator, writing an error response if it fails.
+func (h *MFAHandler) requireSecondFactor(c *gin.Context) (*models.TOTPCredential, bool) {
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	ctx := c.Request.Context()
+	totp, err := h.mfaRepo.GetTOTP(ctx, c.GetInt("userID"))
+	if err != nil {
+		log.Printf("Error getting TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return nil, false
+	}
+	if totp == nil || totp.ConfirmedAt == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Two-factor authentication not enabled"})
+		return nil, false
+	}
+
+	ok, err := h.useTOTPCode(ctx, totp, req.Code)
+	if err == nil && !ok {
+		ok, err = h.mfaRepo.UseRecoveryCode(ctx, totp.UserID, auth.HashRecoveryCode(req.Code))
+	}
+	if err != nil {
+		log.Printf("Error verifying second factor: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return nil, false
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return nil, false
+	}
+
+	return totp, true
+}
+
+// useTOTPCode validates code and records its time step, so that a code
+// observed by an attacker cannot be replayed.
+func (h *MFAHandler) useTOTPCode(ctx context.Context, totp *models.TOTPCredential, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return h.mfaRepo.UseTOTPStep(ctx, totp.UserID, step)
+}
+
+// recordFailure counts a wrong code against an MFA token, revoking the token
+// once maxMFAAttempts is reached. The count is shared by every replica and
+// kept until the token expires.
+func (h *MFAHandler) recordFailure(ctx context.Context, claims *auth.Claims) {
+	failures, err := h.throttles.RecordFailureUntil(ctx, mfaThrottleKey(claims.ID), claims.ExpiresAt.Time)
+	if err != nil {
+		log.Printf("Error recording MFA failure: %v", err)
+		return
+	}
+
+	if failures >= maxMFAAttempts {
+		h.clearFailures(ctx, claims.ID)
+		if err := h.revocations.Revoke(ctx, claims); err != nil {
+			log.Printf("Error revoking MFA token: %v", err)
+		}
+	}
+}
+
+func (h *MFAHandler) clearFailures(ctx context.Context, jti string) {
+	if _, err := h.throttles.Clear(ctx, mfaThrottleKey(jti)); err != nil {
+		log.Printf("Error clearing MFA failures: %v", err)
+	}
+}
+
+// mfaThrottleKey is the login_throttles key wrong codes against the MFA token
+// jti are counted under.
+func mfaThrottleKey(jti string) string {
+	return "mfa:" + jti
+}
+
+// generateRecoveryCodes returns a fresh set of recovery codes and their hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
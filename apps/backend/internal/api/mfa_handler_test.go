@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// The MFA tests run as part of AuthHandlerTestSuite, which sets up the routes.
+
+// enrollTOTP registers a user and enables TOTP for them. Confirmation uses the
+// previous period's code so that tests can still log in with the current one.
+func (suite *AuthHandlerTestSuite) enrollTOTP(email string) (models.AuthResponse, string, []string) {
+	registered := suite.register(email, "password123")
+
+	w := suite.authedRequest("POST", "/me/mfa/totp", registered.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var enrollment models.TOTPEnrollmentResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &enrollment))
+
+	code, _ := auth.TOTPCode(enrollment.Secret, time.Now().Add(-30*time.Second))
+	body, _ := json.Marshal(models.MFACodeRequest{Code: code})
+	w = suite.authedRequest("POST", "/me/mfa/totp/confirm", registered.Token, body)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var recovery models.RecoveryCodesResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &recovery))
+
+	return registered, enrollment.Secret, recovery.RecoveryCodes
+}
+
+// loginForMFA logs in and returns the MFA token from the challenge.
+func (suite *AuthHandlerTestSuite) loginForMFA(email string) string {
+	w := suite.postJSON("/login", models.LoginRequest{Email: email, Password: "password123"})
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var challenge models.MFAChallengeResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &challenge))
+	suite.Require().True(challenge.MFARequired)
+	suite.Require().NotEmpty(challenge.MFAToken)
+	return challenge.MFAToken
+}
+
+func (suite *AuthHandlerTestSuite) currentCode(secret string) string {
+	code, err := auth.TOTPCode(secret, time.Now())
+	suite.Require().NoError(err)
+	return code
+}
+
+func (suite *AuthHandlerTestSuite) TestBeginTOTP_ReturnsOTPAuthURL() {
+	registered := suite.register("begin@example.com", "password123")
+
+	w := suite.authedRequest("POST", "/me/mfa/totp", registered.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var enrollment models.TOTPEnrollmentResponse
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	assert.NotEmpty(suite.T(), enrollment.Secret)
+	assert.Contains(suite.T(), enrollment.OTPAuthURL, "otpauth://totp/Test%20App:begin@example.com")
+	assert.Contains(suite.T(), enrollment.OTPAuthURL, "secret="+enrollment.Secret)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogin_WithoutMFAIssuesTokens() {
+	registered := suite.register("unenrolled@example.com", "password123")
+
+	// Enrollment that was never confirmed does not protect logins
+	suite.authedRequest("POST", "/me/mfa/totp", registered.Token, nil)
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "unenrolled@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var response models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotEmpty(suite.T(), response.Token)
+}
+
+func (suite *AuthHandlerTestSuite) TestConfirmTOTP_InvalidCode() {
+	registered := suite.register("badconfirm@example.com", "password123")
+	suite.authedRequest("POST", "/me/mfa/totp", registered.Token, nil)
+
+	body, _ := json.Marshal(models.MFACodeRequest{Code: "000000"})
+	w := suite.authedRequest("POST", "/me/mfa/totp/confirm", registered.Token, body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_Success() {
+	_, secret, recoveryCodes := suite.enrollTOTP("mfa@example.com")
+	assert.Len(suite.T(), recoveryCodes, auth.RecoveryCodeCount)
+
+	mfaToken := suite.loginForMFA("mfa@example.com")
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: suite.currentCode(secret)})
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var response models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotEmpty(suite.T(), response.Token)
+	assert.NotEmpty(suite.T(), response.RefreshToken)
+	assert.Equal(suite.T(), http.StatusOK, suite.authedRequest("GET", "/me", response.Token, nil).Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAToken_IsNotAnAccessToken() {
+	suite.enrollTOTP("pending@example.com")
+	mfaToken := suite.loginForMFA("pending@example.com")
+
+	w := suite.authedRequest("GET", "/me", mfaToken, nil)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_TokenSingleUse() {
+	_, secret, recoveryCodes := suite.enrollTOTP("mfaonce@example.com")
+	mfaToken := suite.loginForMFA("mfaonce@example.com")
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: suite.currentCode(secret)})
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	w = suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, RecoveryCode: recoveryCodes[0]})
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_RejectsAccessToken() {
+	registered, secret, _ := suite.enrollTOTP("wrongtoken@example.com")
+
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: registered.Token, Code: suite.currentCode(secret)})
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_RejectsReplayedCode() {
+	_, secret, _ := suite.enrollTOTP("replay@example.com")
+	code := suite.currentCode(secret)
+
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("replay@example.com"), Code: code})
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	w = suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("replay@example.com"), Code: code})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_RecoveryCodeSingleUse() {
+	_, _, recoveryCodes := suite.enrollTOTP("recovery@example.com")
+
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("recovery@example.com"), RecoveryCode: recoveryCodes[0]})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("recovery@example.com"), RecoveryCode: recoveryCodes[0]})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_TooManyAttemptsRevokesToken() {
+	_, secret, _ := suite.enrollTOTP("guess@example.com")
+	mfaToken := suite.loginForMFA("guess@example.com")
+
+	for i := 0; i < maxMFAAttempts; i++ {
+		w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: "000000"})
+		suite.Require().Equal(http.StatusUnauthorized, w.Code)
+	}
+
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: suite.currentCode(secret)})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_AttemptsSharedBetweenReplicas() {
+	_, secret, _ := suite.enrollTOTP("replicas@example.com")
+	mfaToken := suite.loginForMFA("replicas@example.com")
+	// A second replica, with its own revocation cache
+	replica := NewMFAHandler(
+		repository.NewUserRepository(suite.db),
+		repository.NewMFARepository(suite.db),
+		auth.NewRevocationStore(repository.NewRevocationRepository(suite.db)),
+		suite.handler.issuer,
+		repository.NewLoginThrottleRepository(suite.db),
+		"Test App",
+	)
+	router := gin.New()
+	router.POST("/mfa/verify", replica.Verify)
+
+	body, _ := json.Marshal(models.MFAVerifyRequest{MFAToken: mfaToken, Code: "000000"})
+	for i := 0; i < maxMFAAttempts; i++ {
+		// Alternate between the replicas
+		req := httptest.NewRequest("POST", "/mfa/verify", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		if i%2 == 0 {
+			suite.router.ServeHTTP(w, req)
+		} else {
+			router.ServeHTTP(w, req)
+		}
+		suite.Require().Equal(http.StatusUnauthorized, w.Code)
+	}
+
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: mfaToken, Code: suite.currentCode(secret)})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAVerify_RequiresCode() {
+	suite.enrollTOTP("nocode@example.com")
+
+	w := suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("nocode@example.com")})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestBeginTOTP_AlreadyEnabled() {
+	registered, _, _ := suite.enrollTOTP("twice@example.com")
+
+	w := suite.authedRequest("POST", "/me/mfa/totp", registered.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestMFAStatus() {
+	registered, _, recoveryCodes := suite.enrollTOTP("status@example.com")
+	suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("status@example.com"), RecoveryCode: recoveryCodes[0]})
+
+	w := suite.authedRequest("GET", "/me/mfa", registered.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var status models.MFAStatusResponse
+	json.Unmarshal(w.Body.Bytes(), &status)
+	assert.True(suite.T(), status.TOTPEnabled)
+	assert.Equal(suite.T(), auth.RecoveryCodeCount-1, status.RecoveryCodesRemaining)
+}
+
+func (suite *AuthHandlerTestSuite) TestDisableTOTP() {
+	registered, _, recoveryCodes := suite.enrollTOTP("disable@example.com")
+
+	wrong, _ := json.Marshal(models.MFACodeRequest{Code: "000000"})
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.authedRequest("DELETE", "/me/mfa/totp", registered.Token, wrong).Code)
+
+	body, _ := json.Marshal(models.MFACodeRequest{Code: recoveryCodes[0]})
+	w := suite.authedRequest("DELETE", "/me/mfa/totp", registered.Token, body)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "disable@example.com", Password: "password123"})
+	var response models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotEmpty(suite.T(), response.Token, "Login should no longer require a second factor")
+}
+
+func (suite *AuthHandlerTestSuite) TestRegenerateRecoveryCodes_InvalidatesOldCodes() {
+	registered, secret, oldCodes := suite.enrollTOTP("regenerate@example.com")
+
+	body, _ := json.Marshal(models.MFACodeRequest{Code: suite.currentCode(secret)})
+	w := suite.authedRequest("POST", "/me/mfa/recovery-codes", registered.Token, body)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var recovery models.RecoveryCodesResponse
+	json.Unmarshal(w.Body.Bytes(), &recovery)
+	assert.Len(suite.T(), recovery.RecoveryCodes, auth.RecoveryCodeCount)
+
+	w = suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("regenerate@example.com"), RecoveryCode: oldCodes[0]})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w = suite.postJSON("/mfa/verify", models.MFAVerifyRequest{MFAToken: suite.loginForMFA("regenerate@example.com"), RecoveryCode: recovery.RecoveryCodes[0]})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
@@ -1,41 +1,377 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddlewareConfig holds the checks AuthMiddleware applies after a
+// token's signature and expiry have been verified.
+type AuthMiddlewareConfig struct {
+	// Revocations rejects tokens that have been logged out. Nil disables the check.
+	Revocations *auth.RevocationStore
+
+	// RequireVerifiedEmail rejects users who have not verified their email
+	// address yet.
+	RequireVerifiedEmail bool
+
+	// Purpose is the purpose tokens must carry. Empty accepts only ordinary
+	// access tokens.
+	Purpose string
+
+	// PersonalAccessTokens accepts personal access tokens as well as JWTs.
+	// Nil accepts only JWTs. Leave it nil when Purpose is set.
+	PersonalAccessTokens *PersonalAccessTokenVerifier
+
+	// ServiceAccounts accepts tokens issued to service accounts, checking
+	// that the account has not been disabled since. Nil rejects them. Their
+	// claims have no UserID, so only set it for routes guarded by
+	// RequirePermission.
+	ServiceAccounts *repository.ServiceAccountRepository
+
+	// Cookies accepts an access token from the access token cookie when the
+	// request has no Authorization header. Routes that accept it must be
+	// behind CSRFProtection.
+	Cookies bool
+}
+
+func AuthMiddleware(cfg AuthMiddlewareConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		var token string
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			// Expected format: "Bearer <token>"
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+				c.Abort()
+				return
+			}
+			token = parts[1]
+		} else if cookie, err := c.Cookie(AccessTokenCookie); cfg.Cookies && err == nil && cookie != "" {
+			token = cookie
+		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
 			return
 		}
 
-		// Expected format: "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+		if cfg.PersonalAccessTokens != nil && auth.IsPersonalAccessToken(token) {
+			pat, claims, err := cfg.PersonalAccessTokens.Verify(c.Request.Context(), token)
+			if err != nil {
+				log.Printf("Error verifying personal access token: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+				c.Abort()
+				return
+			}
+			if pat == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				c.Abort()
+				return
+			}
+			c.Set("personalAccessTokenID", pat.ID)
+			authenticated(c, cfg, claims)
 			return
 		}
 
-		token := parts[1]
 		claims, err := auth.ValidateToken(token)
-		if err != nil {
+		if err != nil || !acceptable(cfg, claims) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		// Set user info in context
-		c.Set("userID", claims.UserID)
-		c.Set("email", claims.Email)
+		if cfg.Revocations != nil {
+			revoked, err := cfg.Revocations.IsRevoked(c.Request.Context(), claims)
+			if err != nil {
+				log.Printf("Error checking token revocation: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				c.Abort()
+				return
+			}
+		}
+
+		if claims.ServiceAccountID != 0 {
+			authenticatedServiceAccount(c, cfg, claims)
+			return
+		}
+
+		authenticated(c, cfg, claims)
+	}
+}
+
+// acceptable reports whether a validly signed token is one the route takes.
+// Tokens issued for another purpose, such as the MFA step of a login or an ID
+// token, are not access tokens. Neither are tokens meant for another
+// audience, nor ones that name no user or service account.
+func acceptable(cfg AuthMiddlewareConfig, claims *auth.Claims) bool {
+	if claims.Purpose != cfg.Purpose {
+		return false
+	}
+	if cfg.Purpose == "" && len(claims.Audience) > 0 {
+		return false
+	}
+	return claims.UserID != 0 || claims.ServiceAccountID != 0
+}
+
+// authenticatedServiceAccount makes a service account's claims available to
+// handlers, setting "serviceAccountID" rather than "userID".
+func authenticatedServiceAccount(c *gin.Context, cfg AuthMiddlewareConfig, claims *auth.Claims) {
+	if cfg.ServiceAccounts == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed for service accounts"})
+		c.Abort()
+		return
+	}
+
+	account, err := cfg.ServiceAccounts.GetByID(c.Request.Context(), claims.ServiceAccountID)
+	if err != nil {
+		log.Printf("Error getting service account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+		c.Abort()
+		return
+	}
+	if account == nil || account.IsDisabled() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+
+	c.Set("serviceAccountID", account.ID)
+	c.Set("claims", claims)
+
+	c.Next()
+}
+
+// authenticated applies the checks common to every kind of token and makes
+// claims available to handlers.
+func authenticated(c *gin.Context, cfg AuthMiddlewareConfig, claims *auth.Claims) {
+	if cfg.RequireVerifiedEmail && !claims.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		c.Abort()
+		return
+	}
+
+	// Set user info in context
+	c.Set("userID", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("claims", claims)
+
+	c.Next()
+}
+
+// RequireSession rejects requests made with a personal access token, for
+// routes that only a logged in user should reach. It must run after
+// AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("personalAccessTokenID"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed with a personal access token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission rejects requests whose access token does not grant
+// permission. It must run after AuthMiddleware. Permissions are read from the
+// token, so role changes apply once the user's tokens are renewed.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("claims")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.Abort()
+			return
+		}
+
+		if !claims.(*auth.Claims).HasPermission(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireOrgMember resolves the organization in the :orgID parameter and
+// checks that the current user belongs to it, setting "orgID" and "orgRole"
+// for handlers. It must run after AuthMiddleware. Membership is looked up on
+// every request, so removing a member takes effect immediately whatever
+// organization their token claims. Organizations the user does not belong to
+// are reported as not found.
+func RequireOrgMember(orgRepo *repository.OrganizationRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := strconv.Atoi(c.Param("orgID"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			c.Abort()
+			return
+		}
+
+		member, err := orgRepo.GetMember(c.Request.Context(), orgID, c.GetInt("userID"))
+		if err != nil {
+			log.Printf("Error getting organization member: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify organization"})
+			c.Abort()
+			return
+		}
+		if member == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("orgID", member.OrgID)
+		c.Set("orgRole", member.Role)
+
+		c.Next()
+	}
+}
+
+// errRequestFailed rolls back a tenant scope whose handler responded with an
+// error.
+var errRequestFailed = errors.New("request failed")
+
+// TenantScope runs the rest of the request in a database transaction scoped to
+// the current organization and user, so that row-level security hides other
+// organizations' rows from every repository call the handler makes with
+// c.Request.Context(). It must run after RequireOrgMember. The transaction is
+// rolled back if the handler responds with an error status. The handler's
+// response is held back until the transaction has committed, so a failed
+// commit is reported as an error rather than the handler's success.
+func TenantScope(db *database.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := database.Tenant{OrgID: c.GetInt("orgID"), UserID: c.GetInt("userID")}
+		request := c.Request
+		writer := c.Writer
+		buffered := newBufferedResponseWriter(writer)
+
+		err := db.WithTenant(request.Context(), tenant, func(ctx context.Context) error {
+			c.Request = request.WithContext(ctx)
+			c.Writer = buffered
+			c.Next()
+			if c.IsAborted() || buffered.Status() >= http.StatusBadRequest {
+				return errRequestFailed
+			}
+			return nil
+		})
+		c.Request = request
+		c.Writer = writer
+
+		if err != nil && !errors.Is(err, errRequestFailed) {
+			log.Printf("Error in tenant scope: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access organization"})
+			c.Abort()
+			return
+		}
+		buffered.flushTo(writer)
+	}
+}
+
+// bufferedResponseWriter holds a response in memory until flushTo writes it
+// to the underlying writer.
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	header  http.Header
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func newBufferedResponseWriter(w gin.ResponseWriter) *bufferedResponseWriter {
+	return &bufferedResponseWriter{ResponseWriter: w, header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.written
+}
+
+// Flush is a no-op: nothing reaches the client before flushTo.
+func (w *bufferedResponseWriter) Flush() {}
+
+func (w *bufferedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("cannot hijack a buffered response")
+}
+
+func (w *bufferedResponseWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// flushTo writes the buffered response to dst.
+func (w *bufferedResponseWriter) flushTo(dst gin.ResponseWriter) {
+	for key, values := range w.header {
+		dst.Header()[key] = values
+	}
+	dst.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		dst.Write(w.body.Bytes())
+	}
+}
+
+// RequireOrgRole rejects members whose role in the current organization is
+// less privileged than role. It must run after RequireOrgMember.
+func RequireOrgRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.OrgRoleAtLeast(c.GetString("orgRole"), role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient organization role"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/mail"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+)
+
+// Notifier delivers single-use links to users out of band.
+type Notifier interface {
+	SendEmailVerification(ctx context.Context, user *models.User, token string) error
+	SendPasswordReset(ctx context.Context, user *models.User, token string) error
+	// SendEmailChange asks the owner of email to confirm that user's address
+	// should change to it.
+	SendEmailChange(ctx context.Context, user *models.User, email string, token string) error
+	// SendMagicLink sends a login link. user may not have an account yet, in
+	// which case only its Email is set.
+	SendMagicLink(ctx context.Context, user *models.User, token string) error
+	// SendAccountLocked tells a user that failed logins have locked their
+	// account for lockedFor, with a link to unlock it sooner.
+	SendAccountLocked(ctx context.Context, user *models.User, token string, lockedFor time.Duration) error
+	// SendAccountDeleted confirms that user deleted their account, with a
+	// link to restore it during the grace period.
+	SendAccountDeleted(ctx context.Context, user *models.User, token string) error
+	// SendOrgInvitation is sent to an address that may not have an account.
+	SendOrgInvitation(ctx context.Context, invitation *models.OrgInvitation, org *models.Organization, inviter *models.User, token string) error
+}
+
+// MailNotifier emails links rendered from the mail package's templates.
+type MailNotifier struct {
+	mailer    mail.Mailer
+	templates *mail.Templates
+	// baseURL is the frontend URL that links point at.
+	baseURL string
+}
+
+func NewMailNotifier(mailer mail.Mailer, templates *mail.Templates, baseURL string) *MailNotifier {
+	return &MailNotifier{mailer: mailer, templates: templates, baseURL: baseURL}
+}
+
+func (n *MailNotifier) SendEmailVerification(ctx context.Context, user *models.User, token string) error {
+	return n.sendLink(ctx, "email_verification", user, "/verify-email", token, auth.EmailVerificationTTL)
+}
+
+func (n *MailNotifier) SendPasswordReset(ctx context.Context, user *models.User, token string) error {
+	return n.sendLink(ctx, "password_reset", user, "/reset-password", token, auth.PasswordResetTTL)
+}
+
+func (n *MailNotifier) SendEmailChange(ctx context.Context, user *models.User, email string, token string) error {
+	msg, err := n.templates.Render("email_change", email, linkEmail{
+		Name:      displayName(user),
+		Link:      n.baseURL + "/confirm-email-change?token=" + url.QueryEscape(token),
+		ExpiresIn: formatDuration(auth.EmailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+	return n.mailer.Send(ctx, msg)
+}
+
+func (n *MailNotifier) SendMagicLink(ctx context.Context, user *models.User, token string) error {
+	return n.sendLink(ctx, "magic_link", user, "/magic-link", token, auth.MagicLinkTTL)
+}
+
+func (n *MailNotifier) SendAccountLocked(ctx context.Context, user *models.User, token string, lockedFor time.Duration) error {
+	msg, err := n.templates.Render("account_locked", user.Email, lockedEmail{
+		linkEmail: linkEmail{
+			Name:      displayName(user),
+			Link:      n.baseURL + "/unlock-account?token=" + url.QueryEscape(token),
+			ExpiresIn: formatDuration(auth.AccountUnlockTTL),
+		},
+		LockedFor: formatDuration(lockedFor),
+	})
+	if err != nil {
+		return err
+	}
+	return n.mailer.Send(ctx, msg)
+}
+
+func (n *MailNotifier) SendAccountDeleted(ctx context.Context, user *models.User, token string) error {
+	return n.sendLink(ctx, "account_deleted", user, "/restore-account", token, auth.AccountDeletionGracePeriod)
+}
+
+func (n *MailNotifier) SendOrgInvitation(ctx context.Context, invitation *models.OrgInvitation, org *models.Organization, inviter *models.User, token string) error {
+	msg, err := n.templates.Render("org_invitation", invitation.Email, invitationEmail{
+		InviterName: displayName(inviter),
+		OrgName:     org.Name,
+		Role:        invitation.Role,
+		Link:        n.baseURL + "/invitations/accept?token=" + url.QueryEscape(token),
+		ExpiresIn:   formatDuration(auth.OrgInvitationTTL),
+	})
+	if err != nil {
+		return err
+	}
+	return n.mailer.Send(ctx, msg)
+}
+
+// invitationEmail is the data available to the org_invitation template.
+type invitationEmail struct {
+	InviterName string
+	OrgName     string
+	Role        string
+	Link        string
+	ExpiresIn   string
+}
+
+// linkEmail is the data available to link templates.
+type linkEmail struct {
+	Name      string
+	Link      string
+	ExpiresIn string
+}
+
+// lockedEmail is the data available to the account_locked template.
+type lockedEmail struct {
+	linkEmail
+	LockedFor string
+}
+
+func (n *MailNotifier) sendLink(ctx context.Context, template string, user *models.User, path, token string, ttl time.Duration) error {
+	msg, err := n.templates.Render(template, user.Email, linkEmail{
+		Name:      displayName(user),
+		Link:      n.baseURL + path + "?token=" + url.QueryEscape(token),
+		ExpiresIn: formatDuration(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	return n.mailer.Send(ctx, msg)
+}
+
+func displayName(user *models.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	return user.Email
+}
+
+// formatDuration renders a link lifetime for people, e.g. "1 hour" or "30 minutes".
+func formatDuration(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case d >= 48*time.Hour && d%(24*time.Hour) == 0:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d >= time.Hour && d%time.Hour == 0:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(int(d.Round(time.Minute)/time.Minute), "minute")
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/mail"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMailNotifier(t *testing.T) (*MailNotifier, *mail.MemoryMailer) {
+	templates, err := mail.LoadTemplates()
+	require.NoError(t, err)
+
+	mailer := &mail.MemoryMailer{From: "app@example.com"}
+	return NewMailNotifier(mailer, templates, "https://app.example.com"), mailer
+}
+
+func TestMailNotifier_SendEmailVerification(t *testing.T) {
+	notifier, mailer := newTestMailNotifier(t)
+	user := &models.User{Email: "user@example.com", Name: "Ada"}
+
+	err := notifier.SendEmailVerification(context.Background(), user, "token/with+chars")
+
+	require.NoError(t, err)
+	msg, ok := mailer.LastTo("user@example.com")
+	require.True(t, ok)
+	assert.Contains(t, msg.Text, "https://app.example.com/verify-email?token=token%2Fwith%2Bchars")
+	assert.Contains(t, msg.Text, "Hi Ada")
+	assert.NotEmpty(t, msg.HTML)
+}
+
+func TestMailNotifier_SendPasswordReset(t *testing.T) {
+	notifier, mailer := newTestMailNotifier(t)
+	user := &models.User{Email: "user@example.com"}
+
+	err := notifier.SendPasswordReset(context.Background(), user, "reset-token")
+
+	require.NoError(t, err)
+	msg, ok := mailer.LastTo("user@example.com")
+	require.True(t, ok)
+	assert.Contains(t, msg.Text, "https://app.example.com/reset-password?token=reset-token")
+	assert.Contains(t, msg.Text, "Hi user@example.com", "Falls back to the address without a name")
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "1 hour", formatDuration(time.Hour))
+	assert.Equal(t, "24 hours", formatDuration(24*time.Hour))
+	assert.Equal(t, "7 days", formatDuration(7*24*time.Hour))
+	assert.Equal(t, "30 minutes", formatDuration(30*time.Minute))
+	assert.Equal(t, "1 minute", formatDuration(time.Minute))
+}
+
+func TestMailNotifier_SendOrgInvitation(t *testing.T) {
+	notifier, mailer := newTestMailNotifier(t)
+	invitation := &models.OrgInvitation{Email: "invitee@example.com", Role: models.OrgRoleAdmin}
+	org := &models.Organization{Name: "Acme"}
+	inviter := &models.User{Email: "owner@example.com", Name: "Grace"}
+
+	err := notifier.SendOrgInvitation(context.Background(), invitation, org, inviter, "invite-token")
+
+	require.NoError(t, err)
+	msg, ok := mailer.LastTo("invitee@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Grace invited you to join Acme", msg.Subject)
+	assert.Contains(t, msg.Text, "https://app.example.com/invitations/accept?token=invite-token")
+	assert.Contains(t, msg.Text, "as admin")
+	assert.Contains(t, msg.HTML, "<strong>Acme</strong>")
+}
+
+func TestMailNotifier_SendAccountLocked(t *testing.T) {
+	notifier, mailer := newTestMailNotifier(t)
+	user := &models.User{Email: "user@example.com", Name: "Ada"}
+
+	err := notifier.SendAccountLocked(context.Background(), user, "unlock-token", 15*time.Minute)
+
+	require.NoError(t, err)
+	msg, ok := mailer.LastTo("user@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Your account has been locked", msg.Subject)
+	assert.Contains(t, msg.Text, "https://app.example.com/unlock-account?token=unlock-token")
+	assert.Contains(t, msg.Text, "blocked for 15 minutes")
+	assert.Contains(t, msg.HTML, "Unlock my account")
+}
+
+func TestMailNotifier_SendMagicLink(t *testing.T) {
+	notifier, mailer := newTestMailNotifier(t)
+	user := &models.User{Email: "new@example.com"}
+
+	err := notifier.SendMagicLink(context.Background(), user, "login-token")
+
+	require.NoError(t, err)
+	msg, ok := mailer.LastTo("new@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Your login link", msg.Subject)
+	assert.Contains(t, msg.Text, "https://app.example.com/magic-link?token=login-token")
+	assert.Contains(t, msg.Text, "15 minutes")
+}
+
+func TestMailNotifier_SendAccountDeleted(t *testing.T) {
+	notifier, mailer := newTestMailNotifier(t)
+	user := &models.User{Email: "gone@example.com", Name: "Ada"}
+
+	err := notifier.SendAccountDeleted(context.Background(), user, "restore-token")
+
+	require.NoError(t, err)
+	msg, ok := mailer.LastTo("gone@example.com")
+	require.True(t, ok)
+	assert.Contains(t, msg.Text, "https://app.example.com/restore-account?token=restore-token")
+	assert.Contains(t, msg.Text, "30 days")
+}
+
+func TestMailNotifier_SendEmailChange(t *testing.T) {
+	notifier, mailer := newTestMailNotifier(t)
+	user := &models.User{Email: "old@example.com", Name: "Ada"}
+
+	err := notifier.SendEmailChange(context.Background(), user, "new@example.com", "change-token")
+
+	require.NoError(t, err)
+	_, sentToOld := mailer.LastTo("old@example.com")
+	assert.False(t, sentToOld, "The new address is the one to confirm")
+	msg, ok := mailer.LastTo("new@example.com")
+	require.True(t, ok)
+	assert.Contains(t, msg.Text, "https://app.example.com/confirm-email-change?token=change-token")
+	assert.Contains(t, msg.Text, "Hi Ada")
+}
@@ -0,0 +1,449 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oauthAuthorizationRequestTTL is how long the user has to log in and consent
+// after a client sends them to the authorization endpoint.
+const oauthAuthorizationRequestTTL = 10 * time.Minute
+
+// Scopes this provider understands. Others are ignored.
+const (
+	scopeOpenID  = "openid"
+	scopeEmail   = "email"
+	scopeProfile = "profile"
+)
+
+var supportedScopes = []string{scopeOpenID, scopeEmail, scopeProfile}
+
+// OAuthProviderHandler makes this service an OpenID Connect provider for
+// other applications, using the authorization code flow with PKCE.
+//
+// The authorization endpoint does not render any pages. It stores the
+// request and sends the browser to the frontend's consent screen, which logs
+// the user in as usual and approves or denies the request through the API.
+type OAuthProviderHandler struct {
+	oauthRepo   *repository.OAuthRepository
+	userRepo    *repository.UserRepository
+	issuer      string
+	frontendURL string
+}
+
+func NewOAuthProviderHandler(oauthRepo *repository.OAuthRepository, userRepo *repository.UserRepository, issuer, frontendURL string) *OAuthProviderHandler {
+	return &OAuthProviderHandler{
+		oauthRepo:   oauthRepo,
+		userRepo:    userRepo,
+		issuer:      strings.TrimSuffix(issuer, "/"),
+		frontendURL: strings.TrimSuffix(frontendURL, "/"),
+	}
+}
+
+// Discovery serves the provider's OpenID Connect metadata.
+func (h *OAuthProviderHandler) Discovery(c *gin.Context) {
+	alg, err := auth.SigningAlgorithm()
+	if err != nil {
+		log.Printf("Error getting signing algorithm: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing keys"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, oidc.Discovery{
+		Issuer:                            h.issuer,
+		AuthorizationEndpoint:             h.issuer + "/oauth/authorize",
+		TokenEndpoint:                     h.issuer + "/oauth/token",
+		UserinfoEndpoint:                  h.issuer + "/oauth/userinfo",
+		JWKSURI:                           h.issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   supportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{alg},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "email_verified", "name"},
+	})
+}
+
+// Authorize validates a client's authorization request and sends the browser
+// to the consent screen. Errors with the client or redirect URI are shown to
+// the user; any other error is reported back to the client.
+func (h *OAuthProviderHandler) Authorize(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := h.oauthRepo.GetClient(ctx, c.Query("client_id"))
+	if err != nil {
+		log.Printf("Error getting OAuth client: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load client"})
+		return
+	}
+	if client == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown client"})
+		return
+	}
+	redirectURI := c.Query("redirect_uri")
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Redirect URI is not registered for this client"})
+		return
+	}
+
+	state := c.Query("state")
+	redirectError := func(code, description string) {
+		c.Redirect(http.StatusFound, appendQuery(redirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {state},
+		}))
+	}
+
+	if c.Query("response_type") != "code" {
+		redirectError("unsupported_response_type", "Only the code response type is supported")
+		return
+	}
+	scopes := parseScopes(c.Query("scope"))
+	if !slices.Contains(scopes, scopeOpenID) {
+		redirectError("invalid_scope", "The openid scope is required")
+		return
+	}
+	challenge := c.Query("code_challenge")
+	if challenge == "" || c.Query("code_challenge_method") != "S256" {
+		redirectError("invalid_request", "PKCE with the S256 method is required")
+		return
+	}
+
+	requestID, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		redirectError("server_error", "Failed to store the request")
+		return
+	}
+	req := &models.OAuthAuthorizationRequest{
+		RequestID:     requestID,
+		ClientID:      client.ClientID,
+		RedirectURI:   redirectURI,
+		Scope:         strings.Join(scopes, " "),
+		State:         state,
+		Nonce:         c.Query("nonce"),
+		CodeChallenge: challenge,
+	}
+	if err := h.oauthRepo.CreateAuthorizationRequest(ctx, req, oauthAuthorizationRequestTTL); err != nil {
+		log.Printf("Error saving OAuth authorization request: %v", err)
+		redirectError("server_error", "Failed to store the request")
+		return
+	}
+
+	c.Redirect(http.StatusFound, h.frontendURL+"/oauth/consent?"+url.Values{"request": {requestID}}.Encode())
+}
+
+// GetAuthorizationRequest describes a pending request to the consent screen.
+func (h *OAuthProviderHandler) GetAuthorizationRequest(c *gin.Context) {
+	ctx := c.Request.Context()
+	req, err := h.oauthRepo.GetAuthorizationRequest(ctx, c.Param("id"))
+	if err != nil {
+		log.Printf("Error getting OAuth authorization request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load request"})
+		return
+	}
+	if req == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization request not found or expired"})
+		return
+	}
+
+	client, err := h.oauthRepo.GetClient(ctx, req.ClientID)
+	if err != nil || client == nil {
+		log.Printf("Error getting OAuth client %s: %v", req.ClientID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load client"})
+		return
+	}
+
+	granted, err := h.oauthRepo.GetConsent(ctx, c.GetInt("userID"), client.ClientID)
+	if err != nil {
+		log.Printf("Error getting OAuth consent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load request"})
+		return
+	}
+
+	scopes := strings.Fields(req.Scope)
+	consentRequired := false
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			consentRequired = true
+		}
+	}
+
+	c.JSON(http.StatusOK, models.OAuthConsentPrompt{
+		RequestID:       req.RequestID,
+		ClientID:        client.ClientID,
+		ClientName:      client.Name,
+		Scopes:          scopes,
+		ConsentRequired: consentRequired,
+	})
+}
+
+// Approve grants a pending request for the current user and returns the
+// client redirect carrying the authorization code.
+func (h *OAuthProviderHandler) Approve(c *gin.Context) {
+	ctx := c.Request.Context()
+	req, err := h.oauthRepo.ConsumeAuthorizationRequest(ctx, c.Param("id"))
+	if err != nil {
+		log.Printf("Error consuming OAuth authorization request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve request"})
+		return
+	}
+	if req == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization request not found or expired"})
+		return
+	}
+
+	code, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve request"})
+		return
+	}
+	userID := c.GetInt("userID")
+	err = h.oauthRepo.CreateCode(ctx, &models.OAuthAuthorizationCode{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+	}, auth.AuthorizationCodeTTL)
+	if err == nil {
+		err = h.oauthRepo.SaveConsent(ctx, userID, req.ClientID, strings.Fields(req.Scope))
+	}
+	if err != nil {
+		log.Printf("Error approving OAuth authorization request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OAuthRedirectResponse{
+		RedirectTo: appendQuery(req.RedirectURI, url.Values{"code": {code}, "state": {req.State}}),
+	})
+}
+
+// Deny refuses a pending request and returns the client redirect reporting
+// that access was denied.
+func (h *OAuthProviderHandler) Deny(c *gin.Context) {
+	req, err := h.oauthRepo.ConsumeAuthorizationRequest(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("Error consuming OAuth authorization request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deny request"})
+		return
+	}
+	if req == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization request not found or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OAuthRedirectResponse{
+		RedirectTo: appendQuery(req.RedirectURI, url.Values{"error": {"access_denied"}, "state": {req.State}}),
+	})
+}
+
+// Token redeems an authorization code for an ID token and an access token
+// for the userinfo endpoint. Errors follow RFC 6749 section 5.2.
+func (h *OAuthProviderHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	if c.PostForm("grant_type") != "authorization_code" {
+		tokenError(c, http.StatusBadRequest, "unsupported_grant_type", "Only the authorization_code grant is supported")
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	code, err := h.oauthRepo.ConsumeCode(ctx, auth.HashToken(c.PostForm("code")))
+	if err != nil {
+		log.Printf("Error consuming OAuth authorization code: %v", err)
+		tokenError(c, http.StatusInternalServerError, "server_error", "Failed to redeem code")
+		return
+	}
+	if code == nil || code.ClientID != client.ClientID || code.RedirectURI != c.PostForm("redirect_uri") {
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "Invalid or expired code")
+		return
+	}
+	verifier := c.PostForm("code_verifier")
+	if subtle.ConstantTimeCompare([]byte(oidc.CodeChallengeS256(verifier)), []byte(code.CodeChallenge)) != 1 {
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "Code verifier does not match")
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, code.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		tokenError(c, http.StatusInternalServerError, "server_error", "Failed to redeem code")
+		return
+	}
+	if user == nil {
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "Invalid or expired code")
+		return
+	}
+
+	registered := jwt.RegisteredClaims{
+		Issuer:   h.issuer,
+		Subject:  strconv.Itoa(user.ID),
+		Audience: jwt.ClaimStrings{client.ClientID},
+	}
+	accessToken, err := auth.SignClaims(auth.Claims{
+		UserID:           user.ID,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerifiedAt != nil,
+		Purpose:          auth.PurposeOAuthAccess,
+		Scope:            code.Scope,
+		RegisteredClaims: registered,
+	})
+	if err != nil {
+		log.Printf("Error signing OAuth access token: %v", err)
+		tokenError(c, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
+		return
+	}
+
+	scopes := strings.Fields(code.Scope)
+	idClaims := auth.IDTokenClaims{Nonce: code.Nonce, RegisteredClaims: registered}
+	info := userInfo(user, scopes)
+	idClaims.Email, idClaims.EmailVerified, idClaims.Name = info.Email, info.EmailVerified, info.Name
+	idToken, err := auth.SignIDToken(idClaims)
+	if err != nil {
+		log.Printf("Error signing ID token: %v", err)
+		tokenError(c, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(auth.AccessTokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       code.Scope,
+	})
+}
+
+// UserInfo returns the claims the access token's scopes allow. It must be
+// behind AuthMiddleware accepting PurposeOAuthAccess tokens.
+func (h *OAuthProviderHandler) UserInfo(c *gin.Context) {
+	user, err := h.userRepo.GetByID(c.Request.Context(), c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	c.JSON(http.StatusOK, userInfo(user, strings.Fields(claims.Scope)))
+}
+
+// authenticateClient identifies the client calling the token endpoint by
+// HTTP Basic credentials or form parameters. Public clients send only their
+// client ID. It writes the error response itself when authentication fails.
+func (h *OAuthProviderHandler) authenticateClient(c *gin.Context) (*models.OAuthClient, bool) {
+	clientID, secret, basic := clientCredentials(c)
+	client, err := h.oauthRepo.GetClient(c.Request.Context(), clientID)
+	if err != nil {
+		log.Printf("Error getting OAuth client: %v", err)
+		tokenError(c, http.StatusInternalServerError, "server_error", "Failed to load client")
+		return nil, false
+	}
+
+	valid := client != nil
+	if valid && !client.IsPublic() {
+		valid = subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.ClientSecretHash)) == 1
+	}
+	if !valid {
+		invalidClient(c, basic)
+		return nil, false
+	}
+
+	return client, true
+}
+
+// userInfo returns the user's claims allowed by scopes.
+func userInfo(user *models.User, scopes []string) models.OAuthUserInfo {
+	info := models.OAuthUserInfo{Subject: strconv.Itoa(user.ID)}
+	if slices.Contains(scopes, scopeEmail) {
+		verified := user.EmailVerifiedAt != nil
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+	if slices.Contains(scopes, scopeProfile) {
+		info.Name = user.Name
+	}
+	return info
+}
+
+// parseScopes returns the supported scopes in a space-separated scope
+// parameter, in a canonical order and without duplicates.
+func parseScopes(scope string) []string {
+	requested := strings.Fields(scope)
+	scopes := []string{}
+	for _, supported := range supportedScopes {
+		if slices.Contains(requested, supported) {
+			scopes = append(scopes, supported)
+		}
+	}
+	return scopes
+}
+
+// appendQuery adds params to a URL that may already have a query string.
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		if len(values) == 1 && values[0] == "" {
+			continue
+		}
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// clientCredentials returns the client ID and secret sent to the token
+// endpoint, and whether they were sent with HTTP Basic authentication.
+func clientCredentials(c *gin.Context) (clientID, secret string, basic bool) {
+	clientID, secret, basic = c.Request.BasicAuth()
+	if basic {
+		// Credentials are form-encoded before Basic encoding (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+		return clientID, secret, true
+	}
+	return c.PostForm("client_id"), c.PostForm("client_secret"), false
+}
+
+// invalidClient rejects a client whose credentials are wrong.
+func invalidClient(c *gin.Context, basic bool) {
+	if basic {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	tokenError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+}
+
+func tokenError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
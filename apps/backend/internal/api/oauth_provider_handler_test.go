@@ -0,0 +1,361 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+const testClientRedirect = "https://docs.example.com/callback"
+
+// registerOAuthClient registers a client the way clientctl does and returns
+// its secret, which is empty for public clients.
+func (suite *AuthHandlerTestSuite) registerOAuthClient(clientID string, public bool) string {
+	client := &models.OAuthClient{ClientID: clientID, Name: "Docs", RedirectURIs: []string{testClientRedirect}}
+	secret := ""
+	if !public {
+		secret = "secret-" + clientID
+		client.ClientSecretHash = auth.HashToken(secret)
+	}
+	suite.Require().NoError(repository.NewOAuthRepository(suite.db).CreateClient(suite.ctx, client))
+	return secret
+}
+
+// useAsymmetricSigningKey signs tokens with an Ed25519 key, which relying
+// parties can verify from the JWKS, until the test ends.
+func (suite *AuthHandlerTestSuite) useAsymmetricSigningKey() {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	suite.Require().NoError(err)
+	key, err := auth.ParsePrivateKeyPEM("provider-test", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	suite.Require().NoError(err)
+
+	auth.SetSigningKey(key)
+	suite.T().Cleanup(func() { auth.SetSigningKey(nil) })
+}
+
+// oauthAuthorize sends an authorization request and returns the response
+// without following its redirect.
+func (suite *AuthHandlerTestSuite) oauthAuthorize(params url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/oauth/authorize?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func authorizeParams(clientID, verifier string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {testClientRedirect},
+		"scope":                 {"openid email"},
+		"state":                 {"client-state"},
+		"nonce":                 {"client-nonce"},
+		"code_challenge":        {oidc.CodeChallengeS256(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// consentRequestID returns the request ID from a redirect to the consent
+// screen.
+func (suite *AuthHandlerTestSuite) consentRequestID(w *httptest.ResponseRecorder) string {
+	suite.Require().Equal(http.StatusFound, w.Code, w.Body.String())
+	location, err := url.Parse(w.Header().Get("Location"))
+	suite.Require().NoError(err)
+	suite.Require().Equal("/oauth/consent", location.Path)
+	return location.Query().Get("request")
+}
+
+// approve approves a consent request and returns the client redirect's query.
+func (suite *AuthHandlerTestSuite) approve(requestID, token string) url.Values {
+	w := suite.authedRequest("POST", "/oauth/requests/"+requestID+"/approve", token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var response models.OAuthRedirectResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	redirect, err := url.Parse(response.RedirectTo)
+	suite.Require().NoError(err)
+	return redirect.Query()
+}
+
+func (suite *AuthHandlerTestSuite) redeemCode(form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// authorizationCode runs the flow up to the code for a new user.
+func (suite *AuthHandlerTestSuite) authorizationCode(clientID, email, verifier string) string {
+	registered := suite.register(email, "password123")
+	requestID := suite.consentRequestID(suite.oauthAuthorize(authorizeParams(clientID, verifier)))
+	return suite.approve(requestID, registered.Token).Get("code")
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthDiscovery() {
+	req := httptest.NewRequest("GET", "/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var discovery oidc.Discovery
+	json.Unmarshal(w.Body.Bytes(), &discovery)
+	assert.Equal(suite.T(), suite.server.URL, discovery.Issuer)
+	assert.Equal(suite.T(), suite.server.URL+"/oauth/token", discovery.TokenEndpoint)
+	assert.Equal(suite.T(), []string{"S256"}, discovery.CodeChallengeMethodsSupported)
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthAuthorize_UnknownClient() {
+	w := suite.oauthAuthorize(authorizeParams("unknown", "verifier"))
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthAuthorize_UnregisteredRedirectURI() {
+	suite.registerOAuthClient("docs", false)
+	params := authorizeParams("docs", "verifier")
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+
+	w := suite.oauthAuthorize(params)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Empty(suite.T(), w.Header().Get("Location"))
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthAuthorize_RequiresPKCE() {
+	suite.registerOAuthClient("docs", false)
+	params := authorizeParams("docs", "verifier")
+	params.Del("code_challenge")
+
+	w := suite.oauthAuthorize(params)
+
+	assert.Equal(suite.T(), http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(suite.T(), "docs.example.com", location.Host)
+	assert.Equal(suite.T(), "invalid_request", location.Query().Get("error"))
+	assert.Equal(suite.T(), "client-state", location.Query().Get("state"))
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthAuthorize_RequiresOpenIDScope() {
+	suite.registerOAuthClient("docs", false)
+	params := authorizeParams("docs", "verifier")
+	params.Set("scope", "email")
+
+	w := suite.oauthAuthorize(params)
+
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(suite.T(), "invalid_scope", location.Query().Get("error"))
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthConsent_RememberedForGrantedScopes() {
+	suite.registerOAuthClient("docs", false)
+	registered := suite.register("consent@example.com", "password123")
+
+	requestID := suite.consentRequestID(suite.oauthAuthorize(authorizeParams("docs", "verifier")))
+	w := suite.authedRequest("GET", "/oauth/requests/"+requestID, registered.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var prompt models.OAuthConsentPrompt
+	json.Unmarshal(w.Body.Bytes(), &prompt)
+	assert.Equal(suite.T(), "Docs", prompt.ClientName)
+	assert.Equal(suite.T(), []string{"openid", "email"}, prompt.Scopes)
+	assert.True(suite.T(), prompt.ConsentRequired)
+	suite.approve(requestID, registered.Token)
+
+	requestID = suite.consentRequestID(suite.oauthAuthorize(authorizeParams("docs", "verifier")))
+	w = suite.authedRequest("GET", "/oauth/requests/"+requestID, registered.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &prompt)
+	assert.False(suite.T(), prompt.ConsentRequired)
+
+	// Asking for more than was granted asks again
+	params := authorizeParams("docs", "verifier")
+	params.Set("scope", "openid email profile")
+	requestID = suite.consentRequestID(suite.oauthAuthorize(params))
+	w = suite.authedRequest("GET", "/oauth/requests/"+requestID, registered.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &prompt)
+	assert.True(suite.T(), prompt.ConsentRequired)
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthDeny() {
+	suite.registerOAuthClient("docs", false)
+	registered := suite.register("deny@example.com", "password123")
+	requestID := suite.consentRequestID(suite.oauthAuthorize(authorizeParams("docs", "verifier")))
+
+	w := suite.authedRequest("POST", "/oauth/requests/"+requestID+"/deny", registered.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var response models.OAuthRedirectResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), testClientRedirect+"?error=access_denied&state=client-state", response.RedirectTo)
+
+	// The request is answered and cannot be approved afterwards
+	w = suite.authedRequest("POST", "/oauth/requests/"+requestID+"/approve", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthToken_CodeSingleUse() {
+	secret := suite.registerOAuthClient("docs", false)
+	code := suite.authorizationCode("docs", "single-use@example.com", "verifier")
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testClientRedirect},
+		"code_verifier": {"verifier"},
+		"client_id":     {"docs"},
+		"client_secret": {secret},
+	}
+
+	w := suite.redeemCode(form)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(suite.T(), "no-store", w.Header().Get("Cache-Control"))
+
+	w = suite.redeemCode(form)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.JSONEq(suite.T(), `{"error":"invalid_grant","error_description":"Invalid or expired code"}`, w.Body.String())
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthToken_WrongVerifier() {
+	secret := suite.registerOAuthClient("docs", false)
+	code := suite.authorizationCode("docs", "pkce@example.com", "verifier")
+	w := suite.redeemCode(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testClientRedirect},
+		"code_verifier": {"other-verifier"},
+		"client_id":     {"docs"},
+		"client_secret": {secret},
+	})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "invalid_grant")
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthToken_WrongSecret() {
+	suite.registerOAuthClient("docs", false)
+	code := suite.authorizationCode("docs", "wrong-secret@example.com", "verifier")
+
+	w := suite.redeemCode(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testClientRedirect},
+		"code_verifier": {"verifier"},
+		"client_id":     {"docs"},
+		"client_secret": {"guess"},
+	})
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "invalid_client")
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthToken_CodeBelongsToClient() {
+	suite.registerOAuthClient("docs", false)
+	suite.registerOAuthClient("spa", true)
+	code := suite.authorizationCode("docs", "mixup-client@example.com", "verifier")
+
+	w := suite.redeemCode(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testClientRedirect},
+		"code_verifier": {"verifier"},
+		"client_id":     {"spa"},
+	})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "invalid_grant")
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthToken_NotAnAccessToken() {
+	suite.registerOAuthClient("spa", true)
+	code := suite.authorizationCode("spa", "scoped@example.com", "verifier")
+	w := suite.redeemCode(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testClientRedirect},
+		"code_verifier": {"verifier"},
+		"client_id":     {"spa"},
+	})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var tokens models.OAuthTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+
+	// Tokens issued to other apps only work at the userinfo endpoint
+	w = suite.authedRequest("GET", "/me", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	registered := suite.register("not-oauth@example.com", "password123")
+	w = suite.authedRequest("GET", "/oauth/userinfo", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOAuthToken_IDTokenNotAnAccessToken() {
+	suite.registerOAuthClient("idtoken", true)
+	code := suite.authorizationCode("idtoken", "idtoken@example.com", "verifier")
+	w := suite.redeemCode(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testClientRedirect},
+		"code_verifier": {"verifier"},
+		"client_id":     {"idtoken"},
+	})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var tokens models.OAuthTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	suite.Require().NotEmpty(tokens.IDToken)
+
+	w = suite.authedRequest("GET", "/me", tokens.IDToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, "ID tokens handed to other apps are not access tokens")
+	w = suite.authedRequest("GET", "/oauth/userinfo", tokens.IDToken, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+// TestOAuthProvider_RelyingParty logs a user in to another app using this
+// package's own relying party client against the provider over HTTP.
+func (suite *AuthHandlerTestSuite) TestOAuthProvider_RelyingParty() {
+	suite.useAsymmetricSigningKey()
+	secret := suite.registerOAuthClient("docs", false)
+	registered := suite.register("sso@example.com", "password123")
+	client := oidc.NewClient(oidc.Config{
+		Name:         "backend",
+		Issuer:       suite.server.URL,
+		ClientID:     "docs",
+		ClientSecret: secret,
+		RedirectURL:  testClientRedirect,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, nil)
+	verifier, err := oidc.NewCodeVerifier()
+	suite.Require().NoError(err)
+
+	authURL, err := client.AuthCodeURL(suite.ctx, "rp-state", "rp-nonce", oidc.CodeChallengeS256(verifier))
+	suite.Require().NoError(err)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, httptest.NewRequest("GET", strings.TrimPrefix(authURL, suite.server.URL), nil))
+	callback := suite.approve(suite.consentRequestID(w), registered.Token)
+	suite.Require().Equal("rp-state", callback.Get("state"))
+
+	tokens, err := client.Exchange(suite.ctx, callback.Get("code"), verifier)
+	suite.Require().NoError(err)
+	idToken, err := client.VerifyIDToken(suite.ctx, tokens.IDToken, "rp-nonce")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "sso@example.com", idToken.Email)
+	assert.False(suite.T(), idToken.EmailVerified)
+	assert.Equal(suite.T(), "Test User", idToken.Name)
+
+	w = suite.authedRequest("GET", "/oauth/userinfo", tokens.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+	var info models.OAuthUserInfo
+	json.Unmarshal(w.Body.Bytes(), &info)
+	assert.Equal(suite.T(), idToken.Subject, info.Subject)
+	assert.Equal(suite.T(), "sso@example.com", info.Email)
+}
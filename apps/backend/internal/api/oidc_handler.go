@@ -0,0 +1,367 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// oidcAuthRequestTTL is how long the user has to authenticate at the provider.
+const oidcAuthRequestTTL = 10 * time.Minute
+
+// OIDCHandler logs users in with external OpenID Connect providers and links
+// provider accounts to existing users.
+//
+// A first login with a provider account is matched to an existing user by
+// email address only when the provider is configured to allow it, the
+// provider asserts the address is verified, and the user has verified it
+// too. Otherwise the user must log in and link the provider explicitly.
+type OIDCHandler struct {
+	providers    map[string]*oidc.Client
+	userRepo     *repository.UserRepository
+	identityRepo *repository.IdentityRepository
+	issuer       *TokenIssuer
+
+	// sendVerification emails a verification link to an account created
+	// with an address the provider did not verify.
+	sendVerification func(ctx context.Context, user *models.User) error
+}
+
+func NewOIDCHandler(
+	providers []*oidc.Client,
+	userRepo *repository.UserRepository,
+	identityRepo *repository.IdentityRepository,
+	issuer *TokenIssuer,
+	sendVerification func(ctx context.Context, user *models.User) error,
+) *OIDCHandler {
+	byName := make(map[string]*oidc.Client, len(providers))
+	for _, provider := range providers {
+		byName[provider.Config().Name] = provider
+	}
+
+	return &OIDCHandler{
+		providers:        byName,
+		userRepo:         userRepo,
+		identityRepo:     identityRepo,
+		issuer:           issuer,
+		sendVerification: sendVerification,
+	}
+}
+
+// ListProviders returns the names of the configured providers.
+func (h *OIDCHandler) ListProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// Start begins logging in with a provider.
+func (h *OIDCHandler) Start(c *gin.Context) {
+	h.start(c, nil)
+}
+
+// StartLink begins linking a provider account to the current user.
+func (h *OIDCHandler) StartLink(c *gin.Context) {
+	userID := c.GetInt("userID")
+	h.start(c, &userID)
+}
+
+func (h *OIDCHandler) start(c *gin.Context, userID *int) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+
+	req, err := newOIDCAuthRequest(provider.Config().Name, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	authURL, err := provider.AuthCodeURL(ctx, req.State, req.Nonce, oidc.CodeChallengeS256(req.CodeVerifier))
+	if err != nil {
+		log.Printf("Error building %s authorization URL: %v", req.Provider, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Provider is unavailable"})
+		return
+	}
+	if err := h.identityRepo.CreateAuthRequest(ctx, req, oidcAuthRequestTTL); err != nil {
+		log.Printf("Error saving OIDC auth request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OIDCStartResponse{AuthorizationURL: authURL})
+}
+
+// Callback completes a login or link with the code the provider sent back to
+// the frontend.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+	name := provider.Config().Name
+
+	ctx := c.Request.Context()
+	stored, err := h.identityRepo.ConsumeAuthRequest(ctx, name, req.State)
+	if err != nil {
+		log.Printf("Error consuming OIDC auth request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if stored == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired state"})
+		return
+	}
+
+	token, err := provider.Exchange(ctx, req.Code, stored.CodeVerifier)
+	if err != nil {
+		log.Printf("Error exchanging %s authorization code: %v", name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication with provider failed"})
+		return
+	}
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, stored.Nonce)
+	if err != nil {
+		log.Printf("Error verifying %s ID token: %v", name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication with provider failed"})
+		return
+	}
+
+	identity, err := h.identityRepo.GetByProviderSubject(ctx, name, idToken.Subject)
+	if err != nil {
+		log.Printf("Error getting user identity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	if stored.UserID != nil {
+		h.link(c, *stored.UserID, name, idToken, identity)
+		return
+	}
+	if identity != nil {
+		h.login(c, identity, idToken)
+		return
+	}
+	h.firstLogin(c, provider.Config(), idToken)
+}
+
+// link attaches the provider account to the user who started the flow.
+func (h *OIDCHandler) link(c *gin.Context, userID int, provider string, idToken *oidc.IDToken, identity *models.UserIdentity) {
+	if identity != nil {
+		if identity.UserID != userID {
+			c.JSON(http.StatusConflict, gin.H{"error": "This account is already linked to another user"})
+			return
+		}
+		c.JSON(http.StatusOK, identity)
+		return
+	}
+
+	identity = &models.UserIdentity{UserID: userID, Provider: provider, Subject: idToken.Subject, Email: idToken.Email}
+	if err := h.identityRepo.Create(c.Request.Context(), identity); err != nil {
+		if errors.Is(err, repository.ErrIdentityAlreadyLinked) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This account is already linked to another user"})
+			return
+		}
+		log.Printf("Error creating user identity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, identity)
+}
+
+// login logs in the user a known provider account is linked to. A second
+// factor is still required if the user has one.
+func (h *OIDCHandler) login(c *gin.Context, identity *models.UserIdentity, idToken *oidc.IDToken) {
+	ctx := c.Request.Context()
+	user, err := h.userRepo.GetByID(ctx, identity.UserID)
+	if err != nil || user == nil {
+		log.Printf("Error getting user %d for identity %d: %v", identity.UserID, identity.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	if err := h.identityRepo.RecordLogin(ctx, identity.ID, idToken.Email); err != nil {
+		log.Printf("Error updating user identity: %v", err)
+	}
+
+	h.issuer.Login(c, user)
+}
+
+// firstLogin handles a provider account that is not linked to any user: it
+// is linked to the existing account with the same address if that is
+// allowed, or used to create a new passwordless account.
+func (h *OIDCHandler) firstLogin(c *gin.Context, cfg oidc.Config, idToken *oidc.IDToken) {
+	if idToken.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider did not share an email address"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	existingUser, err := h.userRepo.GetByEmail(ctx, idToken.Email)
+	if err != nil {
+		log.Printf("Error checking existing user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+		return
+	}
+
+	identity := &models.UserIdentity{Provider: cfg.Name, Subject: idToken.Subject, Email: idToken.Email}
+
+	if existingUser != nil {
+		if !cfg.LinkByEmail || !idToken.EmailVerified || existingUser.EmailVerifiedAt == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Log in and link this provider from your account settings"})
+			return
+		}
+
+		identity.UserID = existingUser.ID
+		if err := h.identityRepo.Create(ctx, identity); err != nil {
+			if errors.Is(err, repository.ErrIdentityAlreadyLinked) {
+				c.JSON(http.StatusConflict, gin.H{"error": "This account is already linked to another user"})
+				return
+			}
+			log.Printf("Error creating user identity: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+		h.issuer.Login(c, existingUser)
+		return
+	}
+
+	name := idToken.Name
+	if name == "" {
+		name = idToken.Email
+	}
+	user := &models.User{Email: idToken.Email, Name: name}
+	// A deleted account keeps its address until it is purged
+	err = h.identityRepo.CreateUserWithIdentity(ctx, user, idToken.EmailVerified, identity)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating OIDC user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := h.sendVerification(ctx, user); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+	}
+
+	response, err := h.issuer.Issue(c, user, nil)
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.issuer.Respond(c, http.StatusCreated, response)
+}
+
+// ListIdentities returns the provider accounts linked to the current user.
+func (h *OIDCHandler) ListIdentities(c *gin.Context) {
+	identities, err := h.identityRepo.ListByUser(c.Request.Context(), c.GetInt("userID"))
+	if err != nil {
+		log.Printf("Error listing user identities: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list linked accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// DeleteIdentity unlinks one of the current user's provider accounts, unless
+// it is the only way left to log in to the account.
+func (h *OIDCHandler) DeleteIdentity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Linked account not found"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := c.GetInt("userID")
+	methods, err := h.userRepo.LoginMethods(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting login methods: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if methods == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !methods.Password && methods.Passkeys == 0 {
+		identities, err := h.identityRepo.ListByUser(ctx, userID)
+		if err != nil {
+			log.Printf("Error listing user identities: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+			return
+		}
+		if len(identities) == 1 && identities[0].ID == id {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot unlink the only way to log in to this account"})
+			return
+		}
+	}
+
+	deleted, err := h.identityRepo.Delete(ctx, userID, id)
+	if err != nil {
+		log.Printf("Error deleting user identity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Linked account not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func newOIDCAuthRequest(provider string, userID *int) (*models.OIDCAuthRequest, error) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OIDCAuthRequest{
+		State:        state,
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userID,
+	}, nil
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testOIDCProviders configures the fake provider twice: as "test", which may
+// link accounts by verified email, and as "strict", which may not.
+func testOIDCProviders(provider *oidctest.Provider) []*oidc.Client {
+	newClient := func(name string, linkByEmail bool) *oidc.Client {
+		return oidc.NewClient(oidc.Config{
+			Name:         name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  "http://localhost:3000/auth/callback/" + name,
+			LinkByEmail:  linkByEmail,
+		}, nil)
+	}
+	return []*oidc.Client{newClient("test", true), newClient("strict", false)}
+}
+
+// useProviderAccount sets the account the fake provider logs in as.
+func (suite *AuthHandlerTestSuite) useProviderAccount(subject, email string, verified bool) {
+	suite.provider.Subject = subject
+	suite.provider.Email = email
+	suite.provider.EmailVerified = verified
+}
+
+// oidcAuthorize starts a flow with the provider, authenticates at the fake
+// provider and returns the callback parameters.
+func (suite *AuthHandlerTestSuite) oidcAuthorize(start *httptest.ResponseRecorder) models.OIDCCallbackRequest {
+	suite.Require().Equal(http.StatusOK, start.Code, start.Body.String())
+	var response models.OIDCStartResponse
+	suite.Require().NoError(json.Unmarshal(start.Body.Bytes(), &response))
+
+	code, state, err := suite.provider.Authorize(response.AuthorizationURL)
+	suite.Require().NoError(err)
+	return models.OIDCCallbackRequest{Code: code, State: state}
+}
+
+func (suite *AuthHandlerTestSuite) oidcLogin(provider string) *httptest.ResponseRecorder {
+	callback := suite.oidcAuthorize(suite.postJSON("/oidc/"+provider+"/start", nil))
+	return suite.postJSON("/oidc/"+provider+"/callback", callback)
+}
+
+func (suite *AuthHandlerTestSuite) oidcLink(provider, token string) *httptest.ResponseRecorder {
+	callback := suite.oidcAuthorize(suite.authedRequest("POST", "/oidc/"+provider+"/link/start", token, nil))
+	return suite.postJSON("/oidc/"+provider+"/callback", callback)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCListProviders() {
+	req := httptest.NewRequest("GET", "/oidc/providers", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"providers":["strict","test"]}`, w.Body.String())
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCStart_UnknownProvider() {
+	w := suite.postJSON("/oidc/unknown/start", nil)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_CreatesAccount() {
+	suite.useProviderAccount("new-subject", "social@example.com", true)
+
+	w := suite.oidcLogin("test")
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code, w.Body.String())
+	var created models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.NotEmpty(suite.T(), created.Token)
+	assert.Equal(suite.T(), "social@example.com", created.User.Email)
+	assert.NotNil(suite.T(), created.User.EmailVerifiedAt, "The provider verified the address")
+	assert.Empty(suite.T(), suite.notifier.verificationToken("social@example.com"))
+
+	// Later logins find the same account
+	w = suite.oidcLogin("test")
+	assert.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+	var again models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &again)
+	assert.Equal(suite.T(), created.User.ID, again.User.ID)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_UnverifiedProviderEmail() {
+	suite.useProviderAccount("unverified-subject", "unverified-social@example.com", false)
+
+	w := suite.oidcLogin("test")
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code, w.Body.String())
+	var created models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Nil(suite.T(), created.User.EmailVerifiedAt)
+	assert.NotEmpty(suite.T(), suite.notifier.verificationToken("unverified-social@example.com"))
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_NoEmail() {
+	suite.useProviderAccount("no-email-subject", "", false)
+
+	w := suite.oidcLogin("test")
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_LinksVerifiedAccountByEmail() {
+	registered := suite.register("linkme@example.com", "password123")
+	suite.Require().Equal(http.StatusOK, suite.verifyEmail(suite.notifier.verificationToken("linkme@example.com")).Code)
+	suite.useProviderAccount("link-subject", "linkme@example.com", true)
+
+	w := suite.oidcLogin("test")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+	var response models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), registered.User.ID, response.User.ID)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_DoesNotLinkUnverifiedAccount() {
+	suite.register("unverified-local@example.com", "password123")
+	suite.useProviderAccount("takeover-subject", "unverified-local@example.com", true)
+
+	w := suite.oidcLogin("test")
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_DoesNotLinkUnverifiedProviderEmail() {
+	suite.register("verified-local@example.com", "password123")
+	suite.Require().Equal(http.StatusOK, suite.verifyEmail(suite.notifier.verificationToken("verified-local@example.com")).Code)
+	suite.useProviderAccount("takeover-subject", "verified-local@example.com", false)
+
+	w := suite.oidcLogin("test")
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_StrictProviderDoesNotLinkByEmail() {
+	suite.register("strict@example.com", "password123")
+	suite.Require().Equal(http.StatusOK, suite.verifyEmail(suite.notifier.verificationToken("strict@example.com")).Code)
+	suite.useProviderAccount("strict-subject", "strict@example.com", true)
+
+	w := suite.oidcLogin("strict")
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCCallback_StateSingleUse() {
+	suite.useProviderAccount("replay-subject", "replay@example.com", true)
+	callback := suite.oidcAuthorize(suite.postJSON("/oidc/test/start", nil))
+
+	w := suite.postJSON("/oidc/test/callback", callback)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	w = suite.postJSON("/oidc/test/callback", callback)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCCallback_StateBelongsToProvider() {
+	suite.useProviderAccount("mixup-subject", "mixup@example.com", true)
+	callback := suite.oidcAuthorize(suite.postJSON("/oidc/test/start", nil))
+
+	w := suite.postJSON("/oidc/strict/callback", callback)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCCallback_InvalidCode() {
+	suite.useProviderAccount("bad-code-subject", "bad-code@example.com", true)
+	callback := suite.oidcAuthorize(suite.postJSON("/oidc/test/start", nil))
+	callback.Code = "not-a-code"
+
+	w := suite.postJSON("/oidc/test/callback", callback)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLink_ToCurrentUser() {
+	registered := suite.register("linker@example.com", "password123")
+	suite.useProviderAccount("linker-subject", "different@example.com", false)
+
+	w := suite.oidcLink("strict", registered.Token)
+	assert.Equal(suite.T(), http.StatusCreated, w.Code, w.Body.String())
+
+	w = suite.authedRequest("GET", "/identities", registered.Token, nil)
+	var identities []models.UserIdentity
+	json.Unmarshal(w.Body.Bytes(), &identities)
+	suite.Require().Len(identities, 1)
+	assert.Equal(suite.T(), "strict", identities[0].Provider)
+
+	w = suite.oidcLogin("strict")
+	assert.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+	var response models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), registered.User.ID, response.User.ID)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLink_AlreadyLinkedToOtherUser() {
+	suite.useProviderAccount("shared-subject", "shared@example.com", true)
+	suite.Require().Equal(http.StatusCreated, suite.oidcLogin("test").Code)
+	other := suite.register("other-linker@example.com", "password123")
+
+	w := suite.oidcLink("test", other.Token)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOIDCLogin_RequiresSecondFactor() {
+	registered, _, _ := suite.enrollTOTP("oidc-mfa@example.com")
+	suite.useProviderAccount("mfa-subject", "oidc-mfa@example.com", true)
+	suite.Require().Equal(http.StatusCreated, suite.oidcLink("test", registered.Token).Code)
+
+	w := suite.oidcLogin("test")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var challenge models.MFAChallengeResponse
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	assert.True(suite.T(), challenge.MFARequired)
+}
+
+func (suite *AuthHandlerTestSuite) TestDeleteIdentity_KeepsOnlyLoginMethod() {
+	suite.useProviderAccount("only-subject", "only-identity@example.com", true)
+	w := suite.oidcLogin("test")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var created models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = suite.authedRequest("GET", "/identities", created.Token, nil)
+	var identities []models.UserIdentity
+	json.Unmarshal(w.Body.Bytes(), &identities)
+	suite.Require().Len(identities, 1)
+
+	w = suite.authedRequest("DELETE", fmt.Sprintf("/identities/%d", identities[0].ID), created.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestDeleteIdentity_WithPassword() {
+	registered := suite.register("unlink@example.com", "password123")
+	suite.useProviderAccount("unlink-subject", "unlink@example.com", true)
+	suite.Require().Equal(http.StatusCreated, suite.oidcLink("test", registered.Token).Code)
+
+	w := suite.authedRequest("GET", "/identities", registered.Token, nil)
+	var identities []models.UserIdentity
+	json.Unmarshal(w.Body.Bytes(), &identities)
+	suite.Require().Len(identities, 1)
+
+	w = suite.authedRequest("DELETE", fmt.Sprintf("/identities/%d", identities[0].ID), registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.authedRequest("GET", "/identities", registered.Token, nil)
+	assert.JSONEq(suite.T(), `[]`, w.Body.String())
+}
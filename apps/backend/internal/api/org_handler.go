@@ -0,0 +1,392 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// OrgHandler manages organizations, their members and invitations. Routes
+// under /orgs/:orgID run behind RequireOrgMember, and RequireOrgRole where a
+// single role is enough; checks that depend on the member being acted on are
+// made here.
+type OrgHandler struct {
+	orgRepo  *repository.OrganizationRepository
+	userRepo *repository.UserRepository
+	notifier Notifier
+}
+
+func NewOrgHandler(orgRepo *repository.OrganizationRepository, userRepo *repository.UserRepository, notifier Notifier) *OrgHandler {
+	return &OrgHandler{orgRepo: orgRepo, userRepo: userRepo, notifier: notifier}
+}
+
+// Create creates an organization owned by the current user.
+func (h *OrgHandler) Create(c *gin.Context) {
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org := &models.Organization{Name: req.Name}
+	if err := h.orgRepo.Create(c.Request.Context(), org, c.GetInt("userID")); err != nil {
+		log.Printf("Error creating organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.UserOrganization{Organization: *org, Role: models.OrgRoleOwner})
+}
+
+// List returns the organizations the current user belongs to.
+func (h *OrgHandler) List(c *gin.Context) {
+	orgs, err := h.orgRepo.ListForUser(c.Request.Context(), c.GetInt("userID"))
+	if err != nil {
+		log.Printf("Error listing organizations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+// Get returns the current organization and the user's role in it.
+func (h *OrgHandler) Get(c *gin.Context) {
+	org, ok := h.currentOrg(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserOrganization{Organization: *org, Role: c.GetString("orgRole")})
+}
+
+// Update renames the current organization.
+func (h *OrgHandler) Update(c *gin.Context) {
+	var req models.UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, ok := h.currentOrg(c)
+	if !ok {
+		return
+	}
+
+	org.Name = req.Name
+	if err := h.orgRepo.UpdateName(c.Request.Context(), org); err != nil {
+		log.Printf("Error updating organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserOrganization{Organization: *org, Role: c.GetString("orgRole")})
+}
+
+// Delete deletes the current organization with its memberships and
+// invitations.
+func (h *OrgHandler) Delete(c *gin.Context) {
+	if err := h.orgRepo.Delete(c.Request.Context(), c.GetInt("orgID")); err != nil {
+		log.Printf("Error deleting organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete organization"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListMembers returns the current organization's members.
+func (h *OrgHandler) ListMembers(c *gin.Context) {
+	members, err := h.orgRepo.ListMembers(c.Request.Context(), c.GetInt("orgID"))
+	if err != nil {
+		log.Printf("Error listing organization members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// UpdateMember changes a member's role. The last owner cannot be demoted.
+func (h *OrgHandler) UpdateMember(c *gin.Context) {
+	var req models.UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, ok := h.targetMember(c)
+	if !ok {
+		return
+	}
+
+	_, err := h.orgRepo.UpdateMemberRole(c.Request.Context(), member.OrgID, member.UserID, req.Role)
+	if errors.Is(err, repository.ErrLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An organization must keep at least one owner"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating organization member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	member.Role = req.Role
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember removes a member from the current organization. Any member can
+// leave; removing someone else takes an admin, or an owner to remove an
+// owner. The last owner cannot leave.
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	member, ok := h.targetMember(c)
+	if !ok {
+		return
+	}
+
+	role := c.GetString("orgRole")
+	if member.UserID != c.GetInt("userID") {
+		required := models.OrgRoleAdmin
+		if member.Role == models.OrgRoleOwner {
+			required = models.OrgRoleOwner
+		}
+		if !models.OrgRoleAtLeast(role, required) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient organization role"})
+			return
+		}
+	}
+
+	_, err := h.orgRepo.RemoveMember(c.Request.Context(), member.OrgID, member.UserID)
+	if errors.Is(err, repository.ErrLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An organization must keep at least one owner"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error removing organization member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListInvitations returns the current organization's pending invitations.
+func (h *OrgHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.orgRepo.ListInvitations(c.Request.Context(), c.GetInt("orgID"))
+	if err != nil {
+		log.Printf("Error listing organization invitations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// CreateInvitation emails an invitation to join the current organization.
+// Only owners can invite owners.
+func (h *OrgHandler) CreateInvitation(c *gin.Context) {
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.OrgRoleAtLeast(c.GetString("orgRole"), req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot invite a member with a higher role than your own"})
+		return
+	}
+
+	org, ok := h.currentOrg(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	existing, err := h.userRepo.GetByEmail(ctx, req.Email)
+	if err == nil && existing != nil {
+		var member *models.OrgMember
+		member, err = h.orgRepo.GetMember(ctx, org.ID, existing.ID)
+		if err == nil && member != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Error checking organization membership: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	inviter, err := h.userRepo.GetByID(ctx, c.GetInt("userID"))
+	if err != nil || inviter == nil {
+		log.Printf("Error getting inviting user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+	invitation := &models.OrgInvitation{
+		OrgID:     org.ID,
+		Email:     req.Email,
+		Role:      req.Role,
+		TokenHash: auth.HashToken(token),
+		InvitedBy: &inviter.ID,
+	}
+	if err := h.orgRepo.CreateInvitation(ctx, invitation, auth.OrgInvitationTTL); err != nil {
+		log.Printf("Error creating organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	// The invitation stands even if the email fails; it can be withdrawn and
+	// sent again
+	if err := h.notifier.SendOrgInvitation(ctx, invitation, org, inviter, token); err != nil {
+		log.Printf("Error sending organization invitation: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// DeleteInvitation withdraws a pending invitation.
+func (h *OrgHandler) DeleteInvitation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	deleted, err := h.orgRepo.DeleteInvitation(c.Request.Context(), c.GetInt("orgID"), id)
+	if err != nil {
+		log.Printf("Error deleting organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invitation"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptInvitation adds the current user to the organization they were
+// invited to. The invitation must have been sent to their email address.
+func (h *OrgHandler) AcceptInvitation(c *gin.Context) {
+	var req models.InvitationTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	invitation, err := h.orgRepo.GetInvitationByTokenHash(ctx, auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("Error getting organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	if invitation == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+	if !strings.EqualFold(invitation.Email, c.GetString("email")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This invitation was sent to a different email address"})
+		return
+	}
+
+	accepted, err := h.orgRepo.AcceptInvitation(ctx, invitation, c.GetInt("userID"))
+	if errors.Is(err, repository.ErrAlreadyMember) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already a member of this organization"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error accepting organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	if !accepted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+
+	org, err := h.orgRepo.GetByID(ctx, invitation.OrgID)
+	if err != nil || org == nil {
+		log.Printf("Error getting organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserOrganization{Organization: *org, Role: invitation.Role})
+}
+
+// DeclineInvitation discards an invitation. The token alone is enough, so
+// people without an account can decline.
+func (h *OrgHandler) DeclineInvitation(c *gin.Context) {
+	var req models.InvitationTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.orgRepo.ConsumeInvitation(c.Request.Context(), auth.HashToken(req.Token))
+	if err != nil {
+		log.Printf("Error consuming organization invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline invitation"})
+		return
+	}
+	if invitation == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// currentOrg loads the organization resolved by RequireOrgMember.
+func (h *OrgHandler) currentOrg(c *gin.Context) (*models.Organization, bool) {
+	org, err := h.orgRepo.GetByID(c.Request.Context(), c.GetInt("orgID"))
+	if err != nil {
+		log.Printf("Error getting organization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get organization"})
+		return nil, false
+	}
+	if org == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return nil, false
+	}
+
+	return org, true
+}
+
+// targetMember loads the member in the :userID parameter, writing the error
+// response itself if there is none.
+func (h *OrgHandler) targetMember(c *gin.Context) (*models.OrgMember, bool) {
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return nil, false
+	}
+
+	member, err := h.orgRepo.GetMember(c.Request.Context(), c.GetInt("orgID"), userID)
+	if err != nil {
+		log.Printf("Error getting organization member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get member"})
+		return nil, false
+	}
+	if member == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return nil, false
+	}
+
+	return member, true
+}
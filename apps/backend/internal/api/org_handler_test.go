@@ -0,0 +1,291 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *AuthHandlerTestSuite) createOrg(token, name string) models.UserOrganization {
+	body, _ := json.Marshal(models.CreateOrganizationRequest{Name: name})
+	w := suite.authedRequest("POST", "/orgs", token, body)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	var org models.UserOrganization
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &org))
+	return org
+}
+
+func (suite *AuthHandlerTestSuite) invite(orgID int, token, email, role string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.CreateInvitationRequest{Email: email, Role: role})
+	return suite.authedRequest("POST", fmt.Sprintf("/orgs/%d/invitations", orgID), token, body)
+}
+
+func (suite *AuthHandlerTestSuite) acceptInvitation(token, invitationToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.InvitationTokenRequest{Token: invitationToken})
+	return suite.authedRequest("POST", "/invitations/accept", token, body)
+}
+
+// joinOrg registers a user and adds them to the organization with role by
+// way of an invitation from inviterToken.
+func (suite *AuthHandlerTestSuite) joinOrg(orgID int, inviterToken, email, role string) models.AuthResponse {
+	suite.Require().Equal(http.StatusCreated, suite.invite(orgID, inviterToken, email, role).Code)
+	registered := suite.register(email, "password123")
+	w := suite.acceptInvitation(registered.Token, suite.notifier.invitationToken(email))
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	return registered
+}
+
+func orgPath(orgID int, path string) string {
+	return fmt.Sprintf("/orgs/%d%s", orgID, path)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgCreate() {
+	owner := suite.register("owner@example.com", "password123")
+
+	org := suite.createOrg(owner.Token, "Acme")
+	assert.Equal(suite.T(), "Acme", org.Name)
+	assert.Equal(suite.T(), models.OrgRoleOwner, org.Role)
+
+	w := suite.authedRequest("GET", "/orgs", owner.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var orgs []models.UserOrganization
+	json.Unmarshal(w.Body.Bytes(), &orgs)
+	suite.Require().Len(orgs, 1)
+	assert.Equal(suite.T(), org.ID, orgs[0].ID)
+
+	w = suite.authedRequest("GET", orgPath(org.ID, ""), owner.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrg_NonMemberGetsNotFound() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	outsider := suite.register("outsider@example.com", "password123")
+
+	w := suite.authedRequest("GET", orgPath(org.ID, ""), outsider.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.authedRequest("GET", orgPath(org.ID, "/members"), outsider.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgInvitation_Accept() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	suite.Require().Equal(http.StatusCreated, suite.invite(org.ID, owner.Token, "invitee@example.com", models.OrgRoleMember).Code)
+	token := suite.notifier.invitationToken("invitee@example.com")
+	suite.Require().NotEmpty(token)
+
+	w := suite.authedRequest("GET", orgPath(org.ID, "/invitations"), owner.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var invitations []models.OrgInvitation
+	json.Unmarshal(w.Body.Bytes(), &invitations)
+	suite.Require().Len(invitations, 1)
+	assert.Equal(suite.T(), "invitee@example.com", invitations[0].Email)
+
+	invitee := suite.register("invitee@example.com", "password123")
+	w = suite.acceptInvitation(invitee.Token, token)
+	assert.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+	var joined models.UserOrganization
+	json.Unmarshal(w.Body.Bytes(), &joined)
+	assert.Equal(suite.T(), org.ID, joined.ID)
+	assert.Equal(suite.T(), models.OrgRoleMember, joined.Role)
+
+	w = suite.authedRequest("GET", orgPath(org.ID, "/members"), invitee.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var members []models.OrgMember
+	json.Unmarshal(w.Body.Bytes(), &members)
+	assert.Len(suite.T(), members, 2)
+
+	// Each invitation can be used once
+	w = suite.acceptInvitation(invitee.Token, token)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgInvitation_OtherEmail() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	suite.Require().Equal(http.StatusCreated, suite.invite(org.ID, owner.Token, "invitee@example.com", models.OrgRoleMember).Code)
+	other := suite.register("other@example.com", "password123")
+
+	w := suite.acceptInvitation(other.Token, suite.notifier.invitationToken("invitee@example.com"))
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgInvitation_Decline() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	suite.Require().Equal(http.StatusCreated, suite.invite(org.ID, owner.Token, "invitee@example.com", models.OrgRoleMember).Code)
+	token := suite.notifier.invitationToken("invitee@example.com")
+
+	w := suite.postJSON("/invitations/decline", models.InvitationTokenRequest{Token: token})
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	invitee := suite.register("invitee@example.com", "password123")
+	w = suite.acceptInvitation(invitee.Token, token)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgInvitation_RoleLimits() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	member := suite.joinOrg(org.ID, owner.Token, "member@example.com", models.OrgRoleMember)
+	admin := suite.joinOrg(org.ID, owner.Token, "admin@example.com", models.OrgRoleAdmin)
+
+	w := suite.invite(org.ID, member.Token, "new@example.com", models.OrgRoleMember)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "Members cannot invite")
+
+	w = suite.invite(org.ID, admin.Token, "new@example.com", models.OrgRoleOwner)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "Admins cannot invite owners")
+
+	w = suite.invite(org.ID, admin.Token, "new@example.com", models.OrgRoleAdmin)
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	w = suite.invite(org.ID, owner.Token, "member@example.com", models.OrgRoleMember)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code, "Already a member")
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgMembers_LastOwner() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	ownerPath := orgPath(org.ID, fmt.Sprintf("/members/%d", owner.User.ID))
+
+	w := suite.authedRequest("DELETE", ownerPath, owner.Token, nil)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	body, _ := json.Marshal(models.UpdateMemberRoleRequest{Role: models.OrgRoleMember})
+	w = suite.authedRequest("PATCH", ownerPath, owner.Token, body)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	// With a second owner the first can step down
+	second := suite.joinOrg(org.ID, owner.Token, "second@example.com", models.OrgRoleOwner)
+	w = suite.authedRequest("PATCH", ownerPath, second.Token, body)
+	assert.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgMembers_DeletedOwnerDoesNotCount() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	second := suite.joinOrg(org.ID, owner.Token, "second@example.com", models.OrgRoleOwner)
+	suite.deleteAccount(second.Token, "second@example.com")
+
+	body, _ := json.Marshal(models.UpdateMemberRoleRequest{Role: models.OrgRoleMember})
+	w := suite.authedRequest("PATCH", orgPath(org.ID, fmt.Sprintf("/members/%d", owner.User.ID)), owner.Token, body)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgMembers_Remove() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	admin := suite.joinOrg(org.ID, owner.Token, "admin@example.com", models.OrgRoleAdmin)
+	member := suite.joinOrg(org.ID, owner.Token, "member@example.com", models.OrgRoleMember)
+
+	w := suite.authedRequest("DELETE", orgPath(org.ID, fmt.Sprintf("/members/%d", owner.User.ID)), admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "Admins cannot remove owners")
+
+	w = suite.authedRequest("DELETE", orgPath(org.ID, fmt.Sprintf("/members/%d", admin.User.ID)), member.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "Members cannot remove others")
+
+	w = suite.authedRequest("DELETE", orgPath(org.ID, fmt.Sprintf("/members/%d", member.User.ID)), admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	// Removal applies to the member's existing token straight away
+	w = suite.authedRequest("GET", orgPath(org.ID, ""), member.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	// Members can leave on their own
+	w = suite.authedRequest("DELETE", orgPath(org.ID, fmt.Sprintf("/members/%d", admin.User.ID)), admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestOrgDelete_OwnerOnly() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	admin := suite.joinOrg(org.ID, owner.Token, "admin@example.com", models.OrgRoleAdmin)
+
+	w := suite.authedRequest("DELETE", orgPath(org.ID, ""), admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.authedRequest("DELETE", orgPath(org.ID, ""), owner.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.authedRequest("GET", orgPath(org.ID, ""), owner.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestRefresh_SwitchesOrg() {
+	owner := suite.register("owner@example.com", "password123")
+	org := suite.createOrg(owner.Token, "Acme")
+	other := suite.register("other-owner@example.com", "password123")
+	otherOrg := suite.createOrg(other.Token, "Globex")
+
+	refresh := func(refreshToken string, orgID *int) (int, models.AuthResponse) {
+		w := suite.postJSON("/refresh", models.RefreshRequest{RefreshToken: refreshToken, OrgID: orgID})
+		var response models.AuthResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, switched := refresh(owner.RefreshToken, &org.ID)
+	suite.Require().Equal(http.StatusOK, code)
+	claims, err := auth.ValidateToken(switched.Token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), org.ID, claims.OrgID)
+	assert.Equal(suite.T(), models.OrgRoleOwner, claims.OrgRole)
+
+	// The organization is kept across later refreshes
+	code, kept := refresh(switched.RefreshToken, nil)
+	suite.Require().Equal(http.StatusOK, code)
+	claims, _ = auth.ValidateToken(kept.Token)
+	assert.Equal(suite.T(), org.ID, claims.OrgID)
+
+	code, _ = refresh(kept.RefreshToken, &otherOrg.ID)
+	assert.Equal(suite.T(), http.StatusForbidden, code)
+
+	none := 0
+	code, cleared := refresh(kept.RefreshToken, &none)
+	suite.Require().Equal(http.StatusOK, code)
+	claims, _ = auth.ValidateToken(cleared.Token)
+	assert.Zero(suite.T(), claims.OrgID)
+	assert.Empty(suite.T(), claims.OrgRole)
+}
+
+func TestBufferedResponseWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		writer := c.Writer
+		buffered := newBufferedResponseWriter(writer)
+		c.Writer = buffered
+		c.Next()
+		c.Writer = writer
+
+		assert.Equal(t, http.StatusCreated, buffered.Status())
+		assert.False(t, writer.Written(), "Nothing is written before the flush")
+		assert.Empty(t, w.Body.String())
+		assert.Empty(t, w.Header().Get("Location"))
+		buffered.flushTo(writer)
+	})
+	router.POST("/things", func(c *gin.Context) {
+		c.Header("Location", "/things/1")
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/things", nil))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/things/1", w.Header().Get("Location"))
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"id":1}`, w.Body.String())
+}
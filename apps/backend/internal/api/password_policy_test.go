@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// breachedSet is a corpus of breached passwords held in memory.
+type breachedSet map[string]int
+
+func (s breachedSet) Count(password string) (int, error) {
+	return s[password], nil
+}
+
+// testPasswordPolicy doesn't score strength, so that tests can use simple
+// passwords, but applies every other rule.
+var testPasswordPolicy = &auth.PasswordPolicy{
+	MinLength: 8,
+	MaxBytes:  64,
+	Breached:  breachedSet{"breachedpassword": 42},
+}
+
+// passwordReasons returns the codes of the reasons a password was refused
+func passwordReasons(body []byte) []string {
+	var response struct {
+		Reasons []auth.PasswordViolation `json:"reasons"`
+	}
+	json.Unmarshal(body, &response)
+	var codes []string
+	for _, reason := range response.Reasons {
+		codes = append(codes, reason.Code)
+	}
+	return codes
+}
+
+func (suite *AuthHandlerTestSuite) TestRegister_PasswordPolicy() {
+	tests := []struct {
+		name     string
+		password string
+		reasons  []string
+	}{
+		{"too short", "short", []string{auth.PasswordTooShort}},
+		{"too long", string(make([]byte, 65)), []string{auth.PasswordTooLong}},
+		{"contains email", "policyholder-99", []string{auth.PasswordBannedWord}},
+		{"contains name", "xyz-Testing-99", []string{auth.PasswordBannedWord}},
+		{"breached", "breachedpassword", []string{auth.PasswordBreached}},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			w := suite.postJSON("/register", models.RegisterRequest{
+				Email:    "policyholder@example.com",
+				Password: tt.password,
+				Name:     "Testing Person",
+			})
+
+			assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+			assert.Contains(suite.T(), w.Body.String(), "Password does not meet the requirements")
+			assert.Equal(suite.T(), tt.reasons, passwordReasons(w.Body.Bytes()))
+		})
+	}
+
+	user, err := suite.handler.userRepo.GetByEmail(suite.ctx, "policyholder@example.com")
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), user, "No account is created with a refused password")
+}
+
+func (suite *AuthHandlerTestSuite) TestResetPassword_PasswordPolicy() {
+	suite.register("policyreset@example.com", "password123")
+	token := suite.requestReset("policyreset@example.com")
+
+	w := suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: token, Password: "breachedpassword"})
+	suite.Require().Equal(http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), []string{auth.PasswordBreached}, passwordReasons(w.Body.Bytes()))
+
+	w = suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: token, Password: "policyreset-2"})
+	suite.Require().Equal(http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), []string{auth.PasswordBannedWord}, passwordReasons(w.Body.Bytes()))
+
+	// A refused password doesn't use up the link
+	w = suite.postJSON("/reset-password", models.ResetPasswordRequest{Token: token, Password: "newpassword123"})
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "policyreset@example.com", Password: "newpassword123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
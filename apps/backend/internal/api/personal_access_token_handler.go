@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// personalAccessTokenPrefixLength is how much of a token is stored in the
+// clear to identify it: the fixed prefix and a few random characters.
+const personalAccessTokenPrefixLength = len(auth.PersonalAccessTokenPrefix) + 8
+
+// PersonalAccessTokenHandler lets users manage their personal access tokens.
+// Its routes must be behind RequireSession, so that a leaked token cannot be
+// used to create more.
+type PersonalAccessTokenHandler struct {
+	tokens   *repository.PersonalAccessTokenRepository
+	roleRepo *repository.RoleRepository
+}
+
+func NewPersonalAccessTokenHandler(tokens *repository.PersonalAccessTokenRepository, roleRepo *repository.RoleRepository) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{tokens: tokens, roleRepo: roleRepo}
+}
+
+// List returns the current user's unexpired tokens.
+func (h *PersonalAccessTokenHandler) List(c *gin.Context) {
+	tokens, err := h.tokens.ListForUser(c.Request.Context(), c.GetInt("userID"))
+	if err != nil {
+		log.Printf("Error listing personal access tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Create issues a new token and returns it. This is the only time the token
+// itself is available. Its scopes must be permissions the user holds.
+func (h *PersonalAccessTokenHandler) Create(c *gin.Context) {
+	var req models.CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := c.GetInt("userID")
+
+	permissions, err := h.roleRepo.ListUserPermissions(ctx, userID)
+	if err != nil {
+		log.Printf("Error listing user permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(permissions, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid scope: %s", scope)})
+			return
+		}
+	}
+
+	secret, err := auth.GeneratePersonalAccessToken()
+	if err != nil {
+		log.Printf("Error generating personal access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	token := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    secret[:personalAccessTokenPrefixLength],
+		TokenHash: auth.HashToken(secret),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.tokens.Create(ctx, token); err != nil {
+		log.Printf("Error creating personal access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreatePersonalAccessTokenResponse{PersonalAccessToken: *token, Token: secret})
+}
+
+// Delete revokes one of the current user's tokens. It stops working
+// immediately.
+func (h *PersonalAccessTokenHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	deleted, err := h.tokens.Delete(c.Request.Context(), c.GetInt("userID"), id)
+	if err != nil {
+		log.Printf("Error deleting personal access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete token"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PersonalAccessTokenVerifier lets AuthMiddleware accept personal access
+// tokens. Unlike JWTs they are looked up on every request, so the claims it
+// builds always reflect the user's current account and roles.
+type PersonalAccessTokenVerifier struct {
+	tokens   *repository.PersonalAccessTokenRepository
+	userRepo *repository.UserRepository
+	roleRepo *repository.RoleRepository
+}
+
+func NewPersonalAccessTokenVerifier(tokens *repository.PersonalAccessTokenRepository, userRepo *repository.UserRepository, roleRepo *repository.RoleRepository) *PersonalAccessTokenVerifier {
+	return &PersonalAccessTokenVerifier{tokens: tokens, userRepo: userRepo, roleRepo: roleRepo}
+}
+
+// Verify returns the token and the claims it grants, or nil if the token is
+// unknown or expired. The claims carry only those of the token's scopes that
+// the user still holds, and no other permissions.
+func (v *PersonalAccessTokenVerifier) Verify(ctx context.Context, secret string) (*models.PersonalAccessToken, *auth.Claims, error) {
+	token, err := v.tokens.Use(ctx, auth.HashToken(secret))
+	if err != nil || token == nil {
+		return nil, nil, err
+	}
+
+	user, err := v.userRepo.GetByID(ctx, token.UserID)
+	if err != nil || user == nil {
+		return nil, nil, err
+	}
+
+	roles, err := v.roleRepo.ListUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	held, err := v.roleRepo.ListUserPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	permissions := []string{}
+	for _, scope := range token.Scopes {
+		if slices.Contains(held, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	claims := &auth.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Roles:         roles,
+		Permissions:   permissions,
+	}
+	return token, claims, nil
+}
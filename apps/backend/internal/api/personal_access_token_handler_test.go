@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *AuthHandlerTestSuite) createPersonalAccessToken(token string, req models.CreatePersonalAccessTokenRequest) models.CreatePersonalAccessTokenResponse {
+	body, _ := json.Marshal(req)
+	w := suite.authedRequest("POST", "/me/tokens", token, body)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	var created models.CreatePersonalAccessTokenResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	return created
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_Create() {
+	registered := suite.register("pat@example.com", "password123")
+
+	created := suite.createPersonalAccessToken(registered.Token, models.CreatePersonalAccessTokenRequest{Name: "deploy script"})
+
+	assert.True(suite.T(), strings.HasPrefix(created.Token, auth.PersonalAccessTokenPrefix))
+	assert.True(suite.T(), strings.HasPrefix(created.Token, created.Prefix))
+	assert.Equal(suite.T(), "deploy script", created.Name)
+	assert.Nil(suite.T(), created.ExpiresAt)
+
+	w := suite.authedRequest("GET", "/me/tokens", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), created.Token, "Tokens are only shown once")
+	var tokens []models.PersonalAccessToken
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	suite.Require().Len(tokens, 1)
+	assert.Equal(suite.T(), created.Prefix, tokens[0].Prefix)
+	assert.Nil(suite.T(), tokens[0].LastUsedAt)
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_Authenticates() {
+	registered := suite.register("pat@example.com", "password123")
+	created := suite.createPersonalAccessToken(registered.Token, models.CreatePersonalAccessTokenRequest{Name: "cli"})
+
+	w := suite.authedRequest("GET", "/me", created.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "pat@example.com")
+
+	w = suite.authedRequest("GET", "/me/tokens", registered.Token, nil)
+	var tokens []models.PersonalAccessToken
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	suite.Require().Len(tokens, 1)
+	assert.NotNil(suite.T(), tokens[0].LastUsedAt)
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_CannotManageTokens() {
+	registered := suite.register("pat@example.com", "password123")
+	created := suite.createPersonalAccessToken(registered.Token, models.CreatePersonalAccessTokenRequest{Name: "cli"})
+
+	body, _ := json.Marshal(models.CreatePersonalAccessTokenRequest{Name: "another"})
+	w := suite.authedRequest("POST", "/me/tokens", created.Token, body)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_CannotActAsSession() {
+	registered := suite.register("patsession@example.com", "password123")
+	created := suite.createPersonalAccessToken(registered.Token, models.CreatePersonalAccessTokenRequest{Name: "cli"})
+	org := suite.createOrg(registered.Token, "Acme")
+
+	for _, route := range []struct{ method, path string }{
+		{"PATCH", "/me"},
+		{"POST", "/me/mfa/totp"},
+		{"DELETE", "/me/mfa/totp"},
+		{"POST", "/orgs"},
+		{"PATCH", fmt.Sprintf("/orgs/%d", org.ID)},
+		{"DELETE", fmt.Sprintf("/orgs/%d", org.ID)},
+		{"POST", fmt.Sprintf("/orgs/%d/invitations", org.ID)},
+		{"POST", "/oauth/requests/any/approve"},
+	} {
+		w := suite.authedRequest(route.method, route.path, created.Token, []byte("{}"))
+		assert.Equal(suite.T(), http.StatusForbidden, w.Code, route.method+" "+route.path)
+	}
+
+	w := suite.authedRequest("GET", fmt.Sprintf("/orgs/%d", org.ID), created.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code, "Tokens can still read")
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_Delete() {
+	registered := suite.register("pat@example.com", "password123")
+	created := suite.createPersonalAccessToken(registered.Token, models.CreatePersonalAccessTokenRequest{Name: "cli"})
+	other := suite.register("other@example.com", "password123")
+	path := fmt.Sprintf("/me/tokens/%d", created.ID)
+
+	w := suite.authedRequest("DELETE", path, other.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code, "Other users' tokens are not found")
+
+	w = suite.authedRequest("DELETE", path, registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.authedRequest("GET", "/me", created.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_Expiry() {
+	registered := suite.register("pat@example.com", "password123")
+
+	past := time.Now().Add(-time.Minute)
+	body, _ := json.Marshal(models.CreatePersonalAccessTokenRequest{Name: "cli", ExpiresAt: &past})
+	w := suite.authedRequest("POST", "/me/tokens", registered.Token, body)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	soon := time.Now().Add(time.Hour)
+	created := suite.createPersonalAccessToken(registered.Token, models.CreatePersonalAccessTokenRequest{Name: "cli", ExpiresAt: &soon})
+	suite.Require().NotNil(created.ExpiresAt)
+
+	_, err := suite.db.Pool.Exec(suite.ctx, "UPDATE personal_access_tokens SET expires_at = NOW() - INTERVAL '1 second' WHERE id = $1", created.ID)
+	suite.Require().NoError(err)
+
+	w = suite.authedRequest("GET", "/me", created.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_Scopes() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+
+	unscoped := suite.createPersonalAccessToken(admin.Token, models.CreatePersonalAccessTokenRequest{Name: "unscoped"})
+	w := suite.authedRequest("GET", "/admin/roles", unscoped.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "Tokens only carry the permissions they are scoped to")
+
+	scoped := suite.createPersonalAccessToken(admin.Token, models.CreatePersonalAccessTokenRequest{
+		Name:   "roles",
+		Scopes: []string{auth.PermissionRolesRead},
+	})
+	assert.Equal(suite.T(), []string{auth.PermissionRolesRead}, scoped.Scopes)
+	w = suite.authedRequest("GET", "/admin/roles", scoped.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// Scopes are limited to the user's own permissions
+	user := suite.register("user@example.com", "password123")
+	body, _ := json.Marshal(models.CreatePersonalAccessTokenRequest{Name: "escalate", Scopes: []string{auth.PermissionRolesRead}})
+	w = suite.authedRequest("POST", "/me/tokens", user.Token, body)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_FollowsRoleChanges() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	scoped := suite.createPersonalAccessToken(admin.Token, models.CreatePersonalAccessTokenRequest{
+		Name:   "roles",
+		Scopes: []string{auth.PermissionRolesRead},
+	})
+
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM user_roles WHERE user_id = $1", admin.User.ID)
+	suite.Require().NoError(err)
+
+	w := suite.authedRequest("GET", "/admin/roles", scoped.Token, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPersonalAccessToken_Unknown() {
+	w := suite.authedRequest("GET", "/me", auth.PersonalAccessTokenPrefix+"not-a-real-token", nil)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *AuthHandlerTestSuite) TestUpdateProfile() {
+	registered := suite.register("profile@example.com", "password123")
+
+	body, _ := json.Marshal(map[string]string{"name": "  New Name "})
+	w := suite.authedRequest("PATCH", "/me", registered.Token, body)
+
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var user models.User
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(suite.T(), "New Name", user.Name)
+	assert.False(suite.T(), user.UpdatedAt.Before(registered.User.UpdatedAt))
+
+	w = suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Contains(suite.T(), w.Body.String(), "New Name")
+}
+
+func (suite *AuthHandlerTestSuite) TestUpdateProfile_BlankName() {
+	registered := suite.register("profileblank@example.com", "password123")
+
+	body, _ := json.Marshal(map[string]string{"name": "   "})
+	w := suite.authedRequest("PATCH", "/me", registered.Token, body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestChangePassword() {
+	registered := suite.register("changepw@example.com", "password123")
+	other := suite.loginFrom("changepw@example.com", "curl/8.0", "")
+
+	body, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "newpassword456"})
+	w := suite.authedRequest("POST", "/me/password", registered.Token, body)
+	suite.Require().Equal(http.StatusNoContent, w.Code, w.Body.String())
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "changepw@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, "The old password stops working")
+	w = suite.postJSON("/login", models.LoginRequest{Email: "changepw@example.com", Password: "newpassword456"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code, "The session making the change stays logged in")
+	w = suite.authedRequest("GET", "/me", other.Token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, "Other sessions are ended")
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(other.RefreshToken).Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestChangePassword_RevokesSessionlessTokens() {
+	registered := suite.register("changepwsessionless@example.com", "password123")
+	// As issued to an OAuth client, or before sessions were recorded
+	sessionless, err := auth.SignClaims(auth.Claims{UserID: registered.User.ID, Email: registered.User.Email})
+	suite.Require().NoError(err)
+	w := suite.authedRequest("GET", "/me", sessionless, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	body, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "newpassword456"})
+	w = suite.authedRequest("POST", "/me/password", registered.Token, body)
+	suite.Require().Equal(http.StatusNoContent, w.Code, w.Body.String())
+
+	w = suite.authedRequest("GET", "/me", sessionless, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	w = suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.refresh(registered.RefreshToken).Code, "The current session can still refresh")
+}
+
+func (suite *AuthHandlerTestSuite) TestChangePassword_WrongCurrentPassword() {
+	registered := suite.register("changepwwrong@example.com", "password123")
+
+	body, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: "wrongpassword", NewPassword: "newpassword456"})
+	w := suite.authedRequest("POST", "/me/password", registered.Token, body)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	w = suite.postJSON("/login", models.LoginRequest{Email: "changepwwrong@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestChangePassword_AppliesPolicy() {
+	registered := suite.register("changepwpolicy@example.com", "password123")
+
+	body, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: "password123", NewPassword: "breachedpassword"})
+	w := suite.authedRequest("POST", "/me/password", registered.Token, body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), passwordReasons(w.Body.Bytes()), "breached")
+}
+
+// requestEmailChange asks to move the holder of token to email and returns
+// the confirmation token sent there
+func (suite *AuthHandlerTestSuite) requestEmailChange(token, email string) string {
+	body, _ := json.Marshal(models.ChangeEmailRequest{Email: email, Password: "password123"})
+	w := suite.authedRequest("POST", "/me/email", token, body)
+	suite.Require().Equal(http.StatusAccepted, w.Code, w.Body.String())
+
+	confirmation := suite.notifier.emailChangeToken(email)
+	suite.Require().NotEmpty(confirmation, "The confirmation is sent to the new address")
+	return confirmation
+}
+
+func (suite *AuthHandlerTestSuite) TestChangeEmail() {
+	registered := suite.register("changeemail@example.com", "password123")
+	token := suite.requestEmailChange(registered.Token, "changedemail@example.com")
+
+	w := suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Contains(suite.T(), w.Body.String(), "changeemail@example.com", "Nothing changes until the new address is confirmed")
+
+	w = suite.postJSON("/confirm-email-change", models.ConfirmEmailChangeRequest{Token: token})
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var user models.User
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(suite.T(), "changedemail@example.com", user.Email)
+	assert.NotNil(suite.T(), user.EmailVerifiedAt)
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "changedemail@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.postJSON("/login", models.LoginRequest{Email: "changeemail@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w = suite.postJSON("/confirm-email-change", models.ConfirmEmailChangeRequest{Token: token})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code, "Confirmations are single use")
+}
+
+func (suite *AuthHandlerTestSuite) TestChangeEmail_WrongPassword() {
+	registered := suite.register("changeemailwrong@example.com", "password123")
+
+	body, _ := json.Marshal(models.ChangeEmailRequest{Email: "changedemailwrong@example.com", Password: "wrongpassword"})
+	w := suite.authedRequest("POST", "/me/email", registered.Token, body)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	assert.Empty(suite.T(), suite.notifier.emailChangeToken("changedemailwrong@example.com"))
+}
+
+func (suite *AuthHandlerTestSuite) TestChangeEmail_Taken() {
+	registered := suite.register("changeemailfrom@example.com", "password123")
+	suite.register("changeemailtaken@example.com", "password123")
+
+	body, _ := json.Marshal(models.ChangeEmailRequest{Email: "changeemailtaken@example.com", Password: "password123"})
+	w := suite.authedRequest("POST", "/me/email", registered.Token, body)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestConfirmEmailChange_TakenSinceRequest() {
+	registered := suite.register("changeemailrace@example.com", "password123")
+	token := suite.requestEmailChange(registered.Token, "changeemailraced@example.com")
+	suite.register("changeemailraced@example.com", "password123")
+
+	w := suite.postJSON("/confirm-email-change", models.ConfirmEmailChangeRequest{Token: token})
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	w = suite.authedRequest("GET", "/me", registered.Token, nil)
+	assert.Contains(suite.T(), w.Body.String(), "changeemailrace@example.com")
+}
+
+func (suite *AuthHandlerTestSuite) TestConfirmEmailChange_InvalidToken() {
+	w := suite.postJSON("/confirm-email-change", models.ConfirmEmailChangeRequest{Token: "not-a-real-token"})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
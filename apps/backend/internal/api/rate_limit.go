@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limit stores accepted in Config.RateLimitStore.
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+// RateLimits are the limits SetupRoutes applies. A zero limit is not
+// enforced.
+type RateLimits struct {
+	// Auth applies to each public /auth route, per client IP address.
+	Auth ratelimit.Limit
+	// Register applies to creating accounts, per client IP address.
+	Register ratelimit.Limit
+	// Email applies to routes that send email, per client IP address.
+	Email ratelimit.Limit
+	// Token applies to /oauth/token, per client IP address.
+	Token ratelimit.Limit
+	// API applies to authenticated routes, per user, or per token for
+	// personal access tokens and service accounts.
+	API ratelimit.Limit
+}
+
+// DefaultRateLimits are the limits main.go starts from.
+var DefaultRateLimits = RateLimits{
+	Auth:     ratelimit.Limit{Requests: 30, Period: time.Minute},
+	Register: ratelimit.Limit{Requests: 10, Period: time.Hour},
+	Email:    ratelimit.Limit{Requests: 5, Period: time.Hour},
+	Token:    ratelimit.Limit{Requests: 60, Period: time.Minute},
+	API:      ratelimit.Limit{Requests: 600, Period: time.Minute},
+}
+
+// RateLimitKey returns what a request is counted against.
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitByIP counts requests per client IP address.
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByUser counts requests per user, or per service account. It must
+// come after AuthMiddleware, and counts unauthenticated requests per IP
+// address.
+func RateLimitByUser(c *gin.Context) string {
+	if userID, ok := c.Get("userID"); ok {
+		return fmt.Sprintf("user:%d", userID.(int))
+	}
+	if accountID, ok := c.Get("serviceAccountID"); ok {
+		return fmt.Sprintf("service_account:%d", accountID.(int))
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitByToken is RateLimitByUser, except that each personal access token
+// has a separate limit from its user's sessions.
+func RateLimitByToken(c *gin.Context) string {
+	if tokenID, ok := c.Get("personalAccessTokenID"); ok {
+		return fmt.Sprintf("pat:%d", tokenID.(int))
+	}
+	return RateLimitByUser(c)
+}
+
+// RateLimitPolicy limits the requests to some routes. Name keeps the buckets
+// of different policies apart when they count requests by the same key.
+type RateLimitPolicy struct {
+	Name  string
+	Limit ratelimit.Limit
+	Key   RateLimitKey
+}
+
+// RateLimit refuses requests beyond policy's limit with 429. Every response
+// carries RateLimit-* headers describing the limit, and refusals carry
+// Retry-After. If the store fails the request is let through, so that an
+// outage of the store doesn't take the API down with it.
+func RateLimit(store ratelimit.Store, policy RateLimitPolicy) gin.HandlerFunc {
+	if policy.Limit.IsZero() {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		result, err := store.Take(c.Request.Context(), policy.Name+":"+policy.Key(c), policy.Limit)
+		if err != nil {
+			log.Printf("Error checking rate limit: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit.Requests))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit.Requests, ceilSeconds(policy.Limit.Period)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, as HTTP headers count them.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore is a ratelimit.Store that is always down
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+// rateLimitedRouter serves GET /limited behind policy. The user ID, if any,
+// is taken from the X-User header in place of AuthMiddleware.
+func rateLimitedRouter(store ratelimit.Store, policy RateLimitPolicy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/limited", func(c *gin.Context) {
+		if id, err := strconv.Atoi(c.GetHeader("X-User")); err == nil {
+			c.Set("userID", id)
+		}
+		c.Next()
+	}, RateLimit(store, policy), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func getLimited(router *gin.Engine, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/limited", nil)
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_Headers(t *testing.T) {
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+	router := rateLimitedRouter(ratelimit.NewMemoryStore(), RateLimitPolicy{Name: "test", Limit: limit, Key: RateLimitByIP})
+
+	w := getLimited(router, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	w = getLimited(router, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = getLimited(router, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimit_ByUser(t *testing.T) {
+	limit := ratelimit.Limit{Requests: 1, Period: time.Minute}
+	router := rateLimitedRouter(ratelimit.NewMemoryStore(), RateLimitPolicy{Name: "test", Limit: limit, Key: RateLimitByUser})
+
+	assert.Equal(t, http.StatusOK, getLimited(router, "1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, getLimited(router, "1").Code)
+	assert.Equal(t, http.StatusOK, getLimited(router, "2").Code, "Each user has their own limit")
+	assert.Equal(t, http.StatusOK, getLimited(router, "").Code, "Anonymous requests are limited by IP address")
+}
+
+func TestRateLimit_PoliciesAreSeparate(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Requests: 1, Period: time.Minute}
+	first := rateLimitedRouter(store, RateLimitPolicy{Name: "first", Limit: limit, Key: RateLimitByIP})
+	second := rateLimitedRouter(store, RateLimitPolicy{Name: "second", Limit: limit, Key: RateLimitByIP})
+
+	assert.Equal(t, http.StatusOK, getLimited(first, "").Code)
+	assert.Equal(t, http.StatusOK, getLimited(second, "").Code)
+}
+
+func TestRateLimit_ZeroLimitIsOff(t *testing.T) {
+	router := rateLimitedRouter(failingStore{}, RateLimitPolicy{Name: "test", Key: RateLimitByIP})
+
+	w := getLimited(router, "")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_StoreErrorLetsRequestsThrough(t *testing.T) {
+	limit := ratelimit.Limit{Requests: 1, Period: time.Minute}
+	router := rateLimitedRouter(failingStore{}, RateLimitPolicy{Name: "test", Limit: limit, Key: RateLimitByIP})
+
+	assert.Equal(t, http.StatusOK, getLimited(router, "").Code)
+	assert.Equal(t, http.StatusOK, getLimited(router, "").Code)
+}
@@ -1,35 +1,264 @@
 package api
 
 import (
+	"fmt"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
 	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/mail"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc"
+	"github.com/dwfennell/monorepo-scaffold/internal/ratelimit"
 	"github.com/dwfennell/monorepo-scaffold/internal/repository"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(router *gin.Engine, db *database.DB) {
+func SetupRoutes(router *gin.Engine, db *database.DB, cfg Config) error {
+	templates, err := mail.LoadTemplates()
+	if err != nil {
+		return err
+	}
+
+	wa, err := NewWebAuthn(cfg.AppName, cfg.WebAuthnRPID, cfg.WebAuthnOrigins)
+	if err != nil {
+		return err
+	}
+
+	var limiter ratelimit.Store
+	switch cfg.RateLimitStore {
+	case RateLimitStoreMemory, "":
+		limiter = ratelimit.NewMemoryStore()
+	case RateLimitStorePostgres:
+		limiter = repository.NewRateLimitRepository(db)
+	default:
+		return fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+	limitByIP := func(name string, limit ratelimit.Limit) gin.HandlerFunc {
+		return RateLimit(limiter, RateLimitPolicy{Name: name, Limit: limit, Key: RateLimitByIP})
+	}
+	limitAPI := RateLimit(limiter, RateLimitPolicy{Name: "api", Limit: cfg.RateLimits.API, Key: RateLimitByToken})
+
 	userRepo := repository.NewUserRepository(db)
-	authHandler := NewAuthHandler(userRepo)
+	refreshRepo := repository.NewRefreshTokenRepository(db)
+	tokenRepo := repository.NewUserTokenRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	revocations := auth.NewRevocationStore(repository.NewRevocationRepository(db))
+	notifier := NewMailNotifier(cfg.Mailer, templates, cfg.FrontendURL)
+	roleRepo := repository.NewRoleRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+	patRepo := repository.NewPersonalAccessTokenRepository(db)
+	serviceAccountRepo := repository.NewServiceAccountRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	issuer := NewTokenIssuer(refreshRepo, mfaRepo, roleRepo, orgRepo, sessionRepo, cfg.SessionLocationHeader, cfg.Cookies)
+	loginLimits := cfg.LoginLimits
+	if loginLimits == (LoginLimits{}) {
+		loginLimits = DefaultLoginLimits
+	}
+	throttleRepo := repository.NewLoginThrottleRepository(db)
+	throttle := NewLoginThrottle(throttleRepo, auditRepo, tokenRepo, notifier, loginLimits)
+	passwords := cfg.PasswordPolicy
+	if passwords == nil {
+		passwords = &auth.DefaultPasswordPolicy
+	}
+	authHandler := NewAuthHandler(userRepo, refreshRepo, sessionRepo, tokenRepo, revocations, issuer, notifier, throttle, passwords)
+	mfaHandler := NewMFAHandler(userRepo, mfaRepo, revocations, issuer, throttleRepo, cfg.AppName)
+	adminHandler := NewAdminHandler(userRepo, roleRepo, revocations, throttle, auditRepo)
+	orgHandler := NewOrgHandler(orgRepo, userRepo, notifier)
+	patHandler := NewPersonalAccessTokenHandler(patRepo, roleRepo)
+	sessionHandler := NewSessionHandler(sessionRepo, refreshRepo, revocations)
+	serviceAccountHandler := NewServiceAccountHandler(serviceAccountRepo, cfg.Issuer)
+	magicLinkHandler := NewMagicLinkHandler(userRepo, repository.NewMagicLinkRepository(db), issuer, notifier, cfg.MagicLinkSignup)
+	webauthnHandler := NewWebAuthnHandler(wa, userRepo, repository.NewWebAuthnRepository(db), issuer, authHandler.sendVerification)
+
+	providers := make([]*oidc.Client, len(cfg.OIDCProviders))
+	for i, providerCfg := range cfg.OIDCProviders {
+		providers[i] = oidc.NewClient(providerCfg, nil)
+	}
+	oidcHandler := NewOIDCHandler(providers, userRepo, repository.NewIdentityRepository(db), issuer, authHandler.sendVerification)
+
+	patVerifier := NewPersonalAccessTokenVerifier(patRepo, userRepo, roleRepo)
+
+	// authenticate accepts any valid token; requireAuth additionally applies
+	// the email verification policy
+	authenticate := AuthMiddleware(AuthMiddlewareConfig{
+		Revocations: revocations,
+		Cookies:     cfg.Cookies.Enabled,
+	})
+	requireAuth := AuthMiddleware(AuthMiddlewareConfig{
+		Revocations:          revocations,
+		RequireVerifiedEmail: cfg.RequireEmailVerification,
+		PersonalAccessTokens: patVerifier,
+		Cookies:              cfg.Cookies.Enabled,
+	})
+	// requireAdminAuth also accepts service accounts, which have permissions
+	// but no user
+	requireAdminAuth := AuthMiddleware(AuthMiddlewareConfig{
+		Revocations:          revocations,
+		RequireVerifiedEmail: cfg.RequireEmailVerification,
+		PersonalAccessTokens: patVerifier,
+		ServiceAccounts:      serviceAccountRepo,
+		Cookies:              cfg.Cookies.Enabled,
+	})
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", JWKS)
+
+	// OpenID Connect provider for other apps
+	var oauthProvider *OAuthProviderHandler
+	if cfg.Issuer != "" {
+		oauthProvider = NewOAuthProviderHandler(repository.NewOAuthRepository(db), userRepo, cfg.Issuer, cfg.FrontendURL)
+		userInfo := AuthMiddleware(AuthMiddlewareConfig{
+			Revocations: revocations,
+			Purpose:     auth.PurposeOAuthAccess,
+		})
+
+		router.GET("/.well-known/openid-configuration", oauthProvider.Discovery)
+		oauthGroup := router.Group("/oauth")
+		oauthGroup.GET("/authorize", oauthProvider.Authorize)
+		oauthGroup.GET("/userinfo", userInfo, oauthProvider.UserInfo)
+		oauthGroup.POST("/userinfo", userInfo, oauthProvider.UserInfo)
+	}
+
+	// Service accounts obtain tokens here even when this service is not an
+	// OpenID Connect provider
+	router.POST("/oauth/token", limitByIP("token", cfg.RateLimits.Token), TokenEndpoint(oauthProvider, serviceAccountHandler))
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
+	if cfg.Cookies.Enabled {
+		v1.Use(CSRFProtection())
+	}
 	{
 		// Public routes
-		auth := v1.Group("/auth")
+		authGroup := v1.Group("/auth", limitByIP("auth", cfg.RateLimits.Auth))
 		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			authGroup.POST("/register", limitByIP("register", cfg.RateLimits.Register), authHandler.Register)
+			authGroup.POST("/login", authHandler.Login)
+			authGroup.POST("/refresh", authHandler.Refresh)
+			authGroup.POST("/verify-email", authHandler.VerifyEmail)
+			authGroup.POST("/forgot-password", limitByIP("email", cfg.RateLimits.Email), authHandler.ForgotPassword)
+			authGroup.POST("/reset-password", authHandler.ResetPassword)
+			authGroup.POST("/unlock", authHandler.UnlockAccount)
+			authGroup.POST("/confirm-email-change", authHandler.ConfirmEmailChange)
+			authGroup.POST("/restore-account", authHandler.RestoreAccount)
+			authGroup.POST("/magic-link", limitByIP("email", cfg.RateLimits.Email), magicLinkHandler.Send)
+			authGroup.POST("/magic-link/consume", magicLinkHandler.Consume)
+			authGroup.POST("/mfa/verify", mfaHandler.Verify)
+			if cfg.Cookies.Enabled {
+				authGroup.GET("/csrf", CSRFToken(cfg.Cookies))
+			}
+
+			// Available to unverified users
+			authGroup.POST("/resend-verification", limitByIP("email", cfg.RateLimits.Email), authenticate, authHandler.ResendVerification)
+			authGroup.POST("/logout", authenticate, authHandler.Logout)
+			authGroup.POST("/logout-all", authenticate, authHandler.LogoutAll)
+
+			// Passkeys
+			webauthnGroup := authGroup.Group("/webauthn")
+			webauthnGroup.POST("/signup/begin", limitByIP("register", cfg.RateLimits.Register), webauthnHandler.BeginSignup)
+			webauthnGroup.POST("/signup/finish", webauthnHandler.FinishSignup)
+			webauthnGroup.POST("/login/begin", webauthnHandler.BeginLogin)
+			webauthnGroup.POST("/login/finish", webauthnHandler.FinishLogin)
+			webauthnGroup.POST("/register/begin", authenticate, webauthnHandler.BeginRegistration)
+			webauthnGroup.POST("/register/finish", authenticate, webauthnHandler.FinishRegistration)
+			webauthnGroup.GET("/credentials", authenticate, webauthnHandler.ListCredentials)
+			webauthnGroup.DELETE("/credentials/:id", authenticate, webauthnHandler.DeleteCredential)
+
+			// External identity providers
+			oidcGroup := authGroup.Group("/oidc")
+			oidcGroup.GET("/providers", oidcHandler.ListProviders)
+			oidcGroup.POST("/:provider/start", oidcHandler.Start)
+			oidcGroup.POST("/:provider/link/start", authenticate, oidcHandler.StartLink)
+			oidcGroup.POST("/:provider/callback", oidcHandler.Callback)
+			authGroup.GET("/identities", authenticate, oidcHandler.ListIdentities)
+			authGroup.DELETE("/identities/:id", authenticate, oidcHandler.DeleteIdentity)
 		}
 
+		// Unverified users may need to correct a mistyped address, or to
+		// delete an account they can't verify
+		v1.POST("/me/email", limitByIP("email", cfg.RateLimits.Email), authenticate, RequireSession(), authHandler.ChangeEmail)
+		v1.DELETE("/me", authenticate, RequireSession(), authHandler.DeleteAccount)
+
+		// Declining an invitation only needs the emailed token
+		v1.POST("/invitations/decline", orgHandler.DeclineInvitation)
+
 		// Protected routes
 		protected := v1.Group("/")
-		protected.Use(AuthMiddleware())
+		protected.Use(requireAuth, limitAPI)
 		{
+			// Personal access tokens may read, but only a logged in user may
+			// change the account, its second factors, its organizations or
+			// what other apps it has consented to
 			protected.GET("/me", authHandler.GetCurrentUser)
+			protected.PATCH("/me", RequireSession(), authHandler.UpdateProfile)
+			protected.POST("/me/password", RequireSession(), authHandler.ChangePassword)
+
+			protected.GET("/me/mfa", mfaHandler.Status)
+			protected.POST("/me/mfa/totp", RequireSession(), mfaHandler.BeginTOTP)
+			protected.POST("/me/mfa/totp/confirm", RequireSession(), mfaHandler.ConfirmTOTP)
+			protected.DELETE("/me/mfa/totp", RequireSession(), mfaHandler.DisableTOTP)
+			protected.POST("/me/mfa/recovery-codes", RequireSession(), mfaHandler.RegenerateRecoveryCodes)
+
+			// Personal access tokens can't manage themselves
+			protected.GET("/me/tokens", RequireSession(), patHandler.List)
+			protected.POST("/me/tokens", RequireSession(), patHandler.Create)
+			protected.DELETE("/me/tokens/:id", RequireSession(), patHandler.Delete)
+
+			// Sessions are the logins personal access tokens stand apart from
+			protected.GET("/me/sessions", RequireSession(), sessionHandler.List)
+			protected.DELETE("/me/sessions/:id", RequireSession(), sessionHandler.Delete)
+
+			// Organizations
+			protected.GET("/orgs", orgHandler.List)
+			protected.POST("/orgs", RequireSession(), orgHandler.Create)
+			protected.POST("/invitations/accept", RequireSession(), orgHandler.AcceptInvitation)
+
+			org := protected.Group("/orgs/:orgID", RequireOrgMember(orgRepo), TenantScope(db))
+			org.GET("", orgHandler.Get)
+			org.PATCH("", RequireSession(), RequireOrgRole(models.OrgRoleAdmin), orgHandler.Update)
+			org.DELETE("", RequireSession(), RequireOrgRole(models.OrgRoleOwner), orgHandler.Delete)
+			org.GET("/members", orgHandler.ListMembers)
+			org.PATCH("/members/:userID", RequireSession(), RequireOrgRole(models.OrgRoleOwner), orgHandler.UpdateMember)
+			org.DELETE("/members/:userID", RequireSession(), orgHandler.RemoveMember)
+			org.GET("/invitations", RequireOrgRole(models.OrgRoleAdmin), orgHandler.ListInvitations)
+			org.POST("/invitations", RequireSession(), RequireOrgRole(models.OrgRoleAdmin), orgHandler.CreateInvitation)
+			org.DELETE("/invitations/:id", RequireSession(), RequireOrgRole(models.OrgRoleAdmin), orgHandler.DeleteInvitation)
+
+			// Consent screen for apps logging in through this service. Approving
+			// logs the user in to the app, which a token must not be able to do.
+			if oauthProvider != nil {
+				protected.GET("/oauth/requests/:id", RequireSession(), oauthProvider.GetAuthorizationRequest)
+				protected.POST("/oauth/requests/:id/approve", RequireSession(), oauthProvider.Approve)
+				protected.POST("/oauth/requests/:id/deny", RequireSession(), oauthProvider.Deny)
+			}
+		}
+
+		// Admin API, guarded per route by permission
+		admin := v1.Group("/admin")
+		admin.Use(requireAdminAuth, limitAPI)
+		{
+			admin.GET("/roles", RequirePermission(auth.PermissionRolesRead), adminHandler.ListRoles)
+			admin.GET("/users/:id", RequirePermission(auth.PermissionUsersRead), adminHandler.GetUser)
+			admin.POST("/users/:id/unlock", RequirePermission(auth.PermissionUsersWrite), adminHandler.UnlockUser)
+			admin.GET("/users/:id/audit-events", RequirePermission(auth.PermissionUsersRead), adminHandler.ListAuditEvents)
+			admin.GET("/users/:id/roles", RequirePermission(auth.PermissionRolesRead), adminHandler.GetUserRoles)
+			admin.POST("/users/:id/roles", RequirePermission(auth.PermissionRolesWrite), adminHandler.AssignRole)
+			admin.DELETE("/users/:id/roles/:role", RequirePermission(auth.PermissionRolesWrite), adminHandler.RevokeRole)
+
+			admin.GET("/service-accounts", RequirePermission(auth.PermissionServiceAccountsRead), serviceAccountHandler.List)
+			admin.POST("/service-accounts", RequirePermission(auth.PermissionServiceAccountsWrite), serviceAccountHandler.Create)
+			admin.GET("/service-accounts/:id", RequirePermission(auth.PermissionServiceAccountsRead), serviceAccountHandler.Get)
+			admin.POST("/service-accounts/:id/rotate-secret", RequirePermission(auth.PermissionServiceAccountsWrite), serviceAccountHandler.RotateSecret)
+			admin.POST("/service-accounts/:id/disable", RequirePermission(auth.PermissionServiceAccountsWrite), serviceAccountHandler.Disable)
+			admin.POST("/service-accounts/:id/enable", RequirePermission(auth.PermissionServiceAccountsWrite), serviceAccountHandler.Enable)
 		}
 	}
+
+	return nil
 }
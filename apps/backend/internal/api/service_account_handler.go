@@ -0,0 +1,261 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ServiceAccountHandler issues tokens to service accounts with the OAuth 2.0
+// client_credentials grant and serves the admin API for managing them. The
+// admin routes are guarded by RequirePermission in SetupRoutes.
+type ServiceAccountHandler struct {
+	accounts *repository.ServiceAccountRepository
+	issuer   string
+}
+
+// NewServiceAccountHandler creates the handler. issuer is set as the iss of
+// the tokens it issues, and may be empty.
+func NewServiceAccountHandler(accounts *repository.ServiceAccountRepository, issuer string) *ServiceAccountHandler {
+	return &ServiceAccountHandler{accounts: accounts, issuer: strings.TrimSuffix(issuer, "/")}
+}
+
+// Token exchanges a service account's client credentials for an access token.
+// The token carries the requested scope, or every scope of the account if
+// none is requested, as permissions. No refresh token is issued: the account
+// asks for a new access token when the old one expires.
+func (h *ServiceAccountHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	if c.PostForm("grant_type") != "client_credentials" {
+		tokenError(c, http.StatusBadRequest, "unsupported_grant_type", "Only the client_credentials grant is supported")
+		return
+	}
+
+	clientID, secret, basic := clientCredentials(c)
+	account, err := h.accounts.GetByClientID(c.Request.Context(), clientID)
+	if err != nil {
+		log.Printf("Error getting service account: %v", err)
+		tokenError(c, http.StatusInternalServerError, "server_error", "Failed to load client")
+		return
+	}
+	if account == nil || account.IsDisabled() ||
+		subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(account.ClientSecretHash)) != 1 {
+		invalidClient(c, basic)
+		return
+	}
+
+	scopes := account.Scopes
+	if requested := c.PostForm("scope"); requested != "" {
+		scopes = strings.Fields(requested)
+		for _, scope := range scopes {
+			if !slices.Contains(account.Scopes, scope) {
+				tokenError(c, http.StatusBadRequest, "invalid_scope", fmt.Sprintf("Scope %s is not granted to this client", scope))
+				return
+			}
+		}
+	}
+	scope := strings.Join(scopes, " ")
+
+	accessToken, err := auth.SignClaims(auth.Claims{
+		ServiceAccountID: account.ID,
+		Scope:            scope,
+		Permissions:      scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:  h.issuer,
+			Subject: account.ClientID,
+		},
+	})
+	if err != nil {
+		log.Printf("Error signing service account token: %v", err)
+		tokenError(c, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(auth.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	})
+}
+
+// List returns every service account.
+func (h *ServiceAccountHandler) List(c *gin.Context) {
+	accounts, err := h.accounts.List(c.Request.Context())
+	if err != nil {
+		log.Printf("Error listing service accounts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list service accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// Get returns a service account.
+func (h *ServiceAccountHandler) Get(c *gin.Context) {
+	account, ok := h.targetAccount(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// Create adds a service account and returns its client secret, which is not
+// shown again. Its scopes must be permissions the caller's own token carries.
+func (h *ServiceAccountHandler) Create(c *gin.Context) {
+	var req models.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	for _, scope := range req.Scopes {
+		if !claims.HasPermission(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid scope: %s", scope)})
+			return
+		}
+	}
+
+	clientID, err := auth.GenerateClientID()
+	if err != nil {
+		log.Printf("Error generating client ID: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+	secret, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating client secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	account := &models.ServiceAccount{
+		ClientID:         clientID,
+		ClientSecretHash: auth.HashToken(secret),
+		Name:             req.Name,
+		Scopes:           slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+	}
+	if claims.UserID != 0 {
+		account.CreatedBy = &claims.UserID
+	}
+	if err := h.accounts.Create(c.Request.Context(), account); err != nil {
+		log.Printf("Error creating service account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ServiceAccountCredentialsResponse{ServiceAccount: *account, ClientSecret: secret})
+}
+
+// RotateSecret replaces a service account's client secret and returns the new
+// one. The old secret stops working immediately; tokens already issued with
+// it last until they expire.
+func (h *ServiceAccountHandler) RotateSecret(c *gin.Context) {
+	account, ok := h.targetAccount(c)
+	if !ok {
+		return
+	}
+
+	secret, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating client secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate secret"})
+		return
+	}
+	rotated, err := h.accounts.RotateSecret(c.Request.Context(), account, auth.HashToken(secret))
+	if err != nil {
+		log.Printf("Error rotating service account secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate secret"})
+		return
+	}
+	if !rotated {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ServiceAccountCredentialsResponse{ServiceAccount: *account, ClientSecret: secret})
+}
+
+// Disable stops a service account obtaining tokens. Tokens it already holds
+// stop working immediately.
+func (h *ServiceAccountHandler) Disable(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+// Enable lets a disabled service account obtain tokens again.
+func (h *ServiceAccountHandler) Enable(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *ServiceAccountHandler) setDisabled(c *gin.Context, disabled bool) {
+	account, ok := h.targetAccount(c)
+	if !ok {
+		return
+	}
+
+	updated, err := h.accounts.SetDisabled(c.Request.Context(), account, disabled)
+	if err != nil {
+		log.Printf("Error updating service account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service account"})
+		return
+	}
+	if !updated {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// targetAccount loads the service account named by the :id parameter. It
+// writes the error response itself if there is none.
+func (h *ServiceAccountHandler) targetAccount(c *gin.Context) (*models.ServiceAccount, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return nil, false
+	}
+
+	account, err := h.accounts.GetByID(c.Request.Context(), id)
+	if err != nil {
+		log.Printf("Error getting service account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get service account"})
+		return nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return nil, false
+	}
+
+	return account, true
+}
+
+// TokenEndpoint serves /oauth/token, passing each grant to the handler that
+// supports it. provider is nil when this service is not an OpenID Connect
+// provider, in which case only service accounts can obtain tokens.
+func TokenEndpoint(provider *OAuthProviderHandler, serviceAccounts *ServiceAccountHandler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch grantType := c.PostForm("grant_type"); {
+		case grantType == "client_credentials":
+			serviceAccounts.Token(c)
+		case grantType == "authorization_code" && provider != nil:
+			provider.Token(c)
+		default:
+			c.Header("Cache-Control", "no-store")
+			tokenError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+		}
+	}
+}
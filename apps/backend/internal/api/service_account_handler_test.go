@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *AuthHandlerTestSuite) createServiceAccount(token string, scopes ...string) models.ServiceAccountCredentialsResponse {
+	body, _ := json.Marshal(models.CreateServiceAccountRequest{Name: "worker", Scopes: scopes})
+	w := suite.authedRequest("POST", "/admin/service-accounts", token, body)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	var created models.ServiceAccountCredentialsResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+	return created
+}
+
+func (suite *AuthHandlerTestSuite) clientCredentialsToken(clientID, secret, scope string) *httptest.ResponseRecorder {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AuthHandlerTestSuite) serviceAccountToken(account models.ServiceAccountCredentialsResponse) string {
+	w := suite.clientCredentialsToken(account.ClientID, account.ClientSecret, "")
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var response models.OAuthTokenResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response.AccessToken
+}
+
+func (suite *AuthHandlerTestSuite) TestServiceAccount_ClientCredentials() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	account := suite.createServiceAccount(admin.Token, auth.PermissionUsersRead, auth.PermissionRolesRead)
+	suite.Require().NotEmpty(account.ClientSecret)
+
+	w := suite.clientCredentialsToken(account.ClientID, account.ClientSecret, auth.PermissionUsersRead)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var response models.OAuthTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(suite.T(), "Bearer", response.TokenType)
+	assert.Equal(suite.T(), auth.PermissionUsersRead, response.Scope)
+	assert.Empty(suite.T(), response.IDToken)
+
+	claims, err := auth.ValidateToken(response.AccessToken)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), account.ID, claims.ServiceAccountID)
+	assert.Zero(suite.T(), claims.UserID)
+	assert.Equal(suite.T(), []string{auth.PermissionUsersRead}, claims.Permissions)
+
+	w = suite.authedRequest("GET", fmt.Sprintf("/admin/users/%d", admin.User.ID), response.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.authedRequest("GET", "/admin/roles", response.AccessToken, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code, "The token only carries the requested scope")
+}
+
+func (suite *AuthHandlerTestSuite) TestServiceAccount_InvalidCredentials() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	account := suite.createServiceAccount(admin.Token, auth.PermissionUsersRead)
+
+	w := suite.clientCredentialsToken(account.ClientID, "wrong", "")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "invalid_client")
+
+	w = suite.clientCredentialsToken(account.ClientID, account.ClientSecret, auth.PermissionRolesWrite)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "invalid_scope")
+}
+
+func (suite *AuthHandlerTestSuite) TestServiceAccount_RejectedOnUserRoutes() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	token := suite.serviceAccountToken(suite.createServiceAccount(admin.Token, auth.PermissionUsersRead))
+
+	w := suite.authedRequest("GET", "/me", token, nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestServiceAccount_ScopesLimitedToCaller() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	scoped := suite.createPersonalAccessToken(admin.Token, models.CreatePersonalAccessTokenRequest{
+		Name:   "automation",
+		Scopes: []string{auth.PermissionServiceAccountsWrite},
+	})
+
+	body, _ := json.Marshal(models.CreateServiceAccountRequest{Name: "worker", Scopes: []string{auth.PermissionUsersRead}})
+	w := suite.authedRequest("POST", "/admin/service-accounts", scoped.Token, body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestServiceAccount_RotateSecret() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	account := suite.createServiceAccount(admin.Token, auth.PermissionUsersRead)
+
+	w := suite.authedRequest("POST", fmt.Sprintf("/admin/service-accounts/%d/rotate-secret", account.ID), admin.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var rotated models.ServiceAccountCredentialsResponse
+	json.Unmarshal(w.Body.Bytes(), &rotated)
+	assert.NotEqual(suite.T(), account.ClientSecret, rotated.ClientSecret)
+
+	w = suite.clientCredentialsToken(account.ClientID, account.ClientSecret, "")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, "The old secret stops working")
+	w = suite.clientCredentialsToken(account.ClientID, rotated.ClientSecret, "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestServiceAccount_Disable() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	account := suite.createServiceAccount(admin.Token, auth.PermissionUsersRead)
+	token := suite.serviceAccountToken(account)
+	userPath := fmt.Sprintf("/admin/users/%d", admin.User.ID)
+
+	w := suite.authedRequest("POST", fmt.Sprintf("/admin/service-accounts/%d/disable", account.ID), admin.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var disabled models.ServiceAccount
+	json.Unmarshal(w.Body.Bytes(), &disabled)
+	assert.NotNil(suite.T(), disabled.DisabledAt)
+
+	w = suite.authedRequest("GET", userPath, token, nil)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, "Issued tokens stop working")
+	w = suite.clientCredentialsToken(account.ClientID, account.ClientSecret, "")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	w = suite.authedRequest("POST", fmt.Sprintf("/admin/service-accounts/%d/enable", account.ID), admin.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	w = suite.authedRequest("GET", userPath, token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestServiceAccount_ListAndGet() {
+	admin := suite.registerWithRole("admin@example.com", "admin")
+	account := suite.createServiceAccount(admin.Token)
+
+	w := suite.authedRequest("GET", "/admin/service-accounts", admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), account.ClientSecret)
+	var accounts []models.ServiceAccount
+	json.Unmarshal(w.Body.Bytes(), &accounts)
+	suite.Require().Len(accounts, 1)
+	suite.Require().NotNil(accounts[0].CreatedBy)
+	assert.Equal(suite.T(), admin.User.ID, *accounts[0].CreatedBy)
+
+	w = suite.authedRequest("GET", fmt.Sprintf("/admin/service-accounts/%d", account.ID), admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	w = suite.authedRequest("GET", "/admin/service-accounts/0", admin.Token, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestTokenEndpoint_UnsupportedGrant() {
+	w := suite.redeemCode(url.Values{"grant_type": {"password"}})
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "unsupported_grant_type")
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler lets users see where they are logged in and log out of
+// other devices. Its routes must be behind RequireSession.
+type SessionHandler struct {
+	sessionRepo *repository.SessionRepository
+	refreshRepo *repository.RefreshTokenRepository
+	revocations *auth.RevocationStore
+}
+
+func NewSessionHandler(sessionRepo *repository.SessionRepository, refreshRepo *repository.RefreshTokenRepository, revocations *auth.RevocationStore) *SessionHandler {
+	return &SessionHandler{sessionRepo: sessionRepo, refreshRepo: refreshRepo, revocations: revocations}
+}
+
+// List returns the current user's active sessions, most recently used first,
+// marking the one the request was made in.
+func (h *SessionHandler) List(c *gin.Context) {
+	sessions, err := h.sessionRepo.ListForUser(c.Request.Context(), c.GetInt("userID"))
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	current := c.MustGet("claims").(*auth.Claims).SessionID
+	for i := range sessions {
+		sessions[i].Device = describeUserAgent(sessions[i].UserAgent)
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// Delete ends one of the current user's sessions, revoking its access and
+// refresh tokens. Ending the current session logs the user out.
+func (h *SessionHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	session, err := h.sessionRepo.GetForUser(ctx, c.GetInt("userID"), c.Param("id"))
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := endSession(ctx, h.revocations, h.refreshRepo, session.ID); err != nil {
+		log.Printf("Error ending session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// endSession revokes the access tokens issued for a session and its refresh
+// token family.
+func endSession(ctx context.Context, revocations *auth.RevocationStore, refreshRepo *repository.RefreshTokenRepository, sessionID string) error {
+	if err := revocations.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	return refreshRepo.RevokeFamily(ctx, sessionID)
+}
+
+// userAgentBrowsers and userAgentPlatforms map tokens found in User-Agent
+// headers to names users recognise. Order matters: Edge and Opera claim to be
+// Chrome, which claims to be Safari.
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	userAgentPlatforms = []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"CrOS", "ChromeOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// describeUserAgent summarises a User-Agent header as, for example, "Firefox
+// on Windows".
+func describeUserAgent(userAgent string) string {
+	var browser, platform string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range userAgentPlatforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
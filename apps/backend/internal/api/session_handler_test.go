@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// testLocationHeader is where tests report a client's location, as a proxy
+// would
+const testLocationHeader = "X-Client-Location"
+
+const (
+	firefoxOnWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	safariOnIPhone   = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+)
+
+func TestDescribeUserAgent(t *testing.T) {
+	tests := map[string]string{
+		firefoxOnWindows: "Firefox on Windows",
+		safariOnIPhone:   "Safari on iOS",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36":             "Chrome on macOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.2592.87": "Edge on Windows",
+		"curl/8.7.1": "curl",
+		"":           "Unknown device",
+	}
+	for userAgent, want := range tests {
+		assert.Equal(t, want, describeUserAgent(userAgent), userAgent)
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	assert.Equal(t, "São", truncateRunes("São", 3))
+	assert.Equal(t, "Sã", truncateRunes("São Paulo", 2))
+	assert.Equal(t, "東京", truncateRunes("東京都", 2))
+	assert.Equal(t, "", truncateRunes("東京都", 0))
+
+	location := truncateRunes(strings.Repeat("é", maxSessionLocation+1), maxSessionLocation)
+	assert.True(t, utf8.ValidString(location))
+	assert.Equal(t, maxSessionLocation, utf8.RuneCountInString(location))
+}
+
+// loginFrom logs in as if from a browser at a location
+func (suite *AuthHandlerTestSuite) loginFrom(email, userAgent, location string) models.AuthResponse {
+	body, _ := json.Marshal(models.LoginRequest{Email: email, Password: "password123"})
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(testLocationHeader, location)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var response models.AuthResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+// listSessions returns the sessions the holder of token can see
+func (suite *AuthHandlerTestSuite) listSessions(token string) []models.Session {
+	w := suite.authedRequest("GET", "/me/sessions", token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var sessions []models.Session
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &sessions))
+	return sessions
+}
+
+func sessionID(token string) string {
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		return ""
+	}
+	return claims.SessionID
+}
+
+func (suite *AuthHandlerTestSuite) TestSessions_List() {
+	suite.register("sessions@example.com", "password123")
+	laptop := suite.loginFrom("sessions@example.com", firefoxOnWindows, "NZ")
+	phone := suite.loginFrom("sessions@example.com", safariOnIPhone, "AU")
+
+	sessions := suite.listSessions(laptop.Token)
+
+	suite.Require().Len(sessions, 3, "Registering starts a session too")
+	assert.Equal(suite.T(), sessionID(phone.Token), sessions[0].ID, "Most recently used first")
+	assert.Equal(suite.T(), "Safari on iOS", sessions[0].Device)
+	assert.Equal(suite.T(), "AU", sessions[0].Location)
+	assert.NotEmpty(suite.T(), sessions[0].IPAddress)
+	assert.False(suite.T(), sessions[0].Current)
+	assert.Equal(suite.T(), sessionID(laptop.Token), sessions[1].ID)
+	assert.Equal(suite.T(), "Firefox on Windows", sessions[1].Device)
+	assert.True(suite.T(), sessions[1].Current)
+}
+
+func (suite *AuthHandlerTestSuite) TestSessions_RefreshKeepsSession() {
+	registered := suite.register("keepsession@example.com", "password123")
+
+	w := suite.refresh(registered.RefreshToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var refreshed models.AuthResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &refreshed))
+
+	assert.Equal(suite.T(), sessionID(registered.Token), sessionID(refreshed.Token))
+	assert.Len(suite.T(), suite.listSessions(refreshed.Token), 1)
+}
+
+func (suite *AuthHandlerTestSuite) TestSessions_Delete() {
+	suite.register("endsession@example.com", "password123")
+	laptop := suite.loginFrom("endsession@example.com", firefoxOnWindows, "NZ")
+	stolen := suite.loginFrom("endsession@example.com", safariOnIPhone, "AU")
+
+	w := suite.authedRequest("DELETE", "/me/sessions/"+sessionID(stolen.Token), laptop.Token, nil)
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.authedRequest("GET", "/me", stolen.Token, nil).Code)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(stolen.RefreshToken).Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.authedRequest("GET", "/me", laptop.Token, nil).Code)
+	assert.Len(suite.T(), suite.listSessions(laptop.Token), 2)
+}
+
+func (suite *AuthHandlerTestSuite) TestSessions_DeleteOtherUsersSession() {
+	owner := suite.register("owner@example.com", "password123")
+	other := suite.register("other@example.com", "password123")
+
+	w := suite.authedRequest("DELETE", "/me/sessions/"+sessionID(owner.Token), other.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.authedRequest("GET", "/me", owner.Token, nil).Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogout_EndsSession() {
+	first := suite.register("logoutsession@example.com", "password123")
+	second := suite.loginFrom("logoutsession@example.com", firefoxOnWindows, "")
+
+	w := suite.authedRequest("POST", "/logout", first.Token, nil)
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.refresh(first.RefreshToken).Code, "Logging out ends the session's refresh tokens")
+	sessions := suite.listSessions(second.Token)
+	suite.Require().Len(sessions, 1)
+	assert.Equal(suite.T(), sessionID(second.Token), sessions[0].ID)
+}
+
+func (suite *AuthHandlerTestSuite) TestLogoutAll_EndsSessions() {
+	registered := suite.register("endall@example.com", "password123")
+	suite.loginFrom("endall@example.com", firefoxOnWindows, "")
+
+	w := suite.authedRequest("POST", "/logout-all", registered.Token, nil)
+	suite.Require().Equal(http.StatusNoContent, w.Code)
+
+	fresh := suite.loginFrom("endall@example.com", safariOnIPhone, "")
+	sessions := suite.listSessions(fresh.Token)
+	suite.Require().Len(sessions, 1)
+	assert.True(suite.T(), sessions[0].Current)
+}
+
+func (suite *AuthHandlerTestSuite) TestSessions_RequireSession() {
+	registered := suite.register("patsessions@example.com", "password123")
+	pat := suite.createPersonalAccessToken(registered.Token, models.CreatePersonalAccessTokenRequest{Name: "script"}).Token
+
+	w := suite.authedRequest("GET", "/me/sessions", pat, nil)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
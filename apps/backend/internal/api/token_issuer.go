@@ -0,0 +1,249 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenIssuer completes logins. Handlers that authenticate a user in some way
+// hand the user to it, and it responds with either tokens or, when the user
+// has a second factor enabled, an MFA challenge.
+type TokenIssuer struct {
+	refreshRepo *repository.RefreshTokenRepository
+	mfaRepo     *repository.MFARepository
+	roleRepo    *repository.RoleRepository
+	orgRepo     *repository.OrganizationRepository
+	sessionRepo *repository.SessionRepository
+	// locationHeader is the request header a proxy reports the client's
+	// location in, if any
+	locationHeader string
+	cookies        CookieMode
+}
+
+// maxSessionLocation is the longest location, in characters, stored for a
+// session.
+const maxSessionLocation = 255
+
+// ErrNotOrgMember is returned by SwitchOrg when the user does not belong to
+// the organization.
+var ErrNotOrgMember = errors.New("not a member of the organization")
+
+func NewTokenIssuer(
+	refreshRepo *repository.RefreshTokenRepository,
+	mfaRepo *repository.MFARepository,
+	roleRepo *repository.RoleRepository,
+	orgRepo *repository.OrganizationRepository,
+	sessionRepo *repository.SessionRepository,
+	locationHeader string,
+	cookies CookieMode,
+) *TokenIssuer {
+	return &TokenIssuer{
+		refreshRepo:    refreshRepo,
+		mfaRepo:        mfaRepo,
+		roleRepo:       roleRepo,
+		orgRepo:        orgRepo,
+		sessionRepo:    sessionRepo,
+		locationHeader: locationHeader,
+		cookies:        cookies,
+	}
+}
+
+// Login responds to a request whose user has proved their first factor.
+func (i *TokenIssuer) Login(c *gin.Context, user *models.User) {
+	ctx := c.Request.Context()
+
+	totp, err := i.mfaRepo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error getting TOTP credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if totp != nil && totp.ConfirmedAt != nil {
+		mfaToken, err := auth.SignClaims(auth.Claims{
+			UserID:  user.ID,
+			Email:   user.Email,
+			Purpose: auth.PurposeMFAPending,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(auth.MFAPendingTTL)),
+			},
+		})
+		if err != nil {
+			log.Printf("Error signing MFA token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.MFAChallengeResponse{MFARequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	response, err := i.Issue(c, user, nil)
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	i.Respond(c, http.StatusOK, response)
+}
+
+// Respond sends tokens issued to the client, moving them into cookies in
+// cookie mode.
+func (i *TokenIssuer) Respond(c *gin.Context, status int, response *models.AuthResponse) {
+	if i.cookies.Enabled {
+		if err := i.cookies.setTokens(c, response); err != nil {
+			log.Printf("Error setting token cookies: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+	}
+
+	c.JSON(status, response)
+}
+
+// Issue creates an access token and a refresh token for user. When parent is
+// nil the refresh token starts a new family, and a new session for the
+// requesting client; otherwise parent is rotated out in favour of the new
+// token, keeping its session and its organization as long as the user still
+// belongs to it. The access token carries the user's current roles and
+// permissions.
+func (i *TokenIssuer) Issue(c *gin.Context, user *models.User, parent *models.RefreshToken) (*models.AuthResponse, error) {
+	var membership *models.OrgMember
+	if parent != nil && parent.OrgID != nil {
+		var err error
+		membership, err = i.orgRepo.GetMember(c.Request.Context(), *parent.OrgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return i.issue(c, user, parent, membership)
+}
+
+// SwitchOrg rotates parent like Issue, but makes orgID the session's
+// organization, or leaves it without one when orgID is 0.
+func (i *TokenIssuer) SwitchOrg(c *gin.Context, user *models.User, parent *models.RefreshToken, orgID int) (*models.AuthResponse, error) {
+	var membership *models.OrgMember
+	if orgID != 0 {
+		var err error
+		membership, err = i.orgRepo.GetMember(c.Request.Context(), orgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if membership == nil {
+			return nil, ErrNotOrgMember
+		}
+	}
+
+	return i.issue(c, user, parent, membership)
+}
+
+func (i *TokenIssuer) issue(c *gin.Context, user *models.User, parent *models.RefreshToken, membership *models.OrgMember) (*models.AuthResponse, error) {
+	ctx := c.Request.Context()
+	roles, err := i.roleRepo.ListUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := i.roleRepo.ListUserPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A session is a family of refresh tokens, and shares its ID
+	session := i.clientSession(c, user.ID)
+	if parent == nil {
+		session.ID, err = auth.GenerateFamilyID()
+		if err != nil {
+			return nil, err
+		}
+		err = i.sessionRepo.Create(ctx, session, auth.RefreshTokenTTL)
+	} else {
+		session.ID = parent.FamilyID
+		err = i.sessionRepo.Touch(ctx, session, auth.RefreshTokenTTL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims := auth.Claims{
+		SessionID:     session.ID,
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Roles:         roles,
+		Permissions:   permissions,
+	}
+	if membership != nil {
+		claims.OrgID = membership.OrgID
+		claims.OrgRole = membership.Role
+	}
+	accessToken, err := auth.SignClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(refreshToken),
+	}
+	if membership != nil {
+		stored.OrgID = &membership.OrgID
+	}
+	if parent == nil {
+		stored.FamilyID = session.ID
+		err = i.refreshRepo.Create(ctx, stored, auth.RefreshTokenTTL)
+	} else {
+		err = i.refreshRepo.Rotate(ctx, parent, stored, auth.RefreshTokenTTL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		User:         *user,
+	}, nil
+}
+
+// clientSession describes a session of userID's from the client making the
+// request.
+func (i *TokenIssuer) clientSession(c *gin.Context, userID int) *models.Session {
+	session := &models.Session{
+		UserID:    userID,
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+	if i.locationHeader != "" {
+		session.Location = truncateRunes(c.GetHeader(i.locationHeader), maxSessionLocation)
+	}
+	return session
+}
+
+// truncateRunes shortens s to at most n characters without splitting one.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
@@ -0,0 +1,561 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// webauthnSessionTTL is how long the browser has to complete a ceremony.
+const webauthnSessionTTL = 5 * time.Minute
+
+// defaultPasskeyName labels passkeys registered without a name.
+const defaultPasskeyName = "Passkey"
+
+// WebAuthnHandler registers passkeys and logs users in with them. Passkeys are
+// discoverable and require user verification, so a passkey login is not
+// followed by a TOTP challenge.
+type WebAuthnHandler struct {
+	webauthn     *webauthn.WebAuthn
+	userRepo     *repository.UserRepository
+	webauthnRepo *repository.WebAuthnRepository
+	issuer       *TokenIssuer
+
+	// sendVerification emails a verification link to an account created
+	// with a passkey.
+	sendVerification func(ctx context.Context, user *models.User) error
+}
+
+func NewWebAuthnHandler(
+	wa *webauthn.WebAuthn,
+	userRepo *repository.UserRepository,
+	webauthnRepo *repository.WebAuthnRepository,
+	issuer *TokenIssuer,
+	sendVerification func(ctx context.Context, user *models.User) error,
+) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webauthn:         wa,
+		userRepo:         userRepo,
+		webauthnRepo:     webauthnRepo,
+		issuer:           issuer,
+		sendVerification: sendVerification,
+	}
+}
+
+// NewWebAuthn configures the relying party. rpID is the domain passkeys are
+// bound to and origins the frontend origins allowed to use them.
+func NewWebAuthn(displayName, rpID string, origins []string) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: displayName,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+}
+
+// webauthnUser adapts a user and their passkeys to the WebAuthn library.
+type webauthnUser struct {
+	user        *models.User
+	handle      []byte
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte                         { return u.handle }
+func (u *webauthnUser) WebAuthnName() string                       { return u.user.Email }
+func (u *webauthnUser) WebAuthnDisplayName() string                { return displayName(u.user) }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// webauthnSessionData is what is stored server-side between the two halves of
+// a ceremony. The account fields are only set for signups.
+type webauthnSessionData struct {
+	Session webauthn.SessionData `json:"session"`
+	Email   string               `json:"email,omitempty"`
+	Name    string               `json:"name,omitempty"`
+}
+
+// BeginRegistration starts adding a passkey to the current user's account.
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := h.userRepo.GetByID(ctx, c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	candidate, err := newUserHandle()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+	handle, err := h.webauthnRepo.UserHandle(ctx, user.ID, candidate)
+	if err != nil {
+		log.Printf("Error getting WebAuthn user handle: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+	waUser, err := h.loadUser(ctx, user, handle)
+	if err != nil {
+		log.Printf("Error loading WebAuthn credentials: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	// Stop the authenticator from registering a second passkey for the
+	// same account
+	exclusions := make([]protocol.CredentialDescriptor, len(waUser.credentials))
+	for i, credential := range waUser.credentials {
+		exclusions[i] = credential.Descriptor()
+	}
+
+	creation, session, err := h.webauthn.BeginRegistration(waUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		log.Printf("Error beginning WebAuthn registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+	if err := h.saveSession(ctx, models.WebAuthnCeremonyRegistration, &user.ID, webauthnSessionData{Session: *session}); err != nil {
+		log.Printf("Error saving WebAuthn session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, creation)
+}
+
+// FinishRegistration verifies the new passkey and adds it to the current
+// user's account.
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	var req models.WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := c.GetInt("userID")
+	stored, data, err := h.consumeSession(ctx, models.WebAuthnCeremonyRegistration, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		log.Printf("Error consuming WebAuthn session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+	if stored == nil || stored.UserID == nil || *stored.UserID != userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	waUser, err := h.loadUser(ctx, user, data.Session.UserID)
+	if err != nil {
+		log.Printf("Error loading WebAuthn credentials: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+
+	credential, err := h.webauthn.CreateCredential(waUser, data.Session, parsed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	record, err := newCredentialRecord(user.ID, req.Name, credential)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+	if err := h.webauthnRepo.CreateCredential(ctx, record); err != nil {
+		log.Printf("Error creating WebAuthn credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, record)
+}
+
+// BeginSignup starts creating an account that uses a passkey instead of a
+// password. The account is only created once the ceremony finishes.
+func (h *WebAuthnHandler) BeginSignup(c *gin.Context) {
+	var req models.WebAuthnSignupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	existingUser, err := h.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		log.Printf("Error checking existing user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+		return
+	}
+	if existingUser != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		return
+	}
+
+	handle, err := newUserHandle()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+	waUser := &webauthnUser{user: &models.User{Email: req.Email, Name: req.Name}, handle: handle}
+
+	creation, session, err := h.webauthn.BeginRegistration(waUser)
+	if err != nil {
+		log.Printf("Error beginning WebAuthn registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+	data := webauthnSessionData{Session: *session, Email: req.Email, Name: req.Name}
+	if err := h.saveSession(ctx, models.WebAuthnCeremonySignup, nil, data); err != nil {
+		log.Printf("Error saving WebAuthn session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, creation)
+}
+
+// FinishSignup verifies the passkey, creates the account and logs it in.
+func (h *WebAuthnHandler) FinishSignup(c *gin.Context) {
+	var req models.WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	stored, data, err := h.consumeSession(ctx, models.WebAuthnCeremonySignup, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		log.Printf("Error consuming WebAuthn session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	if stored == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	user := &models.User{Email: data.Email, Name: data.Name}
+	waUser := &webauthnUser{user: user, handle: data.Session.UserID}
+	credential, err := h.webauthn.CreateCredential(waUser, data.Session, parsed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	// The address may have been registered since the ceremony began
+	existingUser, err := h.userRepo.GetByEmail(ctx, user.Email)
+	if err != nil {
+		log.Printf("Error checking existing user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+		return
+	}
+	if existingUser != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		return
+	}
+
+	record, err := newCredentialRecord(0, req.Name, credential)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	// A deleted account keeps its address until it is purged
+	err = h.webauthnRepo.CreateUserWithCredential(ctx, user, waUser.handle, record)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating passkey user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	if err := h.sendVerification(ctx, user); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+
+	response, err := h.issuer.Issue(c, user, nil)
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.issuer.Respond(c, http.StatusCreated, response)
+}
+
+// BeginLogin starts a login with any passkey the browser holds for this site.
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	assertion, session, err := h.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		log.Printf("Error beginning WebAuthn login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	if err := h.saveSession(c.Request.Context(), models.WebAuthnCeremonyLogin, nil, webauthnSessionData{Session: *session}); err != nil {
+		log.Printf("Error saving WebAuthn session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assertion)
+}
+
+// FinishLogin verifies a passkey assertion and issues tokens for its owner.
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var req models.WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	stored, data, err := h.consumeSession(ctx, models.WebAuthnCeremonyLogin, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		log.Printf("Error consuming WebAuthn session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if stored == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	var record *models.WebAuthnCredential
+	var user *models.User
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		var err error
+		record, err = h.webauthnRepo.GetByCredentialID(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil || !bytes.Equal(record.UserHandle, userHandle) {
+			return nil, errors.New("unknown credential")
+		}
+		user, err = h.userRepo.GetByID(ctx, record.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, errors.New("unknown user")
+		}
+		return h.loadUser(ctx, user, record.UserHandle)
+	}
+
+	credential, err := h.webauthn.ValidateDiscoverableLogin(findUser, data.Session, parsed)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+		return
+	}
+	if credential.Authenticator.CloneWarning {
+		log.Printf("Possible cloned passkey %d for user %d", record.ID, user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+		return
+	}
+
+	// Keep the updated signature counter for clone detection next time
+	updated, err := json.Marshal(credential)
+	if err == nil {
+		err = h.webauthnRepo.RecordUse(ctx, record.ID, updated)
+	}
+	if err != nil {
+		log.Printf("Error updating WebAuthn credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	response, err := h.issuer.Issue(c, user, nil)
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.issuer.Respond(c, http.StatusOK, response)
+}
+
+// ListCredentials returns the current user's passkeys.
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	credentials, err := h.webauthnRepo.ListByUser(c.Request.Context(), c.GetInt("userID"))
+	if err != nil {
+		log.Printf("Error listing WebAuthn credentials: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+// DeleteCredential removes one of the current user's passkeys. An account
+// without a password or linked identity must keep at least one.
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := c.GetInt("userID")
+	methods, err := h.userRepo.LoginMethods(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting login methods: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if methods == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !methods.Password && methods.Identities == 0 {
+		credentials, err := h.webauthnRepo.ListByUser(ctx, userID)
+		if err != nil {
+			log.Printf("Error listing WebAuthn credentials: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+			return
+		}
+		if len(credentials) == 1 && credentials[0].ID == id {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the only passkey of an account without a password"})
+			return
+		}
+	}
+
+	deleted, err := h.webauthnRepo.Delete(ctx, userID, id)
+	if err != nil {
+		log.Printf("Error deleting WebAuthn credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// loadUser returns user with their registered passkeys.
+func (h *WebAuthnHandler) loadUser(ctx context.Context, user *models.User, handle []byte) (*webauthnUser, error) {
+	records, err := h.webauthnRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	waUser := &webauthnUser{user: user, handle: handle}
+	for _, record := range records {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(record.Data, &credential); err != nil {
+			return nil, err
+		}
+		waUser.credentials = append(waUser.credentials, credential)
+	}
+	return waUser, nil
+}
+
+func (h *WebAuthnHandler) saveSession(ctx context.Context, ceremony string, userID *int, data webauthnSessionData) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return h.webauthnRepo.CreateSession(ctx, &models.WebAuthnSession{
+		Challenge: data.Session.Challenge,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Data:      encoded,
+	}, webauthnSessionTTL)
+}
+
+// consumeSession looks up the ceremony answered by the client. The stored
+// session is nil if the challenge is unknown, expired or already used.
+func (h *WebAuthnHandler) consumeSession(ctx context.Context, ceremony, challenge string) (*models.WebAuthnSession, *webauthnSessionData, error) {
+	stored, err := h.webauthnRepo.ConsumeSession(ctx, ceremony, challenge)
+	if err != nil || stored == nil {
+		return nil, nil, err
+	}
+
+	var data webauthnSessionData
+	if err := json.Unmarshal(stored.Data, &data); err != nil {
+		return nil, nil, err
+	}
+	return stored, &data, nil
+}
+
+func newCredentialRecord(userID int, name string, credential *webauthn.Credential) (*models.WebAuthnCredential, error) {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = defaultPasskeyName
+	}
+
+	return &models.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		Name:         name,
+		Data:         data,
+	}, nil
+}
+
+// newUserHandle returns a random WebAuthn user handle. Handles are random
+// rather than derived from the user ID so that they reveal nothing about the
+// account.
+func newUserHandle() ([]byte, error) {
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The WebAuthn tests run as part of AuthHandlerTestSuite, which sets up the
+// routes. Browsers and authenticators are played by softAuthenticator.
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:5173"
+)
+
+// softAuthenticator is a software passkey holding a single P-256 credential.
+// It answers ceremonies the way a browser and platform authenticator would,
+// without attestation.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID, signCount: 1}
+}
+
+var b64 = base64.RawURLEncoding
+
+// create answers the options returned by a registration or signup begin
+// endpoint.
+func (a *softAuthenticator) create(optionsJSON []byte) json.RawMessage {
+	var options struct {
+		PublicKey struct {
+			Challenge protocol.URLEncodedBase64 `json:"challenge"`
+			User      struct {
+				ID protocol.URLEncodedBase64 `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	require.NoError(a.t, json.Unmarshal(optionsJSON, &options))
+	a.userHandle = options.PublicKey.User.ID
+
+	clientData := a.clientData("webauthn.create", options.PublicKey.Challenge)
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(a.t, err)
+
+	authData := a.authData(0x40) // attested credential data included
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	require.NoError(a.t, err)
+
+	return a.marshal(map[string]string{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"attestationObject": b64.EncodeToString(attestation),
+	})
+}
+
+// get answers the options returned by the login begin endpoint.
+func (a *softAuthenticator) get(optionsJSON []byte) json.RawMessage {
+	var options struct {
+		PublicKey struct {
+			Challenge protocol.URLEncodedBase64 `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	require.NoError(a.t, json.Unmarshal(optionsJSON, &options))
+
+	a.signCount++
+	clientData := a.clientData("webauthn.get", options.PublicKey.Challenge)
+	authData := a.authData(0)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(a.t, err)
+
+	return a.marshal(map[string]string{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": b64.EncodeToString(challenge),
+		"origin":    testOrigin,
+	})
+	return data
+}
+
+// authData returns the authenticator data header with the user present and
+// user verified flags set in addition to flags.
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags|0x01|0x04)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) marshal(response map[string]string) json.RawMessage {
+	data, _ := json.Marshal(map[string]interface{}{
+		"id":       b64.EncodeToString(a.credentialID),
+		"rawId":    b64.EncodeToString(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	return data
+}
+
+// passkeySignup creates a passwordless account with a new passkey.
+func (suite *AuthHandlerTestSuite) passkeySignup(email string) (*softAuthenticator, models.AuthResponse) {
+	authenticator := newSoftAuthenticator(suite.T())
+
+	w := suite.postJSON("/webauthn/signup/begin", models.WebAuthnSignupRequest{Email: email, Name: "Passkey User"})
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	w = suite.postJSON("/webauthn/signup/finish", models.WebAuthnFinishRequest{Credential: authenticator.create(w.Body.Bytes())})
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	var response models.AuthResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	return authenticator, response
+}
+
+func (suite *AuthHandlerTestSuite) passkeyLogin(authenticator *softAuthenticator) *httptest.ResponseRecorder {
+	w := suite.postJSON("/webauthn/login/begin", nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	return suite.postJSON("/webauthn/login/finish", models.WebAuthnFinishRequest{Credential: authenticator.get(w.Body.Bytes())})
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeySignup_CreatesPasswordlessAccount() {
+	_, response := suite.passkeySignup("passkey@example.com")
+
+	assert.NotEmpty(suite.T(), response.Token)
+	assert.Equal(suite.T(), "passkey@example.com", response.User.Email)
+	assert.NotEmpty(suite.T(), suite.notifier.verificationToken("passkey@example.com"))
+
+	w := suite.postJSON("/login", models.LoginRequest{Email: "passkey@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code, "The account should have no password")
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeySignup_ExistingEmail() {
+	suite.register("taken@example.com", "password123")
+
+	w := suite.postJSON("/webauthn/signup/begin", models.WebAuthnSignupRequest{Email: "taken@example.com", Name: "Taken"})
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeyLogin_Success() {
+	authenticator, signup := suite.passkeySignup("passkeylogin@example.com")
+
+	w := suite.passkeyLogin(authenticator)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+	var response models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotEmpty(suite.T(), response.Token)
+	assert.Equal(suite.T(), signup.User.ID, response.User.ID)
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeyLogin_ChallengeSingleUse() {
+	authenticator, _ := suite.passkeySignup("passkeyonce@example.com")
+	w := suite.postJSON("/webauthn/login/begin", nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	options := w.Body.Bytes()
+
+	w = suite.postJSON("/webauthn/login/finish", models.WebAuthnFinishRequest{Credential: authenticator.get(options)})
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	w = suite.postJSON("/webauthn/login/finish", models.WebAuthnFinishRequest{Credential: authenticator.get(options)})
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeyLogin_UnknownCredential() {
+	suite.passkeySignup("known@example.com")
+	stranger := newSoftAuthenticator(suite.T())
+	stranger.userHandle = []byte("someone-else")
+
+	w := suite.passkeyLogin(stranger)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestPasskeyLogin_RejectsReplayedCounter() {
+	authenticator, _ := suite.passkeySignup("clone@example.com")
+	suite.Require().Equal(http.StatusOK, suite.passkeyLogin(authenticator).Code)
+
+	// A copy of the key whose counter has fallen behind
+	authenticator.signCount -= 2
+	w := suite.passkeyLogin(authenticator)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestRegisterPasskey_AlongsidePassword() {
+	registered := suite.register("both@example.com", "password123")
+	authenticator := newSoftAuthenticator(suite.T())
+
+	w := suite.authedRequest("POST", "/webauthn/register/begin", registered.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	body, _ := json.Marshal(models.WebAuthnFinishRequest{Name: "Laptop", Credential: authenticator.create(w.Body.Bytes())})
+	w = suite.authedRequest("POST", "/webauthn/register/finish", registered.Token, body)
+	suite.Require().Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	w = suite.passkeyLogin(authenticator)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.postJSON("/login", models.LoginRequest{Email: "both@example.com", Password: "password123"})
+	assert.Equal(suite.T(), http.StatusOK, w.Code, "The password should still work")
+
+	w = suite.authedRequest("GET", "/webauthn/credentials", registered.Token, nil)
+	var credentials []models.WebAuthnCredential
+	json.Unmarshal(w.Body.Bytes(), &credentials)
+	assert.Len(suite.T(), credentials, 1)
+	assert.Equal(suite.T(), "Laptop", credentials[0].Name)
+	assert.NotNil(suite.T(), credentials[0].LastUsedAt)
+}
+
+func (suite *AuthHandlerTestSuite) TestRegisterPasskey_ChallengeBelongsToUser() {
+	first := suite.register("first@example.com", "password123")
+	second := suite.register("second@example.com", "password123")
+	authenticator := newSoftAuthenticator(suite.T())
+
+	w := suite.authedRequest("POST", "/webauthn/register/begin", first.Token, nil)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	body, _ := json.Marshal(models.WebAuthnFinishRequest{Credential: authenticator.create(w.Body.Bytes())})
+	w = suite.authedRequest("POST", "/webauthn/register/finish", second.Token, body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestDeletePasskey_KeepsLastPasskeyOfPasswordlessAccount() {
+	_, signup := suite.passkeySignup("onlypasskey@example.com")
+	w := suite.authedRequest("GET", "/webauthn/credentials", signup.Token, nil)
+	var credentials []models.WebAuthnCredential
+	json.Unmarshal(w.Body.Bytes(), &credentials)
+	suite.Require().Len(credentials, 1)
+
+	w = suite.authedRequest("DELETE", fmt.Sprintf("/webauthn/credentials/%d", credentials[0].ID), signup.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *AuthHandlerTestSuite) TestDeletePasskey_OtherUsersPasskey() {
+	_, owner := suite.passkeySignup("owner@example.com")
+	other := suite.register("other@example.com", "password123")
+	w := suite.authedRequest("GET", "/webauthn/credentials", owner.Token, nil)
+	var credentials []models.WebAuthnCredential
+	json.Unmarshal(w.Body.Bytes(), &credentials)
+	suite.Require().Len(credentials, 1)
+
+	w = suite.authedRequest("DELETE", fmt.Sprintf("/webauthn/credentials/%d", credentials[0].ID), other.Token, nil)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
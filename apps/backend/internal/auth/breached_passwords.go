@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachedPasswords looks passwords up in a corpus of ones exposed in data
+// breaches.
+type BreachedPasswords interface {
+	// Count returns how many times password appears in the corpus, or 0 if
+	// it doesn't.
+	Count(password string) (int, error)
+}
+
+// maxBreachLine is longer than any line of a corpus: a 40 character hash, a
+// colon and a count.
+const maxBreachLine = 128
+
+// breachScanSize is the size of the region of a sorted corpus file that is
+// read line by line once a binary search has narrowed it down.
+const breachScanSize = 16 * 1024
+
+// OpenBreachedPasswords opens a corpus of SHA-1 password hashes in the format
+// Have I Been Pwned's Pwned Passwords are distributed in. path is either
+//
+//   - a directory of range files, one named <PREFIX>.txt for each 5 character
+//     hash prefix, whose lines hold the rest of a hash and a count as
+//     "SUFFIX:COUNT", which is how the k-anonymity range API serves them and
+//     how its downloader saves them, or
+//   - a single file of "HASH:COUNT" lines ordered by hash.
+//
+// Neither is loaded into memory; each lookup reads just the part of the
+// corpus that could hold the password. Counts are optional.
+func OpenBreachedPasswords(path string) (BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords: %w", err)
+	}
+	if info.IsDir() {
+		return breachedPasswordRanges{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords: %w", err)
+	}
+	return &breachedPasswordFile{f: f, size: info.Size()}, nil
+}
+
+// breachedPasswordRanges is a directory of k-anonymity range files.
+type breachedPasswordRanges struct {
+	dir string
+}
+
+func (r breachedPasswordRanges) Count(password string) (int, error) {
+	hash := sha1Hex(password)
+
+	f, err := os.Open(filepath.Join(r.dir, hash[:5]+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		// No breached password has this prefix
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read breached passwords: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if suffix, count := parseBreachLine(scanner.Bytes()); suffix == hash[5:] {
+			return count, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read breached passwords: %w", err)
+	}
+	return 0, nil
+}
+
+// breachedPasswordFile is a single file of hashes in order, searched by
+// bisecting it.
+type breachedPasswordFile struct {
+	f    *os.File
+	size int64
+}
+
+func (b *breachedPasswordFile) Count(password string) (int, error) {
+	hash := sha1Hex(password)
+
+	// The line holding hash, if any, starts in [lo, hi)
+	lo, hi := int64(0), b.size
+	for hi-lo > breachScanSize {
+		mid := lo + (hi-lo)/2
+		start, line, err := b.lineAt(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		found, count := parseBreachLine(line)
+		switch strings.Compare(found, hash) {
+		case 0:
+			return count, nil
+		case -1:
+			lo = start + 1
+		default:
+			hi = start
+		}
+	}
+
+	return b.scan(lo, hi, hash)
+}
+
+// lineAt returns the first line starting at or after offset, and where it
+// starts. At the end of the file the line is empty.
+func (b *breachedPasswordFile) lineAt(offset int64) (int64, []byte, error) {
+	buf, from, err := b.linesFrom(offset, offset+maxBreachLine)
+	if err != nil {
+		return 0, nil, err
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	}
+	return from, buf, nil
+}
+
+// scan reads the lines starting in [lo, hi) looking for hash.
+func (b *breachedPasswordFile) scan(lo, hi int64, hash string) (int, error) {
+	buf, from, err := b.linesFrom(lo, hi+maxBreachLine)
+	if err != nil {
+		return 0, err
+	}
+
+	for len(buf) > 0 && from < hi {
+		line, rest, _ := bytes.Cut(buf, []byte{'\n'})
+		if found, count := parseBreachLine(line); found == hash {
+			return count, nil
+		}
+		from += int64(len(buf) - len(rest))
+		buf = rest
+	}
+	return 0, nil
+}
+
+// linesFrom reads the file up to end, starting from the first line that
+// starts at or after offset, and returns what it read and where it started.
+func (b *breachedPasswordFile) linesFrom(offset, end int64) ([]byte, int64, error) {
+	// Reading from the byte before offset finds lines that start exactly at it
+	from := max(offset-1, 0)
+	end = min(end+maxBreachLine, b.size)
+	if from >= end {
+		return nil, b.size, nil
+	}
+
+	buf := make([]byte, end-from)
+	n, err := b.f.ReadAt(buf, from)
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("failed to read breached passwords: %w", err)
+	}
+	buf = buf[:n]
+
+	if offset > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return nil, b.size, nil
+		}
+		buf = buf[i+1:]
+		from += int64(i + 1)
+	}
+	return buf, from, nil
+}
+
+// parseBreachLine splits a "HASH:COUNT" line into an upper case hash, or hash
+// suffix, and a count, which is 1 if missing.
+func parseBreachLine(line []byte) (string, int) {
+	hash, countText, _ := strings.Cut(strings.TrimSpace(string(line)), ":")
+	count, err := strconv.Atoi(countText)
+	if err != nil || count < 1 {
+		count = 1
+	}
+	return strings.ToUpper(hash), count
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// breachedPasswords are enough passwords to make a corpus file that has to
+// be bisected rather than read in one go.
+func breachedPasswords() map[string]int {
+	passwords := map[string]int{}
+	for i := 1; i <= 2000; i++ {
+		passwords[fmt.Sprintf("breached-%d", i)] = i
+	}
+	return passwords
+}
+
+func TestOpenBreachedPasswords_File(t *testing.T) {
+	passwords := breachedPasswords()
+	var lines []string
+	for password, count := range passwords {
+		lines = append(lines, fmt.Sprintf("%s:%d\r\n", sha1Hex(password), count))
+	}
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "")), 0o600))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Greater(t, info.Size(), int64(breachScanSize))
+
+	corpus, err := OpenBreachedPasswords(path)
+	require.NoError(t, err)
+
+	for password, count := range passwords {
+		found, err := corpus.Count(password)
+		require.NoError(t, err)
+		require.Equal(t, count, found, password)
+	}
+	found, err := corpus.Count("not-breached")
+	require.NoError(t, err)
+	assert.Zero(t, found)
+}
+
+func TestOpenBreachedPasswords_Ranges(t *testing.T) {
+	dir := t.TempDir()
+	hash := sha1Hex("breached-1")
+	// Range files may be in lower case and counts are optional
+	content := "0000000000000000000000000000000000A:2\n" + strings.ToLower(hash[5:]) + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(content), 0o600))
+
+	corpus, err := OpenBreachedPasswords(dir)
+	require.NoError(t, err)
+
+	found, err := corpus.Count("breached-1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, found)
+
+	found, err = corpus.Count("not-breached")
+	require.NoError(t, err)
+	assert.Zero(t, found, "Prefixes without a range file have no breached passwords")
+}
+
+func TestOpenBreachedPasswords_Missing(t *testing.T) {
+	_, err := OpenBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"))
+
+	assert.Error(t, err)
+}
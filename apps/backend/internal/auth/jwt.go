@@ -3,48 +3,218 @@ package auth
 import (
 	"errors"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenTTL is the lifetime of access tokens. Clients renew them with a
+// refresh token rather than re-sending credentials.
+var AccessTokenTTL = 15 * time.Minute
+
+// MFAPendingTTL is the lifetime of the token returned by the password step of
+// a login that still needs a second factor.
+var MFAPendingTTL = 5 * time.Minute
+
+// PurposeMFAPending marks a token that only proves the password step of a
+// login. It can be exchanged for a real access token and nothing else.
+const PurposeMFAPending = "mfa_pending"
+
+// PurposeOAuthAccess marks an access token issued to an OAuth client. It is
+// only accepted by the userinfo endpoint, not by the rest of the API.
+const PurposeOAuthAccess = "oauth_access"
+
+// PurposeIDToken marks an OpenID Connect ID token issued to a client. ID
+// tokens tell the client who logged in and are never accepted by the API.
+const PurposeIDToken = "id_token"
+
+var (
+	keyMu   sync.RWMutex
+	keyRing *KeyRing
+)
+
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID        int    `json:"user_id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// Purpose is empty for access tokens. Tokens with a purpose must not be
+	// accepted as access tokens.
+	Purpose string `json:"purpose,omitempty"`
+	// Scope lists the space-separated scopes granted to an OAuth client
+	Scope string `json:"scope,omitempty"`
+	// Roles and the permissions they grant, as of when the token was issued
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// OrgID is the organization the session has switched to, and OrgRole the
+	// user's role in it when the token was issued. Both are empty otherwise.
+	OrgID   int    `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// ServiceAccountID is set instead of UserID on tokens issued to a
+	// service account with the client_credentials grant
+	ServiceAccountID int `json:"service_account_id,omitempty"`
+	// SessionID identifies the login a user's access token was issued for,
+	// so that ending the session revokes it
+	SessionID string `json:"sid,omitempty"`
+	// IssuedAtMilli is the issue time in Unix milliseconds. iat only has
+	// second precision, which cannot tell a token issued just after a
+	// revocation from one issued just before it.
+	IssuedAtMilli int64 `json:"iat_ms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int, email string) (string, error) {
+// IDTokenClaims are the claims of an OpenID Connect ID token issued to a
+// client. Profile claims are only set for the scopes the user granted.
+type IDTokenClaims struct {
+	// Purpose is always PurposeIDToken, so that the API can tell ID tokens
+	// from access tokens signed with the same keys
+	Purpose       string `json:"purpose"`
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// SetKeyRing configures the keys used to sign and verify tokens. Passing nil
+// restores the default, an HS256 key read from JWT_SECRET on each call.
+func SetKeyRing(ring *KeyRing) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	keyRing = ring
+}
+
+// SetSigningKey configures a ring holding only key. Passing nil restores the
+// JWT_SECRET default.
+func SetSigningKey(key *Key) {
+	if key == nil {
+		SetKeyRing(nil)
+		return
+	}
+	ring, _ := NewKeyRing(key)
+	SetKeyRing(ring)
+}
+
+func currentKeyRing() (*KeyRing, error) {
+	keyMu.RLock()
+	ring := keyRing
+	keyMu.RUnlock()
+	if ring != nil {
+		return ring, nil
+	}
+
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
-		return "", errors.New("JWT_SECRET not set")
+		return nil, errors.New("JWT_SECRET not set")
+	}
+	return NewKeyRing(NewHMACKey("", []byte(secret)))
+}
+
+// PublicJWKS returns the public keys that verify our tokens. It is empty when
+// tokens are signed with a shared secret.
+func PublicJWKS() JWKS {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return ring.JWKS()
+}
+
+func GenerateToken(userID int, email string) (string, error) {
+	return SignClaims(Claims{UserID: userID, Email: email})
+}
+
+// SignClaims signs an access token carrying claims. A jti, issue time and
+// expiry are filled in when not already set.
+func SignClaims(claims Claims) (string, error) {
+	if claims.IssuedAt == nil {
+		now := time.Now()
+		claims.IssuedAt = jwt.NewNumericDate(now)
+		claims.IssuedAtMilli = now.UnixMilli()
+	}
+	if err := fillRegisteredClaims(&claims.RegisteredClaims); err != nil {
+		return "", err
+	}
+	return sign(claims)
+}
+
+// SignIDToken signs an ID token with the same keys as access tokens, so that
+// clients can verify it against our JWKS. A jti, issue time and expiry are
+// filled in when not already set.
+func SignIDToken(claims IDTokenClaims) (string, error) {
+	claims.Purpose = PurposeIDToken
+	if err := fillRegisteredClaims(&claims.RegisteredClaims); err != nil {
+		return "", err
+	}
+	return sign(claims)
+}
+
+// SigningAlgorithm returns the algorithm new tokens are signed with.
+func SigningAlgorithm() (string, error) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return "", err
+	}
+	key, err := ring.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return key.Algorithm, nil
+}
+
+func fillRegisteredClaims(claims *jwt.RegisteredClaims) error {
+	if claims.ID == "" {
+		id, err := randomString(16)
+		if err != nil {
+			return err
+		}
+		claims.ID = id
+	}
+	now := time.Now()
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(now)
 	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(AccessTokenTTL))
+	}
+	return nil
+}
 
-	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+func sign(claims jwt.Claims) (string, error) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return "", err
+	}
+	key, err := ring.SigningKey()
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	token := jwt.NewWithClaims(key.Method(), claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.signKey)
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return nil, errors.New("JWT_SECRET not set")
+	ring, err := currentKeyRing()
+	if err != nil {
+		return nil, err
 	}
 
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Tokens signed by the JWT_SECRET default carry no kid
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ring.Lookup(kid)
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.Algorithm {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(secret), nil
-	})
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}))
 
 	if err != nil {
 		return nil, err
@@ -48,6 +48,34 @@ func TestValidateToken_ValidToken(t *testing.T) {
 	assert.Equal(t, email, claims.Email)
 }
 
+func TestGenerateToken_UniqueID(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key")
+	defer os.Unsetenv("JWT_SECRET")
+
+	token1, _ := GenerateToken(1, "test@example.com")
+	token2, _ := GenerateToken(1, "test@example.com")
+	claims1, _ := ValidateToken(token1)
+	claims2, _ := ValidateToken(token2)
+
+	assert.NotEmpty(t, claims1.ID, "Token should carry a jti")
+	assert.NotEqual(t, claims1.ID, claims2.ID)
+}
+
+func TestSignClaims_CustomClaims(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key")
+	defer os.Unsetenv("JWT_SECRET")
+
+	token, err := SignClaims(Claims{UserID: 9, Email: "verified@example.com", EmailVerified: true})
+	assert.NoError(t, err)
+
+	claims, err := ValidateToken(token)
+	assert.NoError(t, err)
+	assert.True(t, claims.EmailVerified)
+	assert.NotEmpty(t, claims.ID)
+	assert.NotNil(t, claims.ExpiresAt)
+	assert.Equal(t, claims.IssuedAt.Unix(), claims.IssuedAtMilli/1000, "iat_ms refines iat")
+}
+
 func TestValidateToken_InvalidToken(t *testing.T) {
 	os.Setenv("JWT_SECRET", "test-secret-key")
 	defer os.Unsetenv("JWT_SECRET")
@@ -121,3 +149,21 @@ func TestValidateToken_MissingSecret(t *testing.T) {
 	assert.Nil(t, claims)
 	assert.Equal(t, "JWT_SECRET not set", err.Error())
 }
+
+func TestValidateToken_CarriesRolesAndPermissions(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key")
+	defer os.Unsetenv("JWT_SECRET")
+
+	token, err := SignClaims(Claims{
+		UserID:      1,
+		Roles:       []string{"admin"},
+		Permissions: []string{PermissionRolesRead, PermissionUsersRead},
+	})
+	assert.NoError(t, err)
+
+	claims, err := ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+	assert.True(t, claims.HasPermission(PermissionUsersRead))
+	assert.False(t, claims.HasPermission(PermissionUsersWrite))
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// KeyManifestFile lists the keys in a key directory. Each key itself is
+// stored alongside it as <kid>.pem, either as a private key or, for keys this
+// instance should only verify with, a public key.
+const KeyManifestFile = "keyring.json"
+
+type KeyManifest struct {
+	Keys []KeyManifestEntry `json:"keys"`
+}
+
+type KeyManifestEntry struct {
+	ID         string    `json:"kid"`
+	CreatedAt  time.Time `json:"created_at"`
+	ActiveFrom time.Time `json:"active_from"`
+}
+
+// ReadKeyManifest reads the manifest in dir. A missing manifest is treated as
+// an empty one.
+func ReadKeyManifest(dir string) (*KeyManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, KeyManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &KeyManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest KeyManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", KeyManifestFile, err)
+	}
+	sort.SliceStable(manifest.Keys, func(i, j int) bool {
+		return manifest.Keys[i].ActiveFrom.Before(manifest.Keys[j].ActiveFrom)
+	})
+	return &manifest, nil
+}
+
+// WriteKeyManifest replaces the manifest in dir atomically.
+func WriteKeyManifest(dir string, manifest *KeyManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, KeyManifestFile+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, KeyManifestFile))
+}
+
+// LoadKeyRingDir loads every key listed in dir's manifest.
+func LoadKeyRingDir(dir string) (*KeyRing, error) {
+	manifest, err := ReadKeyManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Keys) == 0 {
+		return nil, fmt.Errorf("no keys listed in %s", filepath.Join(dir, KeyManifestFile))
+	}
+
+	ring := newKeyRing()
+	for _, entry := range manifest.Keys {
+		key, err := loadKeyFile(entry.ID, keyPath(dir, entry.ID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %w", entry.ID, err)
+		}
+		if err := ring.add(key, entry.ActiveFrom, true); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// AddGeneratedKey generates a new key with the given algorithm, writes it to
+// dir and lists it in the manifest. It starts signing at activeFrom; until
+// then it is only published, giving every verifier time to learn about it.
+func AddGeneratedKey(dir, algorithm string, activeFrom time.Time) (KeyManifestEntry, error) {
+	data, err := generatePrivateKeyPEM(algorithm)
+	if err != nil {
+		return KeyManifestEntry{}, err
+	}
+	key, err := ParsePrivateKeyPEM("", data)
+	if err != nil {
+		return KeyManifestEntry{}, err
+	}
+
+	manifest, err := ReadKeyManifest(dir)
+	if err != nil {
+		return KeyManifestEntry{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return KeyManifestEntry{}, err
+	}
+	if err := os.WriteFile(keyPath(dir, key.ID), data, 0600); err != nil {
+		return KeyManifestEntry{}, err
+	}
+
+	entry := KeyManifestEntry{ID: key.ID, CreatedAt: time.Now().UTC(), ActiveFrom: activeFrom.UTC()}
+	manifest.Keys = append(manifest.Keys, entry)
+	if err := WriteKeyManifest(dir, manifest); err != nil {
+		return KeyManifestEntry{}, err
+	}
+	return entry, nil
+}
+
+// RetireKeys removes keys that can no longer have signed an unexpired token:
+// those replaced by a newer active key more than maxTokenLifetime ago. It
+// returns the kids of the removed keys.
+func RetireKeys(dir string, maxTokenLifetime time.Duration, now time.Time) ([]string, error) {
+	manifest, err := ReadKeyManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []KeyManifestEntry
+	var retired []string
+	for i, entry := range manifest.Keys {
+		if i+1 < len(manifest.Keys) {
+			supersededAt := manifest.Keys[i+1].ActiveFrom
+			if !supersededAt.After(now) && !supersededAt.Add(maxTokenLifetime).After(now) {
+				retired = append(retired, entry.ID)
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+
+	if len(retired) == 0 {
+		return nil, nil
+	}
+
+	manifest.Keys = kept
+	if err := WriteKeyManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	for _, kid := range retired {
+		if err := os.Remove(keyPath(dir, kid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return retired, err
+		}
+	}
+	return retired, nil
+}
+
+func keyPath(dir, kid string) string {
+	return filepath.Join(dir, kid+".pem")
+}
+
+func loadKeyFile(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block != nil && block.Type == "PUBLIC KEY" {
+		return ParsePublicKeyPEM(kid, data)
+	}
+	return ParsePrivateKeyPEM(kid, data)
+}
+
+func generatePrivateKeyPEM(algorithm string) ([]byte, error) {
+	var private interface{}
+	switch algorithm {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddGeneratedKey_WritesKeyAndManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	entry, err := AddGeneratedKey(dir, AlgEdDSA, time.Now())
+
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, entry.ID+".pem"))
+
+	manifest, err := ReadKeyManifest(dir)
+	assert.NoError(t, err)
+	require.Len(t, manifest.Keys, 1)
+	assert.Equal(t, entry.ID, manifest.Keys[0].ID)
+}
+
+func TestAddGeneratedKey_UnsupportedAlgorithm(t *testing.T) {
+	_, err := AddGeneratedKey(t.TempDir(), AlgHS256, time.Now())
+
+	assert.Error(t, err)
+}
+
+func TestLoadKeyRingDir(t *testing.T) {
+	dir := t.TempDir()
+	first, err := AddGeneratedKey(dir, AlgRS256, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	second, err := AddGeneratedKey(dir, AlgEdDSA, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	ring, err := LoadKeyRingDir(dir)
+
+	require.NoError(t, err)
+	key, err := ring.SigningKey()
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, key.ID, "The pending key should not sign yet")
+	_, ok := ring.Lookup(second.ID)
+	assert.True(t, ok)
+}
+
+func TestLoadKeyRingDir_PublicKeyIsVerifyOnly(t *testing.T) {
+	dir := t.TempDir()
+	private, _ := ParsePrivateKeyPEM("verifier", ed25519PEM(t))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "verifier.pem"), publicPEM(t, private), 0644))
+	require.NoError(t, WriteKeyManifest(dir, &KeyManifest{Keys: []KeyManifestEntry{{ID: "verifier"}}}))
+
+	ring, err := LoadKeyRingDir(dir)
+
+	require.NoError(t, err)
+	key, ok := ring.Lookup("verifier")
+	assert.True(t, ok)
+	assert.False(t, key.CanSign())
+}
+
+func TestLoadKeyRingDir_Empty(t *testing.T) {
+	_, err := LoadKeyRingDir(t.TempDir())
+
+	assert.Error(t, err)
+}
+
+func TestRetireKeys(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	oldest, _ := AddGeneratedKey(dir, AlgEdDSA, now.Add(-3*time.Hour))
+	previous, _ := AddGeneratedKey(dir, AlgEdDSA, now.Add(-2*time.Hour))
+	current, _ := AddGeneratedKey(dir, AlgEdDSA, now.Add(-10*time.Minute))
+	pending, _ := AddGeneratedKey(dir, AlgEdDSA, now.Add(10*time.Minute))
+
+	retired, err := RetireKeys(dir, 15*time.Minute, now)
+
+	require.NoError(t, err)
+	// previous was replaced only 10 minutes ago, so its tokens may still be live
+	assert.Equal(t, []string{oldest.ID}, retired)
+	assert.NoFileExists(t, filepath.Join(dir, oldest.ID+".pem"))
+
+	manifest, _ := ReadKeyManifest(dir)
+	var ids []string
+	for _, entry := range manifest.Keys {
+		ids = append(ids, entry.ID)
+	}
+	assert.Equal(t, []string{previous.ID, current.ID, pending.ID}, ids)
+}
+
+func TestRetireKeys_KeepsOnlyKey(t *testing.T) {
+	dir := t.TempDir()
+	AddGeneratedKey(dir, AlgEdDSA, time.Now().Add(-24*time.Hour))
+
+	retired, err := RetireKeys(dir, time.Minute, time.Now())
+
+	assert.NoError(t, err)
+	assert.Empty(t, retired)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// KeyRing holds every key that may have signed a live token. Exactly one key
+// signs at any moment: the most recently activated key that has private
+// material. The others remain available for verification, selected by kid,
+// until the tokens they signed have expired.
+type KeyRing struct {
+	entries []keyEntry
+	byID    map[string]*Key
+	now     func() time.Time
+}
+
+type keyEntry struct {
+	key        *Key
+	activeFrom time.Time
+	signing    bool
+}
+
+// NewKeyRing returns a ring that signs with active and additionally accepts
+// tokens signed by any of the verification keys.
+func NewKeyRing(active *Key, verification ...*Key) (*KeyRing, error) {
+	ring := newKeyRing()
+	if err := ring.add(active, time.Time{}, true); err != nil {
+		return nil, err
+	}
+	for _, key := range verification {
+		if err := ring.add(key, time.Time{}, false); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+func newKeyRing() *KeyRing {
+	return &KeyRing{byID: make(map[string]*Key), now: time.Now}
+}
+
+func (r *KeyRing) add(key *Key, activeFrom time.Time, signing bool) error {
+	if _, exists := r.byID[key.ID]; exists {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	r.byID[key.ID] = key
+	r.entries = append(r.entries, keyEntry{key: key, activeFrom: activeFrom, signing: signing})
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		return r.entries[i].activeFrom.Before(r.entries[j].activeFrom)
+	})
+	return nil
+}
+
+// SigningKey returns the key new tokens are signed with.
+func (r *KeyRing) SigningKey() (*Key, error) {
+	now := r.now()
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		entry := r.entries[i]
+		if entry.signing && entry.key.CanSign() && !entry.activeFrom.After(now) {
+			return entry.key, nil
+		}
+	}
+	return nil, errors.New("no active signing key")
+}
+
+// Lookup returns the key with the given kid.
+func (r *KeyRing) Lookup(kid string) (*Key, bool) {
+	key, ok := r.byID[kid]
+	return key, ok
+}
+
+// JWKS returns the public half of every asymmetric key in the ring, including
+// keys that are not active yet so that verifiers learn about them in advance.
+func (r *KeyRing) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, entry := range r.entries {
+		if jwk, ok := entry.key.PublicJWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing_SignsWithActiveKey(t *testing.T) {
+	active, _ := ParsePrivateKeyPEM("active", ed25519PEM(t))
+	old, _ := ParsePrivateKeyPEM("old", ed25519PEM(t))
+
+	ring, err := NewKeyRing(active, old)
+	require.NoError(t, err)
+
+	key, err := ring.SigningKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "active", key.ID)
+}
+
+func TestKeyRing_DuplicateKid(t *testing.T) {
+	first, _ := ParsePrivateKeyPEM("same", ed25519PEM(t))
+	second, _ := ParsePrivateKeyPEM("same", ed25519PEM(t))
+
+	_, err := NewKeyRing(first, second)
+
+	assert.Error(t, err)
+}
+
+func TestKeyRing_PendingKeyDoesNotSignYet(t *testing.T) {
+	now := time.Now()
+	current, _ := ParsePrivateKeyPEM("current", ed25519PEM(t))
+	next, _ := ParsePrivateKeyPEM("next", ed25519PEM(t))
+
+	ring := newKeyRing()
+	ring.now = func() time.Time { return now }
+	require.NoError(t, ring.add(current, now.Add(-time.Hour), true))
+	require.NoError(t, ring.add(next, now.Add(10*time.Minute), true))
+
+	key, _ := ring.SigningKey()
+	assert.Equal(t, "current", key.ID)
+	assert.Len(t, ring.JWKS().Keys, 2, "Pending keys are published ahead of time")
+
+	now = now.Add(11 * time.Minute)
+	key, _ = ring.SigningKey()
+	assert.Equal(t, "next", key.ID)
+}
+
+func TestKeyRing_NoSigningKey(t *testing.T) {
+	private, _ := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+	public, _ := ParsePublicKeyPEM("ed-1", publicPEM(t, private))
+	ring, _ := NewKeyRing(public)
+
+	_, err := ring.SigningKey()
+
+	assert.Error(t, err)
+}
+
+func TestKeyRing_OldTokensValidAfterRotation(t *testing.T) {
+	old, _ := ParsePrivateKeyPEM("old", ed25519PEM(t))
+	SetSigningKey(old)
+	token, err := GenerateToken(3, "rotate@example.com")
+	require.NoError(t, err)
+
+	next, _ := ParsePrivateKeyPEM("next", rsaPEM(t))
+	ring, _ := NewKeyRing(next, old)
+	SetKeyRing(ring)
+	defer SetKeyRing(nil)
+
+	claims, err := ValidateToken(token)
+	assert.NoError(t, err, "Tokens signed by a verification key stay valid")
+	assert.Equal(t, 3, claims.UserID)
+
+	// Once the old key is dropped its tokens are rejected
+	ring, _ = NewKeyRing(next)
+	SetKeyRing(ring)
+
+	claims, err = ValidateToken(token)
+	assert.Error(t, err)
+	assert.Nil(t, claims)
+}
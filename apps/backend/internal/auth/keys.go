@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms supported for access tokens.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a JWT key identified by its kid. Asymmetric keys loaded from a
+// public key can verify tokens but not sign them.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey returns an HS256 key. HMAC keys are never published in the JWKS.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: AlgHS256, signKey: secret, verifyKey: secret}
+}
+
+// ParsePrivateKeyPEM parses an RSA (PKCS#1 or PKCS#8) or Ed25519 (PKCS#8)
+// private key. The algorithm follows from the key type. If id is empty, the
+// key's RFC 7638 thumbprint is used as its kid.
+func ParsePrivateKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	var key *Key
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key = &Key{Algorithm: AlgRS256, signKey: k, verifyKey: &k.PublicKey}
+	case ed25519.PrivateKey:
+		key = &Key{Algorithm: AlgEdDSA, signKey: k, verifyKey: k.Public()}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	return withID(key, id)
+}
+
+// ParsePublicKeyPEM parses an RSA or Ed25519 public key (PKIX) into a
+// verification-only key.
+func ParsePublicKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	var key *Key
+	switch k := parsed.(type) {
+	case *rsa.PublicKey:
+		key = &Key{Algorithm: AlgRS256, verifyKey: k}
+	case ed25519.PublicKey:
+		key = &Key{Algorithm: AlgEdDSA, verifyKey: k}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", parsed)
+	}
+
+	return withID(key, id)
+}
+
+// LoadPrivateKeyFile reads a PEM private key from disk. See ParsePrivateKeyPEM.
+func LoadPrivateKeyFile(id, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(id, data)
+}
+
+func withID(key *Key, id string) (*Key, error) {
+	if id == "" {
+		thumbprint, err := key.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		id = thumbprint
+	}
+	key.ID = id
+	return key, nil
+}
+
+// CanSign reports whether the key holds private material.
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// Method returns the jwt signing method for the key's algorithm.
+func (k *Key) Method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK returns the public half of an asymmetric key. It returns false
+// for HMAC keys, which must never be published.
+func (k *Key) PublicJWK() (JWK, bool) {
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: AlgRS256,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: AlgEdDSA,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of an asymmetric key.
+func (k *Key) Thumbprint() (string, error) {
+	jwk, ok := k.PublicJWK()
+	if !ok {
+		return "", errors.New("thumbprints are only defined for asymmetric keys")
+	}
+
+	// The required members, in lexicographic order and without whitespace
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	encoded, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaPEM(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func ed25519PEM(t *testing.T) []byte {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicPEM(t *testing.T, key *Key) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key.verifyKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParsePrivateKeyPEM_RSA(t *testing.T) {
+	key, err := ParsePrivateKeyPEM("rsa-1", rsaPEM(t))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "rsa-1", key.ID)
+	assert.Equal(t, AlgRS256, key.Algorithm)
+	assert.True(t, key.CanSign())
+}
+
+func TestParsePrivateKeyPEM_Ed25519(t *testing.T) {
+	key, err := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+
+	assert.NoError(t, err)
+	assert.Equal(t, AlgEdDSA, key.Algorithm)
+	assert.True(t, key.CanSign())
+}
+
+func TestParsePrivateKeyPEM_DefaultsIDToThumbprint(t *testing.T) {
+	key, err := ParsePrivateKeyPEM("", ed25519PEM(t))
+	require.NoError(t, err)
+
+	thumbprint, err := key.Thumbprint()
+	assert.NoError(t, err)
+	assert.Equal(t, thumbprint, key.ID)
+	assert.Len(t, key.ID, 43, "Base64url SHA-256 is 43 characters")
+}
+
+func TestParsePrivateKeyPEM_Invalid(t *testing.T) {
+	_, err := ParsePrivateKeyPEM("bad", []byte("not a pem file"))
+
+	assert.Error(t, err)
+}
+
+func TestParsePublicKeyPEM_VerifyOnly(t *testing.T) {
+	private, _ := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+
+	key, err := ParsePublicKeyPEM("ed-1", publicPEM(t, private))
+
+	assert.NoError(t, err)
+	assert.Equal(t, AlgEdDSA, key.Algorithm)
+	assert.False(t, key.CanSign())
+}
+
+func TestLoadPrivateKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	require.NoError(t, os.WriteFile(path, rsaPEM(t), 0600))
+
+	key, err := LoadPrivateKeyFile("file-key", path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "file-key", key.ID)
+}
+
+func TestAsymmetricToken_RoundTrip(t *testing.T) {
+	for name, data := range map[string][]byte{"RS256": rsaPEM(t), "EdDSA": ed25519PEM(t)} {
+		t.Run(name, func(t *testing.T) {
+			key, err := ParsePrivateKeyPEM("kid-"+name, data)
+			require.NoError(t, err)
+			SetSigningKey(key)
+			defer SetSigningKey(nil)
+
+			token, err := GenerateToken(7, "asym@example.com")
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, name, parsed.Method.Alg())
+			assert.Equal(t, "kid-"+name, parsed.Header["kid"])
+
+			claims, err := ValidateToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, 7, claims.UserID)
+		})
+	}
+}
+
+func TestAsymmetricToken_VerifyOnlyKeyCannotSign(t *testing.T) {
+	private, _ := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+	public, _ := ParsePublicKeyPEM("ed-1", publicPEM(t, private))
+
+	SetSigningKey(private)
+	token, err := GenerateToken(1, "test@example.com")
+	require.NoError(t, err)
+
+	SetSigningKey(public)
+	defer SetSigningKey(nil)
+
+	claims, err := ValidateToken(token)
+	assert.NoError(t, err, "Public key should verify tokens")
+	assert.Equal(t, 1, claims.UserID)
+
+	_, err = GenerateToken(1, "test@example.com")
+	assert.Error(t, err, "Public key should not mint tokens")
+}
+
+func TestAsymmetricToken_RejectsHMACWithPublicKey(t *testing.T) {
+	key, _ := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+	SetSigningKey(key)
+	defer SetSigningKey(nil)
+
+	// Classic algorithm confusion: HS256 signed with the public key bytes
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 1})
+	forged.Header["kid"] = "ed-1"
+	tokenString, err := forged.SignedString([]byte(key.verifyKey.(ed25519.PublicKey)))
+	require.NoError(t, err)
+
+	claims, err := ValidateToken(tokenString)
+
+	assert.Error(t, err)
+	assert.Nil(t, claims)
+}
+
+func TestAsymmetricToken_RejectsUnknownKid(t *testing.T) {
+	key, _ := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+	SetSigningKey(key)
+	token, _ := GenerateToken(1, "test@example.com")
+
+	other, _ := ParsePrivateKeyPEM("ed-2", ed25519PEM(t))
+	SetSigningKey(other)
+	defer SetSigningKey(nil)
+
+	claims, err := ValidateToken(token)
+
+	assert.Error(t, err)
+	assert.Nil(t, claims)
+}
+
+func TestPublicJWKS(t *testing.T) {
+	rsaKey, _ := ParsePrivateKeyPEM("rsa-1", rsaPEM(t))
+	SetSigningKey(rsaKey)
+	defer SetSigningKey(nil)
+
+	jwks := PublicJWKS()
+
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "rsa-1", jwks.Keys[0].Kid)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.NotEmpty(t, jwks.Keys[0].N)
+
+	edKey, _ := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+	SetSigningKey(edKey)
+	jwks = PublicJWKS()
+
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+}
+
+func TestPublicJWKS_EmptyForHMAC(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key")
+	defer os.Unsetenv("JWT_SECRET")
+
+	jwks := PublicJWKS()
+
+	assert.Empty(t, jwks.Keys, "Shared secrets must never be published")
+}
+
+func TestSignIDToken(t *testing.T) {
+	key, _ := ParsePrivateKeyPEM("ed-1", ed25519PEM(t))
+	SetSigningKey(key)
+	defer SetSigningKey(nil)
+
+	verified := true
+	tokenString, err := SignIDToken(IDTokenClaims{
+		Nonce:            "nonce-1",
+		Email:            "id@example.com",
+		EmailVerified:    &verified,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "42", Audience: jwt.ClaimStrings{"client-1"}},
+	})
+	require.NoError(t, err)
+
+	var claims IDTokenClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return key.verifyKey, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ed-1", token.Header["kid"])
+	assert.Equal(t, "nonce-1", claims.Nonce)
+	assert.Equal(t, "42", claims.Subject)
+	assert.True(t, *claims.EmailVerified)
+	assert.NotNil(t, claims.ExpiresAt)
+
+	alg, err := SigningAlgorithm()
+	assert.NoError(t, err)
+	assert.Equal(t, AlgEdDSA, alg)
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can
+// be told apart from JWTs and recognised by secret scanners.
+const PersonalAccessTokenPrefix = "pat_"
+
+// RefreshTokenTTL is how long a refresh token can be exchanged before it expires.
+var RefreshTokenTTL = 30 * 24 * time.Hour
+
+// EmailVerificationTTL is how long an emailed verification link stays valid.
+var EmailVerificationTTL = 24 * time.Hour
+
+// PasswordResetTTL is how long an emailed password reset link stays valid.
+var PasswordResetTTL = time.Hour
+
+// MagicLinkTTL is how long an emailed login link stays valid.
+var MagicLinkTTL = 15 * time.Minute
+
+// AccountUnlockTTL is how long the unlock link emailed when an account is
+// locked out stays valid.
+var AccountUnlockTTL = 24 * time.Hour
+
+// AccountDeletionGracePeriod is how long a deleted account is kept, and can
+// be restored with the emailed link, before it is purged.
+var AccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// OrgInvitationTTL is how long an emailed organization invitation stays valid.
+var OrgInvitationTTL = 7 * 24 * time.Hour
+
+// AuthorizationCodeTTL is how long an OAuth client has to redeem an
+// authorization code.
+var AuthorizationCodeTTL = time.Minute
+
+// GenerateOpaqueToken returns a random, URL-safe token with 256 bits of entropy.
+// Only its HashToken digest should ever be persisted.
+func GenerateOpaqueToken() (string, error) {
+	return randomString(32)
+}
+
+// GenerateFamilyID returns a random identifier shared by every refresh token
+// descended from the same login.
+func GenerateFamilyID() (string, error) {
+	return randomString(16)
+}
+
+// GenerateClientID returns a random identifier for an OAuth client.
+func GenerateClientID() (string, error) {
+	return randomString(16)
+}
+
+// GeneratePersonalAccessToken returns a new personal access token. Like other
+// opaque tokens, only its HashToken digest should be persisted.
+func GeneratePersonalAccessToken() (string, error) {
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+// IsPersonalAccessToken reports whether token looks like a personal access
+// token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// HashToken returns the hex-encoded SHA-256 digest of an opaque token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateOpaqueToken_Unique(t *testing.T) {
+	token1, err1 := GenerateOpaqueToken()
+	token2, err2 := GenerateOpaqueToken()
+
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.NotEmpty(t, token1)
+	assert.NotEqual(t, token1, token2, "Tokens should be random")
+}
+
+func TestGenerateFamilyID_Unique(t *testing.T) {
+	id1, _ := GenerateFamilyID()
+	id2, _ := GenerateFamilyID()
+
+	assert.NotEmpty(t, id1)
+	assert.NotEqual(t, id1, id2)
+}
+
+func TestHashToken_Deterministic(t *testing.T) {
+	token, _ := GenerateOpaqueToken()
+
+	assert.Equal(t, HashToken(token), HashToken(token))
+	assert.Len(t, HashToken(token), 64, "SHA-256 hex digest should be 64 characters")
+	assert.NotEqual(t, token, HashToken(token))
+}
+
+func TestHashToken_DifferentTokens(t *testing.T) {
+	assert.NotEqual(t, HashToken("token-a"), HashToken("token-b"))
+}
+
+func TestGeneratePersonalAccessToken(t *testing.T) {
+	token, err := GeneratePersonalAccessToken()
+
+	assert.NoError(t, err)
+	assert.True(t, IsPersonalAccessToken(token))
+	assert.False(t, IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig"), "JWTs are not personal access tokens")
+}
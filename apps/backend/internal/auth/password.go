@@ -1,13 +1,151 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords with one algorithm and set of parameters.
+// Hashes are self-describing, recording the algorithm, its version and
+// parameters, so CheckPassword can verify any of them whatever the current
+// hasher is.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Current reports whether hash was made with this hasher's algorithm and
+	// parameters. Hashes that aren't should be replaced at the next login.
+	Current(hash string) bool
+}
+
+// Argon2idHasher hashes passwords with argon2id, encoding them in the PHC
+// string format: $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+type Argon2idHasher struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// BcryptHasher hashes passwords with bcrypt, which only uses the first 72
+// bytes of a password. Rather than ignore the rest, it returns
+// ErrPasswordTooLong for longer ones.
+type BcryptHasher struct {
+	Cost int
+}
+
+// ErrPasswordTooLong is returned by hashers that can't use the whole of a
+// password.
+var ErrPasswordTooLong = errors.New("password is too long")
+
+// DefaultArgon2idHasher uses the parameters OWASP recommends for argon2id.
+var DefaultArgon2idHasher = Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+// PasswordHashing is the hasher HashPassword uses.
+var PasswordHashing PasswordHasher = DefaultArgon2idHasher
+
+const (
+	argon2idSaltLength = 16
+	argon2idKeyLength  = 32
+)
+
+// HashPassword hashes password with PasswordHashing.
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return PasswordHashing.Hash(password)
 }
 
+// CheckPassword reports whether password matches hash, which may have been
+// made by any supported algorithm.
 func CheckPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return checkArgon2id(password, hash)
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	default:
+		return false
+	}
+}
+
+// PasswordNeedsRehash reports whether hash should be replaced by one from
+// PasswordHashing.
+func PasswordNeedsRehash(hash string) bool {
+	return !PasswordHashing.Current(hash)
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2idKeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s",
+		argon2.Version,
+		h.params(),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Current(hash string) bool {
+	return strings.HasPrefix(hash, fmt.Sprintf("$argon2id$v=%d$%s$", argon2.Version, h.params()))
+}
+
+func (h Argon2idHasher) params() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", h.Memory, h.Iterations, h.Parallelism)
+}
+
+// checkArgon2id verifies password against an argon2id hash using the
+// parameters recorded in it.
+func checkArgon2id(password, hash string) bool {
+	// "", "argon2id", "v=19", params, salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var h Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Iterations, &h.Parallelism); err != nil {
+		return false
+	}
+	if h.Memory == 0 || h.Iterations == 0 || h.Parallelism == 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrPasswordTooLong
+	}
+	return string(bytes), err
+}
+
+func (h BcryptHasher) Current(hash string) bool {
+	if !strings.HasPrefix(hash, "$2") {
+		return false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost == h.Cost
 }
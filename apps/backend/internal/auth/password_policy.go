@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reasons a password can break a PasswordPolicy.
+const (
+	PasswordTooShort   = "too_short"
+	PasswordTooLong    = "too_long"
+	PasswordBannedWord = "banned_word"
+	PasswordTooWeak    = "too_weak"
+	PasswordBreached   = "breached"
+)
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	// MinLength is in characters.
+	MinLength int
+	// MaxBytes is the longest password accepted, in bytes. Hashers may have
+	// their own limit; bcrypt's is 72.
+	MaxBytes int
+	// MinStrength is the lowest PasswordStrength accepted, from 0 to 4.
+	MinStrength int
+	// BannedWords may not appear in any password, such as the site's name.
+	// The user's own name and email address are banned too.
+	BannedWords []string
+	// Breached, if set, rejects passwords exposed in data breaches.
+	Breached BreachedPasswords
+}
+
+// PasswordViolation is one way a password breaks a policy, with a code
+// clients can rely on and a message they can show.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// DefaultPasswordPolicy is used when no other is configured.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:   8,
+	MaxBytes:    256,
+	MinStrength: 2,
+}
+
+// Check returns every way password breaks the policy, or nil if it doesn't.
+// context holds what the user has told us about themselves, such as their
+// name and email address, which the password must not contain. It only
+// returns an error if the breached password corpus can't be read.
+func (p *PasswordPolicy) Check(password string, context ...string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		// Longer passwords aren't worth checking any further
+		return append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Password must be at most %d bytes", p.MaxBytes),
+		}), nil
+	}
+
+	if word := p.bannedWord(password, context); word != "" {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordBannedWord,
+			Message: fmt.Sprintf("Password must not contain %q", word),
+		})
+	}
+
+	if PasswordStrength(password, slices.Concat(context, p.BannedWords)...) < p.MinStrength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooWeak,
+			Message: "Password is too easy to guess",
+		})
+	}
+
+	if p.Breached != nil {
+		count, err := p.Breached.Count(password)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordBreached,
+				Message: "Password has appeared in a data breach and must not be used",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+// bannedWord returns the first banned or context word that password
+// contains, ignoring case and leet substitutions, or "".
+func (p *PasswordPolicy) bannedWord(password string, context []string) string {
+	normalized := normalizePassword(password)
+	for _, word := range contextWords(slices.Concat(context, p.BannedWords)) {
+		if strings.Contains(normalized, word) {
+			return word
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// breachedSet is a corpus of breached passwords held in memory.
+type breachedSet map[string]int
+
+func (s breachedSet) Count(password string) (int, error) {
+	return s[password], nil
+}
+
+func violationCodes(violations []PasswordViolation) []string {
+	var codes []string
+	for _, v := range violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		max      int
+		min      int
+	}{
+		{"password", 0, 0},
+		{"P@ssw0rd", 0, 0},
+		{"aaaaaaaaaaaa", 0, 0},
+		{"1234567890", 0, 0},
+		{"qwertyuiop", 0, 0},
+		{"abcdefgh", 0, 0},
+		{"password123", 1, 0},
+		{"Summer2024", 1, 0},
+		{"iloveyou2", 1, 0},
+		{"kx8fwz3m", 4, 2},
+		{"correcthorsebatterystaple", 4, 4},
+		{"Tr0ub4dor&3", 4, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			score := PasswordStrength(tt.password)
+			assert.GreaterOrEqual(t, score, tt.min)
+			assert.LessOrEqual(t, score, tt.max)
+		})
+	}
+}
+
+func TestPasswordStrength_Context(t *testing.T) {
+	assert.Less(t,
+		PasswordStrength("jonathanhallworth", "jonathan@example.com", "Jonathan Hallworth"),
+		PasswordStrength("jonathanhallworth"),
+		"Words the user has given us are easy to guess")
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8, MaxBytes: 64, MinStrength: 2, BannedWords: []string{"Scaffold"}}
+
+	tests := []struct {
+		name     string
+		password string
+		codes    []string
+	}{
+		{"acceptable", "kx8fwz3m-plum", nil},
+		{"too short", "kx8f", []string{PasswordTooShort}},
+		{"too long", string(make([]byte, 65)), []string{PasswordTooLong}},
+		{"weak", "password123", []string{PasswordTooWeak}},
+		{"name", "hallworth-kx8f", []string{PasswordBannedWord}},
+		{"email", "jhall-kx8fwz3m", []string{PasswordBannedWord}},
+		{"banned word", "scaff0ld-kx8fwz", []string{PasswordBannedWord}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check(tt.password, "jhall@example.com", "Jo Hallworth")
+			require.NoError(t, err)
+			assert.Equal(t, tt.codes, violationCodes(violations))
+		})
+	}
+}
+
+func TestPasswordPolicy_Check_CountsCharacters(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8}
+
+	violations, err := policy.Check("ñøßþæðŧħ")
+
+	require.NoError(t, err)
+	assert.Empty(t, violations, "Length is in characters, not bytes")
+}
+
+func TestPasswordPolicy_Check_Breached(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8, Breached: breachedSet{"kx8fwz3m-plum": 3}}
+
+	violations, err := policy.Check("kx8fwz3m-plum")
+
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	assert.Equal(t, PasswordBreached, violations[0].Code)
+	assert.NotEmpty(t, violations[0].Message)
+}
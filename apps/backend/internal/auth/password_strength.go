@@ -0,0 +1,208 @@
+package auth
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords are the most frequently used passwords, normalized.
+var commonPasswords = func() []string {
+	var words []string
+	for _, word := range strings.Fields(commonPasswordList) {
+		words = append(words, normalizePassword(word))
+	}
+	return words
+}()
+
+// keyboardRows are runs of keys that people type as sequences.
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// leetSubstitutions undo the usual character swaps, so that "p@ssw0rd" is
+// recognised as "password".
+var leetSubstitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's', '!': 'i',
+}
+
+// PasswordStrength estimates how hard password is to guess, scoring it from
+// 0, trivially guessable, to 4, very hard to guess, on the same scale as
+// zxcvbn. Common passwords, words from context such as the user's name or
+// email address, years, repeated characters and sequences such as "abcd" or
+// "qwerty" are cheap to guess; everything else is assumed to be brute forced
+// over the kinds of character the password uses.
+func PasswordStrength(password string, context ...string) int {
+	guesses := passwordEntropy(password, contextWords(context)) * math.Log10(2)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// passwordEntropy estimates the bits of entropy in password, walking it a
+// piece at a time and charging each piece what it would cost to guess.
+func passwordEntropy(password string, context []string) float64 {
+	runes := []rune(password)
+	normalized := []rune(normalizePassword(password))
+	perChar := math.Log2(float64(charsetSize(runes)))
+	commonBits := math.Log2(float64(len(commonPasswords)))
+
+	bits := 0.0
+	for i := 0; i < len(runes); {
+		rest := string(normalized[i:])
+		if n := longestPrefix(rest, context); n > 0 {
+			bits += 1 + capitalizationBits(runes[i:i+n])
+			i += n
+			continue
+		}
+		if n := longestPrefix(rest, commonPasswords); n > 0 {
+			bits += commonBits + capitalizationBits(runes[i:i+n])
+			i += n
+			continue
+		}
+		if isYear(runes[i:]) {
+			bits += math.Log2(200)
+			i += 4
+			continue
+		}
+		if i > 0 && follows(runes[i-1], runes[i]) {
+			bits += 0.25
+		} else {
+			bits += perChar
+		}
+		i++
+	}
+	return bits
+}
+
+// contextWords are the words in context, such as a user's name and email
+// address, long enough to be worth looking for in their password.
+func contextWords(context []string) []string {
+	var words []string
+	for _, value := range context {
+		// Of an email address, only the local part is the user's own
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			value = local
+			words = append(words, normalizePassword(local))
+		}
+		for _, word := range strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			words = append(words, normalizePassword(word))
+		}
+	}
+
+	long := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) >= 4 {
+			long = append(long, word)
+		}
+	}
+	return long
+}
+
+// normalizePassword lowercases s and undoes leet substitutions, rune for rune.
+func normalizePassword(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if sub, ok := leetSubstitutions[r]; ok {
+			return sub
+		}
+		return r
+	}, s)
+}
+
+// longestPrefix returns the length in runes of the longest of words that s
+// starts with, or 0.
+func longestPrefix(s string, words []string) int {
+	longest := ""
+	for _, word := range words {
+		if len(word) > len(longest) && strings.HasPrefix(s, word) {
+			longest = word
+		}
+	}
+	return len([]rune(longest))
+}
+
+// capitalizationBits is the cost of guessing where a word's capitals are,
+// approximated as one bit if it has any.
+func capitalizationBits(word []rune) float64 {
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// charsetSize is the number of characters a brute force attack would have to
+// try at each position, given the kinds of character in password.
+func charsetSize(password []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			size += class.size
+		}
+	}
+	return max(size, 1)
+}
+
+// isYear reports whether s starts with a year from 1900 to 2099.
+func isYear(s []rune) bool {
+	if len(s) < 4 {
+		return false
+	}
+	for _, r := range s[:4] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	century := string(s[:2])
+	return century == "19" || century == "20"
+}
+
+// follows reports whether cur repeats prev or continues a sequence from it,
+// alphabetically, numerically or along a row of the keyboard.
+func follows(prev, cur rune) bool {
+	prev, cur = unicode.ToLower(prev), unicode.ToLower(cur)
+	if d := cur - prev; d >= -1 && d <= 1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		i, j := strings.IndexRune(row, prev), strings.IndexRune(row, cur)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -59,3 +61,68 @@ func TestHashPassword_EmptyString(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, hash, "Should be able to hash empty string")
 }
+
+func TestCheckPassword_Bcrypt(t *testing.T) {
+	hash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("bcryptPassword")
+	assert.NoError(t, err)
+
+	assert.True(t, CheckPassword("bcryptPassword", hash), "Existing bcrypt hashes keep working")
+	assert.False(t, CheckPassword("wrongPassword", hash))
+	assert.True(t, PasswordNeedsRehash(hash))
+}
+
+func TestHashPassword_Argon2id(t *testing.T) {
+	hash, err := HashPassword("argonPassword")
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"), hash)
+	assert.False(t, PasswordNeedsRehash(hash))
+}
+
+func TestCheckPassword_Argon2idUsesStoredParameters(t *testing.T) {
+	hash, _ := Argon2idHasher{Memory: 8 * 1024, Iterations: 1, Parallelism: 2}.Hash("argonPassword")
+
+	assert.True(t, CheckPassword("argonPassword", hash))
+	assert.False(t, CheckPassword("wrongPassword", hash))
+	assert.True(t, PasswordNeedsRehash(hash), "Hashes with other parameters are replaced")
+}
+
+func TestCheckPassword_LongPassword(t *testing.T) {
+	long := strings.Repeat("a", 72)
+	hash, _ := HashPassword(long + "suffix")
+
+	assert.True(t, CheckPassword(long+"suffix", hash))
+	assert.False(t, CheckPassword(long, hash), "argon2id uses every byte of the password")
+
+	_, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash(long + "suffix")
+	assert.ErrorIs(t, err, ErrPasswordTooLong, "bcrypt refuses passwords it would truncate")
+}
+
+func TestCheckPassword_MalformedHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA",
+		"$argon2id$v=18$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$!!!$a2V5",
+	} {
+		assert.False(t, CheckPassword("password", hash), hash)
+	}
+}
+
+func TestPasswordHashing_Bcrypt(t *testing.T) {
+	previous := PasswordHashing
+	PasswordHashing = BcryptHasher{Cost: bcrypt.MinCost}
+	defer func() { PasswordHashing = previous }()
+
+	hash, err := HashPassword("bcryptPassword")
+	assert.NoError(t, err)
+	assert.True(t, CheckPassword("bcryptPassword", hash))
+	assert.False(t, PasswordNeedsRehash(hash))
+
+	higherCost, _ := BcryptHasher{Cost: bcrypt.MinCost + 1}.Hash("bcryptPassword")
+	assert.True(t, PasswordNeedsRehash(higherCost))
+	argon, _ := DefaultArgon2idHasher.Hash("bcryptPassword")
+	assert.True(t, PasswordNeedsRehash(argon))
+}
@@ -0,0 +1,20 @@
+package auth
+
+import "slices"
+
+// Permissions checked by the API. The roles granting them are defined in the
+// database.
+const (
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+	PermissionRolesRead  = "roles:read"
+	PermissionRolesWrite = "roles:write"
+
+	PermissionServiceAccountsRead  = "service_accounts:read"
+	PermissionServiceAccountsWrite = "service_accounts:write"
+)
+
+// HasPermission reports whether the token grants permission.
+func (c *Claims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions, permission)
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationBackend persists revocations so that they survive restarts and
+// are shared between instances.
+type RevocationBackend interface {
+	RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID int, before time.Time) error
+	RevokeSessionlessUserTokens(ctx context.Context, userID int, before time.Time) error
+	// UserTokensRevokedBefore returns the cutoffs set by RevokeUserTokens and
+	// RevokeSessionlessUserTokens, each the zero time if it was never set.
+	UserTokensRevokedBefore(ctx context.Context, userID int) (before, sessionlessBefore time.Time, err error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	// IsSessionRevoked reports sessions that no longer exist as revoked.
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// RevocationStore decides whether an otherwise valid access token has been
+// revoked, either individually by its jti, because the session it was issued
+// for has ended, or because its user logged out everywhere, or ended their
+// other sessions, after it was issued.
+//
+// Lookups are cached in memory. A revoked jti or session is cached until the
+// token would have expired anyway, since revocations are never undone. Negative results
+// and per-user cutoffs are only trusted for CacheTTL, which bounds how long a
+// revocation made on another instance can take to be noticed here.
+type RevocationStore struct {
+	backend  RevocationBackend
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	tokens    map[string]cachedRevocation
+	sessions  map[string]cachedRevocation
+	users     map[int]cachedCutoff
+	nextSweep time.Time
+}
+
+type cachedRevocation struct {
+	revoked bool
+	until   time.Time
+}
+
+type cachedCutoff struct {
+	before      time.Time
+	sessionless time.Time
+	until       time.Time
+}
+
+// DefaultRevocationCacheTTL is used by NewRevocationStore.
+const DefaultRevocationCacheTTL = 30 * time.Second
+
+func NewRevocationStore(backend RevocationBackend) *RevocationStore {
+	return &RevocationStore{
+		backend:  backend,
+		cacheTTL: DefaultRevocationCacheTTL,
+		now:      time.Now,
+		tokens:   make(map[string]cachedRevocation),
+		sessions: make(map[string]cachedRevocation),
+		users:    make(map[int]cachedCutoff),
+	}
+}
+
+// Revoke revokes a single access token.
+func (s *RevocationStore) Revoke(ctx context.Context, claims *Claims) error {
+	expiresAt := s.now().Add(AccessTokenTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	if err := s.backend.RevokeToken(ctx, claims.ID, claims.UserID, expiresAt.UTC()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens[claims.ID] = cachedRevocation{revoked: true, until: expiresAt}
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeSession revokes every access token issued for a session. Its refresh
+// tokens must be revoked separately.
+func (s *RevocationStore) RevokeSession(ctx context.Context, sessionID string) error {
+	if err := s.backend.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	// Tokens issued for the session before now expire within AccessTokenTTL,
+	// and none can be issued after
+	s.mu.Lock()
+	s.sessions[sessionID] = cachedRevocation{revoked: true, until: s.now().Add(AccessTokenTTL)}
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeAll revokes every access token issued to userID up to now.
+func (s *RevocationStore) RevokeAll(ctx context.Context, userID int) error {
+	before := s.now().UTC()
+	if err := s.backend.RevokeUserTokens(ctx, userID, before); err != nil {
+		return err
+	}
+
+	s.forgetCutoff(userID)
+	return nil
+}
+
+// RevokeSessionless revokes every access token issued to userID up to now
+// that is not tied to a session, such as those issued to OAuth clients. Tokens
+// tied to a session are revoked by ending it.
+func (s *RevocationStore) RevokeSessionless(ctx context.Context, userID int) error {
+	before := s.now().UTC()
+	if err := s.backend.RevokeSessionlessUserTokens(ctx, userID, before); err != nil {
+		return err
+	}
+
+	s.forgetCutoff(userID)
+	return nil
+}
+
+// forgetCutoff drops userID's cached cutoffs so that the next check reads the
+// ones just stored.
+func (s *RevocationStore) forgetCutoff(userID int) {
+	s.mu.Lock()
+	delete(s.users, userID)
+	s.mu.Unlock()
+}
+
+// IsRevoked reports whether claims belong to a token that has been revoked.
+func (s *RevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	s.sweep(now)
+	token, tokenCached := s.tokens[claims.ID]
+	session, sessionCached := s.sessions[claims.SessionID]
+	user, userCached := s.users[claims.UserID]
+	s.mu.Unlock()
+
+	if tokenCached && now.After(token.until) {
+		tokenCached = false
+	}
+	if sessionCached && now.After(session.until) {
+		sessionCached = false
+	}
+	if userCached && now.After(user.until) {
+		userCached = false
+	}
+
+	if !tokenCached {
+		revoked, err := s.backend.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return false, err
+		}
+		token = cachedRevocation{revoked: revoked, until: now.Add(s.cacheTTL)}
+		if revoked && claims.ExpiresAt != nil {
+			token.until = claims.ExpiresAt.Time
+		}
+		s.mu.Lock()
+		s.tokens[claims.ID] = token
+		s.mu.Unlock()
+	}
+	if token.revoked {
+		return true, nil
+	}
+
+	// Tokens from before sessions were recorded have no session to check
+	if claims.SessionID != "" && !sessionCached {
+		revoked, err := s.backend.IsSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			return false, err
+		}
+		session = cachedRevocation{revoked: revoked, until: now.Add(s.cacheTTL)}
+		if revoked {
+			session.until = now.Add(AccessTokenTTL)
+		}
+		s.mu.Lock()
+		s.sessions[claims.SessionID] = session
+		s.mu.Unlock()
+	}
+	if session.revoked {
+		return true, nil
+	}
+
+	if !userCached {
+		before, sessionless, err := s.backend.UserTokensRevokedBefore(ctx, claims.UserID)
+		if err != nil {
+			return false, err
+		}
+		user = cachedCutoff{before: before, sessionless: sessionless, until: now.Add(s.cacheTTL)}
+		s.mu.Lock()
+		s.users[claims.UserID] = user
+		s.mu.Unlock()
+	}
+
+	cutoff := user.before
+	if claims.SessionID == "" && user.sessionless.After(cutoff) {
+		cutoff = user.sessionless
+	}
+	return issuedBefore(claims, cutoff), nil
+}
+
+// issuedBefore reports whether the token was issued no later than cutoff.
+// Tokens without iat_ms only have second precision, so one of those issued in
+// the same second as the cutoff is treated as revoked.
+func issuedBefore(claims *Claims, cutoff time.Time) bool {
+	if cutoff.IsZero() {
+		return false
+	}
+	if claims.IssuedAtMilli != 0 {
+		return !time.UnixMilli(claims.IssuedAtMilli).After(cutoff)
+	}
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return !claims.IssuedAt.Time.After(cutoff.Truncate(time.Second))
+}
+
+// sweep drops expired cache entries. It must be called with s.mu held.
+func (s *RevocationStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for jti, entry := range s.tokens {
+		if now.After(entry.until) {
+			delete(s.tokens, jti)
+		}
+	}
+	for sessionID, entry := range s.sessions {
+		if now.After(entry.until) {
+			delete(s.sessions, sessionID)
+		}
+	}
+	for userID, entry := range s.users {
+		if now.After(entry.until) {
+			delete(s.users, userID)
+		}
+	}
+	s.nextSweep = now.Add(s.cacheTTL)
+}
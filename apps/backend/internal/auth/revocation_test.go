@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRevocationBackend is an in-memory RevocationBackend that counts lookups
+type fakeRevocationBackend struct {
+	tokens        map[string]bool
+	sessions      map[string]bool
+	cutoffs       map[int]time.Time
+	sessionless   map[int]time.Time
+	tokenChecks   int
+	sessionChecks int
+	userChecks    int
+}
+
+func newFakeRevocationBackend() *fakeRevocationBackend {
+	return &fakeRevocationBackend{tokens: map[string]bool{}, sessions: map[string]bool{}, cutoffs: map[int]time.Time{}, sessionless: map[int]time.Time{}}
+}
+
+func (f *fakeRevocationBackend) RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	f.tokens[jti] = true
+	return nil
+}
+
+func (f *fakeRevocationBackend) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	f.tokenChecks++
+	return f.tokens[jti], nil
+}
+
+func (f *fakeRevocationBackend) RevokeUserTokens(ctx context.Context, userID int, before time.Time) error {
+	f.cutoffs[userID] = before
+	return nil
+}
+
+func (f *fakeRevocationBackend) RevokeSessionlessUserTokens(ctx context.Context, userID int, before time.Time) error {
+	f.sessionless[userID] = before
+	return nil
+}
+
+func (f *fakeRevocationBackend) UserTokensRevokedBefore(ctx context.Context, userID int) (time.Time, time.Time, error) {
+	f.userChecks++
+	return f.cutoffs[userID], f.sessionless[userID], nil
+}
+
+func (f *fakeRevocationBackend) RevokeSession(ctx context.Context, sessionID string) error {
+	f.sessions[sessionID] = true
+	return nil
+}
+
+func (f *fakeRevocationBackend) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	f.sessionChecks++
+	return f.sessions[sessionID], nil
+}
+
+func testClaims(jti string, userID int, issuedAt time.Time) *Claims {
+	return &Claims{
+		UserID:        userID,
+		IssuedAtMilli: issuedAt.UnixMilli(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(AccessTokenTTL)),
+		},
+	}
+}
+
+func TestRevocationStore_NotRevoked(t *testing.T) {
+	store := NewRevocationStore(newFakeRevocationBackend())
+
+	revoked, err := store.IsRevoked(context.Background(), testClaims("jti-1", 1, time.Now()))
+
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestRevocationStore_RevokeSingleToken(t *testing.T) {
+	store := NewRevocationStore(newFakeRevocationBackend())
+	ctx := context.Background()
+	claims := testClaims("jti-1", 1, time.Now())
+	other := testClaims("jti-2", 1, time.Now())
+
+	assert.NoError(t, store.Revoke(ctx, claims))
+
+	revoked, _ := store.IsRevoked(ctx, claims)
+	assert.True(t, revoked)
+	otherRevoked, _ := store.IsRevoked(ctx, other)
+	assert.False(t, otherRevoked, "Other tokens of the same user stay valid")
+}
+
+func TestRevocationStore_RevokeAll(t *testing.T) {
+	store := NewRevocationStore(newFakeRevocationBackend())
+	ctx := context.Background()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	oldToken := testClaims("jti-old", 1, now.Add(-time.Minute))
+	otherUser := testClaims("jti-other", 2, now.Add(-time.Minute))
+
+	assert.NoError(t, store.RevokeAll(ctx, 1))
+
+	revoked, _ := store.IsRevoked(ctx, oldToken)
+	assert.True(t, revoked)
+	otherRevoked, _ := store.IsRevoked(ctx, otherUser)
+	assert.False(t, otherRevoked)
+
+	newToken := testClaims("jti-new", 1, now.Add(2*time.Second))
+	newRevoked, _ := store.IsRevoked(ctx, newToken)
+	assert.False(t, newRevoked, "Tokens issued after the cutoff stay valid")
+}
+
+func TestRevocationStore_RevokeAll_SameSecond(t *testing.T) {
+	store := NewRevocationStore(newFakeRevocationBackend())
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second).Add(500 * time.Millisecond)
+	store.now = func() time.Time { return now }
+
+	before := testClaims("jti-before", 1, now.Add(-100*time.Millisecond))
+	after := testClaims("jti-after", 1, now.Add(100*time.Millisecond))
+	legacy := testClaims("jti-legacy", 1, now.Add(100*time.Millisecond))
+	legacy.IssuedAtMilli = 0
+
+	assert.NoError(t, store.RevokeAll(ctx, 1))
+
+	revoked, _ := store.IsRevoked(ctx, before)
+	assert.True(t, revoked, "A token issued earlier in the same second is revoked")
+	afterRevoked, _ := store.IsRevoked(ctx, after)
+	assert.False(t, afterRevoked, "A token issued right after the cutoff stays valid")
+	legacyRevoked, _ := store.IsRevoked(ctx, legacy)
+	assert.True(t, legacyRevoked, "Tokens without iat_ms are revoked for the whole second")
+}
+
+func TestRevocationStore_RevokeSessionless(t *testing.T) {
+	store := NewRevocationStore(newFakeRevocationBackend())
+	ctx := context.Background()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	sessionless := testClaims("jti-sessionless", 1, now.Add(-time.Minute))
+	inSession := testClaims("jti-session", 1, now.Add(-time.Minute))
+	inSession.SessionID = "session-1"
+
+	// A cutoff cached before the revocation is not trusted afterwards
+	revoked, _ := store.IsRevoked(ctx, sessionless)
+	assert.False(t, revoked)
+
+	assert.NoError(t, store.RevokeSessionless(ctx, 1))
+
+	revoked, _ = store.IsRevoked(ctx, sessionless)
+	assert.True(t, revoked)
+	inSessionRevoked, _ := store.IsRevoked(ctx, inSession)
+	assert.False(t, inSessionRevoked, "Tokens tied to a session are left to the session")
+	newToken := testClaims("jti-new", 1, now.Add(time.Millisecond))
+	newRevoked, _ := store.IsRevoked(ctx, newToken)
+	assert.False(t, newRevoked)
+}
+
+func TestRevocationStore_CachesLookups(t *testing.T) {
+	backend := newFakeRevocationBackend()
+	store := NewRevocationStore(backend)
+	ctx := context.Background()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	claims := testClaims("jti-1", 1, now)
+
+	store.IsRevoked(ctx, claims)
+	store.IsRevoked(ctx, claims)
+	assert.Equal(t, 1, backend.tokenChecks)
+	assert.Equal(t, 1, backend.userChecks)
+
+	// A revocation made by another instance is picked up once the cache expires
+	backend.tokens["jti-1"] = true
+	now = now.Add(DefaultRevocationCacheTTL + time.Second)
+
+	revoked, _ := store.IsRevoked(ctx, claims)
+	assert.True(t, revoked)
+	assert.Equal(t, 2, backend.tokenChecks)
+}
+
+func TestRevocationStore_RevokeSession(t *testing.T) {
+	backend := newFakeRevocationBackend()
+	store := NewRevocationStore(backend)
+	ctx := context.Background()
+	claims := testClaims("jti-1", 1, time.Now())
+	claims.SessionID = "session-1"
+	other := testClaims("jti-2", 1, time.Now())
+	other.SessionID = "session-2"
+	sessionless := testClaims("jti-3", 1, time.Now())
+
+	assert.NoError(t, store.RevokeSession(ctx, "session-1"))
+
+	revoked, _ := store.IsRevoked(ctx, claims)
+	assert.True(t, revoked)
+	otherRevoked, _ := store.IsRevoked(ctx, other)
+	assert.False(t, otherRevoked, "The user's other sessions stay valid")
+	sessionlessRevoked, _ := store.IsRevoked(ctx, sessionless)
+	assert.False(t, sessionlessRevoked)
+	assert.Equal(t, 1, backend.sessionChecks, "Tokens without a session are not looked up")
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The RFC 6238 SHA-1 test secret, "12345678901234567890", base32-encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; these are their last 6 digits
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range vectors {
+		code, err := TOTPCode(rfcSecret, time.Unix(unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code, "time %d", unix)
+	}
+}
+
+func TestTOTPCode_InvalidSecret(t *testing.T) {
+	_, err := TOTPCode("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestValidateTOTP_AcceptsAdjacentSteps(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	for _, offset := range []time.Duration{-totpPeriod, 0, totpPeriod} {
+		code, _ := TOTPCode(rfcSecret, now.Add(offset))
+		step, ok := ValidateTOTP(rfcSecret, code, now)
+		assert.True(t, ok, "offset %s", offset)
+		assert.Equal(t, totpStep(now.Add(offset)), step)
+	}
+}
+
+func TestValidateTOTP_RejectsDistantSteps(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	code, _ := TOTPCode(rfcSecret, now.Add(-2*totpPeriod))
+	_, ok := ValidateTOTP(rfcSecret, code, now)
+	assert.False(t, ok)
+}
+
+func TestValidateTOTP_RejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	for _, code := range []string{"", "00592", "0059240", "abcdef"} {
+		_, ok := ValidateTOTP(rfcSecret, code, now)
+		assert.False(t, ok, "code %q", code)
+	}
+
+	_, ok := ValidateTOTP(rfcSecret, "005 924", now)
+	assert.True(t, ok, "Spaces should be ignored")
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret1, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	secret2, _ := GenerateTOTPSecret()
+
+	assert.Len(t, secret1, 32, "160 bits should encode to 32 base32 characters")
+	assert.NotEqual(t, secret1, secret2)
+
+	_, err = TOTPCode(secret1, time.Now())
+	assert.NoError(t, err)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("My App", "user@example.com", rfcSecret)
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/My App:user@example.com", parsed.Path)
+	assert.Equal(t, rfcSecret, parsed.Query().Get("secret"))
+	assert.Equal(t, "My App", parsed.Query().Get("issuer"))
+	assert.Equal(t, "6", parsed.Query().Get("digits"))
+	assert.Equal(t, "30", parsed.Query().Get("period"))
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	require.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Len(t, code, 19)
+		assert.Len(t, strings.Split(code, "-"), 4)
+		assert.False(t, seen[code], "Codes should be unique")
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode_Normalizes(t *testing.T) {
+	hash := HashRecoveryCode("abcd-efgh-ijkl-mnop")
+
+	assert.Equal(t, hash, HashRecoveryCode("ABCD-EFGH-IJKL-MNOP"))
+	assert.Equal(t, hash, HashRecoveryCode("abcdefghijklmnop"))
+	assert.Equal(t, hash, HashRecoveryCode("abcd efgh ijkl mnop"))
+	assert.NotEqual(t, hash, HashRecoveryCode("abcd-efgh-ijkl-mnoq"))
+}
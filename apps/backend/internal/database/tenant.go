@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TenantRole is the role queries in a tenant scope run as. Row-level security
+// policies in the migrations limit it to the rows of the scope's
+// organization.
+const TenantRole = "app_tenant"
+
+type tenantTxKey struct{}
+
+// Tenant identifies the organization, and the user within it, that a scope
+// acts for.
+type Tenant struct {
+	OrgID  int
+	UserID int
+}
+
+// WithTenant runs fn in a transaction scoped to tenant. The transaction sets
+// app.current_org and app.current_user for its duration and switches to
+// TenantRole, so every query made through db with the context passed to fn
+// only sees the tenant's rows, whatever its WHERE clause says. The
+// transaction commits if fn returns nil and rolls back otherwise.
+func (db *DB) WithTenant(ctx context.Context, tenant Tenant, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(tenantTxKey{}).(pgx.Tx); ok {
+		return errors.New("already in a tenant scope")
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// set_config with is_local is SET LOCAL, but takes parameters
+	_, err = tx.Exec(ctx, "SELECT set_config('app.current_org', $1, true), set_config('app.current_user', $2, true)",
+		strconv.Itoa(tenant.OrgID), strconv.Itoa(tenant.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to set tenant: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+TenantRole); err != nil {
+		return fmt.Errorf("failed to set tenant role: %w", err)
+	}
+
+	if err := fn(context.WithValue(ctx, tenantTxKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit tenant transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mail
+
+import "fmt"
+
+// DefaultFrom is the sender used when Config.From is empty.
+const DefaultFrom = "noreply@localhost"
+
+// Drivers accepted by NewMailer.
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+	DriverLog  = "log"
+)
+
+// Config selects and configures a Mailer driver.
+type Config struct {
+	Driver string
+	From   string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	// Dir is where the file driver writes messages.
+	Dir string
+}
+
+// NewMailer returns the driver named by cfg.Driver. An empty driver selects
+// the log driver.
+func NewMailer(cfg Config) (Mailer, error) {
+	if cfg.From == "" {
+		cfg.From = DefaultFrom
+	}
+
+	switch cfg.Driver {
+	case DriverSMTP:
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("smtp driver requires a host")
+		}
+		port := cfg.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     port,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	case DriverFile:
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("file driver requires a directory")
+		}
+		return &FileMailer{Dir: cfg.Dir, From: cfg.From}, nil
+	case DriverLog, "":
+		return &LogMailer{From: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
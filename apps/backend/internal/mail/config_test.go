@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMailer_Drivers(t *testing.T) {
+	smtpMailer, err := NewMailer(Config{Driver: DriverSMTP, SMTPHost: "smtp.example.com"})
+	assert.NoError(t, err)
+	assert.IsType(t, &SMTPMailer{}, smtpMailer)
+	assert.Equal(t, 587, smtpMailer.(*SMTPMailer).Port)
+
+	fileMailer, err := NewMailer(Config{Driver: DriverFile, Dir: "tmp/mail"})
+	assert.NoError(t, err)
+	assert.IsType(t, &FileMailer{}, fileMailer)
+
+	logMailer, err := NewMailer(Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, &LogMailer{}, logMailer)
+	assert.Equal(t, DefaultFrom, logMailer.(*LogMailer).From)
+}
+
+func TestNewMailer_Invalid(t *testing.T) {
+	_, err := NewMailer(Config{Driver: DriverSMTP})
+	assert.Error(t, err, "SMTP requires a host")
+
+	_, err = NewMailer(Config{Driver: DriverFile})
+	assert.Error(t, err, "File driver requires a directory")
+
+	_, err = NewMailer(Config{Driver: "carrier-pigeon"})
+	assert.Error(t, err)
+}
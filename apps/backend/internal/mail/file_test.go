@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer_WritesEML(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := &FileMailer{Dir: dir, From: "app@example.com"}
+
+	err := mailer.Send(context.Background(), &Message{To: []string{"user@example.com"}, Subject: "Saved", Text: "On disk"})
+	require.NoError(t, err)
+	err = mailer.Send(context.Background(), &Message{To: []string{"user@example.com"}, Subject: "Again", Text: "On disk"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2, "Each message should get its own file")
+
+	data, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(data), "From: app@example.com")
+	assert.Contains(t, string(data), "On disk")
+}
@@ -0,0 +1,18 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// LogMailer writes messages to the server log instead of sending them.
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	msg = withDefaultFrom(msg, m.From)
+	log.Printf("Email from %s to %s: %s\n%s", msg.From, strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBytes_PlainText(t *testing.T) {
+	msg := &Message{From: "app@example.com", To: []string{"user@example.com"}, Subject: "Hello", Text: "Plain body"}
+
+	data, err := msg.Bytes()
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "app@example.com", parsed.Header.Get("From"))
+	assert.Equal(t, "user@example.com", parsed.Header.Get("To"))
+	assert.Equal(t, "Hello", parsed.Header.Get("Subject"))
+	assert.Contains(t, parsed.Header.Get("Content-Type"), "text/plain")
+	assert.NotEmpty(t, parsed.Header.Get("Message-ID"))
+
+	body, _ := io.ReadAll(parsed.Body)
+	assert.Contains(t, string(body), "Plain body")
+}
+
+func TestMessageBytes_Alternative(t *testing.T) {
+	msg := &Message{
+		From:    "app@example.com",
+		To:      []string{"user@example.com"},
+		Subject: "Grüße",
+		Text:    "Text version",
+		HTML:    "<p>HTML version</p>",
+	}
+
+	data, err := msg.Bytes()
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Grüße", subject)
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, _ := io.ReadAll(part)
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+
+	// The plain-text fallback comes first so HTML-capable clients prefer the HTML
+	require.Len(t, types, 2)
+	assert.Contains(t, types[0], "text/plain")
+	assert.Contains(t, types[1], "text/html")
+	assert.Equal(t, "Text version", bodies[0])
+	assert.Equal(t, "<p>HTML version</p>", bodies[1])
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := &MemoryMailer{From: "app@example.com"}
+
+	mailer.Send(context.Background(), &Message{To: []string{"a@example.com"}, Subject: "First"})
+	mailer.Send(context.Background(), &Message{To: []string{"a@example.com"}, Subject: "Second"})
+
+	assert.Len(t, mailer.Messages(), 2)
+	last, ok := mailer.LastTo("a@example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "Second", last.Subject)
+	assert.Equal(t, "app@example.com", last.From, "Default sender should be applied")
+
+	_, ok = mailer.LastTo("b@example.com")
+	assert.False(t, ok)
+
+	mailer.Reset()
+	assert.Empty(t, mailer.Messages())
+}
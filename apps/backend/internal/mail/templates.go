@@ -0,0 +1,109 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Templates renders the embedded email templates. Each email <name> has a
+// text/template file <name>.txt, which defines a "subject" template and
+// provides the plain-text body, and optionally an html/template file
+// <name>.html, which is rendered inside layout.html. Without an HTML file the
+// message is sent as plain text only.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parses every embedded template.
+func LoadTemplates() (*Templates, error) {
+	return parseTemplates(templateFS)
+}
+
+func parseTemplates(fsys fs.FS) (*Templates, error) {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+
+	textFiles, err := fs.Glob(fsys, "templates/*.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range textFiles {
+		name := strings.TrimSuffix(strings.TrimPrefix(file, "templates/"), ".txt")
+		tmpl, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl.Lookup("subject") == nil {
+			return nil, fmt.Errorf("template %s does not define a subject", file)
+		}
+		t.text[name] = tmpl
+	}
+
+	htmlFiles, err := fs.Glob(fsys, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range htmlFiles {
+		name := strings.TrimSuffix(strings.TrimPrefix(file, "templates/"), ".html")
+		if name == "layout" {
+			continue
+		}
+		if _, ok := t.text[name]; !ok {
+			return nil, fmt.Errorf("template %s has no plain-text version", file)
+		}
+		tmpl, err := htmltemplate.ParseFS(fsys, "templates/layout.html", file)
+		if err != nil {
+			return nil, err
+		}
+		t.html[name] = tmpl
+	}
+
+	return t, nil
+}
+
+// Render builds a message addressed to `to` from the named template.
+func (t *Templates) Render(name string, to string, data interface{}) (*Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		To:      []string{to},
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+	}
+
+	if html, ok := t.html[name]; ok {
+		var buf bytes.Buffer
+		if err := html.ExecuteTemplate(&buf, "layout", data); err != nil {
+			return nil, err
+		}
+		msg.HTML = buf.String()
+	}
+
+	if msg.Subject == "" {
+		return nil, errors.New("email subject is empty")
+	}
+	return msg, nil
+}
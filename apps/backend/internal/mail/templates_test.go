@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTemplates_Embedded(t *testing.T) {
+	templates, err := LoadTemplates()
+	require.NoError(t, err)
+
+	for _, name := range []string{"email_verification", "password_reset", "magic_link", "email_change", "account_deleted"} {
+		msg, err := templates.Render(name, "user@example.com", map[string]string{
+			"Name":      "Ada",
+			"Link":      "https://app.example.com/link?token=abc",
+			"ExpiresIn": "1 hour",
+		})
+
+		require.NoError(t, err, name)
+		assert.NotEmpty(t, msg.Subject, name)
+		assert.Equal(t, []string{"user@example.com"}, msg.To)
+		assert.Contains(t, msg.Text, "https://app.example.com/link?token=abc", name)
+		assert.Contains(t, msg.HTML, "Ada", name)
+	}
+}
+
+func TestRender_EscapesHTML(t *testing.T) {
+	templates, _ := LoadTemplates()
+
+	msg, err := templates.Render("email_verification", "user@example.com", map[string]string{
+		"Name": "<script>alert(1)</script>",
+		"Link": "https://app.example.com",
+	})
+
+	require.NoError(t, err)
+	assert.NotContains(t, msg.HTML, "<script>")
+	assert.Contains(t, msg.Text, "<script>", "The plain-text part is not HTML")
+}
+
+func TestRender_UnknownTemplate(t *testing.T) {
+	templates, _ := LoadTemplates()
+
+	_, err := templates.Render("missing", "user@example.com", nil)
+
+	assert.Error(t, err)
+}
+
+func TestParseTemplates_TextOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/layout.html": {Data: []byte(`{{define "layout"}}{{template "content" .}}{{end}}`)},
+		"templates/notice.txt":  {Data: []byte(`{{define "subject"}}Notice{{end}}Plain only`)},
+	}
+
+	templates, err := parseTemplates(fsys)
+	require.NoError(t, err)
+
+	msg, err := templates.Render("notice", "user@example.com", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Notice", msg.Subject)
+	assert.Equal(t, "Plain only\n", msg.Text)
+	assert.Empty(t, msg.HTML)
+}
+
+func TestParseTemplates_RequiresSubject(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/notice.txt": {Data: []byte(`No subject here`)},
+	}
+
+	_, err := parseTemplates(fsys)
+
+	assert.Error(t, err)
+}
+
+func TestParseTemplates_RequiresTextVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/layout.html": {Data: []byte(`{{define "layout"}}{{template "content" .}}{{end}}`)},
+		"templates/notice.html": {Data: []byte(`{{define "content"}}HTML only{{end}}`)},
+	}
+
+	_, err := parseTemplates(fsys)
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Audit events recorded by the API.
+const (
+	AuditEventAccountLocked   = "account.locked"
+	AuditEventAccountUnlocked = "account.unlocked"
+	AuditEventIPBlocked       = "login.ip_blocked"
+)
+
+// AuditEvent records a security event. UserID is the account it concerns and
+// ActorID the user who caused it, when there is one.
+type AuditEvent struct {
+	ID        int            `json:"id"`
+	Event     string         `json:"event"`
+	UserID    *int           `json:"user_id"`
+	ActorID   *int           `json:"actor_id"`
+	IPAddress string         `json:"ip_address,omitempty"`
+	Details   map[string]any `json:"details"`
+	CreatedAt time.Time      `json:"created_at"`
+}
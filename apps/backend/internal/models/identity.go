@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an external OpenID Connect provider to a
+// user.
+type UserIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// OIDCAuthRequest is the server-side state of an authorization request sent
+// to a provider, found again by its state parameter.
+type OIDCAuthRequest struct {
+	ID           int
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// UserID is set when an authenticated user is linking an identity
+	UserID    *int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// OIDCStartResponse carries the provider URL the client should navigate to.
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// OIDCCallbackRequest carries the parameters the provider appended to the
+// redirect URI.
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
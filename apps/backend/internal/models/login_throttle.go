@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for an email address or client IP
+// address, and blocks further attempts while RetryAfter is positive.
+type LoginThrottle struct {
+	Key      string
+	Failures int
+	// Locked is set while attempts are locked out, rather than delayed.
+	Locked     bool
+	RetryAfter time.Duration
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// MagicLink is a single-use login link emailed to an address, which may not
+// have an account yet. Only its hash is stored.
+type MagicLink struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// OAuthClient is an application that logs users in through this service.
+// Public clients have no secret.
+type OAuthClient struct {
+	ID               int       `json:"id"`
+	ClientID         string    `json:"client_id"`
+	ClientSecretHash string    `json:"-"`
+	Name             string    `json:"name"`
+	RedirectURIs     []string  `json:"redirect_uris"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// IsPublic reports whether the client cannot keep a secret and authenticates
+// with PKCE alone.
+func (c *OAuthClient) IsPublic() bool {
+	return c.ClientSecretHash == ""
+}
+
+// OAuthAuthorizationRequest is a client's request to log a user in, held
+// until the user consents.
+type OAuthAuthorizationRequest struct {
+	ID            int
+	RequestID     string
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	State         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// OAuthAuthorizationCode is an issued authorization code, stored by hash.
+type OAuthAuthorizationCode struct {
+	ID            int
+	CodeHash      string
+	ClientID      string
+	UserID        int
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// OAuthConsentPrompt describes an authorization request to the consent
+// screen. ConsentRequired is false when the user already granted every
+// requested scope to the client, in which case the screen can approve it
+// without asking.
+type OAuthConsentPrompt struct {
+	RequestID       string   `json:"request_id"`
+	ClientID        string   `json:"client_id"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+	ConsentRequired bool     `json:"consent_required"`
+}
+
+// OAuthRedirectResponse is where the consent screen should send the browser
+// next.
+type OAuthRedirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// OAuthTokenResponse is the token endpoint's response. Only the
+// authorization code grant returns an ID token.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token,omitempty"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthUserInfo is the userinfo endpoint's response. Claims beyond sub are
+// only included for the scopes the user granted.
+type OAuthUserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
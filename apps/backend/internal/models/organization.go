@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Roles a user can hold within an organization, from most to least
+// privileged.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var orgRoleRank = map[string]int{
+	OrgRoleMember: 1,
+	OrgRoleAdmin:  2,
+	OrgRoleOwner:  3,
+}
+
+// OrgRoleAtLeast reports whether role is at least as privileged as min.
+func OrgRoleAtLeast(role, min string) bool {
+	return orgRoleRank[role] >= orgRoleRank[min] && orgRoleRank[role] > 0
+}
+
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserOrganization is an organization along with the current user's role in
+// it.
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// OrgMember is a user's membership of an organization.
+type OrgMember struct {
+	OrgID     int       `json:"org_id"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgInvitation invites an email address to join an organization. Only a hash
+// of its token is stored.
+type OrgInvitation struct {
+	ID        int       `json:"id"`
+	OrgID     int       `json:"org_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	TokenHash string    `json:"-"`
+	InvitedBy *int      `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+// InvitationTokenRequest carries the token from an invitation email.
+type InvitationTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// PersonalAccessToken is a long-lived credential a user creates for scripts
+// and command line tools. The token itself is only returned when it is
+// created.
+type PersonalAccessToken struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"-"`
+	Name   string `json:"name"`
+	// Prefix is the start of the token, shown so users can recognise it
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatePersonalAccessTokenRequest creates a token. Scopes are permissions
+// the token may use, and a nil ExpiresAt creates a token that never expires.
+type CreatePersonalAccessTokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreatePersonalAccessTokenResponse struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// RefreshToken is a stored refresh token. Tokens descended from the same login
+// share a FamilyID so that replaying a rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	FamilyID   string     `json:"-"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *int       `json:"-"`
+	// OrgID is the organization the session has switched to, if any
+	OrgID     *int      `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RefreshRequest struct {
+	// RefreshToken is required unless it is sent in a cookie
+	RefreshToken string `json:"refresh_token"`
+	// OrgID switches the new access token to another organization, or to
+	// none when 0. The current organization is kept when it is omitted.
+	OrgID *int `json:"org_id"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
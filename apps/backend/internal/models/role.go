@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Role is a named set of permissions that can be assigned to users.
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UserRolesResponse lists a user's roles and the permissions they grant.
+type UserRolesResponse struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ServiceAccount is a background worker or other service that calls the API
+// on its own behalf, authenticating with the client_credentials grant. Scopes
+// are the permissions its tokens may carry.
+type ServiceAccount struct {
+	ID               int        `json:"id"`
+	ClientID         string     `json:"client_id"`
+	ClientSecretHash string     `json:"-"`
+	Name             string     `json:"name"`
+	Scopes           []string   `json:"scopes"`
+	CreatedBy        *int       `json:"created_by"`
+	DisabledAt       *time.Time `json:"disabled_at"`
+	SecretRotatedAt  time.Time  `json:"secret_rotated_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// IsDisabled reports whether the account has been disabled, which stops it
+// obtaining tokens and its existing tokens working.
+func (a *ServiceAccount) IsDisabled() bool {
+	return a.DisabledAt != nil
+}
+
+type CreateServiceAccountRequest struct {
+	Name   string   `json:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes"`
+}
+
+// ServiceAccountCredentialsResponse returns a service account with its client
+// secret, which is only available when the account is created or its secret
+// rotated.
+type ServiceAccountCredentialsResponse struct {
+	ServiceAccount
+	ClientSecret string `json:"client_secret"`
+}
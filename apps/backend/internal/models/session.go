@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Session is a login on one device, lasting as long as its refresh tokens.
+type Session struct {
+	ID        string `json:"id"`
+	UserID    int    `json:"-"`
+	UserAgent string `json:"user_agent"`
+	// Device describes the user agent, such as "Firefox on Windows"
+	Device    string `json:"device"`
+	IPAddress string `json:"ip_address"`
+	// Location is where the IP address is, when a proxy in front of the
+	// service reports it
+	Location   string     `json:"location,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// Current marks the session the request was made in
+	Current bool `json:"current"`
+}
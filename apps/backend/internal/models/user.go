@@ -3,17 +3,18 @@ package models
 import "time"
 
 type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // Never send password hash to client
-	Name         string    `json:"name"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              int        `json:"id"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"` // Never send password hash to client
+	Name            string     `json:"name"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	Name     string `json:"name" binding:"required"`
 }
 
@@ -22,7 +23,43 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// AuthResponse carries newly issued tokens. In cookie mode the tokens are
+// set as cookies instead, and CSRFToken is the value to send in the
+// X-CSRF-Token header.
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+	User         User   `json:"user"`
+}
+
+// LoginMethods summarizes the ways a user can log in, so that removing one
+// never leaves an account that cannot be accessed.
+type LoginMethods struct {
+	Password   bool
+	Passkeys   int
+	Identities int
+}
+
+// UpdateProfileRequest changes the fields that are set.
+type UpdateProfileRequest struct {
+	Name *string `json:"name" binding:"omitempty,min=1,max=255"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangeEmailRequest starts changing the user's address to Email. Password
+// is required if the account has one.
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password"`
+}
+
+// DeleteAccountRequest confirms an account deletion. Password is required if
+// the account has one.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
 }
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Purposes of single-use tokens sent to users by email.
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeAccountUnlock     = "account_unlock"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeAccountRestore    = "account_restore"
+)
+
+// UserToken is a single-use token emailed to a user. Only its hash is stored.
+type UserToken struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	Purpose   string `json:"purpose"`
+	TokenHash string `json:"-"`
+	// Email is the new address an email change token confirms
+	Email      string     `json:"email,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type RestoreAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
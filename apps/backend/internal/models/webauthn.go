@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebAuthn ceremonies a stored challenge can be used for.
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonySignup       = "signup"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential is a registered passkey. Data holds the credential record
+// as serialized by the WebAuthn library.
+type WebAuthnCredential struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	CredentialID []byte     `json:"-"`
+	Name         string     `json:"name"`
+	Data         []byte     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+
+	// UserHandle is the owner's WebAuthn user handle. It is only loaded by
+	// lookups that need it.
+	UserHandle []byte `json:"-"`
+}
+
+// WebAuthnSession is the server-side state of a ceremony in progress, found
+// again by the challenge the client signs.
+type WebAuthnSession struct {
+	ID        int
+	Challenge string
+	Ceremony  string
+	UserID    *int
+	Data      []byte
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// WebAuthnSignupRequest starts creating an account whose only credential is a
+// passkey.
+type WebAuthnSignupRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Name  string `json:"name" binding:"required"`
+}
+
+// WebAuthnFinishRequest carries the browser's response to a ceremony, as
+// produced by navigator.credentials.create() or get().
+type WebAuthnFinishRequest struct {
+	Credential json.RawMessage `json:"credential" binding:"required"`
+
+	// Name labels a newly registered passkey, e.g. "MacBook".
+	Name string `json:"name" binding:"max=255"`
+}
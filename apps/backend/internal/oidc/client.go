@@ -0,0 +1,290 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultScopes are requested when a provider is configured without scopes.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// keyRefreshInterval limits how often an unknown kid causes the JWKS to be
+// fetched again, so that tokens with made-up key ids cannot be used to hammer
+// the provider.
+const keyRefreshInterval = time.Minute
+
+// ErrInvalidIDToken is returned when an ID token fails validation.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Config describes a provider and this application's registration with it.
+type Config struct {
+	// Name identifies the provider in URLs and in stored identities.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// LinkByEmail allows a first login with this provider to be attached to
+	// an existing account with the same verified email address. Only enable
+	// it for providers that are trusted to verify the addresses they assert.
+	LinkByEmail bool
+}
+
+// TokenResponse is the token endpoint's response to an authorization code.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	IDToken      string `json:"id_token"`
+}
+
+// IDToken holds the validated claims of an ID token that this application
+// uses.
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Client is a relying party for a single provider. The provider's discovery
+// document and keys are fetched on first use and cached.
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu          sync.Mutex
+	discovery   *Discovery
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// NewClient returns a client for the provider described by cfg. If
+// httpClient is nil, http.DefaultClient is used.
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = DefaultScopes
+	}
+	return &Client{cfg: cfg, http: httpClient}
+}
+
+func (c *Client) Config() Config {
+	return c.cfg
+}
+
+// Discovery returns the provider's metadata, fetching it if necessary.
+func (c *Client) Discovery(ctx context.Context) (*Discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	discovery, err := Discover(ctx, c.http, c.cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	c.discovery = discovery
+	return discovery, nil
+}
+
+// AuthCodeURL returns the URL to send the user to in order to authenticate.
+// challenge is the S256 PKCE challenge of the verifier later passed to
+// Exchange.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	discovery, err := c.Discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code at the token endpoint.
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (*TokenResponse, error) {
+	discovery, err := c.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if c.cfg.ClientSecret == "" {
+		form.Set("client_id", c.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	var token TokenResponse
+	if err := doJSON(c.http, req, &token); err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return &token, nil
+}
+
+// idTokenClaims are the ID token claims checked or read by VerifyIDToken.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty string       `json:"azp,omitempty"`
+	Nonce           string       `json:"nonce,omitempty"`
+	Email           string       `json:"email,omitempty"`
+	EmailVerified   flexibleBool `json:"email_verified,omitempty"`
+	Name            string       `json:"name,omitempty"`
+}
+
+// VerifyIDToken validates the signature and claims of an ID token issued for
+// this client and returns its identity claims. nonce must be the value sent
+// with the authorization request.
+func (c *Client) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	discovery, err := c.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+
+	var claims idTokenClaims
+	_, err = parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.key(ctx, discovery, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp does not match client", ErrInvalidIDToken)
+	}
+	if claims.AuthorizedParty != "" && claims.AuthorizedParty != c.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp does not match client", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	return &IDToken{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// key returns the provider's signing key with the given kid, refetching the
+// JWKS when the kid is unknown so that key rotation is picked up.
+func (c *Client) key(ctx context.Context, discovery *Discovery, kid string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	if c.keys != nil && time.Since(c.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := fetchKeys(ctx, c.http, discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	c.keysFetched = time.Now()
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key. A token without a kid is accepted only when
+// the provider publishes a single key.
+func (c *Client) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// flexibleBool decodes both JSON booleans and the strings "true" and "false",
+// since some providers send email_verified as a string.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*b = flexibleBool(parsed)
+	case nil:
+		*b = false
+	default:
+		return fmt.Errorf("cannot decode %s as a boolean", data)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*Client, *oidctest.Provider) {
+	provider := oidctest.NewProvider()
+	t.Cleanup(provider.Close)
+
+	client := NewClient(Config{
+		Name:         "test",
+		Issuer:       provider.Issuer,
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  "http://localhost:3000/auth/callback/test",
+	}, nil)
+	return client, provider
+}
+
+func TestCodeChallengeS256_RFC7636Vector(t *testing.T) {
+	// From RFC 7636 appendix B
+	assert.Equal(t,
+		"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestDiscover_RejectsIssuerMismatch(t *testing.T) {
+	provider := oidctest.NewProvider()
+	defer provider.Close()
+
+	// The provider's metadata names the issuer without a trailing slash
+	_, err := Discover(context.Background(), http.DefaultClient, provider.Issuer+"/")
+	assert.Error(t, err)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	client, provider := newTestClient(t)
+
+	authURL, err := client.AuthCodeURL(context.Background(), "state-1", "nonce-1", "challenge-1")
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, provider.Issuer+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	query := parsed.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, provider.ClientID, query.Get("client_id"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	assert.Equal(t, "state-1", query.Get("state"))
+	assert.Equal(t, "nonce-1", query.Get("nonce"))
+	assert.Equal(t, "challenge-1", query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+}
+
+// login runs the whole flow against the provider and returns the verified ID
+// token.
+func login(t *testing.T, client *Client, provider *oidctest.Provider) (*IDToken, error) {
+	ctx := context.Background()
+	verifier, err := NewCodeVerifier()
+	require.NoError(t, err)
+
+	authURL, err := client.AuthCodeURL(ctx, "state", "nonce", CodeChallengeS256(verifier))
+	require.NoError(t, err)
+
+	code, state, err := provider.Authorize(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "state", state)
+
+	token, err := client.Exchange(ctx, code, verifier)
+	require.NoError(t, err)
+
+	return client.VerifyIDToken(ctx, token.IDToken, "nonce")
+}
+
+func TestFlow_Success(t *testing.T) {
+	client, provider := newTestClient(t)
+
+	idToken, err := login(t, client, provider)
+	require.NoError(t, err)
+	assert.Equal(t, provider.Subject, idToken.Subject)
+	assert.Equal(t, provider.Email, idToken.Email)
+	assert.True(t, idToken.EmailVerified)
+	assert.Equal(t, provider.Name, idToken.Name)
+}
+
+func TestFlow_PicksUpRotatedKey(t *testing.T) {
+	client, provider := newTestClient(t)
+
+	_, err := login(t, client, provider)
+	require.NoError(t, err)
+
+	provider.RotateKey()
+	// Allow the cache to refresh immediately
+	client.keysFetched = time.Time{}
+
+	_, err = login(t, client, provider)
+	assert.NoError(t, err)
+}
+
+func TestExchange_WrongVerifier(t *testing.T) {
+	client, provider := newTestClient(t)
+	ctx := context.Background()
+
+	verifier, _ := NewCodeVerifier()
+	authURL, err := client.AuthCodeURL(ctx, "state", "nonce", CodeChallengeS256(verifier))
+	require.NoError(t, err)
+	code, _, err := provider.Authorize(authURL)
+	require.NoError(t, err)
+
+	other, _ := NewCodeVerifier()
+	_, err = client.Exchange(ctx, code, other)
+	assert.Error(t, err)
+}
+
+func TestExchange_CodeIsSingleUse(t *testing.T) {
+	client, provider := newTestClient(t)
+	ctx := context.Background()
+
+	verifier, _ := NewCodeVerifier()
+	authURL, err := client.AuthCodeURL(ctx, "state", "nonce", CodeChallengeS256(verifier))
+	require.NoError(t, err)
+	code, _, err := provider.Authorize(authURL)
+	require.NoError(t, err)
+
+	_, err = client.Exchange(ctx, code, verifier)
+	require.NoError(t, err)
+	_, err = client.Exchange(ctx, code, verifier)
+	assert.Error(t, err)
+}
+
+func TestVerifyIDToken_RejectsInvalidClaims(t *testing.T) {
+	client, provider := newTestClient(t)
+	ctx := context.Background()
+
+	tests := map[string]func(claims map[string]interface{}){
+		"wrong issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c map[string]interface{}) { c["aud"] = "other-client" },
+		"expired":        func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c map[string]interface{}) { delete(c, "exp") },
+		"wrong nonce":    func(c map[string]interface{}) { c["nonce"] = "other" },
+		"no subject":     func(c map[string]interface{}) { delete(c, "sub") },
+		"wrong azp": func(c map[string]interface{}) {
+			c["aud"] = []string{provider.ClientID, "other-client"}
+			c["azp"] = "other-client"
+		},
+	}
+
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := provider.Claims("nonce")
+			mutate(claims)
+			raw, err := provider.SignIDToken(claims)
+			require.NoError(t, err)
+
+			_, err = client.VerifyIDToken(ctx, raw, "nonce")
+			assert.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestVerifyIDToken_RejectsForeignSignature(t *testing.T) {
+	client, provider := newTestClient(t)
+	other := oidctest.NewProvider()
+	defer other.Close()
+
+	claims := provider.Claims("nonce")
+	raw, err := other.SignIDToken(claims)
+	require.NoError(t, err)
+
+	_, err = client.VerifyIDToken(context.Background(), raw, "nonce")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestFlexibleBool(t *testing.T) {
+	for input, want := range map[string]bool{`true`: true, `false`: false, `"true"`: true, `"false"`: false, `null`: false} {
+		var b flexibleBool
+		require.NoError(t, json.Unmarshal([]byte(input), &b), input)
+		assert.Equal(t, want, bool(b), input)
+	}
+
+	var b flexibleBool
+	assert.Error(t, json.Unmarshal([]byte(`1`), &b))
+}
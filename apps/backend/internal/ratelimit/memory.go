@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore forgets full buckets.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in memory. Each instance of the API enforces its
+// limits separately, so it suits a single instance.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, tats: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	tat, result := Take(s.tats[key], now, limit)
+	s.tats[key] = tat
+	return result, nil
+}
+
+// sweep drops buckets that have refilled, which are the same as missing ones.
+// It must be called with s.mu held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for key, tat := range s.tats {
+		if !tat.After(now) {
+			delete(s.tats, key)
+		}
+	}
+	s.nextSweep = now.Add(sweepInterval)
+}
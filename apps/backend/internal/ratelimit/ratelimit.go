@@ -0,0 +1,112 @@
+// Package ratelimit limits how often a key, such as a client IP address, may
+// make requests. Limits are enforced as token buckets using the generic cell
+// rate algorithm (GCRA), which only needs to store one timestamp per key.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period. Unused requests accumulate, so up to
+// Requests can be made at once. The zero Limit allows everything.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// IsZero reports whether the limit is unset.
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// Interval is how often the bucket gains a request.
+func (l Limit) Interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+func (l Limit) String() string {
+	if l.IsZero() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// ParseLimit parses a limit written as requests/period, e.g. "10/1m" or
+// "1000/1h". "off" is the zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want requests/period", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Result describes a key's bucket after a request was counted against it.
+type Result struct {
+	Allowed bool
+	Limit   Limit
+	// Remaining is how many more requests could be made now.
+	Remaining int
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+	// RetryAfter is how long until a refused request would be allowed. It is
+	// zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of every key's bucket.
+type Store interface {
+	// Take counts a request against key's bucket if the limit allows it.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Take applies one request to a bucket whose theoretical arrival time is tat,
+// the time at which it would be full again, returning the new tat. Stores
+// hold tat and call Take, or implement the same rule themselves and build
+// the Result with NewResult.
+func Take(tat, now time.Time, limit Limit) (time.Time, Result) {
+	next := tat
+	if next.Before(now) {
+		next = now
+	}
+	next = next.Add(limit.Interval())
+
+	allowed := next.Sub(now) <= limit.Period
+	if allowed {
+		tat = next
+	}
+	return tat, NewResult(tat, now, allowed, limit)
+}
+
+// NewResult describes a bucket with the given tat after a request was allowed
+// or refused.
+func NewResult(tat, now time.Time, allowed bool, limit Limit) Result {
+	result := Result{Allowed: allowed, Limit: limit}
+
+	if tat.After(now) {
+		result.ResetAfter = tat.Sub(now)
+	}
+	result.Remaining = int((limit.Period - result.ResetAfter) / limit.Interval())
+	if !allowed {
+		result.RetryAfter = max(result.ResetAfter+limit.Interval()-limit.Period, 0)
+	}
+
+	return result
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 10, Period: time.Minute}, limit)
+	assert.Equal(t, 6*time.Second, limit.Interval())
+
+	limit, err = ParseLimit("off")
+	require.NoError(t, err)
+	assert.True(t, limit.IsZero())
+
+	for _, invalid := range []string{"10", "0/1m", "ten/1m", "10/soon", "10/-1m"} {
+		_, err := ParseLimit(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTake_Burst(t *testing.T) {
+	limit := Limit{Requests: 3, Period: time.Minute}
+	now := time.Now()
+	var tat time.Time
+	var result Result
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		tat, result = Take(tat, now, limit)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+	assert.Equal(t, time.Minute, result.ResetAfter)
+
+	tat, result = Take(tat, now, limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+
+	// A refused request doesn't use anything up
+	_, result = Take(tat, now.Add(20*time.Second), limit)
+	assert.True(t, result.Allowed)
+}
+
+func TestTake_Refills(t *testing.T) {
+	limit := Limit{Requests: 2, Period: time.Minute}
+	now := time.Now()
+
+	tat, _ := Take(time.Time{}, now, limit)
+	tat, _ = Take(tat, now, limit)
+
+	_, result := Take(tat, now.Add(time.Hour), limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining, "Unused requests accumulate only up to the limit")
+	assert.Equal(t, 30*time.Second, result.ResetAfter)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 1, Period: time.Minute}
+	ctx := context.Background()
+
+	result, err := store.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take(ctx, "a", limit)
+	assert.False(t, result.Allowed)
+	result, _ = store.Take(ctx, "b", limit)
+	assert.True(t, result.Allowed, "Keys have separate buckets")
+
+	now = now.Add(time.Minute)
+	result, _ = store.Take(ctx, "a", limit)
+	assert.True(t, result.Allowed)
+}
+
+func TestMemoryStore_SweepsFullBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 10, Period: time.Second}
+
+	store.Take(context.Background(), "a", limit)
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "b", limit)
+
+	assert.NotContains(t, store.tats, "a")
+	assert.Contains(t, store.tats, "b")
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+)
+
+// AuditRepository stores the audit log of security events.
+type AuditRepository struct {
+	db *database.DB
+}
+
+func NewAuditRepository(db *database.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Record(ctx context.Context, event *models.AuditEvent) error {
+	if event.Details == nil {
+		event.Details = map[string]any{}
+	}
+
+	query := `
+		INSERT INTO audit_events (event, user_id, actor_id, ip_address, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, event.Event, event.UserID, event.ActorID, event.IPAddress, event.Details).
+		Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return nil
+}
+
+// ListForUser returns the events concerning a user, newest first.
+func (r *AuditRepository) ListForUser(ctx context.Context, userID int) ([]models.AuditEvent, error) {
+	query := `
+		SELECT id, event, user_id, actor_id, ip_address, details, created_at
+		FROM audit_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.Event,
+			&event.UserID,
+			&event.ActorID,
+			&event.IPAddress,
+			&event.Details,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrIdentityAlreadyLinked is returned when linking a provider account that is
+// already linked to a user.
+var ErrIdentityAlreadyLinked = errors.New("identity already linked")
+
+// IdentityRepository stores identities at external OpenID Connect providers
+// and the authorization requests used to log in with them.
+type IdentityRepository struct {
+	db *database.DB
+}
+
+func NewIdentityRepository(db *database.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// CreateAuthRequest stores the state of a new authorization request. Requests
+// that have expired are pruned at the same time.
+func (r *IdentityRepository) CreateAuthRequest(ctx context.Context, req *models.OIDCAuthRequest, ttl time.Duration) error {
+	query := `
+		INSERT INTO oidc_auth_requests (state, provider, nonce, code_verifier, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW() + make_interval(secs => $6), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, req.State, req.Provider, req.Nonce, req.CodeVerifier, req.UserID, ttl.Seconds()).
+		Scan(&req.ID, &req.ExpiresAt, &req.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC auth request: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, "DELETE FROM oidc_auth_requests WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to prune OIDC auth requests: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthRequest removes and returns the unexpired request to provider
+// with the given state, or nil if there is none, so that each state can be
+// used at most once.
+func (r *IdentityRepository) ConsumeAuthRequest(ctx context.Context, provider, state string) (*models.OIDCAuthRequest, error) {
+	query := `
+		DELETE FROM oidc_auth_requests
+		WHERE state = $1 AND provider = $2 AND expires_at > NOW()
+		RETURNING id, state, provider, nonce, code_verifier, user_id, expires_at, created_at
+	`
+
+	var req models.OIDCAuthRequest
+	err := r.db.QueryRow(ctx, query, state, provider).Scan(
+		&req.ID,
+		&req.State,
+		&req.Provider,
+		&req.Nonce,
+		&req.CodeVerifier,
+		&req.UserID,
+		&req.ExpiresAt,
+		&req.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume OIDC auth request: %w", err)
+	}
+
+	return &req, nil
+}
+
+// GetByProviderSubject returns the identity for a provider account, or nil if
+// it is not linked to any user.
+func (r *IdentityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	var identity models.UserIdentity
+	err := r.db.QueryRow(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+// Create links identity to an existing user. It returns
+// ErrIdentityAlreadyLinked if the provider account is linked already.
+func (r *IdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	return createIdentity(ctx, r.db, identity)
+}
+
+// CreateUserWithIdentity creates a passwordless account together with the
+// identity used to sign up. If emailVerified is true the provider vouched
+// for the address, and it is recorded as verified.
+func (r *IdentityRepository) CreateUserWithIdentity(ctx context.Context, user *models.User, emailVerified bool, identity *models.UserIdentity) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO users (email, name, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, CASE WHEN $3 THEN NOW() END, NOW(), NOW())
+		RETURNING id, email_verified_at, created_at, updated_at
+	`
+	err = tx.QueryRow(ctx, query, user.Email, user.Name, emailVerified).
+		Scan(&user.ID, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	identity.UserID = user.ID
+	if err := createIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit user creation: %w", err)
+	}
+
+	return nil
+}
+
+func createIdentity(ctx context.Context, q querier, identity *models.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+		ON CONFLICT (provider, subject) DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := q.QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrIdentityAlreadyLinked
+		}
+		return fmt.Errorf("failed to create user identity: %w", err)
+	}
+
+	return nil
+}
+
+// RecordLogin records a login with the identity and the email address the
+// provider currently reports for it.
+func (r *IdentityRepository) RecordLogin(ctx context.Context, id int, email string) error {
+	query := `
+		UPDATE user_identities
+		SET email = NULLIF($2, ''), last_login_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, email); err != nil {
+		return fmt.Errorf("failed to update user identity: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUser returns the user's linked identities, oldest first.
+func (r *IdentityRepository) ListByUser(ctx context.Context, userID int) ([]models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user identities: %w", err)
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		var identity models.UserIdentity
+		err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+			&identity.LastLoginAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list user identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// Delete unlinks one of the user's identities. It returns false if the user
+// has no identity with that id.
+func (r *IdentityRepository) Delete(ctx context.Context, userID, id int) (bool, error) {
+	query := `DELETE FROM user_identities WHERE id = $1 AND user_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user identity: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// IdentityRepositoryTestSuite is an integration test suite that requires a running database
+type IdentityRepositoryTestSuite struct {
+	suite.Suite
+	db       *database.DB
+	repo     *IdentityRepository
+	userRepo *UserRepository
+	user     *models.User
+	ctx      context.Context
+}
+
+func (suite *IdentityRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewIdentityRepository(suite.db)
+	suite.userRepo = NewUserRepository(suite.db)
+}
+
+func (suite *IdentityRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *IdentityRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM oidc_auth_requests")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "identity@example.com", PasswordHash: "hash", Name: "Identity"}
+	suite.Require().NoError(suite.userRepo.Create(suite.ctx, suite.user))
+}
+
+func (suite *IdentityRepositoryTestSuite) newIdentity(provider, subject string) *models.UserIdentity {
+	identity := &models.UserIdentity{UserID: suite.user.ID, Provider: provider, Subject: subject, Email: suite.user.Email}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, identity))
+	return identity
+}
+
+func (suite *IdentityRepositoryTestSuite) TestConsumeAuthRequest_OnlyOnce() {
+	req := &models.OIDCAuthRequest{State: "state-1", Provider: "google", Nonce: "nonce", CodeVerifier: "verifier", UserID: &suite.user.ID}
+	suite.Require().NoError(suite.repo.CreateAuthRequest(suite.ctx, req, time.Minute))
+
+	consumed, err := suite.repo.ConsumeAuthRequest(suite.ctx, "google", "state-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "nonce", consumed.Nonce)
+	assert.Equal(suite.T(), "verifier", consumed.CodeVerifier)
+	assert.Equal(suite.T(), suite.user.ID, *consumed.UserID)
+
+	consumed, err = suite.repo.ConsumeAuthRequest(suite.ctx, "google", "state-1")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestConsumeAuthRequest_WrongProvider() {
+	req := &models.OIDCAuthRequest{State: "state-1", Provider: "google", Nonce: "nonce", CodeVerifier: "verifier"}
+	suite.Require().NoError(suite.repo.CreateAuthRequest(suite.ctx, req, time.Minute))
+
+	consumed, err := suite.repo.ConsumeAuthRequest(suite.ctx, "github", "state-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestConsumeAuthRequest_Expired() {
+	req := &models.OIDCAuthRequest{State: "state-1", Provider: "google", Nonce: "nonce", CodeVerifier: "verifier"}
+	suite.Require().NoError(suite.repo.CreateAuthRequest(suite.ctx, req, -time.Minute))
+
+	consumed, err := suite.repo.ConsumeAuthRequest(suite.ctx, "google", "state-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestGetByProviderSubject() {
+	created := suite.newIdentity("google", "subject-1")
+
+	identity, err := suite.repo.GetByProviderSubject(suite.ctx, "google", "subject-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), created.ID, identity.ID)
+	assert.Equal(suite.T(), suite.user.ID, identity.UserID)
+
+	identity, err = suite.repo.GetByProviderSubject(suite.ctx, "github", "subject-1")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), identity)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestCreate_AlreadyLinked() {
+	suite.newIdentity("google", "subject-1")
+	other := &models.User{Email: "other@example.com", PasswordHash: "hash", Name: "Other"}
+	suite.Require().NoError(suite.userRepo.Create(suite.ctx, other))
+
+	err := suite.repo.Create(suite.ctx, &models.UserIdentity{UserID: other.ID, Provider: "google", Subject: "subject-1"})
+
+	assert.ErrorIs(suite.T(), err, ErrIdentityAlreadyLinked)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestRecordLogin() {
+	created := suite.newIdentity("google", "subject-1")
+
+	err := suite.repo.RecordLogin(suite.ctx, created.ID, "new@example.com")
+
+	assert.NoError(suite.T(), err)
+	identities, _ := suite.repo.ListByUser(suite.ctx, suite.user.ID)
+	assert.NotNil(suite.T(), identities[0].LastLoginAt)
+	assert.Equal(suite.T(), "new@example.com", identities[0].Email)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestDelete_OnlyOwnIdentities() {
+	created := suite.newIdentity("google", "subject-1")
+	other := &models.User{Email: "other@example.com", PasswordHash: "hash", Name: "Other"}
+	suite.Require().NoError(suite.userRepo.Create(suite.ctx, other))
+
+	deleted, err := suite.repo.Delete(suite.ctx, other.ID, created.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), deleted)
+
+	deleted, err = suite.repo.Delete(suite.ctx, suite.user.ID, created.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), deleted)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestCreateUserWithIdentity() {
+	user := &models.User{Email: "social@example.com", Name: "Social"}
+	identity := &models.UserIdentity{Provider: "google", Subject: "subject-2", Email: user.Email}
+
+	err := suite.repo.CreateUserWithIdentity(suite.ctx, user, true, identity)
+
+	assert.NoError(suite.T(), err)
+	assert.NotZero(suite.T(), user.ID)
+	assert.NotNil(suite.T(), user.EmailVerifiedAt)
+	assert.Equal(suite.T(), user.ID, identity.UserID)
+
+	stored, _ := suite.userRepo.GetByID(suite.ctx, user.ID)
+	assert.Empty(suite.T(), stored.PasswordHash)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestCreateUserWithIdentity_Unverified() {
+	user := &models.User{Email: "social@example.com", Name: "Social"}
+	identity := &models.UserIdentity{Provider: "google", Subject: "subject-2"}
+
+	err := suite.repo.CreateUserWithIdentity(suite.ctx, user, false, identity)
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), user.EmailVerifiedAt)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestCreateUserWithIdentity_RollsBackUser() {
+	suite.newIdentity("google", "subject-1")
+	user := &models.User{Email: "duplicate-identity@example.com", Name: "Duplicate"}
+	identity := &models.UserIdentity{Provider: "google", Subject: "subject-1"}
+
+	err := suite.repo.CreateUserWithIdentity(suite.ctx, user, true, identity)
+
+	assert.ErrorIs(suite.T(), err, ErrIdentityAlreadyLinked)
+	stored, _ := suite.userRepo.GetByEmail(suite.ctx, "duplicate-identity@example.com")
+	assert.Nil(suite.T(), stored)
+}
+
+func (suite *IdentityRepositoryTestSuite) TestCreateUserWithIdentity_DeletedAccountsEmail() {
+	suite.Require().NoError(suite.userRepo.SoftDelete(suite.ctx, suite.user.ID))
+	user := &models.User{Email: suite.user.Email, Name: "Social"}
+	identity := &models.UserIdentity{Provider: "google", Subject: "subject-2"}
+
+	err := suite.repo.CreateUserWithIdentity(suite.ctx, user, true, identity)
+
+	assert.ErrorIs(suite.T(), err, ErrEmailTaken)
+}
+
+func TestIdentityRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(IdentityRepositoryTestSuite))
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// LoginThrottleRepository counts failed logins per email address and per IP
+// address, and wrong codes per MFA token. The counts live in the database so
+// that every replica of the API enforces the same limits.
+type LoginThrottleRepository struct {
+	db *database.DB
+}
+
+func NewLoginThrottleRepository(db *database.DB) *LoginThrottleRepository {
+	return &LoginThrottleRepository{db: db}
+}
+
+// Blocked returns whichever of keys is blocked for the longest, or nil if
+// none of them is blocked.
+func (r *LoginThrottleRepository) Blocked(ctx context.Context, keys ...string) (*models.LoginThrottle, error) {
+	query := `
+		SELECT key, failures, locked, EXTRACT(EPOCH FROM blocked_until - NOW())::float8
+		FROM login_throttles
+		WHERE key = ANY($1) AND blocked_until > NOW()
+		ORDER BY blocked_until DESC
+		LIMIT 1
+	`
+
+	var throttle models.LoginThrottle
+	var seconds float64
+	err := r.db.QueryRow(ctx, query, keys).Scan(&throttle.Key, &throttle.Failures, &throttle.Locked, &seconds)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login throttle: %w", err)
+	}
+	throttle.RetryAfter = time.Duration(seconds * float64(time.Second))
+
+	return &throttle, nil
+}
+
+// RecordFailure counts a failed login against key and returns the number of
+// failures within window, including this one. Failures older than window are
+// forgotten.
+func (r *LoginThrottleRepository) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	// Forget throttles that have gone quiet and are no longer blocking, and
+	// those for credentials that have expired
+	pruneQuery := `
+		DELETE FROM login_throttles
+		WHERE (
+			expires_at IS NULL
+			AND last_failure_at < NOW() - make_interval(secs => $1)
+			AND (blocked_until IS NULL OR blocked_until < NOW())
+		) OR expires_at < NOW()
+	`
+	if _, err := r.db.Exec(ctx, pruneQuery, window.Seconds()); err != nil {
+		return 0, fmt.Errorf("failed to prune login throttles: %w", err)
+	}
+
+	query := `
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures
+	`
+
+	var failures int
+	if err := r.db.QueryRow(ctx, query, key, window.Seconds()).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// RecordFailureUntil counts a failed attempt against key, a credential that
+// expires at expiresAt, and returns the number of failures so far, including
+// this one. The count is kept until the credential expires.
+func (r *LoginThrottleRepository) RecordFailureUntil(ctx context.Context, key string, expiresAt time.Time) (int, error) {
+	if _, err := r.db.Exec(ctx, "DELETE FROM login_throttles WHERE expires_at < NOW()"); err != nil {
+		return 0, fmt.Errorf("failed to prune login throttles: %w", err)
+	}
+
+	// Relative to NOW(), so that the expiry is on the database's clock
+	query := `
+		INSERT INTO login_throttles (key, failures, last_failure_at, expires_at)
+		VALUES ($1, 1, NOW(), NOW() + make_interval(secs => $2))
+		ON CONFLICT (key) DO UPDATE SET
+			failures = login_throttles.failures + 1,
+			last_failure_at = NOW()
+		RETURNING failures
+	`
+
+	var failures int
+	if err := r.db.QueryRow(ctx, query, key, time.Until(expiresAt).Seconds()).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// Block refuses attempts for key for d. A lockout also resets the failure
+// count, so that once it ends the progressive delays start over.
+func (r *LoginThrottleRepository) Block(ctx context.Context, key string, d time.Duration, lock bool) error {
+	query := `
+		UPDATE login_throttles
+		SET blocked_until = NOW() + make_interval(secs => $2),
+			locked = $3::boolean,
+			failures = CASE WHEN $3::boolean THEN 0 ELSE failures END
+		WHERE key = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, key, d.Seconds(), lock); err != nil {
+		return fmt.Errorf("failed to block login: %w", err)
+	}
+
+	return nil
+}
+
+// Clear forgets the failures recorded against key and lifts any block. It
+// reports whether key was locked out.
+func (r *LoginThrottleRepository) Clear(ctx context.Context, key string) (bool, error) {
+	query := `DELETE FROM login_throttles WHERE key = $1 RETURNING COALESCE(locked AND blocked_until > NOW(), FALSE)`
+
+	var locked bool
+	err := r.db.QueryRow(ctx, query, key).Scan(&locked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to clear login throttle: %w", err)
+	}
+
+	return locked, nil
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// LoginThrottleRepositoryTestSuite is an integration test suite that requires a running database
+type LoginThrottleRepositoryTestSuite struct {
+	suite.Suite
+	db    *database.DB
+	repo  *LoginThrottleRepository
+	audit *AuditRepository
+	ctx   context.Context
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewLoginThrottleRepository(suite.db)
+	suite.audit = NewAuditRepository(suite.db)
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM login_throttles")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM audit_events")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) TestRecordFailure_Counts() {
+	for want := 1; want <= 3; want++ {
+		failures, err := suite.repo.RecordFailure(suite.ctx, "email:user@example.com", time.Hour)
+		suite.Require().NoError(err)
+		assert.Equal(suite.T(), want, failures)
+	}
+
+	failures, err := suite.repo.RecordFailure(suite.ctx, "ip:192.0.2.1", time.Hour)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, failures, "Keys are counted separately")
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) TestRecordFailure_ForgetsOldFailures() {
+	_, err := suite.repo.RecordFailure(suite.ctx, "email:user@example.com", time.Hour)
+	suite.Require().NoError(err)
+	_, err = suite.db.Pool.Exec(suite.ctx, "UPDATE login_throttles SET last_failure_at = NOW() - INTERVAL '2 hours'")
+	suite.Require().NoError(err)
+
+	failures, err := suite.repo.RecordFailure(suite.ctx, "email:user@example.com", time.Hour)
+
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, failures)
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) TestRecordFailureUntil() {
+	expiresAt := time.Now().Add(5 * time.Minute)
+	for want := 1; want <= 3; want++ {
+		failures, err := suite.repo.RecordFailureUntil(suite.ctx, "mfa:jti-1", expiresAt)
+		suite.Require().NoError(err)
+		assert.Equal(suite.T(), want, failures)
+	}
+
+	// A login failure window shorter than the credential's lifetime does not
+	// forget it
+	_, err := suite.db.Pool.Exec(suite.ctx, "UPDATE login_throttles SET last_failure_at = NOW() - INTERVAL '2 hours'")
+	suite.Require().NoError(err)
+	_, err = suite.repo.RecordFailure(suite.ctx, "email:user@example.com", time.Hour)
+	suite.Require().NoError(err)
+	failures, err := suite.repo.RecordFailureUntil(suite.ctx, "mfa:jti-1", expiresAt)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 4, failures)
+
+	_, err = suite.db.Pool.Exec(suite.ctx, "UPDATE login_throttles SET expires_at = NOW() - INTERVAL '1 second' WHERE key = 'mfa:jti-1'")
+	suite.Require().NoError(err)
+	_, err = suite.repo.RecordFailure(suite.ctx, "email:user@example.com", time.Hour)
+	suite.Require().NoError(err)
+	var remaining int
+	suite.Require().NoError(suite.db.Pool.QueryRow(suite.ctx, "SELECT COUNT(*) FROM login_throttles WHERE key = 'mfa:jti-1'").Scan(&remaining))
+	assert.Zero(suite.T(), remaining, "Counts are evicted once the credential expires")
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) TestBlocked() {
+	_, err := suite.repo.RecordFailure(suite.ctx, "email:user@example.com", time.Hour)
+	suite.Require().NoError(err)
+	_, err = suite.repo.RecordFailure(suite.ctx, "ip:192.0.2.1", time.Hour)
+	suite.Require().NoError(err)
+
+	throttle, err := suite.repo.Blocked(suite.ctx, "email:user@example.com", "ip:192.0.2.1")
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), throttle, "Failures alone don't block")
+
+	suite.Require().NoError(suite.repo.Block(suite.ctx, "email:user@example.com", time.Minute, false))
+	suite.Require().NoError(suite.repo.Block(suite.ctx, "ip:192.0.2.1", time.Hour, true))
+
+	throttle, err = suite.repo.Blocked(suite.ctx, "email:user@example.com", "ip:192.0.2.1")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(throttle)
+	assert.Equal(suite.T(), "ip:192.0.2.1", throttle.Key, "The longest block wins")
+	assert.True(suite.T(), throttle.Locked)
+	assert.Equal(suite.T(), 0, throttle.Failures, "Locking resets the count")
+	assert.InDelta(suite.T(), time.Hour.Seconds(), throttle.RetryAfter.Seconds(), 5)
+
+	throttle, err = suite.repo.Blocked(suite.ctx, "email:other@example.com")
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), throttle)
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) TestClear() {
+	_, err := suite.repo.RecordFailure(suite.ctx, "email:user@example.com", time.Hour)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.repo.Block(suite.ctx, "email:user@example.com", time.Hour, true))
+
+	locked, err := suite.repo.Clear(suite.ctx, "email:user@example.com")
+	suite.Require().NoError(err)
+	assert.True(suite.T(), locked)
+
+	throttle, err := suite.repo.Blocked(suite.ctx, "email:user@example.com")
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), throttle)
+
+	locked, err = suite.repo.Clear(suite.ctx, "email:user@example.com")
+	suite.Require().NoError(err)
+	assert.False(suite.T(), locked)
+}
+
+func (suite *LoginThrottleRepositoryTestSuite) TestAuditEvents() {
+	user := &models.User{Email: "user@example.com", PasswordHash: "hash", Name: "User"}
+	suite.Require().NoError(NewUserRepository(suite.db).Create(suite.ctx, user))
+
+	locked := &models.AuditEvent{
+		Event:     models.AuditEventAccountLocked,
+		UserID:    &user.ID,
+		IPAddress: "192.0.2.1",
+		Details:   map[string]any{"email": user.Email},
+	}
+	suite.Require().NoError(suite.audit.Record(suite.ctx, locked))
+	assert.NotZero(suite.T(), locked.ID)
+	suite.Require().NoError(suite.audit.Record(suite.ctx, &models.AuditEvent{Event: models.AuditEventAccountUnlocked, UserID: &user.ID}))
+	suite.Require().NoError(suite.audit.Record(suite.ctx, &models.AuditEvent{Event: models.AuditEventIPBlocked, IPAddress: "192.0.2.1"}))
+
+	events, err := suite.audit.ListForUser(suite.ctx, user.ID)
+
+	suite.Require().NoError(err)
+	suite.Require().Len(events, 2)
+	assert.Equal(suite.T(), models.AuditEventAccountUnlocked, events[0].Event)
+	assert.Equal(suite.T(), models.AuditEventAccountLocked, events[1].Event)
+	assert.Equal(suite.T(), "192.0.2.1", events[1].IPAddress)
+	assert.Equal(suite.T(), user.Email, events[1].Details["email"])
+}
+
+func TestLoginThrottleRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(LoginThrottleRepositoryTestSuite))
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// MagicLinkRepository stores the single-use login links emailed to users.
+type MagicLinkRepository struct {
+	db *database.DB
+}
+
+func NewMagicLinkRepository(db *database.DB) *MagicLinkRepository {
+	return &MagicLinkRepository{db: db}
+}
+
+// Create stores link, removing expired links first.
+func (r *MagicLinkRepository) Create(ctx context.Context, link *models.MagicLink, ttl time.Duration) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM magic_links WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to prune magic links: %w", err)
+	}
+
+	query := `
+		INSERT INTO magic_links (email, token_hash, expires_at, created_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, link.Email, link.TokenHash, ttl.Seconds()).
+		Scan(&link.ID, &link.ExpiresAt, &link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create magic link: %w", err)
+	}
+
+	return nil
+}
+
+// Consume marks an unexpired, unused link as used and returns it. It returns
+// nil if no such link exists, so each link can be used at most once.
+func (r *MagicLinkRepository) Consume(ctx context.Context, tokenHash string) (*models.MagicLink, error) {
+	query := `
+		UPDATE magic_links
+		SET consumed_at = NOW()
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING id, email, token_hash, expires_at, consumed_at, created_at
+	`
+
+	var link models.MagicLink
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(
+		&link.ID,
+		&link.Email,
+		&link.TokenHash,
+		&link.ExpiresAt,
+		&link.ConsumedAt,
+		&link.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume magic link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// DeleteForEmail removes the links sent to an address, so that logging in
+// with one invalidates the others.
+func (r *MagicLinkRepository) DeleteForEmail(ctx context.Context, email string) error {
+	query := `DELETE FROM magic_links WHERE email = $1`
+
+	if _, err := r.db.Exec(ctx, query, email); err != nil {
+		return fmt.Errorf("failed to delete magic links: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// MagicLinkRepositoryTestSuite is an integration test suite that requires a running database
+type MagicLinkRepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *MagicLinkRepository
+	ctx  context.Context
+}
+
+func (suite *MagicLinkRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewMagicLinkRepository(suite.db)
+}
+
+func (suite *MagicLinkRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *MagicLinkRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM magic_links")
+	suite.Require().NoError(err, "Failed to clean up test data")
+}
+
+func (suite *MagicLinkRepositoryTestSuite) newLink(email, hash string, ttl time.Duration) *models.MagicLink {
+	link := &models.MagicLink{Email: email, TokenHash: hash}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, link, ttl))
+	return link
+}
+
+func (suite *MagicLinkRepositoryTestSuite) TestConsume_Success() {
+	created := suite.newLink("magic@example.com", "hash-1", time.Minute)
+
+	link, err := suite.repo.Consume(suite.ctx, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	suite.Require().NotNil(link)
+	assert.Equal(suite.T(), created.ID, link.ID)
+	assert.Equal(suite.T(), "magic@example.com", link.Email)
+	assert.NotNil(suite.T(), link.ConsumedAt)
+}
+
+func (suite *MagicLinkRepositoryTestSuite) TestConsume_OnlyOnce() {
+	suite.newLink("magic@example.com", "hash-1", time.Minute)
+	suite.repo.Consume(suite.ctx, "hash-1")
+
+	link, err := suite.repo.Consume(suite.ctx, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), link)
+}
+
+func (suite *MagicLinkRepositoryTestSuite) TestConsume_Expired() {
+	suite.newLink("magic@example.com", "hash-1", -time.Minute)
+
+	link, err := suite.repo.Consume(suite.ctx, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), link)
+}
+
+func (suite *MagicLinkRepositoryTestSuite) TestDeleteForEmail() {
+	suite.newLink("magic@example.com", "hash-1", time.Minute)
+	suite.newLink("other@example.com", "hash-2", time.Minute)
+
+	err := suite.repo.DeleteForEmail(suite.ctx, "magic@example.com")
+
+	assert.NoError(suite.T(), err)
+	link, _ := suite.repo.Consume(suite.ctx, "hash-1")
+	assert.Nil(suite.T(), link)
+	link, _ = suite.repo.Consume(suite.ctx, "hash-2")
+	assert.NotNil(suite.T(), link, "Other addresses' links are kept")
+}
+
+func TestMagicLinkRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(MagicLinkRepositoryTestSuite))
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrTOTPAlreadyEnabled is returned when starting TOTP enrollment for a user
+// who already has a confirmed authenticator.
+var ErrTOTPAlreadyEnabled = errors.New("TOTP already enabled")
+
+// MFARepository stores second factors: TOTP authenticators and recovery codes.
+type MFARepository struct {
+	db *database.DB
+}
+
+func NewMFARepository(db *database.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// GetTOTP returns the user's authenticator, confirmed or not, or nil if there
+// is none.
+func (r *MFARepository) GetTOTP(ctx context.Context, userID int) (*models.TOTPCredential, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step, created_at
+		FROM user_totp
+		WHERE user_id = $1
+	`
+
+	var credential models.TOTPCredential
+	err := r.db.QueryRow(ctx, query, userID).Scan(
+		&credential.UserID,
+		&credential.Secret,
+		&credential.ConfirmedAt,
+		&credential.LastUsedStep,
+		&credential.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP credential: %w", err)
+	}
+
+	return &credential, nil
+}
+
+// SaveUnconfirmedTOTP stores a new secret awaiting confirmation, replacing any
+// earlier unconfirmed one. It returns ErrTOTPAlreadyEnabled if the user has a
+// confirmed authenticator.
+func (r *MFARepository) SaveUnconfirmedTOTP(ctx context.Context, userID int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP credential: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+// ConfirmTOTP enables the user's authenticator, recording step as used, and
+// replaces their recovery codes. It returns false if there was no unconfirmed
+// authenticator to enable.
+func (r *MFARepository) ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE user_totp
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+	tag, err := tx.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to confirm TOTP credential: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit TOTP confirmation: %w", err)
+	}
+
+	return true, nil
+}
+
+// UseTOTPStep records that the code for step has been used. It returns false
+// if that step, or a later one, was already used, so each code is accepted at
+// most once.
+func (r *MFARepository) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2
+	`
+
+	tag, err := r.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP use: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteTOTP removes the user's authenticator and recovery codes.
+func (r *MFARepository) DeleteTOTP(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP credential: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit TOTP removal: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates the user's recovery codes and stores new ones.
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	query := `
+		INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at)
+		SELECT $1, unnest($2::text[]), NOW()
+	`
+	if _, err := tx.Exec(ctx, query, userID, codeHashes); err != nil {
+		return fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks one of the user's unused recovery codes as used. It
+// returns false if the user has no unused code with that hash.
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left.
+func (r *MFARepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+
+	var count int
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// MFARepositoryTestSuite is an integration test suite that requires a running database
+type MFARepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *MFARepository
+	user *models.User
+	ctx  context.Context
+}
+
+func (suite *MFARepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewMFARepository(suite.db)
+}
+
+func (suite *MFARepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *MFARepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "mfa@example.com", PasswordHash: "hash", Name: "MFA"}
+	suite.Require().NoError(NewUserRepository(suite.db).Create(suite.ctx, suite.user))
+}
+
+func (suite *MFARepositoryTestSuite) enable() {
+	suite.Require().NoError(suite.repo.SaveUnconfirmedTOTP(suite.ctx, suite.user.ID, "SECRET"))
+	confirmed, err := suite.repo.ConfirmTOTP(suite.ctx, suite.user.ID, 100, []string{"code-1", "code-2"})
+	suite.Require().NoError(err)
+	suite.Require().True(confirmed)
+}
+
+func (suite *MFARepositoryTestSuite) TestGetTOTP_NotFound() {
+	credential, err := suite.repo.GetTOTP(suite.ctx, suite.user.ID)
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), credential)
+}
+
+func (suite *MFARepositoryTestSuite) TestSaveUnconfirmedTOTP_ReplacesPending() {
+	suite.repo.SaveUnconfirmedTOTP(suite.ctx, suite.user.ID, "FIRST")
+
+	err := suite.repo.SaveUnconfirmedTOTP(suite.ctx, suite.user.ID, "SECOND")
+
+	assert.NoError(suite.T(), err)
+	credential, _ := suite.repo.GetTOTP(suite.ctx, suite.user.ID)
+	assert.Equal(suite.T(), "SECOND", credential.Secret)
+	assert.Nil(suite.T(), credential.ConfirmedAt)
+}
+
+func (suite *MFARepositoryTestSuite) TestSaveUnconfirmedTOTP_AlreadyEnabled() {
+	suite.enable()
+
+	err := suite.repo.SaveUnconfirmedTOTP(suite.ctx, suite.user.ID, "OTHER")
+
+	assert.ErrorIs(suite.T(), err, ErrTOTPAlreadyEnabled)
+	credential, _ := suite.repo.GetTOTP(suite.ctx, suite.user.ID)
+	assert.Equal(suite.T(), "SECRET", credential.Secret)
+}
+
+func (suite *MFARepositoryTestSuite) TestConfirmTOTP() {
+	suite.enable()
+
+	credential, err := suite.repo.GetTOTP(suite.ctx, suite.user.ID)
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), credential.ConfirmedAt)
+	assert.Equal(suite.T(), int64(100), credential.LastUsedStep)
+
+	count, _ := suite.repo.CountRecoveryCodes(suite.ctx, suite.user.ID)
+	assert.Equal(suite.T(), 2, count)
+}
+
+func (suite *MFARepositoryTestSuite) TestConfirmTOTP_NothingPending() {
+	confirmed, err := suite.repo.ConfirmTOTP(suite.ctx, suite.user.ID, 100, []string{"code-1"})
+
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), confirmed)
+	count, _ := suite.repo.CountRecoveryCodes(suite.ctx, suite.user.ID)
+	assert.Equal(suite.T(), 0, count)
+}
+
+func (suite *MFARepositoryTestSuite) TestUseTOTPStep_OnlyForward() {
+	suite.enable()
+
+	used, err := suite.repo.UseTOTPStep(suite.ctx, suite.user.ID, 101)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), used)
+
+	used, _ = suite.repo.UseTOTPStep(suite.ctx, suite.user.ID, 101)
+	assert.False(suite.T(), used, "The same step should not be accepted twice")
+
+	used, _ = suite.repo.UseTOTPStep(suite.ctx, suite.user.ID, 100)
+	assert.False(suite.T(), used, "Earlier steps should not be accepted")
+}
+
+func (suite *MFARepositoryTestSuite) TestUseTOTPStep_Unconfirmed() {
+	suite.repo.SaveUnconfirmedTOTP(suite.ctx, suite.user.ID, "SECRET")
+
+	used, err := suite.repo.UseTOTPStep(suite.ctx, suite.user.ID, 101)
+
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), used)
+}
+
+func (suite *MFARepositoryTestSuite) TestUseRecoveryCode_OnlyOnce() {
+	suite.enable()
+
+	used, err := suite.repo.UseRecoveryCode(suite.ctx, suite.user.ID, "code-1")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), used)
+
+	used, _ = suite.repo.UseRecoveryCode(suite.ctx, suite.user.ID, "code-1")
+	assert.False(suite.T(), used)
+
+	count, _ := suite.repo.CountRecoveryCodes(suite.ctx, suite.user.ID)
+	assert.Equal(suite.T(), 1, count)
+}
+
+func (suite *MFARepositoryTestSuite) TestReplaceRecoveryCodes() {
+	suite.enable()
+
+	err := suite.repo.ReplaceRecoveryCodes(suite.ctx, suite.user.ID, []string{"code-3"})
+
+	assert.NoError(suite.T(), err)
+	used, _ := suite.repo.UseRecoveryCode(suite.ctx, suite.user.ID, "code-1")
+	assert.False(suite.T(), used)
+	used, _ = suite.repo.UseRecoveryCode(suite.ctx, suite.user.ID, "code-3")
+	assert.True(suite.T(), used)
+}
+
+func (suite *MFARepositoryTestSuite) TestDeleteTOTP() {
+	suite.enable()
+
+	err := suite.repo.DeleteTOTP(suite.ctx, suite.user.ID)
+
+	assert.NoError(suite.T(), err)
+	credential, _ := suite.repo.GetTOTP(suite.ctx, suite.user.ID)
+	assert.Nil(suite.T(), credential)
+	count, _ := suite.repo.CountRecoveryCodes(suite.ctx, suite.user.ID)
+	assert.Equal(suite.T(), 0, count)
+}
+
+func TestMFARepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(MFARepositoryTestSuite))
+}
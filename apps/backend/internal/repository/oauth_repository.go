@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// OAuthRepository stores the clients that log users in through this service,
+// their pending authorization requests and codes, and users' consents.
+type OAuthRepository struct {
+	db *database.DB
+}
+
+func NewOAuthRepository(db *database.DB) *OAuthRepository {
+	return &OAuthRepository{db: db}
+}
+
+func (r *OAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (client_id, client_secret_hash, name, redirect_uris, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NOW())
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, client.ClientID, client.ClientSecretHash, client.Name, client.RedirectURIs).
+		Scan(&client.ID, &client.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth client: %w", err)
+	}
+
+	return nil
+}
+
+// GetClient returns the client with the given client ID, or nil if there is
+// none.
+func (r *OAuthRepository) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	query := `
+		SELECT id, client_id, COALESCE(client_secret_hash, ''), name, redirect_uris, created_at
+		FROM oauth_clients
+		WHERE client_id = $1
+	`
+
+	var client models.OAuthClient
+	err := r.db.QueryRow(ctx, query, clientID).Scan(
+		&client.ID,
+		&client.ClientID,
+		&client.ClientSecretHash,
+		&client.Name,
+		&client.RedirectURIs,
+		&client.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OAuth client: %w", err)
+	}
+
+	return &client, nil
+}
+
+// ListClients returns every registered client, oldest first.
+func (r *OAuthRepository) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	query := `
+		SELECT id, client_id, COALESCE(client_secret_hash, ''), name, redirect_uris, created_at
+		FROM oauth_clients
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OAuth clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []models.OAuthClient{}
+	for rows.Next() {
+		var client models.OAuthClient
+		err := rows.Scan(
+			&client.ID,
+			&client.ClientID,
+			&client.ClientSecretHash,
+			&client.Name,
+			&client.RedirectURIs,
+			&client.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan OAuth client: %w", err)
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list OAuth clients: %w", err)
+	}
+
+	return clients, nil
+}
+
+// DeleteClient removes a client along with its pending requests, codes and
+// consents. It returns false if there is no such client.
+func (r *OAuthRepository) DeleteClient(ctx context.Context, clientID string) (bool, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM oauth_clients WHERE client_id = $1", clientID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete OAuth client: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// CreateAuthorizationRequest stores a request awaiting consent. Requests that
+// have expired are pruned at the same time.
+func (r *OAuthRepository) CreateAuthorizationRequest(ctx context.Context, req *models.OAuthAuthorizationRequest, ttl time.Duration) error {
+	query := `
+		INSERT INTO oauth_authorization_requests (request_id, client_id, redirect_uri, scope, state, nonce, code_challenge, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW() + make_interval(secs => $8), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, req.RequestID, req.ClientID, req.RedirectURI, req.Scope, req.State, req.Nonce, req.CodeChallenge, ttl.Seconds()).
+		Scan(&req.ID, &req.ExpiresAt, &req.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth authorization request: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, "DELETE FROM oauth_authorization_requests WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to prune OAuth authorization requests: %w", err)
+	}
+
+	return nil
+}
+
+const authorizationRequestColumns = `id, request_id, client_id, redirect_uri, scope, state, nonce, code_challenge, expires_at, created_at`
+
+// GetAuthorizationRequest returns the unexpired request with the given ID, or
+// nil if there is none.
+func (r *OAuthRepository) GetAuthorizationRequest(ctx context.Context, requestID string) (*models.OAuthAuthorizationRequest, error) {
+	query := `
+		SELECT ` + authorizationRequestColumns + `
+		FROM oauth_authorization_requests
+		WHERE request_id = $1 AND expires_at > NOW()
+	`
+
+	return r.scanAuthorizationRequest(r.db.QueryRow(ctx, query, requestID))
+}
+
+// ConsumeAuthorizationRequest removes and returns the unexpired request with
+// the given ID, or nil if there is none, so that each request is answered at
+// most once.
+func (r *OAuthRepository) ConsumeAuthorizationRequest(ctx context.Context, requestID string) (*models.OAuthAuthorizationRequest, error) {
+	query := `
+		DELETE FROM oauth_authorization_requests
+		WHERE request_id = $1 AND expires_at > NOW()
+		RETURNING ` + authorizationRequestColumns
+
+	return r.scanAuthorizationRequest(r.db.QueryRow(ctx, query, requestID))
+}
+
+func (r *OAuthRepository) scanAuthorizationRequest(row pgx.Row) (*models.OAuthAuthorizationRequest, error) {
+	var req models.OAuthAuthorizationRequest
+	err := row.Scan(
+		&req.ID,
+		&req.RequestID,
+		&req.ClientID,
+		&req.RedirectURI,
+		&req.Scope,
+		&req.State,
+		&req.Nonce,
+		&req.CodeChallenge,
+		&req.ExpiresAt,
+		&req.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OAuth authorization request: %w", err)
+	}
+
+	return &req, nil
+}
+
+// CreateCode stores an authorization code. Codes that have expired are pruned
+// at the same time.
+func (r *OAuthRepository) CreateCode(ctx context.Context, code *models.OAuthAuthorizationCode, ttl time.Duration) error {
+	query := `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW() + make_interval(secs => $8), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.Nonce, code.CodeChallenge, ttl.Seconds()).
+		Scan(&code.ID, &code.ExpiresAt, &code.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth authorization code: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, "DELETE FROM oauth_authorization_codes WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to prune OAuth authorization codes: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeCode removes and returns the unexpired code with the given hash, or
+// nil if there is none, so that each code can be redeemed at most once.
+func (r *OAuthRepository) ConsumeCode(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	query := `
+		DELETE FROM oauth_authorization_codes
+		WHERE code_hash = $1 AND expires_at > NOW()
+		RETURNING id, code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at, created_at
+	`
+
+	var code models.OAuthAuthorizationCode
+	err := r.db.QueryRow(ctx, query, codeHash).Scan(
+		&code.ID,
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.Nonce,
+		&code.CodeChallenge,
+		&code.ExpiresAt,
+		&code.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume OAuth authorization code: %w", err)
+	}
+
+	return &code, nil
+}
+
+// GetConsent returns the scopes the user has granted the client, which is
+// empty if they never consented.
+func (r *OAuthRepository) GetConsent(ctx context.Context, userID int, clientID string) ([]string, error) {
+	query := `SELECT scopes FROM oauth_consents WHERE user_id = $1 AND client_id = $2`
+
+	var scopes []string
+	err := r.db.QueryRow(ctx, query, userID, clientID).Scan(&scopes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to get OAuth consent: %w", err)
+	}
+
+	return scopes, nil
+}
+
+// SaveConsent adds scopes to those the user has granted the client.
+func (r *OAuthRepository) SaveConsent(ctx context.Context, userID int, clientID string, scopes []string) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes) ORDER BY 1),
+			updated_at = NOW()
+	`
+
+	if _, err := r.db.Exec(ctx, query, userID, clientID, scopes); err != nil {
+		return fmt.Errorf("failed to save OAuth consent: %w", err)
+	}
+
+	return nil
+}
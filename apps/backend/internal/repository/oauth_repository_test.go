@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// OAuthRepositoryTestSuite is an integration test suite that requires a running database
+type OAuthRepositoryTestSuite struct {
+	suite.Suite
+	db       *database.DB
+	repo     *OAuthRepository
+	userRepo *UserRepository
+	user     *models.User
+	client   *models.OAuthClient
+	ctx      context.Context
+}
+
+func (suite *OAuthRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewOAuthRepository(suite.db)
+	suite.userRepo = NewUserRepository(suite.db)
+}
+
+func (suite *OAuthRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *OAuthRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM oauth_clients")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "oauth@example.com", PasswordHash: "hash", Name: "OAuth"}
+	suite.Require().NoError(suite.userRepo.Create(suite.ctx, suite.user))
+
+	suite.client = &models.OAuthClient{
+		ClientID:         "client-1",
+		ClientSecretHash: "secret-hash",
+		Name:             "Docs",
+		RedirectURIs:     []string{"https://docs.example.com/callback"},
+	}
+	suite.Require().NoError(suite.repo.CreateClient(suite.ctx, suite.client))
+}
+
+func (suite *OAuthRepositoryTestSuite) newCode(hash string, ttl time.Duration) {
+	code := &models.OAuthAuthorizationCode{
+		CodeHash:      hash,
+		ClientID:      suite.client.ClientID,
+		UserID:        suite.user.ID,
+		RedirectURI:   "https://docs.example.com/callback",
+		Scope:         "openid email",
+		Nonce:         "nonce",
+		CodeChallenge: "challenge",
+	}
+	suite.Require().NoError(suite.repo.CreateCode(suite.ctx, code, ttl))
+}
+
+func (suite *OAuthRepositoryTestSuite) TestGetClient() {
+	client, err := suite.repo.GetClient(suite.ctx, "client-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "Docs", client.Name)
+	assert.Equal(suite.T(), []string{"https://docs.example.com/callback"}, client.RedirectURIs)
+	assert.False(suite.T(), client.IsPublic())
+}
+
+func (suite *OAuthRepositoryTestSuite) TestGetClient_Public() {
+	suite.Require().NoError(suite.repo.CreateClient(suite.ctx, &models.OAuthClient{
+		ClientID:     "spa",
+		Name:         "SPA",
+		RedirectURIs: []string{"http://localhost:5174/callback"},
+	}))
+
+	client, err := suite.repo.GetClient(suite.ctx, "spa")
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), client.IsPublic())
+}
+
+func (suite *OAuthRepositoryTestSuite) TestGetClient_NotFound() {
+	client, err := suite.repo.GetClient(suite.ctx, "missing")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), client)
+}
+
+func (suite *OAuthRepositoryTestSuite) TestDeleteClient() {
+	deleted, err := suite.repo.DeleteClient(suite.ctx, "client-1")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), deleted)
+
+	clients, _ := suite.repo.ListClients(suite.ctx)
+	assert.Empty(suite.T(), clients)
+
+	deleted, err = suite.repo.DeleteClient(suite.ctx, "client-1")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), deleted)
+}
+
+func (suite *OAuthRepositoryTestSuite) TestAuthorizationRequest_GetThenConsume() {
+	req := &models.OAuthAuthorizationRequest{
+		RequestID:     "request-1",
+		ClientID:      "client-1",
+		RedirectURI:   "https://docs.example.com/callback",
+		Scope:         "openid",
+		State:         "state",
+		Nonce:         "nonce",
+		CodeChallenge: "challenge",
+	}
+	suite.Require().NoError(suite.repo.CreateAuthorizationRequest(suite.ctx, req, time.Minute))
+
+	found, err := suite.repo.GetAuthorizationRequest(suite.ctx, "request-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "state", found.State)
+
+	consumed, err := suite.repo.ConsumeAuthorizationRequest(suite.ctx, "request-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), req.ID, consumed.ID)
+
+	consumed, err = suite.repo.ConsumeAuthorizationRequest(suite.ctx, "request-1")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *OAuthRepositoryTestSuite) TestAuthorizationRequest_Expired() {
+	req := &models.OAuthAuthorizationRequest{RequestID: "request-1", ClientID: "client-1", RedirectURI: "x", Scope: "openid", CodeChallenge: "c"}
+	suite.Require().NoError(suite.repo.CreateAuthorizationRequest(suite.ctx, req, -time.Minute))
+
+	found, err := suite.repo.GetAuthorizationRequest(suite.ctx, "request-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), found)
+}
+
+func (suite *OAuthRepositoryTestSuite) TestConsumeCode_OnlyOnce() {
+	suite.newCode("code-hash", time.Minute)
+
+	code, err := suite.repo.ConsumeCode(suite.ctx, "code-hash")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.user.ID, code.UserID)
+	assert.Equal(suite.T(), "openid email", code.Scope)
+
+	code, err = suite.repo.ConsumeCode(suite.ctx, "code-hash")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), code)
+}
+
+func (suite *OAuthRepositoryTestSuite) TestConsumeCode_Expired() {
+	suite.newCode("code-hash", -time.Minute)
+
+	code, err := suite.repo.ConsumeCode(suite.ctx, "code-hash")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), code)
+}
+
+func (suite *OAuthRepositoryTestSuite) TestConsent_AccumulatesScopes() {
+	scopes, err := suite.repo.GetConsent(suite.ctx, suite.user.ID, "client-1")
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), scopes)
+
+	suite.Require().NoError(suite.repo.SaveConsent(suite.ctx, suite.user.ID, "client-1", []string{"openid", "email"}))
+	suite.Require().NoError(suite.repo.SaveConsent(suite.ctx, suite.user.ID, "client-1", []string{"openid", "profile"}))
+
+	scopes, err = suite.repo.GetConsent(suite.ctx, suite.user.ID, "client-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"email", "openid", "profile"}, scopes)
+}
+
+func TestOAuthRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(OAuthRepositoryTestSuite))
+}
@@ -0,0 +1,468 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrAlreadyMember is returned when accepting an invitation to an
+// organization the user already belongs to.
+var ErrAlreadyMember = errors.New("already a member of the organization")
+
+// ErrLastOwner is returned when demoting or removing a member would leave an
+// organization without an owner whose account is not deleted.
+var ErrLastOwner = errors.New("organization must keep at least one owner")
+
+// OrganizationRepository stores organizations, their members and pending
+// invitations.
+type OrganizationRepository struct {
+	db *database.DB
+}
+
+func NewOrganizationRepository(db *database.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// Create stores a new organization with ownerID as its first owner.
+func (r *OrganizationRepository) Create(ctx context.Context, org *models.Organization, ownerID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO organizations (name, created_at, updated_at)
+		VALUES ($1, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+	if err := tx.QueryRow(ctx, query, org.Name).Scan(&org.ID, &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	member := `
+		INSERT INTO organization_members (org_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+	if _, err := tx.Exec(ctx, member, org.ID, ownerID, models.OrgRoleOwner); err != nil {
+		return fmt.Errorf("failed to add organization owner: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID returns the organization with the given ID, or nil if there is none.
+func (r *OrganizationRepository) GetByID(ctx context.Context, id int) (*models.Organization, error) {
+	query := `SELECT id, name, created_at, updated_at FROM organizations WHERE id = $1`
+
+	var org models.Organization
+	err := r.db.QueryRow(ctx, query, id).Scan(&org.ID, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return &org, nil
+}
+
+// UpdateName renames an organization.
+func (r *OrganizationRepository) UpdateName(ctx context.Context, org *models.Organization) error {
+	query := `
+		UPDATE organizations
+		SET name = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	if err := r.db.QueryRow(ctx, query, org.ID, org.Name).Scan(&org.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes an organization with its memberships and invitations.
+func (r *OrganizationRepository) Delete(ctx context.Context, id int) error {
+	if _, err := r.db.Exec(ctx, "DELETE FROM organizations WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	return nil
+}
+
+// ListForUser returns the organizations the user belongs to, ordered by name.
+func (r *OrganizationRepository) ListForUser(ctx context.Context, userID int) ([]models.UserOrganization, error) {
+	query := `
+		SELECT o.id, o.name, o.created_at, o.updated_at, m.role
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1
+		ORDER BY o.name, o.id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []models.UserOrganization{}
+	for rows.Next() {
+		var org models.UserOrganization
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedAt, &org.UpdatedAt, &org.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	return orgs, nil
+}
+
+const memberColumns = `m.org_id, m.user_id, u.email, u.name, m.role, m.created_at`
+
+func scanMember(row pgx.Row) (*models.OrgMember, error) {
+	var member models.OrgMember
+	err := row.Scan(&member.OrgID, &member.UserID, &member.Email, &member.Name, &member.Role, &member.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetMember returns the user's membership of the organization, or nil if they
+// are not a member.
+func (r *OrganizationRepository) GetMember(ctx context.Context, orgID, userID int) (*models.OrgMember, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 AND m.user_id = $2
+	`
+
+	member, err := scanMember(r.db.QueryRow(ctx, query, orgID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization member: %w", err)
+	}
+
+	return member, nil
+}
+
+// ListMembers returns the organization's members, oldest first.
+func (r *OrganizationRepository) ListMembers(ctx context.Context, orgID int) ([]models.OrgMember, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY m.created_at, m.user_id
+	`
+
+	rows, err := r.db.Query(ctx, query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.OrgMember{}
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan organization member: %w", err)
+		}
+		members = append(members, *member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+
+	return members, nil
+}
+
+// CountOwners returns how many owners the organization has, not counting
+// owners whose accounts are deleted.
+func (r *OrganizationRepository) CountOwners(ctx context.Context, orgID int) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 AND m.role = $2 AND u.deleted_at IS NULL
+	`
+
+	var count int
+	if err := r.db.QueryRow(ctx, query, orgID, models.OrgRoleOwner).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count organization owners: %w", err)
+	}
+
+	return count, nil
+}
+
+// UpdateMemberRole changes a member's role. It returns false if the user is
+// not a member, and ErrLastOwner if it would demote the last owner.
+func (r *OrganizationRepository) UpdateMemberRole(ctx context.Context, orgID, userID int, role string) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if role != models.OrgRoleOwner {
+		if err := ensureOtherOwner(ctx, tx, orgID, userID); err != nil {
+			return false, err
+		}
+	}
+
+	query := `UPDATE organization_members SET role = $3 WHERE org_id = $1 AND user_id = $2`
+
+	tag, err := tx.Exec(ctx, query, orgID, userID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to update organization member: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit member update: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// RemoveMember removes a user from the organization. It returns false if they
+// were not a member, and ErrLastOwner if they are its last owner.
+func (r *OrganizationRepository) RemoveMember(ctx context.Context, orgID, userID int) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := ensureOtherOwner(ctx, tx, orgID, userID); err != nil {
+		return false, err
+	}
+
+	query := `DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2`
+
+	tag, err := tx.Exec(ctx, query, orgID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove organization member: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit member removal: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ensureOtherOwner locks the organization's memberships for the rest of tx,
+// so that concurrent changes to them wait, and returns ErrLastOwner if userID
+// is an owner and no other owner with an account that is not deleted remains.
+func ensureOtherOwner(ctx context.Context, tx pgx.Tx, orgID, userID int) error {
+	lock := `SELECT 1 FROM organization_members WHERE org_id = $1 ORDER BY user_id FOR UPDATE`
+
+	if _, err := tx.Exec(ctx, lock, orgID); err != nil {
+		return fmt.Errorf("failed to lock organization members: %w", err)
+	}
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM organization_members
+			WHERE org_id = $1 AND user_id = $2 AND role = $3
+		) AND NOT EXISTS (
+			SELECT 1
+			FROM organization_members m
+			JOIN users u ON u.id = m.user_id
+			WHERE m.org_id = $1 AND m.user_id <> $2 AND m.role = $3 AND u.deleted_at IS NULL
+		)
+	`
+
+	var lastOwner bool
+	if err := tx.QueryRow(ctx, query, orgID, userID, models.OrgRoleOwner).Scan(&lastOwner); err != nil {
+		return fmt.Errorf("failed to check organization owners: %w", err)
+	}
+	if lastOwner {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+// CreateInvitation stores an invitation. Invitations that have expired are
+// pruned at the same time.
+func (r *OrganizationRepository) CreateInvitation(ctx context.Context, invitation *models.OrgInvitation, ttl time.Duration) error {
+	query := `
+		INSERT INTO organization_invitations (org_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW() + make_interval(secs => $6), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, invitation.OrgID, invitation.Email, invitation.Role, invitation.TokenHash, invitation.InvitedBy, ttl.Seconds()).
+		Scan(&invitation.ID, &invitation.ExpiresAt, &invitation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create organization invitation: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, "DELETE FROM organization_invitations WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to prune organization invitations: %w", err)
+	}
+
+	return nil
+}
+
+const invitationColumns = `id, org_id, email, role, token_hash, invited_by, expires_at, created_at`
+
+func scanInvitation(row pgx.Row) (*models.OrgInvitation, error) {
+	var invitation models.OrgInvitation
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.OrgID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.TokenHash,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&invitation.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// ListInvitations returns the organization's unexpired invitations, newest
+// first.
+func (r *OrganizationRepository) ListInvitations(ctx context.Context, orgID int) ([]models.OrgInvitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM organization_invitations
+		WHERE org_id = $1 AND expires_at > NOW()
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.OrgInvitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan organization invitation: %w", err)
+		}
+		invitations = append(invitations, *invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list organization invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// GetInvitationByTokenHash returns the unexpired invitation with the given
+// token hash, or nil if there is none.
+func (r *OrganizationRepository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.OrgInvitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM organization_invitations
+		WHERE token_hash = $1 AND expires_at > NOW()
+	`
+
+	invitation, err := scanInvitation(r.db.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// DeleteInvitation withdraws one of the organization's invitations. It returns
+// false if there is no such invitation.
+func (r *OrganizationRepository) DeleteInvitation(ctx context.Context, orgID, id int) (bool, error) {
+	query := `DELETE FROM organization_invitations WHERE org_id = $1 AND id = $2`
+
+	tag, err := r.db.Exec(ctx, query, orgID, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete organization invitation: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ConsumeInvitation removes and returns the unexpired invitation with the
+// given token hash, or nil if there is none.
+func (r *OrganizationRepository) ConsumeInvitation(ctx context.Context, tokenHash string) (*models.OrgInvitation, error) {
+	query := `
+		DELETE FROM organization_invitations
+		WHERE token_hash = $1 AND expires_at > NOW()
+		RETURNING ` + invitationColumns
+
+	invitation, err := scanInvitation(r.db.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume organization invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation consumes the invitation and makes userID a member with the
+// invited role. It returns false if the invitation was already used, and
+// ErrAlreadyMember if the user already belongs to the organization, in which
+// case the invitation is left in place.
+func (r *OrganizationRepository) AcceptInvitation(ctx context.Context, invitation *models.OrgInvitation, userID int) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "DELETE FROM organization_invitations WHERE id = $1 AND expires_at > NOW()", invitation.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume organization invitation: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	member := `
+		INSERT INTO organization_members (org_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`
+	tag, err = tx.Exec(ctx, member, invitation.OrgID, userID, invitation.Role)
+	if err != nil {
+		return false, fmt.Errorf("failed to add organization member: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, ErrAlreadyMember
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit organization invitation: %w", err)
+	}
+
+	return true, nil
+}
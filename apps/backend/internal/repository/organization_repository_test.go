@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// OrganizationRepositoryTestSuite is an integration test suite that requires a running database
+type OrganizationRepositoryTestSuite struct {
+	suite.Suite
+	db    *database.DB
+	repo  *OrganizationRepository
+	owner *models.User
+	other *models.User
+	ctx   context.Context
+}
+
+func (suite *OrganizationRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewOrganizationRepository(suite.db)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *OrganizationRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM organizations")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	users := NewUserRepository(suite.db)
+	suite.owner = &models.User{Email: "owner@example.com", PasswordHash: "hash", Name: "Owner"}
+	suite.Require().NoError(users.Create(suite.ctx, suite.owner))
+	suite.other = &models.User{Email: "other@example.com", PasswordHash: "hash", Name: "Other"}
+	suite.Require().NoError(users.Create(suite.ctx, suite.other))
+}
+
+func (suite *OrganizationRepositoryTestSuite) createOrg() *models.Organization {
+	org := &models.Organization{Name: "Acme"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, org, suite.owner.ID))
+	return org
+}
+
+func (suite *OrganizationRepositoryTestSuite) createInvitation(org *models.Organization, ttl time.Duration) *models.OrgInvitation {
+	invitation := &models.OrgInvitation{
+		OrgID:     org.ID,
+		Email:     suite.other.Email,
+		Role:      models.OrgRoleAdmin,
+		TokenHash: "invitation-hash",
+		InvitedBy: &suite.owner.ID,
+	}
+	suite.Require().NoError(suite.repo.CreateInvitation(suite.ctx, invitation, ttl))
+	return invitation
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestCreate_AddsOwner() {
+	org := suite.createOrg()
+
+	assert.NotZero(suite.T(), org.ID)
+	member, err := suite.repo.GetMember(suite.ctx, org.ID, suite.owner.ID)
+	assert.NoError(suite.T(), err)
+	suite.Require().NotNil(member)
+	assert.Equal(suite.T(), models.OrgRoleOwner, member.Role)
+	assert.Equal(suite.T(), suite.owner.Email, member.Email)
+
+	orgs, err := suite.repo.ListForUser(suite.ctx, suite.owner.ID)
+	assert.NoError(suite.T(), err)
+	suite.Require().Len(orgs, 1)
+	assert.Equal(suite.T(), "Acme", orgs[0].Name)
+	assert.Equal(suite.T(), models.OrgRoleOwner, orgs[0].Role)
+
+	owners, err := suite.repo.CountOwners(suite.ctx, org.ID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, owners)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestGetMember_NotMember() {
+	org := suite.createOrg()
+
+	member, err := suite.repo.GetMember(suite.ctx, org.ID, suite.other.ID)
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), member)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestAcceptInvitation() {
+	org := suite.createOrg()
+	invitation := suite.createInvitation(org, time.Hour)
+
+	found, err := suite.repo.GetInvitationByTokenHash(suite.ctx, "invitation-hash")
+	assert.NoError(suite.T(), err)
+	suite.Require().NotNil(found)
+	assert.Equal(suite.T(), invitation.ID, found.ID)
+
+	accepted, err := suite.repo.AcceptInvitation(suite.ctx, found, suite.other.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), accepted)
+
+	member, _ := suite.repo.GetMember(suite.ctx, org.ID, suite.other.ID)
+	suite.Require().NotNil(member)
+	assert.Equal(suite.T(), models.OrgRoleAdmin, member.Role)
+
+	accepted, err = suite.repo.AcceptInvitation(suite.ctx, found, suite.other.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), accepted, "Invitations are single use")
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestAcceptInvitation_AlreadyMember() {
+	org := suite.createOrg()
+	invitation := suite.createInvitation(org, time.Hour)
+
+	_, err := suite.repo.AcceptInvitation(suite.ctx, invitation, suite.owner.ID)
+	assert.ErrorIs(suite.T(), err, ErrAlreadyMember)
+
+	found, _ := suite.repo.GetInvitationByTokenHash(suite.ctx, "invitation-hash")
+	assert.NotNil(suite.T(), found, "The invitation is left in place")
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestInvitation_Expired() {
+	org := suite.createOrg()
+	suite.createInvitation(org, -time.Minute)
+
+	found, err := suite.repo.GetInvitationByTokenHash(suite.ctx, "invitation-hash")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), found)
+
+	invitations, err := suite.repo.ListInvitations(suite.ctx, org.ID)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), invitations)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestConsumeInvitation() {
+	org := suite.createOrg()
+	suite.createInvitation(org, time.Hour)
+
+	consumed, err := suite.repo.ConsumeInvitation(suite.ctx, "invitation-hash")
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), consumed)
+
+	consumed, err = suite.repo.ConsumeInvitation(suite.ctx, "invitation-hash")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestUpdateAndRemoveMember() {
+	org := suite.createOrg()
+	_, err := suite.repo.AcceptInvitation(suite.ctx, suite.createInvitation(org, time.Hour), suite.other.ID)
+	suite.Require().NoError(err)
+
+	updated, err := suite.repo.UpdateMemberRole(suite.ctx, org.ID, suite.other.ID, models.OrgRoleOwner)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), updated)
+	owners, _ := suite.repo.CountOwners(suite.ctx, org.ID)
+	assert.Equal(suite.T(), 2, owners)
+
+	removed, err := suite.repo.RemoveMember(suite.ctx, org.ID, suite.other.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), removed)
+
+	removed, err = suite.repo.RemoveMember(suite.ctx, org.ID, suite.other.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), removed)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestUpdateAndRemoveMember_LastOwner() {
+	org := suite.createOrg()
+
+	_, err := suite.repo.RemoveMember(suite.ctx, org.ID, suite.owner.ID)
+	assert.ErrorIs(suite.T(), err, ErrLastOwner)
+	_, err = suite.repo.UpdateMemberRole(suite.ctx, org.ID, suite.owner.ID, models.OrgRoleAdmin)
+	assert.ErrorIs(suite.T(), err, ErrLastOwner)
+
+	_, err = suite.repo.AcceptInvitation(suite.ctx, suite.createInvitation(org, time.Hour), suite.other.ID)
+	suite.Require().NoError(err)
+	_, err = suite.repo.UpdateMemberRole(suite.ctx, org.ID, suite.other.ID, models.OrgRoleOwner)
+	suite.Require().NoError(err)
+	suite.Require().NoError(NewUserRepository(suite.db).SoftDelete(suite.ctx, suite.other.ID))
+
+	_, err = suite.repo.UpdateMemberRole(suite.ctx, org.ID, suite.owner.ID, models.OrgRoleAdmin)
+	assert.ErrorIs(suite.T(), err, ErrLastOwner, "Owners whose accounts are deleted do not count")
+	owners, _ := suite.repo.CountOwners(suite.ctx, org.ID)
+	assert.Equal(suite.T(), 1, owners)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestDelete() {
+	org := suite.createOrg()
+
+	suite.Require().NoError(suite.repo.Delete(suite.ctx, org.ID))
+
+	found, err := suite.repo.GetByID(suite.ctx, org.ID)
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), found)
+	orgs, _ := suite.repo.ListForUser(suite.ctx, suite.owner.ID)
+	assert.Empty(suite.T(), orgs)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestTenantScope_HidesOtherOrganizations() {
+	org := suite.createOrg()
+	otherOrg := &models.Organization{Name: "Globex"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, otherOrg, suite.other.ID))
+	suite.createInvitation(otherOrg, time.Hour)
+
+	tenant := database.Tenant{OrgID: org.ID, UserID: suite.owner.ID}
+	err := suite.db.WithTenant(suite.ctx, tenant, func(ctx context.Context) error {
+		found, err := suite.repo.GetByID(ctx, org.ID)
+		suite.Require().NoError(err)
+		assert.NotNil(suite.T(), found)
+
+		// Queries naming the other organization find nothing
+		found, err = suite.repo.GetByID(ctx, otherOrg.ID)
+		suite.Require().NoError(err)
+		assert.Nil(suite.T(), found)
+		members, err := suite.repo.ListMembers(ctx, otherOrg.ID)
+		suite.Require().NoError(err)
+		assert.Empty(suite.T(), members)
+		invitation, err := suite.repo.GetInvitationByTokenHash(ctx, "invitation-hash")
+		suite.Require().NoError(err)
+		assert.Nil(suite.T(), invitation)
+
+		// and so do queries without any tenant condition
+		var count int
+		suite.Require().NoError(suite.db.QueryRow(ctx, "SELECT COUNT(*) FROM organization_members").Scan(&count))
+		assert.Equal(suite.T(), 1, count)
+
+		removed, err := suite.repo.RemoveMember(ctx, otherOrg.ID, suite.other.ID)
+		suite.Require().NoError(err)
+		assert.False(suite.T(), removed)
+		return nil
+	})
+	suite.Require().NoError(err)
+
+	member, _ := suite.repo.GetMember(suite.ctx, otherOrg.ID, suite.other.ID)
+	assert.NotNil(suite.T(), member, "Outside the scope every row is visible")
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestTenantScope_RequiresMembership() {
+	org := suite.createOrg()
+
+	tenant := database.Tenant{OrgID: org.ID, UserID: suite.other.ID}
+	err := suite.db.WithTenant(suite.ctx, tenant, func(ctx context.Context) error {
+		found, err := suite.repo.GetByID(ctx, org.ID)
+		suite.Require().NoError(err)
+		assert.Nil(suite.T(), found)
+		return nil
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *OrganizationRepositoryTestSuite) TestTenantScope_RollsBackOnError() {
+	org := suite.createOrg()
+	failed := errors.New("failed")
+
+	tenant := database.Tenant{OrgID: org.ID, UserID: suite.owner.ID}
+	err := suite.db.WithTenant(suite.ctx, tenant, func(ctx context.Context) error {
+		suite.Require().NoError(suite.repo.Delete(ctx, org.ID))
+		return failed
+	})
+	assert.ErrorIs(suite.T(), err, failed)
+
+	found, _ := suite.repo.GetByID(suite.ctx, org.ID)
+	assert.NotNil(suite.T(), found)
+}
+
+func TestOrganizationRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(OrganizationRepositoryTestSuite))
+}
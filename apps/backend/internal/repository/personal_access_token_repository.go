@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// PersonalAccessTokenRepository stores users' personal access tokens.
+type PersonalAccessTokenRepository struct {
+	db *database.DB
+}
+
+func NewPersonalAccessTokenRepository(db *database.DB) *PersonalAccessTokenRepository {
+	return &PersonalAccessTokenRepository{db: db}
+}
+
+const personalAccessTokenColumns = `id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, created_at`
+
+func scanPersonalAccessToken(row pgx.Row) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&token.TokenHash,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Create stores a token. Tokens that have expired are pruned at the same
+// time.
+func (r *PersonalAccessTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, token.UserID, token.Name, token.Prefix, token.TokenHash, token.Scopes, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create personal access token: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, "DELETE FROM personal_access_tokens WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to prune personal access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// ListForUser returns the user's unexpired tokens, newest first.
+func (r *PersonalAccessTokenRepository) ListForUser(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	query := `
+		SELECT ` + personalAccessTokenColumns + `
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalAccessToken{}
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan personal access token: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Delete revokes one of the user's tokens. It returns false if the user has
+// no such token.
+func (r *PersonalAccessTokenRepository) Delete(ctx context.Context, userID, id int) (bool, error) {
+	query := `DELETE FROM personal_access_tokens WHERE user_id = $1 AND id = $2`
+
+	tag, err := r.db.Exec(ctx, query, userID, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete personal access token: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// Use returns the unexpired token with the given hash and records that it
+// was used, or returns nil if there is no such token.
+func (r *PersonalAccessTokenRepository) Use(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	query := `
+		UPDATE personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING ` + personalAccessTokenColumns
+
+	token, err := scanPersonalAccessToken(r.db.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to use personal access token: %w", err)
+	}
+
+	return token, nil
+}
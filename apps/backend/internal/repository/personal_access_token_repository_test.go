@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// PersonalAccessTokenRepositoryTestSuite is an integration test suite that requires a running database
+type PersonalAccessTokenRepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *PersonalAccessTokenRepository
+	user *models.User
+	ctx  context.Context
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewPersonalAccessTokenRepository(suite.db)
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "pat@example.com", PasswordHash: "hash", Name: "PAT"}
+	suite.Require().NoError(NewUserRepository(suite.db).Create(suite.ctx, suite.user))
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) createToken(hash string, expiresAt *time.Time) *models.PersonalAccessToken {
+	token := &models.PersonalAccessToken{
+		UserID:    suite.user.ID,
+		Name:      "script",
+		Prefix:    "pat_abcdefgh",
+		TokenHash: hash,
+		Scopes:    []string{"users:read"},
+		ExpiresAt: expiresAt,
+	}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, token))
+	return token
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) TestCreateAndList() {
+	token := suite.createToken("hash-1", nil)
+
+	assert.NotZero(suite.T(), token.ID)
+	tokens, err := suite.repo.ListForUser(suite.ctx, suite.user.ID)
+	assert.NoError(suite.T(), err)
+	suite.Require().Len(tokens, 1)
+	assert.Equal(suite.T(), []string{"users:read"}, tokens[0].Scopes)
+	assert.Nil(suite.T(), tokens[0].LastUsedAt)
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) TestUse_RecordsLastUsed() {
+	token := suite.createToken("hash-1", nil)
+
+	used, err := suite.repo.Use(suite.ctx, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	suite.Require().NotNil(used)
+	assert.Equal(suite.T(), token.ID, used.ID)
+	assert.NotNil(suite.T(), used.LastUsedAt)
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) TestUse_Expired() {
+	expired := time.Now().Add(-time.Minute)
+	suite.createToken("hash-1", &expired)
+
+	used, err := suite.repo.Use(suite.ctx, "hash-1")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), used)
+
+	tokens, _ := suite.repo.ListForUser(suite.ctx, suite.user.ID)
+	assert.Empty(suite.T(), tokens)
+}
+
+func (suite *PersonalAccessTokenRepositoryTestSuite) TestDelete() {
+	token := suite.createToken("hash-1", nil)
+
+	deleted, err := suite.repo.Delete(suite.ctx, suite.user.ID+1, token.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), deleted, "Only the owner can delete a token")
+
+	deleted, err = suite.repo.Delete(suite.ctx, suite.user.ID, token.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), deleted)
+
+	used, _ := suite.repo.Use(suite.ctx, "hash-1")
+	assert.Nil(suite.T(), used)
+}
+
+func TestPersonalAccessTokenRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(PersonalAccessTokenRepositoryTestSuite))
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/ratelimit"
+)
+
+// rateLimitPruneInterval is how often RateLimitRepository deletes full
+// buckets. Rate limits are checked on every request, so unlike other
+// repositories it doesn't prune on every write.
+const rateLimitPruneInterval = time.Minute
+
+// RateLimitRepository is a ratelimit.Store that keeps buckets in Postgres, so
+// that every instance of the API enforces the same limits.
+type RateLimitRepository struct {
+	db *database.DB
+
+	mu        sync.Mutex
+	nextPrune time.Time
+}
+
+func NewRateLimitRepository(db *database.DB) *RateLimitRepository {
+	return &RateLimitRepository{db: db}
+}
+
+// Take applies ratelimit.Take to the stored bucket in a single statement, so
+// that concurrent requests for a key are counted one at a time.
+func (r *RateLimitRepository) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	if err := r.prune(ctx); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	query := `
+		INSERT INTO rate_limits AS r (key, tat, allowed)
+		VALUES ($1, LOCALTIMESTAMP + make_interval(secs => $2), TRUE)
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = GREATEST(r.tat, LOCALTIMESTAMP) + make_interval(secs => $2) <= LOCALTIMESTAMP + make_interval(secs => $3),
+			tat = CASE
+				WHEN GREATEST(r.tat, LOCALTIMESTAMP) + make_interval(secs => $2) <= LOCALTIMESTAMP + make_interval(secs => $3)
+				THEN GREATEST(r.tat, LOCALTIMESTAMP) + make_interval(secs => $2)
+				ELSE r.tat
+			END
+		RETURNING tat, allowed, LOCALTIMESTAMP
+	`
+
+	var tat, now time.Time
+	var allowed bool
+	err := r.db.QueryRow(ctx, query, key, limit.Interval().Seconds(), limit.Period.Seconds()).Scan(&tat, &allowed, &now)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("failed to take from rate limit: %w", err)
+	}
+
+	return ratelimit.NewResult(tat, now, allowed, limit), nil
+}
+
+// prune deletes full buckets, which are the same as missing ones, at most
+// once per rateLimitPruneInterval.
+func (r *RateLimitRepository) prune(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	if now.Before(r.nextPrune) {
+		r.mu.Unlock()
+		return nil
+	}
+	r.nextPrune = now.Add(rateLimitPruneInterval)
+	r.mu.Unlock()
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM rate_limits WHERE tat < LOCALTIMESTAMP`); err != nil {
+		return fmt.Errorf("failed to prune rate limits: %w", err)
+	}
+
+	return nil
+}
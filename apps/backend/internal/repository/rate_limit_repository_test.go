@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/ratelimit"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// RateLimitRepositoryTestSuite is an integration test suite that requires a running database
+type RateLimitRepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *RateLimitRepository
+	ctx  context.Context
+}
+
+func (suite *RateLimitRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewRateLimitRepository(suite.db)
+}
+
+func (suite *RateLimitRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *RateLimitRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM rate_limits")
+	suite.Require().NoError(err, "Failed to clean up test data")
+}
+
+func (suite *RateLimitRepositoryTestSuite) TestTake() {
+	limit := ratelimit.Limit{Requests: 2, Period: time.Hour}
+
+	result, err := suite.repo.Take(suite.ctx, "ip:192.0.2.1", limit)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), result.Allowed)
+	assert.Equal(suite.T(), 1, result.Remaining)
+
+	result, err = suite.repo.Take(suite.ctx, "ip:192.0.2.1", limit)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), result.Allowed)
+	assert.Equal(suite.T(), 0, result.Remaining)
+
+	result, err = suite.repo.Take(suite.ctx, "ip:192.0.2.1", limit)
+	suite.Require().NoError(err)
+	assert.False(suite.T(), result.Allowed)
+	assert.InDelta(suite.T(), (30 * time.Minute).Seconds(), result.RetryAfter.Seconds(), 5)
+
+	result, err = suite.repo.Take(suite.ctx, "ip:192.0.2.2", limit)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), result.Allowed, "Keys have separate buckets")
+}
+
+func (suite *RateLimitRepositoryTestSuite) TestTake_Refills() {
+	limit := ratelimit.Limit{Requests: 1, Period: time.Hour}
+	_, err := suite.repo.Take(suite.ctx, "user:1", limit)
+	suite.Require().NoError(err)
+	_, err = suite.db.Pool.Exec(suite.ctx, "UPDATE rate_limits SET tat = LOCALTIMESTAMP - INTERVAL '1 second'")
+	suite.Require().NoError(err)
+
+	result, err := suite.repo.Take(suite.ctx, "user:1", limit)
+
+	suite.Require().NoError(err)
+	assert.True(suite.T(), result.Allowed)
+}
+
+func TestRateLimitRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(RateLimitRepositoryTestSuite))
+}
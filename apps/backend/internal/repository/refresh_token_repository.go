@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRefreshTokenReused is returned by Rotate when the token being rotated has
+// already been revoked or replaced, which indicates it was replayed.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+type RefreshTokenRepository struct {
+	db *database.DB
+}
+
+func NewRefreshTokenRepository(db *database.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken, ttl time.Duration) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, org_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.OrgID, ttl.Seconds()).
+		Scan(&token.ID, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// GetByHash returns the unexpired refresh token with the given hash, including
+// tokens that have been revoked, or nil if there is none.
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, revoked_at, replaced_by, org_id, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1 AND expires_at > NOW()
+	`
+
+	var token models.RefreshToken
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.ReplacedBy,
+		&token.OrgID,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// Rotate atomically revokes current and stores next in the same family. If
+// current was already revoked, nothing is stored and ErrRefreshTokenReused is
+// returned. The caller sets next's organization.
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, current, next *models.RefreshToken, ttl time.Duration) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+
+	insert := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, org_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5), NOW())
+		RETURNING id, expires_at, created_at
+	`
+	err = tx.QueryRow(ctx, insert, next.UserID, next.FamilyID, next.TokenHash, next.OrgID, ttl.Seconds()).
+		Scan(&next.ID, &next.ExpiresAt, &next.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	revoke := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW(), replaced_by = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+	tag, err := tx.Exec(ctx, revoke, current.ID, next.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit refresh token rotation: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeFamily revokes every outstanding token descended from the same login.
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.Exec(ctx, query, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllForUser revokes every outstanding refresh token belonging to a user.
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllForUserExcept revokes every outstanding refresh token belonging to
+// a user outside the given family.
+func (r *RefreshTokenRepository) RevokeAllForUserExcept(ctx context.Context, userID int, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.Exec(ctx, query, userID, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// RefreshTokenRepositoryTestSuite is an integration test suite that requires a running database
+type RefreshTokenRepositoryTestSuite struct {
+	suite.Suite
+	db       *database.DB
+	repo     *RefreshTokenRepository
+	userRepo *UserRepository
+	user     *models.User
+	ctx      context.Context
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewRefreshTokenRepository(suite.db)
+	suite.userRepo = NewUserRepository(suite.db)
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+// SetupTest cleans up test data and creates a user to own the tokens
+func (suite *RefreshTokenRepositoryTestSuite) SetupTest() {
+	// Refresh tokens are removed by ON DELETE CASCADE
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{
+		Email:        "tokens@example.com",
+		PasswordHash: "hashedpassword",
+		Name:         "Token Owner",
+	}
+	suite.Require().NoError(suite.userRepo.Create(suite.ctx, suite.user))
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) newToken(familyID, hash string) *models.RefreshToken {
+	token := &models.RefreshToken{
+		UserID:    suite.user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+	}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, token, time.Hour))
+	return token
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestCreate_Success() {
+	token := suite.newToken("family-1", "hash-1")
+
+	assert.NotZero(suite.T(), token.ID)
+	assert.NotZero(suite.T(), token.ExpiresAt)
+	assert.True(suite.T(), token.ExpiresAt.After(token.CreatedAt))
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestGetByHash_Found() {
+	original := suite.newToken("family-1", "hash-1")
+
+	found, err := suite.repo.GetByHash(suite.ctx, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), found)
+	assert.Equal(suite.T(), original.ID, found.ID)
+	assert.Equal(suite.T(), "family-1", found.FamilyID)
+	assert.Nil(suite.T(), found.RevokedAt)
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestGetByHash_Expired() {
+	token := &models.RefreshToken{UserID: suite.user.ID, FamilyID: "family-1", TokenHash: "expired"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, token, -time.Minute))
+
+	found, err := suite.repo.GetByHash(suite.ctx, "expired")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), found, "Expired tokens should not be returned")
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestRotate_Success() {
+	current := suite.newToken("family-1", "hash-1")
+	next := &models.RefreshToken{TokenHash: "hash-2"}
+
+	err := suite.repo.Rotate(suite.ctx, current, next, time.Hour)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "family-1", next.FamilyID)
+
+	old, _ := suite.repo.GetByHash(suite.ctx, "hash-1")
+	assert.NotNil(suite.T(), old.RevokedAt)
+	assert.Equal(suite.T(), next.ID, *old.ReplacedBy)
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestRotate_AlreadyRotated() {
+	current := suite.newToken("family-1", "hash-1")
+	suite.Require().NoError(suite.repo.Rotate(suite.ctx, current, &models.RefreshToken{TokenHash: "hash-2"}, time.Hour))
+
+	err := suite.repo.Rotate(suite.ctx, current, &models.RefreshToken{TokenHash: "hash-3"}, time.Hour)
+
+	assert.ErrorIs(suite.T(), err, ErrRefreshTokenReused)
+	notStored, _ := suite.repo.GetByHash(suite.ctx, "hash-3")
+	assert.Nil(suite.T(), notStored, "Failed rotation should not store the new token")
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestRevokeFamily() {
+	suite.newToken("family-1", "hash-1")
+	suite.newToken("family-1", "hash-2")
+	suite.newToken("family-2", "hash-3")
+
+	err := suite.repo.RevokeFamily(suite.ctx, "family-1")
+
+	assert.NoError(suite.T(), err)
+	first, _ := suite.repo.GetByHash(suite.ctx, "hash-1")
+	second, _ := suite.repo.GetByHash(suite.ctx, "hash-2")
+	other, _ := suite.repo.GetByHash(suite.ctx, "hash-3")
+	assert.NotNil(suite.T(), first.RevokedAt)
+	assert.NotNil(suite.T(), second.RevokedAt)
+	assert.Nil(suite.T(), other.RevokedAt, "Other families should be untouched")
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestRevokeAllForUser() {
+	suite.newToken("family-1", "hash-1")
+	suite.newToken("family-2", "hash-2")
+
+	err := suite.repo.RevokeAllForUser(suite.ctx, suite.user.ID)
+
+	assert.NoError(suite.T(), err)
+	first, _ := suite.repo.GetByHash(suite.ctx, "hash-1")
+	second, _ := suite.repo.GetByHash(suite.ctx, "hash-2")
+	assert.NotNil(suite.T(), first.RevokedAt)
+	assert.NotNil(suite.T(), second.RevokedAt)
+}
+
+func (suite *RefreshTokenRepositoryTestSuite) TestRevokeAllForUserExcept() {
+	suite.newToken("family-1", "hash-1")
+	suite.newToken("family-2", "hash-2")
+
+	err := suite.repo.RevokeAllForUserExcept(suite.ctx, suite.user.ID, "family-1")
+
+	assert.NoError(suite.T(), err)
+	first, _ := suite.repo.GetByHash(suite.ctx, "hash-1")
+	second, _ := suite.repo.GetByHash(suite.ctx, "hash-2")
+	assert.Nil(suite.T(), first.RevokedAt)
+	assert.NotNil(suite.T(), second.RevokedAt)
+}
+
+func TestRefreshTokenRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(RefreshTokenRepositoryTestSuite))
+}
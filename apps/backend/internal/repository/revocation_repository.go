@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// RevocationRepository stores revoked access tokens and sessions. It implements
+// auth.RevocationBackend. Times are written and compared in UTC.
+type RevocationRepository struct {
+	db *database.DB
+}
+
+func NewRevocationRepository(db *database.DB) *RevocationRepository {
+	return &RevocationRepository{db: db}
+}
+
+// RevokeToken records a revoked jti. Rows for tokens that have since expired
+// are no longer needed and are pruned at the same time.
+func (r *RevocationRepository) RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	if _, err := r.db.Exec(ctx, query, jti, userID, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1", time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to prune revoked tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RevocationRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	var revoked bool
+	if err := r.db.QueryRow(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("failed to check revoked token: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// RevokeUserTokens revokes every token issued to userID before the given time.
+func (r *RevocationRepository) RevokeUserTokens(ctx context.Context, userID int, before time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET revoked_before = GREATEST(user_token_revocations.revoked_before, EXCLUDED.revoked_before)
+	`
+
+	if _, err := r.db.Exec(ctx, query, userID, before.UTC()); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeSessionlessUserTokens revokes every token issued to userID before the
+// given time that is not tied to a session.
+func (r *RevocationRepository) RevokeSessionlessUserTokens(ctx context.Context, userID int, before time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, sessionless_revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET sessionless_revoked_before = GREATEST(user_token_revocations.sessionless_revoked_before, EXCLUDED.sessionless_revoked_before)
+	`
+
+	if _, err := r.db.Exec(ctx, query, userID, before.UTC()); err != nil {
+		return fmt.Errorf("failed to revoke sessionless user tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RevocationRepository) UserTokensRevokedBefore(ctx context.Context, userID int) (before, sessionlessBefore time.Time, err error) {
+	query := `SELECT revoked_before, sessionless_revoked_before FROM user_token_revocations WHERE user_id = $1`
+
+	var all, sessionless *time.Time
+	err = r.db.QueryRow(ctx, query, userID).Scan(&all, &sessionless)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, time.Time{}, nil
+		}
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get user token revocation: %w", err)
+	}
+
+	if all != nil {
+		before = *all
+	}
+	if sessionless != nil {
+		sessionlessBefore = *sessionless
+	}
+	return before, sessionlessBefore, nil
+}
+
+// RevokeSession marks a session revoked.
+func (r *RevocationRepository) RevokeSession(ctx context.Context, sessionID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.db.Exec(ctx, query, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RevocationRepository) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	query := `SELECT NOT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL)`
+
+	var revoked bool
+	if err := r.db.QueryRow(ctx, query, sessionID).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("failed to check revoked session: %w", err)
+	}
+
+	return revoked, nil
+}
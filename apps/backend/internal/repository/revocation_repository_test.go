@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// RevocationRepositoryTestSuite is an integration test suite that requires a running database
+type RevocationRepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *RevocationRepository
+	user *models.User
+	ctx  context.Context
+}
+
+func (suite *RevocationRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewRevocationRepository(suite.db)
+}
+
+func (suite *RevocationRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *RevocationRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "revoke@example.com", PasswordHash: "hash", Name: "Revoke"}
+	suite.Require().NoError(NewUserRepository(suite.db).Create(suite.ctx, suite.user))
+}
+
+func (suite *RevocationRepositoryTestSuite) TestRevokeToken() {
+	err := suite.repo.RevokeToken(suite.ctx, "jti-1", suite.user.ID, time.Now().Add(time.Hour))
+	assert.NoError(suite.T(), err)
+
+	revoked, err := suite.repo.IsTokenRevoked(suite.ctx, "jti-1")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), revoked)
+
+	notRevoked, err := suite.repo.IsTokenRevoked(suite.ctx, "jti-2")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), notRevoked)
+}
+
+func (suite *RevocationRepositoryTestSuite) TestRevokeToken_Twice() {
+	expiresAt := time.Now().Add(time.Hour)
+	assert.NoError(suite.T(), suite.repo.RevokeToken(suite.ctx, "jti-1", suite.user.ID, expiresAt))
+	assert.NoError(suite.T(), suite.repo.RevokeToken(suite.ctx, "jti-1", suite.user.ID, expiresAt))
+}
+
+func (suite *RevocationRepositoryTestSuite) TestRevokeToken_PrunesExpired() {
+	suite.Require().NoError(suite.repo.RevokeToken(suite.ctx, "expired", suite.user.ID, time.Now().Add(-time.Hour)))
+	suite.Require().NoError(suite.repo.RevokeToken(suite.ctx, "current", suite.user.ID, time.Now().Add(time.Hour)))
+
+	revoked, _ := suite.repo.IsTokenRevoked(suite.ctx, "expired")
+	assert.False(suite.T(), revoked, "Expired revocations should be pruned")
+}
+
+func (suite *RevocationRepositoryTestSuite) TestUserTokensRevokedBefore_None() {
+	before, sessionlessBefore, err := suite.repo.UserTokensRevokedBefore(suite.ctx, suite.user.ID)
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), before.IsZero())
+	assert.True(suite.T(), sessionlessBefore.IsZero())
+}
+
+func (suite *RevocationRepositoryTestSuite) TestRevokeUserTokens_KeepsLatestCutoff() {
+	later := time.Now().UTC().Truncate(time.Second)
+	earlier := later.Add(-time.Hour)
+
+	suite.Require().NoError(suite.repo.RevokeUserTokens(suite.ctx, suite.user.ID, later))
+	suite.Require().NoError(suite.repo.RevokeUserTokens(suite.ctx, suite.user.ID, earlier))
+
+	before, _, err := suite.repo.UserTokensRevokedBefore(suite.ctx, suite.user.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), later.Equal(before))
+}
+
+func (suite *RevocationRepositoryTestSuite) TestRevokeSessionlessUserTokens() {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	suite.Require().NoError(suite.repo.RevokeSessionlessUserTokens(suite.ctx, suite.user.ID, now))
+
+	before, sessionlessBefore, err := suite.repo.UserTokensRevokedBefore(suite.ctx, suite.user.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), before.IsZero(), "Tokens tied to a session are not revoked")
+	assert.True(suite.T(), now.Equal(sessionlessBefore))
+
+	suite.Require().NoError(suite.repo.RevokeUserTokens(suite.ctx, suite.user.ID, now))
+	before, sessionlessBefore, _ = suite.repo.UserTokensRevokedBefore(suite.ctx, suite.user.ID)
+	assert.True(suite.T(), now.Equal(before))
+	assert.True(suite.T(), now.Equal(sessionlessBefore))
+}
+
+func TestRevocationRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(RevocationRepositoryTestSuite))
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// RoleRepository stores roles, the permissions they grant and their
+// assignment to users. Roles and permissions are defined by migrations.
+type RoleRepository struct {
+	db *database.DB
+}
+
+func NewRoleRepository(db *database.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+const roleColumns = `
+	r.id, r.name, r.description,
+	COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}'),
+	r.created_at
+`
+
+const roleJoins = `
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id
+	LEFT JOIN permissions p ON p.id = rp.permission_id
+`
+
+// ListRoles returns every role with its permissions, ordered by name.
+func (r *RoleRepository) ListRoles(ctx context.Context) ([]models.Role, error) {
+	query := `SELECT ` + roleColumns + roleJoins + `GROUP BY r.id ORDER BY r.name`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Permissions, &role.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GetRoleByName returns the role with the given name, or nil if there is none.
+func (r *RoleRepository) GetRoleByName(ctx context.Context, name string) (*models.Role, error) {
+	query := `SELECT ` + roleColumns + roleJoins + `WHERE r.name = $1 GROUP BY r.id`
+
+	var role models.Role
+	err := r.db.QueryRow(ctx, query, name).Scan(&role.ID, &role.Name, &role.Description, &role.Permissions, &role.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return &role, nil
+}
+
+// ListUserRoles returns the names of the user's roles, ordered by name.
+func (r *RoleRepository) ListUserRoles(ctx context.Context, userID int) ([]string, error) {
+	query := `
+		SELECT r.name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY r.name
+	`
+
+	return r.queryNames(ctx, query, userID)
+}
+
+// ListUserPermissions returns the permissions granted by any of the user's
+// roles, ordered by name.
+func (r *RoleRepository) ListUserPermissions(ctx context.Context, userID int) ([]string, error) {
+	query := `
+		SELECT DISTINCT p.name
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = $1
+		ORDER BY p.name
+	`
+
+	return r.queryNames(ctx, query, userID)
+}
+
+func (r *RoleRepository) queryNames(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user roles: %w", err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan user role: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list user roles: %w", err)
+	}
+
+	return names, nil
+}
+
+// AssignRole gives the user a role. It returns false if they already had it.
+func (r *RoleRepository) AssignRole(ctx context.Context, userID, roleID int) (bool, error) {
+	query := `
+		INSERT INTO user_roles (user_id, role_id, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id, role_id) DO NOTHING
+	`
+
+	tag, err := r.db.Exec(ctx, query, userID, roleID)
+	if err != nil {
+		return false, fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// RevokeRole takes a role away from the user. It returns false if they did
+// not have it.
+func (r *RoleRepository) RevokeRole(ctx context.Context, userID, roleID int) (bool, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2", userID, roleID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke role: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
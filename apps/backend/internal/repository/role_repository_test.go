@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// RoleRepositoryTestSuite is an integration test suite that requires a running database
+type RoleRepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *RoleRepository
+	user *models.User
+	ctx  context.Context
+}
+
+func (suite *RoleRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewRoleRepository(suite.db)
+}
+
+func (suite *RoleRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *RoleRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "roles@example.com", PasswordHash: "hash", Name: "Roles"}
+	suite.Require().NoError(NewUserRepository(suite.db).Create(suite.ctx, suite.user))
+}
+
+func (suite *RoleRepositoryTestSuite) adminRole() *models.Role {
+	role, err := suite.repo.GetRoleByName(suite.ctx, "admin")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(role, "The admin role is created by migrations")
+	return role
+}
+
+func (suite *RoleRepositoryTestSuite) TestGetRoleByName_Admin() {
+	role := suite.adminRole()
+
+	assert.Equal(suite.T(), []string{"roles:read", "roles:write", "service_accounts:read", "service_accounts:write", "users:read", "users:write"}, role.Permissions)
+}
+
+func (suite *RoleRepositoryTestSuite) TestGetRoleByName_NotFound() {
+	role, err := suite.repo.GetRoleByName(suite.ctx, "missing")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), role)
+}
+
+func (suite *RoleRepositoryTestSuite) TestListRoles() {
+	roles, err := suite.repo.ListRoles(suite.ctx)
+
+	assert.NoError(suite.T(), err)
+	names := []string{}
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	assert.Contains(suite.T(), names, "admin")
+}
+
+func (suite *RoleRepositoryTestSuite) TestAssignAndRevoke() {
+	role := suite.adminRole()
+
+	roles, err := suite.repo.ListUserRoles(suite.ctx, suite.user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), roles)
+
+	assigned, err := suite.repo.AssignRole(suite.ctx, suite.user.ID, role.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), assigned)
+
+	assigned, err = suite.repo.AssignRole(suite.ctx, suite.user.ID, role.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), assigned, "Assigning twice is a no-op")
+
+	roles, _ = suite.repo.ListUserRoles(suite.ctx, suite.user.ID)
+	assert.Equal(suite.T(), []string{"admin"}, roles)
+	permissions, err := suite.repo.ListUserPermissions(suite.ctx, suite.user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), role.Permissions, permissions)
+
+	revoked, err := suite.repo.RevokeRole(suite.ctx, suite.user.ID, role.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), revoked)
+
+	revoked, err = suite.repo.RevokeRole(suite.ctx, suite.user.ID, role.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), revoked)
+
+	permissions, _ = suite.repo.ListUserPermissions(suite.ctx, suite.user.ID)
+	assert.Empty(suite.T(), permissions)
+}
+
+func TestRoleRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(RoleRepositoryTestSuite))
+}
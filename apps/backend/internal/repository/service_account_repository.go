@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ServiceAccountRepository stores service accounts and their client
+// credentials.
+type ServiceAccountRepository struct {
+	db *database.DB
+}
+
+func NewServiceAccountRepository(db *database.DB) *ServiceAccountRepository {
+	return &ServiceAccountRepository{db: db}
+}
+
+const serviceAccountColumns = `id, client_id, client_secret_hash, name, scopes, created_by, disabled_at, secret_rotated_at, created_at`
+
+func scanServiceAccount(row pgx.Row) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	err := row.Scan(
+		&account.ID,
+		&account.ClientID,
+		&account.ClientSecretHash,
+		&account.Name,
+		&account.Scopes,
+		&account.CreatedBy,
+		&account.DisabledAt,
+		&account.SecretRotatedAt,
+		&account.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *ServiceAccountRepository) Create(ctx context.Context, account *models.ServiceAccount) error {
+	if account.Scopes == nil {
+		account.Scopes = []string{}
+	}
+
+	query := `
+		INSERT INTO service_accounts (client_id, client_secret_hash, name, scopes, created_by, secret_rotated_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id, secret_rotated_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, account.ClientID, account.ClientSecretHash, account.Name, account.Scopes, account.CreatedBy).
+		Scan(&account.ID, &account.SecretRotatedAt, &account.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	return nil
+}
+
+// List returns every service account, oldest first.
+func (r *ServiceAccountRepository) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts ORDER BY created_at, id`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan service account: %w", err)
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// GetByID returns the service account with the given ID, or nil if there is
+// none.
+func (r *ServiceAccountRepository) GetByID(ctx context.Context, id int) (*models.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts WHERE id = $1`
+	return r.get(ctx, query, id)
+}
+
+// GetByClientID returns the service account with the given client ID, or nil
+// if there is none.
+func (r *ServiceAccountRepository) GetByClientID(ctx context.Context, clientID string) (*models.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts WHERE client_id = $1`
+	return r.get(ctx, query, clientID)
+}
+
+func (r *ServiceAccountRepository) get(ctx context.Context, query string, arg any) (*models.ServiceAccount, error) {
+	account, err := scanServiceAccount(r.db.QueryRow(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+
+	return account, nil
+}
+
+// RotateSecret replaces the account's client secret, updating account. It
+// returns false if there is no such account.
+func (r *ServiceAccountRepository) RotateSecret(ctx context.Context, account *models.ServiceAccount, secretHash string) (bool, error) {
+	query := `
+		UPDATE service_accounts
+		SET client_secret_hash = $2, secret_rotated_at = NOW()
+		WHERE id = $1
+		RETURNING secret_rotated_at
+	`
+
+	err := r.db.QueryRow(ctx, query, account.ID, secretHash).Scan(&account.SecretRotatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to rotate service account secret: %w", err)
+	}
+
+	account.ClientSecretHash = secretHash
+	return true, nil
+}
+
+// SetDisabled disables or re-enables the account, updating account. It
+// returns false if there is no such account.
+func (r *ServiceAccountRepository) SetDisabled(ctx context.Context, account *models.ServiceAccount, disabled bool) (bool, error) {
+	query := `
+		UPDATE service_accounts
+		SET disabled_at = CASE WHEN $2::boolean THEN COALESCE(disabled_at, NOW()) END
+		WHERE id = $1
+		RETURNING disabled_at
+	`
+
+	err := r.db.QueryRow(ctx, query, account.ID, disabled).Scan(&account.DisabledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update service account: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// ServiceAccountRepositoryTestSuite is an integration test suite that requires a running database
+type ServiceAccountRepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *ServiceAccountRepository
+	ctx  context.Context
+}
+
+func (suite *ServiceAccountRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewServiceAccountRepository(suite.db)
+}
+
+func (suite *ServiceAccountRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *ServiceAccountRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM service_accounts")
+	suite.Require().NoError(err, "Failed to clean up test data")
+}
+
+func (suite *ServiceAccountRepositoryTestSuite) createAccount() *models.ServiceAccount {
+	account := &models.ServiceAccount{
+		ClientID:         "worker-client",
+		ClientSecretHash: "secret-hash",
+		Name:             "Worker",
+		Scopes:           []string{"users:read"},
+	}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, account))
+	return account
+}
+
+func (suite *ServiceAccountRepositoryTestSuite) TestCreateAndGet() {
+	account := suite.createAccount()
+
+	found, err := suite.repo.GetByClientID(suite.ctx, "worker-client")
+	assert.NoError(suite.T(), err)
+	suite.Require().NotNil(found)
+	assert.Equal(suite.T(), account.ID, found.ID)
+	assert.Equal(suite.T(), []string{"users:read"}, found.Scopes)
+	assert.False(suite.T(), found.IsDisabled())
+
+	found, err = suite.repo.GetByID(suite.ctx, account.ID+1)
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), found)
+
+	accounts, err := suite.repo.List(suite.ctx)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), accounts, 1)
+}
+
+func (suite *ServiceAccountRepositoryTestSuite) TestRotateSecret() {
+	account := suite.createAccount()
+
+	rotated, err := suite.repo.RotateSecret(suite.ctx, account, "new-hash")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), rotated)
+
+	found, _ := suite.repo.GetByID(suite.ctx, account.ID)
+	assert.Equal(suite.T(), "new-hash", found.ClientSecretHash)
+}
+
+func (suite *ServiceAccountRepositoryTestSuite) TestSetDisabled() {
+	account := suite.createAccount()
+
+	updated, err := suite.repo.SetDisabled(suite.ctx, account, true)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), updated)
+	assert.True(suite.T(), account.IsDisabled())
+
+	updated, err = suite.repo.SetDisabled(suite.ctx, account, false)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), updated)
+	assert.False(suite.T(), account.IsDisabled())
+
+	missing := &models.ServiceAccount{ID: account.ID + 1}
+	updated, err = suite.repo.SetDisabled(suite.ctx, missing, true)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), updated)
+}
+
+func TestServiceAccountRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(ServiceAccountRepositoryTestSuite))
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SessionRepository stores users' logins. Revoking them is left to
+// RevocationRepository, so that the check on each request can be cached.
+type SessionRepository struct {
+	db *database.DB
+}
+
+func NewSessionRepository(db *database.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+const sessionColumns = `id, user_id, user_agent, ip_address, location, created_at, last_seen_at, expires_at, revoked_at`
+
+func scanSession(row pgx.Row) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.Location,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Create records a new session lasting ttl. Expired sessions are no longer
+// needed, since their access tokens have expired too, and are pruned at the
+// same time.
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session, ttl time.Duration) error {
+	if _, err := r.db.Exec(ctx, "DELETE FROM sessions WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to prune sessions: %w", err)
+	}
+
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, location, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), NOW() + make_interval(secs => $6))
+		RETURNING created_at, last_seen_at, expires_at
+	`
+
+	err := r.db.QueryRow(ctx, query, session.ID, session.UserID, session.UserAgent, session.IPAddress, session.Location, ttl.Seconds()).
+		Scan(&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records that a session is still in use, from the client in session,
+// and extends it to last ttl from now. Sessions that began before they were
+// recorded are created. Revoked sessions are left alone.
+func (r *SessionRepository) Touch(ctx context.Context, session *models.Session, ttl time.Duration) error {
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, location, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), NOW() + make_interval(secs => $6))
+		ON CONFLICT (id) DO UPDATE
+		SET user_agent = EXCLUDED.user_agent,
+			ip_address = EXCLUDED.ip_address,
+			location = EXCLUDED.location,
+			last_seen_at = EXCLUDED.last_seen_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE sessions.revoked_at IS NULL AND sessions.user_id = EXCLUDED.user_id
+	`
+
+	if _, err := r.db.Exec(ctx, query, session.ID, session.UserID, session.UserAgent, session.IPAddress, session.Location, ttl.Seconds()); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return nil
+}
+
+// GetForUser returns one of a user's unexpired, unrevoked sessions, or nil if
+// there is no such session.
+func (r *SessionRepository) GetForUser(ctx context.Context, userID int, id string) (*models.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// ListForUser returns a user's unexpired, unrevoked sessions, most recently
+// used first.
+func (r *SessionRepository) ListForUser(ctx context.Context, userID int) ([]models.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC, created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeAllForUser marks every one of a user's sessions revoked. Their access
+// tokens must be revoked separately.
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.db.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
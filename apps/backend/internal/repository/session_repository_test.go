@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// SessionRepositoryTestSuite is an integration test suite that requires a running database
+type SessionRepositoryTestSuite struct {
+	suite.Suite
+	db          *database.DB
+	repo        *SessionRepository
+	revocations *RevocationRepository
+	user        *models.User
+	ctx         context.Context
+}
+
+func (suite *SessionRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewSessionRepository(suite.db)
+	suite.revocations = NewRevocationRepository(suite.db)
+}
+
+func (suite *SessionRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *SessionRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "sessions@example.com", PasswordHash: "hash", Name: "Sessions"}
+	suite.Require().NoError(NewUserRepository(suite.db).Create(suite.ctx, suite.user))
+}
+
+func (suite *SessionRepositoryTestSuite) newSession(id string, ttl time.Duration) *models.Session {
+	session := &models.Session{ID: id, UserID: suite.user.ID, UserAgent: "test-agent", IPAddress: "192.0.2.1"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, session, ttl))
+	return session
+}
+
+func (suite *SessionRepositoryTestSuite) TestCreate() {
+	session := suite.newSession("session-1", time.Hour)
+
+	assert.False(suite.T(), session.CreatedAt.IsZero())
+	assert.True(suite.T(), session.ExpiresAt.After(session.CreatedAt))
+
+	found, err := suite.repo.GetForUser(suite.ctx, suite.user.ID, "session-1")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(found)
+	assert.Equal(suite.T(), "test-agent", found.UserAgent)
+	assert.Equal(suite.T(), "192.0.2.1", found.IPAddress)
+}
+
+func (suite *SessionRepositoryTestSuite) TestGetForUser_OtherUser() {
+	suite.newSession("session-1", time.Hour)
+
+	found, err := suite.repo.GetForUser(suite.ctx, suite.user.ID+1, "session-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), found)
+}
+
+func (suite *SessionRepositoryTestSuite) TestListForUser() {
+	suite.newSession("session-1", time.Hour)
+	suite.newSession("session-2", time.Hour)
+	suite.newSession("expired", -time.Minute)
+	suite.Require().NoError(suite.revocations.RevokeSession(suite.ctx, "session-2"))
+
+	sessions, err := suite.repo.ListForUser(suite.ctx, suite.user.ID)
+
+	suite.Require().NoError(err)
+	suite.Require().Len(sessions, 1, "Expired and revoked sessions are not listed")
+	assert.Equal(suite.T(), "session-1", sessions[0].ID)
+}
+
+func (suite *SessionRepositoryTestSuite) TestTouch() {
+	suite.newSession("session-1", time.Minute)
+
+	err := suite.repo.Touch(suite.ctx, &models.Session{ID: "session-1", UserID: suite.user.ID, UserAgent: "new-agent", IPAddress: "192.0.2.2"}, time.Hour)
+	suite.Require().NoError(err)
+
+	found, err := suite.repo.GetForUser(suite.ctx, suite.user.ID, "session-1")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(found)
+	assert.Equal(suite.T(), "new-agent", found.UserAgent)
+	assert.Equal(suite.T(), "192.0.2.2", found.IPAddress)
+	assert.True(suite.T(), found.ExpiresAt.After(found.CreatedAt.Add(30*time.Minute)), "Touching extends the session")
+}
+
+func (suite *SessionRepositoryTestSuite) TestTouch_CreatesUnrecordedSession() {
+	err := suite.repo.Touch(suite.ctx, &models.Session{ID: "legacy", UserID: suite.user.ID}, time.Hour)
+	suite.Require().NoError(err)
+
+	found, err := suite.repo.GetForUser(suite.ctx, suite.user.ID, "legacy")
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), found)
+}
+
+func (suite *SessionRepositoryTestSuite) TestTouch_LeavesRevokedSession() {
+	suite.newSession("session-1", time.Hour)
+	suite.Require().NoError(suite.revocations.RevokeSession(suite.ctx, "session-1"))
+
+	err := suite.repo.Touch(suite.ctx, &models.Session{ID: "session-1", UserID: suite.user.ID}, time.Hour)
+	suite.Require().NoError(err)
+
+	revoked, err := suite.revocations.IsSessionRevoked(suite.ctx, "session-1")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), revoked)
+}
+
+func (suite *SessionRepositoryTestSuite) TestIsSessionRevoked() {
+	suite.newSession("session-1", time.Hour)
+
+	revoked, err := suite.revocations.IsSessionRevoked(suite.ctx, "session-1")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), revoked)
+
+	revoked, err = suite.revocations.IsSessionRevoked(suite.ctx, "missing")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), revoked, "Sessions that don't exist are treated as revoked")
+}
+
+func (suite *SessionRepositoryTestSuite) TestRevokeAllForUser() {
+	suite.newSession("session-1", time.Hour)
+	suite.newSession("session-2", time.Hour)
+
+	suite.Require().NoError(suite.repo.RevokeAllForUser(suite.ctx, suite.user.ID))
+
+	sessions, err := suite.repo.ListForUser(suite.ctx, suite.user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), sessions)
+	revoked, err := suite.revocations.IsSessionRevoked(suite.ctx, "session-2")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), revoked)
+}
+
+func TestSessionRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(SessionRepositoryTestSuite))
+}
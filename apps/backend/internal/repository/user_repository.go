@@ -4,12 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/dwfennell/monorepo-scaffold/internal/database"
 	"github.com/dwfennell/monorepo-scaffold/internal/models"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// ErrEmailTaken is returned when creating a user, or changing a user's email
+// address, with an address that another account has. Deleted accounts keep
+// their address until they are purged.
+var ErrEmailTaken = errors.New("email address already in use")
+
+// ErrSoleOwner is returned when deleting a user who is the only owner of an
+// organization with other members, which would be left without one.
+var ErrSoleOwner = errors.New("user is the only owner of an organization")
+
 type UserRepository struct {
 	db *database.DB
 }
@@ -18,35 +29,43 @@ func NewUserRepository(db *database.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// Create inserts user. An empty PasswordHash creates an account without a
+// password, which can only be used with another credential such as a passkey.
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	query := `
 		INSERT INTO users (email, password_hash, name, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
+		VALUES ($1, NULLIF($2, ''), $3, NOW(), NOW())
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.Pool.QueryRow(ctx, query, user.Email, user.PasswordHash, user.Name).
+	err := r.db.QueryRow(ctx, query, user.Email, user.PasswordHash, user.Name).
 		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return nil
 }
 
+// GetByEmail returns the user with the given address, or nil if there is
+// none or the account has been deleted.
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, name, created_at, updated_at
+		SELECT id, email, COALESCE(password_hash, ''), name, email_verified_at, created_at, updated_at
 		FROM users
-		WHERE email = $1
+		WHERE email = $1 AND deleted_at IS NULL
 	`
 
 	var user models.User
-	err := r.db.Pool.QueryRow(ctx, query, email).Scan(
+	err := r.db.QueryRow(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
 		&user.Name,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -61,19 +80,22 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 	return &user, nil
 }
 
+// GetByID returns the user with the given ID, or nil if there is none or the
+// account has been deleted.
 func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, name, created_at, updated_at
+		SELECT id, email, COALESCE(password_hash, ''), name, email_verified_at, created_at, updated_at
 		FROM users
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var user models.User
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.QueryRow(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
 		&user.Name,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -87,3 +109,254 @@ func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, err
 
 	return &user, nil
 }
+
+// MarkEmailVerified records that the user proved ownership of their email
+// address. Verifying an already verified address keeps the original time.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, user *models.User) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+		RETURNING email_verified_at, updated_at
+	`
+
+	err := r.db.QueryRow(ctx, query, user.ID).Scan(&user.EmailVerifiedAt, &user.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateName sets the user's name from user.Name.
+func (r *UserRepository) UpdateName(ctx context.Context, user *models.User) error {
+	query := `
+		UPDATE users
+		SET name = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	if err := r.db.QueryRow(ctx, query, user.ID, user.Name).Scan(&user.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to update name: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateEmail changes the user's email address to one they have proved they
+// control, so it is marked verified. It returns ErrEmailTaken if another
+// account has the address.
+func (r *UserRepository) UpdateEmail(ctx context.Context, user *models.User, email string) error {
+	query := `
+		UPDATE users
+		SET email = $2, email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		RETURNING email, email_verified_at, updated_at
+	`
+
+	err := r.db.QueryRow(ctx, query, user.ID, email).Scan(&user.Email, &user.EmailVerifiedAt, &user.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $2, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, userID, passwordHash); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return nil
+}
+
+// RehashPassword replaces a password hash with an equivalent one made with
+// other parameters. It only does so if the hash is still oldHash, so that it
+// can't undo a password change made in the meantime, and reports whether it
+// did.
+func (r *UserRepository) RehashPassword(ctx context.Context, userID int, oldHash, newHash string) (bool, error) {
+	query := `UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2`
+
+	result, err := r.db.Exec(ctx, query, userID, oldHash, newHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to rehash password: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// LoginMethods returns the credentials the user can log in with, or nil if
+// there is no such user.
+func (r *UserRepository) LoginMethods(ctx context.Context, userID int) (*models.LoginMethods, error) {
+	query := `
+		SELECT
+			COALESCE(password_hash, '') <> '',
+			(SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = users.id),
+			(SELECT COUNT(*) FROM user_identities WHERE user_id = users.id)
+		FROM users
+		WHERE id = $1
+	`
+
+	var methods models.LoginMethods
+	err := r.db.QueryRow(ctx, query, userID).Scan(&methods.Password, &methods.Passkeys, &methods.Identities)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login methods: %w", err)
+	}
+
+	return &methods, nil
+}
+
+// SoftDelete marks the user's account deleted, hiding it from GetByEmail and
+// GetByID until it is restored or purged. It returns ErrSoleOwner if that
+// would leave an organization with members but no owner whose account is
+// not deleted. The memberships of the user's organizations are locked while
+// it checks, so co-owners deleting their accounts at the same time cannot
+// both leave.
+func (r *UserRepository) SoftDelete(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	lock := `
+		SELECT 1
+		FROM organization_members
+		WHERE org_id IN (SELECT org_id FROM organization_members WHERE user_id = $1)
+		ORDER BY org_id, user_id
+		FOR UPDATE
+	`
+
+	if _, err := tx.Exec(ctx, lock, userID); err != nil {
+		return fmt.Errorf("failed to lock organization memberships: %w", err)
+	}
+
+	soleOwner := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM organization_members m
+			WHERE m.user_id = $1 AND m.role = $2
+			AND EXISTS (
+				SELECT 1 FROM organization_members o
+				WHERE o.org_id = m.org_id AND o.user_id <> $1
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM organization_members o
+				JOIN users u ON u.id = o.user_id
+				WHERE o.org_id = m.org_id AND o.user_id <> $1 AND o.role = $2
+				AND u.deleted_at IS NULL
+			)
+		)
+	`
+
+	var isSoleOwner bool
+	if err := tx.QueryRow(ctx, soleOwner, userID, models.OrgRoleOwner).Scan(&isSoleOwner); err != nil {
+		return fmt.Errorf("failed to check organization ownership: %w", err)
+	}
+	if isSoleOwner {
+		return ErrSoleOwner
+	}
+
+	query := `
+		UPDATE users
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit account deletion: %w", err)
+	}
+
+	return nil
+}
+
+// Restore undoes SoftDelete, and reports whether there was a deleted account
+// to restore.
+func (r *UserRepository) Restore(ctx context.Context, userID int) (bool, error) {
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// PurgeDeleted permanently removes accounts deleted more than gracePeriod
+// ago, and returns how many there were. The comparison is made in the
+// database, against the same clock that set deleted_at. Rows belonging to them go with them, as do
+// organizations they were the only members of. Audit events are kept for the
+// record but no longer name the account, and login throttles and magic links
+// for their addresses are dropped.
+func (r *UserRepository) PurgeDeleted(ctx context.Context, gracePeriod time.Duration) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id FROM users WHERE deleted_at < NOW() - make_interval(secs => $1) FOR UPDATE`
+
+	rows, err := tx.Query(ctx, query, gracePeriod.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find deleted users: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return 0, fmt.Errorf("failed to find deleted users: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	statements := []struct{ query, action string }{
+		{`UPDATE audit_events SET details = details - 'email' WHERE user_id = ANY($1)`, "anonymize audit events"},
+		{`DELETE FROM login_throttles WHERE key IN (SELECT 'email:' || LOWER(email) FROM users WHERE id = ANY($1))`, "delete login throttles"},
+		{`DELETE FROM magic_links WHERE email IN (SELECT email FROM users WHERE id = ANY($1))`, "delete magic links"},
+		{`
+			DELETE FROM organizations o
+			WHERE EXISTS (SELECT 1 FROM organization_members m WHERE m.org_id = o.id AND m.user_id = ANY($1))
+			AND NOT EXISTS (SELECT 1 FROM organization_members m WHERE m.org_id = o.id AND m.user_id <> ALL($1))
+		`, "delete organizations"},
+		{`DELETE FROM users WHERE id = ANY($1)`, "delete users"},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement.query, ids); err != nil {
+			return 0, fmt.Errorf("failed to %s: %w", statement.action, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit user purge: %w", err)
+	}
+
+	return len(ids), nil
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/dwfennell/monorepo-scaffold/internal/database"
 	"github.com/dwfennell/monorepo-scaffold/internal/models"
@@ -58,6 +59,21 @@ func (suite *UserRepositoryTestSuite) TestCreate_Success() {
 	assert.NotZero(suite.T(), user.UpdatedAt, "UpdatedAt should be set")
 }
 
+func (suite *UserRepositoryTestSuite) TestCreate_WithoutPassword() {
+	user := &models.User{Email: "passwordless@example.com", Name: "Passwordless"}
+
+	err := suite.repo.Create(suite.ctx, user)
+
+	assert.NoError(suite.T(), err)
+	var isNull bool
+	suite.db.Pool.QueryRow(suite.ctx, "SELECT password_hash IS NULL FROM users WHERE id = $1", user.ID).Scan(&isNull)
+	assert.True(suite.T(), isNull, "An empty hash should be stored as NULL")
+
+	found, err := suite.repo.GetByID(suite.ctx, user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), found.PasswordHash)
+}
+
 func (suite *UserRepositoryTestSuite) TestCreate_DuplicateEmail() {
 	user1 := &models.User{
 		Email:        "duplicate@example.com",
@@ -129,6 +145,233 @@ func (suite *UserRepositoryTestSuite) TestGetByID_NotFound() {
 	assert.Nil(suite.T(), found, "Should return nil for non-existent ID")
 }
 
+func (suite *UserRepositoryTestSuite) TestMarkEmailVerified() {
+	user := &models.User{
+		Email:        "verify@example.com",
+		PasswordHash: "hashedpass",
+		Name:         "Verify Me",
+	}
+	suite.repo.Create(suite.ctx, user)
+	assert.Nil(suite.T(), user.EmailVerifiedAt, "New users should be unverified")
+
+	err := suite.repo.MarkEmailVerified(suite.ctx, user)
+
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), user.EmailVerifiedAt)
+
+	found, _ := suite.repo.GetByID(suite.ctx, user.ID)
+	assert.NotNil(suite.T(), found.EmailVerifiedAt)
+}
+
+func (suite *UserRepositoryTestSuite) TestUpdatePassword() {
+	user := &models.User{
+		Email:        "newpass@example.com",
+		PasswordHash: "oldhash",
+		Name:         "New Pass",
+	}
+	suite.repo.Create(suite.ctx, user)
+
+	err := suite.repo.UpdatePassword(suite.ctx, user.ID, "newhash")
+
+	assert.NoError(suite.T(), err)
+	found, _ := suite.repo.GetByID(suite.ctx, user.ID)
+	assert.Equal(suite.T(), "newhash", found.PasswordHash)
+}
+
+func (suite *UserRepositoryTestSuite) TestUpdateName() {
+	user := &models.User{Email: "rename@example.com", PasswordHash: "hash", Name: "Old Name"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, user))
+	created := user.UpdatedAt
+
+	user.Name = "New Name"
+	err := suite.repo.UpdateName(suite.ctx, user)
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), user.UpdatedAt.After(created), "updated_at is maintained")
+	found, _ := suite.repo.GetByID(suite.ctx, user.ID)
+	assert.Equal(suite.T(), "New Name", found.Name)
+}
+
+func (suite *UserRepositoryTestSuite) TestUpdateEmail() {
+	user := &models.User{Email: "before@example.com", PasswordHash: "hash", Name: "Mover"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, user))
+
+	err := suite.repo.UpdateEmail(suite.ctx, user, "after@example.com")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "after@example.com", user.Email)
+	assert.NotNil(suite.T(), user.EmailVerifiedAt, "The new address has been confirmed")
+	found, _ := suite.repo.GetByEmail(suite.ctx, "after@example.com")
+	suite.Require().NotNil(found)
+	assert.Equal(suite.T(), user.ID, found.ID)
+}
+
+func (suite *UserRepositoryTestSuite) TestUpdateEmail_Taken() {
+	user := &models.User{Email: "mine@example.com", PasswordHash: "hash", Name: "Mine"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, user))
+	suite.Require().NoError(suite.repo.Create(suite.ctx, &models.User{Email: "theirs@example.com", PasswordHash: "hash", Name: "Theirs"}))
+
+	err := suite.repo.UpdateEmail(suite.ctx, user, "theirs@example.com")
+
+	assert.ErrorIs(suite.T(), err, ErrEmailTaken)
+	found, _ := suite.repo.GetByID(suite.ctx, user.ID)
+	assert.Equal(suite.T(), "mine@example.com", found.Email)
+}
+
+func (suite *UserRepositoryTestSuite) TestRehashPassword() {
+	user := &models.User{Email: "rehash@example.com", PasswordHash: "oldhash", Name: "Rehash"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, user))
+
+	rehashed, err := suite.repo.RehashPassword(suite.ctx, user.ID, "otherhash", "newhash")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), rehashed, "A changed password is left alone")
+
+	rehashed, err = suite.repo.RehashPassword(suite.ctx, user.ID, "oldhash", "newhash")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), rehashed)
+	found, _ := suite.repo.GetByID(suite.ctx, user.ID)
+	assert.Equal(suite.T(), "newhash", found.PasswordHash)
+}
+
+func (suite *UserRepositoryTestSuite) TestLoginMethods() {
+	user := &models.User{Email: "methods@example.com", Name: "Methods"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, user))
+	identities := NewIdentityRepository(suite.db)
+	suite.Require().NoError(identities.Create(suite.ctx, &models.UserIdentity{UserID: user.ID, Provider: "google", Subject: "subject-1"}))
+
+	methods, err := suite.repo.LoginMethods(suite.ctx, user.ID)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), models.LoginMethods{Password: false, Passkeys: 0, Identities: 1}, *methods)
+}
+
+func (suite *UserRepositoryTestSuite) TestLoginMethods_NotFound() {
+	methods, err := suite.repo.LoginMethods(suite.ctx, 999999)
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), methods)
+}
+
+func (suite *UserRepositoryTestSuite) TestSoftDelete_HidesUser() {
+	user := &models.User{Email: "softdelete@example.com", PasswordHash: "hash", Name: "Leaving"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, user))
+
+	err := suite.repo.SoftDelete(suite.ctx, user.ID)
+
+	assert.NoError(suite.T(), err)
+	byID, err := suite.repo.GetByID(suite.ctx, user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), byID)
+	byEmail, err := suite.repo.GetByEmail(suite.ctx, "softdelete@example.com")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), byEmail)
+
+	err = suite.repo.Create(suite.ctx, &models.User{Email: "softdelete@example.com", PasswordHash: "hash", Name: "Newcomer"})
+	assert.ErrorIs(suite.T(), err, ErrEmailTaken, "The address is kept until the account is purged")
+}
+
+func (suite *UserRepositoryTestSuite) TestSoftDelete_SoleOwner() {
+	owner := &models.User{Email: "soleowner@example.com", PasswordHash: "hash", Name: "Owner"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, owner))
+	member := &models.User{Email: "member@example.com", PasswordHash: "hash", Name: "Member"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, member))
+	org := &models.Organization{Name: "Acme"}
+	suite.Require().NoError(NewOrganizationRepository(suite.db).Create(suite.ctx, org, owner.ID))
+
+	// An organization of one goes with its owner
+	assert.NoError(suite.T(), suite.repo.SoftDelete(suite.ctx, owner.ID))
+	restored, _ := suite.repo.Restore(suite.ctx, owner.ID)
+	suite.Require().True(restored)
+
+	_, err := suite.db.Pool.Exec(suite.ctx,
+		"INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)",
+		org.ID, member.ID, models.OrgRoleMember)
+	suite.Require().NoError(err)
+
+	err = suite.repo.SoftDelete(suite.ctx, owner.ID)
+
+	assert.ErrorIs(suite.T(), err, ErrSoleOwner)
+	found, _ := suite.repo.GetByID(suite.ctx, owner.ID)
+	assert.NotNil(suite.T(), found)
+	assert.NoError(suite.T(), suite.repo.SoftDelete(suite.ctx, member.ID), "Members can leave")
+}
+
+func (suite *UserRepositoryTestSuite) TestSoftDelete_CoOwners() {
+	first := &models.User{Email: "firstowner@example.com", PasswordHash: "hash", Name: "First"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, first))
+	second := &models.User{Email: "secondowner@example.com", PasswordHash: "hash", Name: "Second"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, second))
+	org := &models.Organization{Name: "Acme"}
+	suite.Require().NoError(NewOrganizationRepository(suite.db).Create(suite.ctx, org, first.ID))
+	_, err := suite.db.Pool.Exec(suite.ctx,
+		"INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)",
+		org.ID, second.ID, models.OrgRoleOwner)
+	suite.Require().NoError(err)
+
+	assert.NoError(suite.T(), suite.repo.SoftDelete(suite.ctx, first.ID))
+
+	err = suite.repo.SoftDelete(suite.ctx, second.ID)
+	assert.ErrorIs(suite.T(), err, ErrSoleOwner, "An owner whose account is deleted does not count")
+}
+
+func (suite *UserRepositoryTestSuite) TestRestore() {
+	user := &models.User{Email: "restore@example.com", PasswordHash: "hash", Name: "Returning"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, user))
+
+	restored, err := suite.repo.Restore(suite.ctx, user.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), restored, "The account was not deleted")
+
+	suite.Require().NoError(suite.repo.SoftDelete(suite.ctx, user.ID))
+	restored, err = suite.repo.Restore(suite.ctx, user.ID)
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), restored)
+	found, _ := suite.repo.GetByEmail(suite.ctx, "restore@example.com")
+	assert.NotNil(suite.T(), found)
+}
+
+func (suite *UserRepositoryTestSuite) TestPurgeDeleted() {
+	purged := &models.User{Email: "purged@example.com", PasswordHash: "hash", Name: "Purged"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, purged))
+	recent := &models.User{Email: "recent@example.com", PasswordHash: "hash", Name: "Recent"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, recent))
+	kept := &models.User{Email: "kept@example.com", PasswordHash: "hash", Name: "Kept"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, kept))
+	suite.Require().NoError(suite.repo.SoftDelete(suite.ctx, purged.ID))
+	suite.Require().NoError(suite.repo.SoftDelete(suite.ctx, recent.ID))
+	_, err := suite.db.Pool.Exec(suite.ctx, "UPDATE users SET deleted_at = NOW() - INTERVAL '31 days' WHERE id = $1", purged.ID)
+	suite.Require().NoError(err)
+
+	org := &models.Organization{Name: "Solo"}
+	suite.Require().NoError(NewOrganizationRepository(suite.db).Create(suite.ctx, org, purged.ID))
+	event := &models.AuditEvent{Event: models.AuditEventAccountLocked, UserID: &purged.ID, Details: map[string]any{"email": purged.Email}}
+	suite.Require().NoError(NewAuditRepository(suite.db).Record(suite.ctx, event))
+	suite.Require().NoError(NewLoginThrottleRepository(suite.db).Block(suite.ctx, "email:purged@example.com", time.Hour, true))
+
+	count, err := suite.repo.PurgeDeleted(suite.ctx, 30*24*time.Hour)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+	var remaining int
+	suite.Require().NoError(suite.db.Pool.QueryRow(suite.ctx, "SELECT COUNT(*) FROM users WHERE id = ANY($1)", []int{purged.ID, recent.ID, kept.ID}).Scan(&remaining))
+	assert.Equal(suite.T(), 2, remaining, "Accounts still in their grace period are kept")
+	restored, _ := suite.repo.Restore(suite.ctx, recent.ID)
+	assert.True(suite.T(), restored)
+
+	var orgs int
+	suite.Require().NoError(suite.db.Pool.QueryRow(suite.ctx, "SELECT COUNT(*) FROM organizations WHERE id = $1", org.ID).Scan(&orgs))
+	assert.Zero(suite.T(), orgs, "Organizations left empty are deleted")
+	var userID *int
+	var details map[string]any
+	suite.Require().NoError(suite.db.Pool.QueryRow(suite.ctx, "SELECT user_id, details FROM audit_events WHERE id = $1", event.ID).Scan(&userID, &details))
+	assert.Nil(suite.T(), userID)
+	assert.NotContains(suite.T(), details, "email")
+	blocked, err := NewLoginThrottleRepository(suite.db).Blocked(suite.ctx, "email:purged@example.com")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), blocked)
+}
+
 // Run the test suite
 func TestUserRepositoryTestSuite(t *testing.T) {
 	// Skip integration tests if SHORT flag is set
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// UserTokenRepository stores single-use tokens emailed to users, such as
+// email verification links.
+type UserTokenRepository struct {
+	db *database.DB
+}
+
+func NewUserTokenRepository(db *database.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, token *models.UserToken, ttl time.Duration) error {
+	query := `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW() + make_interval(secs => $5), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.Email, ttl.Seconds()).
+		Scan(&token.ID, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user token: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns an unexpired, unused token without consuming it, or nil if
+// there is no such token.
+func (r *UserTokenRepository) Get(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	query := `
+		SELECT id, user_id, purpose, token_hash, COALESCE(email, ''), expires_at, consumed_at, created_at
+		FROM user_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+	`
+
+	var token models.UserToken
+	err := r.db.QueryRow(ctx, query, tokenHash, purpose).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Email,
+		&token.ExpiresAt,
+		&token.ConsumedAt,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// Consume marks an unexpired, unused token as used and returns it. It returns
+// nil if no such token exists, so each token can be consumed at most once.
+func (r *UserTokenRepository) Consume(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	query := `
+		UPDATE user_tokens
+		SET consumed_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, COALESCE(email, ''), expires_at, consumed_at, created_at
+	`
+
+	var token models.UserToken
+	err := r.db.QueryRow(ctx, query, tokenHash, purpose).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Email,
+		&token.ExpiresAt,
+		&token.ConsumedAt,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume user token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// DeleteForUser removes a user's outstanding tokens for a purpose, so that
+// sending a new link invalidates the previous ones.
+func (r *UserTokenRepository) DeleteForUser(ctx context.Context, userID int, purpose string) error {
+	query := `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2`
+
+	if _, err := r.db.Exec(ctx, query, userID, purpose); err != nil {
+		return fmt.Errorf("failed to delete user tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// UserTokenRepositoryTestSuite is an integration test suite that requires a running database
+type UserTokenRepositoryTestSuite struct {
+	suite.Suite
+	db   *database.DB
+	repo *UserTokenRepository
+	user *models.User
+	ctx  context.Context
+}
+
+func (suite *UserTokenRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewUserTokenRepository(suite.db)
+}
+
+func (suite *UserTokenRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *UserTokenRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "usertokens@example.com", PasswordHash: "hash", Name: "Tokens"}
+	suite.Require().NoError(NewUserRepository(suite.db).Create(suite.ctx, suite.user))
+}
+
+func (suite *UserTokenRepositoryTestSuite) newToken(purpose, hash string, ttl time.Duration) *models.UserToken {
+	token := &models.UserToken{UserID: suite.user.ID, Purpose: purpose, TokenHash: hash}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, token, ttl))
+	return token
+}
+
+func (suite *UserTokenRepositoryTestSuite) TestGet_DoesNotConsume() {
+	created := suite.newToken(models.TokenPurposePasswordReset, "hash-1", time.Hour)
+
+	token, err := suite.repo.Get(suite.ctx, models.TokenPurposePasswordReset, "hash-1")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(token)
+	assert.Equal(suite.T(), created.ID, token.ID)
+	assert.Nil(suite.T(), token.ConsumedAt)
+
+	consumed, err := suite.repo.Consume(suite.ctx, models.TokenPurposePasswordReset, "hash-1")
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), consumed, "Getting a token leaves it usable")
+
+	token, err = suite.repo.Get(suite.ctx, models.TokenPurposePasswordReset, "hash-1")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), token, "Consumed tokens are not returned")
+}
+
+func (suite *UserTokenRepositoryTestSuite) TestConsume_Success() {
+	created := suite.newToken(models.TokenPurposeEmailVerification, "hash-1", time.Hour)
+
+	token, err := suite.repo.Consume(suite.ctx, models.TokenPurposeEmailVerification, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), token)
+	assert.Equal(suite.T(), created.ID, token.ID)
+	assert.Equal(suite.T(), suite.user.ID, token.UserID)
+	assert.NotNil(suite.T(), token.ConsumedAt)
+}
+
+func (suite *UserTokenRepositoryTestSuite) TestConsume_ReturnsEmail() {
+	token := &models.UserToken{UserID: suite.user.ID, Purpose: models.TokenPurposeEmailChange, TokenHash: "hash-1", Email: "new@example.com"}
+	suite.Require().NoError(suite.repo.Create(suite.ctx, token, time.Hour))
+
+	consumed, err := suite.repo.Consume(suite.ctx, models.TokenPurposeEmailChange, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	suite.Require().NotNil(consumed)
+	assert.Equal(suite.T(), "new@example.com", consumed.Email)
+}
+
+func (suite *UserTokenRepositoryTestSuite) TestConsume_OnlyOnce() {
+	suite.newToken(models.TokenPurposeEmailVerification, "hash-1", time.Hour)
+	suite.repo.Consume(suite.ctx, models.TokenPurposeEmailVerification, "hash-1")
+
+	token, err := suite.repo.Consume(suite.ctx, models.TokenPurposeEmailVerification, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), token)
+}
+
+func (suite *UserTokenRepositoryTestSuite) TestConsume_Expired() {
+	suite.newToken(models.TokenPurposeEmailVerification, "hash-1", -time.Minute)
+
+	token, err := suite.repo.Consume(suite.ctx, models.TokenPurposeEmailVerification, "hash-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), token)
+}
+
+func (suite *UserTokenRepositoryTestSuite) TestConsume_WrongPurpose() {
+	suite.newToken(models.TokenPurposeEmailVerification, "hash-1", time.Hour)
+
+	token, err := suite.repo.Consume(suite.ctx, "other_purpose", "hash-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), token)
+}
+
+func (suite *UserTokenRepositoryTestSuite) TestDeleteForUser() {
+	suite.newToken(models.TokenPurposeEmailVerification, "hash-1", time.Hour)
+
+	err := suite.repo.DeleteForUser(suite.ctx, suite.user.ID, models.TokenPurposeEmailVerification)
+
+	assert.NoError(suite.T(), err)
+	token, _ := suite.repo.Consume(suite.ctx, models.TokenPurposeEmailVerification, "hash-1")
+	assert.Nil(suite.T(), token)
+}
+
+func TestUserTokenRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(UserTokenRepositoryTestSuite))
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// WebAuthnRepository stores passkeys and the challenges of ceremonies in
+// progress.
+type WebAuthnRepository struct {
+	db *database.DB
+}
+
+func NewWebAuthnRepository(db *database.DB) *WebAuthnRepository {
+	return &WebAuthnRepository{db: db}
+}
+
+// UserHandle returns the user's WebAuthn user handle, setting it to candidate
+// if they do not have one yet.
+func (r *WebAuthnRepository) UserHandle(ctx context.Context, userID int, candidate []byte) ([]byte, error) {
+	query := `
+		UPDATE users
+		SET webauthn_handle = COALESCE(webauthn_handle, $2)
+		WHERE id = $1
+		RETURNING webauthn_handle
+	`
+
+	var handle []byte
+	if err := r.db.QueryRow(ctx, query, userID, candidate).Scan(&handle); err != nil {
+		return nil, fmt.Errorf("failed to get WebAuthn user handle: %w", err)
+	}
+
+	return handle, nil
+}
+
+// CreateSession stores the state of a new ceremony. Sessions that have expired
+// are pruned at the same time.
+func (r *WebAuthnRepository) CreateSession(ctx context.Context, session *models.WebAuthnSession, ttl time.Duration) error {
+	query := `
+		INSERT INTO webauthn_sessions (challenge, ceremony, user_id, data, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5), NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, session.Challenge, session.Ceremony, session.UserID, session.Data, ttl.Seconds()).
+		Scan(&session.ID, &session.ExpiresAt, &session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create WebAuthn session: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, "DELETE FROM webauthn_sessions WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to prune WebAuthn sessions: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeSession removes and returns the unexpired session for a ceremony with
+// the given challenge, or nil if there is none, so that each challenge can be
+// answered at most once.
+func (r *WebAuthnRepository) ConsumeSession(ctx context.Context, ceremony, challenge string) (*models.WebAuthnSession, error) {
+	query := `
+		DELETE FROM webauthn_sessions
+		WHERE challenge = $1 AND ceremony = $2 AND expires_at > NOW()
+		RETURNING id, challenge, ceremony, user_id, data, expires_at, created_at
+	`
+
+	var session models.WebAuthnSession
+	err := r.db.QueryRow(ctx, query, challenge, ceremony).Scan(
+		&session.ID,
+		&session.Challenge,
+		&session.Ceremony,
+		&session.UserID,
+		&session.Data,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume WebAuthn session: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (r *WebAuthnRepository) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	return createCredential(ctx, r.db, credential)
+}
+
+// CreateUserWithCredential creates a passwordless account together with its
+// first passkey, so that no account is left without a way to log in.
+func (r *WebAuthnRepository) CreateUserWithCredential(ctx context.Context, user *models.User, handle []byte, credential *models.WebAuthnCredential) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO users (email, name, webauthn_handle, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(ctx, query, user.Email, user.Name, handle).
+		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	credential.UserID = user.ID
+	if err := createCredential(ctx, tx, credential); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit user creation: %w", err)
+	}
+
+	return nil
+}
+
+// querier is satisfied by both the database and a transaction.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func createCredential(ctx context.Context, q querier, credential *models.WebAuthnCredential) error {
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, name, data, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`
+
+	err := q.QueryRow(ctx, query, credential.UserID, credential.CredentialID, credential.Name, credential.Data).
+		Scan(&credential.ID, &credential.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create WebAuthn credential: %w", err)
+	}
+
+	return nil
+}
+
+// GetByCredentialID returns the passkey with the given credential ID, with its
+// owner's user handle, or nil if there is none.
+func (r *WebAuthnRepository) GetByCredentialID(ctx context.Context, credentialID []byte) (*models.WebAuthnCredential, error) {
+	query := `
+		SELECT c.id, c.user_id, c.credential_id, c.name, c.data, c.created_at, c.last_used_at, u.webauthn_handle
+		FROM webauthn_credentials c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.credential_id = $1
+	`
+
+	var credential models.WebAuthnCredential
+	err := r.db.QueryRow(ctx, query, credentialID).Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credential.CredentialID,
+		&credential.Name,
+		&credential.Data,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+		&credential.UserHandle,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get WebAuthn credential: %w", err)
+	}
+
+	return &credential, nil
+}
+
+// ListByUser returns the user's passkeys, oldest first.
+func (r *WebAuthnRepository) ListByUser(ctx context.Context, userID int) ([]models.WebAuthnCredential, error) {
+	query := `
+		SELECT id, user_id, credential_id, name, data, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WebAuthn credentials: %w", err)
+	}
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+	for rows.Next() {
+		var credential models.WebAuthnCredential
+		err := rows.Scan(
+			&credential.ID,
+			&credential.UserID,
+			&credential.CredentialID,
+			&credential.Name,
+			&credential.Data,
+			&credential.CreatedAt,
+			&credential.LastUsedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan WebAuthn credential: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list WebAuthn credentials: %w", err)
+	}
+
+	return credentials, nil
+}
+
+// RecordUse stores the credential record as updated by a login, which carries
+// the new signature counter, and the time of use.
+func (r *WebAuthnRepository) RecordUse(ctx context.Context, id int, data []byte) error {
+	query := `
+		UPDATE webauthn_credentials
+		SET data = $2, last_used_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, data); err != nil {
+		return fmt.Errorf("failed to update WebAuthn credential: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes one of the user's passkeys. It returns false if the user has
+// no passkey with that id.
+func (r *WebAuthnRepository) Delete(ctx context.Context, userID, id int) (bool, error) {
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete WebAuthn credential: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
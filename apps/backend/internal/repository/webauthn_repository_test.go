@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/models"
+	"github.com/dwfennell/monorepo-scaffold/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// WebAuthnRepositoryTestSuite is an integration test suite that requires a running database
+type WebAuthnRepositoryTestSuite struct {
+	suite.Suite
+	db       *database.DB
+	repo     *WebAuthnRepository
+	userRepo *UserRepository
+	user     *models.User
+	ctx      context.Context
+}
+
+func (suite *WebAuthnRepositoryTestSuite) SetupSuite() {
+	var err error
+	suite.ctx = context.Background()
+	suite.db, err = testutil.NewTestDB(suite.ctx)
+	suite.Require().NoError(err)
+
+	suite.repo = NewWebAuthnRepository(suite.db)
+	suite.userRepo = NewUserRepository(suite.db)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TearDownSuite() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
+func (suite *WebAuthnRepositoryTestSuite) SetupTest() {
+	_, err := suite.db.Pool.Exec(suite.ctx, "DELETE FROM users")
+	suite.Require().NoError(err, "Failed to clean up test data")
+	_, err = suite.db.Pool.Exec(suite.ctx, "DELETE FROM webauthn_sessions")
+	suite.Require().NoError(err, "Failed to clean up test data")
+
+	suite.user = &models.User{Email: "webauthn@example.com", PasswordHash: "hash", Name: "WebAuthn"}
+	suite.Require().NoError(suite.userRepo.Create(suite.ctx, suite.user))
+}
+
+func (suite *WebAuthnRepositoryTestSuite) newCredential(credentialID string) *models.WebAuthnCredential {
+	credential := &models.WebAuthnCredential{
+		UserID:       suite.user.ID,
+		CredentialID: []byte(credentialID),
+		Name:         "Passkey",
+		Data:         []byte(`{"id":"` + credentialID + `"}`),
+	}
+	suite.Require().NoError(suite.repo.CreateCredential(suite.ctx, credential))
+	return credential
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestUserHandle_StableOnceSet() {
+	handle, err := suite.repo.UserHandle(suite.ctx, suite.user.ID, []byte("first"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []byte("first"), handle)
+
+	handle, err = suite.repo.UserHandle(suite.ctx, suite.user.ID, []byte("second"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []byte("first"), handle)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestConsumeSession_OnlyOnce() {
+	session := &models.WebAuthnSession{Challenge: "challenge-1", Ceremony: models.WebAuthnCeremonyLogin, Data: []byte(`{}`)}
+	suite.Require().NoError(suite.repo.CreateSession(suite.ctx, session, time.Minute))
+
+	consumed, err := suite.repo.ConsumeSession(suite.ctx, models.WebAuthnCeremonyLogin, "challenge-1")
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), consumed)
+	assert.Nil(suite.T(), consumed.UserID)
+
+	consumed, err = suite.repo.ConsumeSession(suite.ctx, models.WebAuthnCeremonyLogin, "challenge-1")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestConsumeSession_WrongCeremony() {
+	session := &models.WebAuthnSession{Challenge: "challenge-1", Ceremony: models.WebAuthnCeremonySignup, Data: []byte(`{}`)}
+	suite.Require().NoError(suite.repo.CreateSession(suite.ctx, session, time.Minute))
+
+	consumed, err := suite.repo.ConsumeSession(suite.ctx, models.WebAuthnCeremonyLogin, "challenge-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestConsumeSession_Expired() {
+	session := &models.WebAuthnSession{Challenge: "challenge-1", Ceremony: models.WebAuthnCeremonyLogin, Data: []byte(`{}`)}
+	suite.Require().NoError(suite.repo.CreateSession(suite.ctx, session, -time.Minute))
+
+	consumed, err := suite.repo.ConsumeSession(suite.ctx, models.WebAuthnCeremonyLogin, "challenge-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), consumed)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestGetByCredentialID_IncludesUserHandle() {
+	suite.repo.UserHandle(suite.ctx, suite.user.ID, []byte("handle"))
+	created := suite.newCredential("cred-1")
+
+	credential, err := suite.repo.GetByCredentialID(suite.ctx, []byte("cred-1"))
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), created.ID, credential.ID)
+	assert.Equal(suite.T(), []byte("handle"), credential.UserHandle)
+	assert.JSONEq(suite.T(), `{"id":"cred-1"}`, string(credential.Data))
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestGetByCredentialID_NotFound() {
+	credential, err := suite.repo.GetByCredentialID(suite.ctx, []byte("missing"))
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), credential)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestRecordUse() {
+	created := suite.newCredential("cred-1")
+
+	err := suite.repo.RecordUse(suite.ctx, created.ID, []byte(`{"id":"cred-1","count":2}`))
+
+	assert.NoError(suite.T(), err)
+	credentials, _ := suite.repo.ListByUser(suite.ctx, suite.user.ID)
+	assert.NotNil(suite.T(), credentials[0].LastUsedAt)
+	assert.JSONEq(suite.T(), `{"id":"cred-1","count":2}`, string(credentials[0].Data))
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestDelete_OnlyOwnCredentials() {
+	created := suite.newCredential("cred-1")
+	other := &models.User{Email: "other@example.com", PasswordHash: "hash", Name: "Other"}
+	suite.Require().NoError(suite.userRepo.Create(suite.ctx, other))
+
+	deleted, err := suite.repo.Delete(suite.ctx, other.ID, created.ID)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), deleted)
+
+	deleted, err = suite.repo.Delete(suite.ctx, suite.user.ID, created.ID)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), deleted)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestCreateUserWithCredential() {
+	user := &models.User{Email: "passwordless@example.com", Name: "Passwordless"}
+	credential := &models.WebAuthnCredential{CredentialID: []byte("cred-2"), Name: "Passkey", Data: []byte(`{}`)}
+
+	err := suite.repo.CreateUserWithCredential(suite.ctx, user, []byte("handle-2"), credential)
+
+	assert.NoError(suite.T(), err)
+	assert.NotZero(suite.T(), user.ID)
+	assert.Equal(suite.T(), user.ID, credential.UserID)
+
+	stored, _ := suite.userRepo.GetByID(suite.ctx, user.ID)
+	assert.Empty(suite.T(), stored.PasswordHash)
+	found, _ := suite.repo.GetByCredentialID(suite.ctx, []byte("cred-2"))
+	assert.Equal(suite.T(), []byte("handle-2"), found.UserHandle)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestCreateUserWithCredential_RollsBackUser() {
+	suite.newCredential("cred-1")
+	user := &models.User{Email: "duplicate-cred@example.com", Name: "Duplicate"}
+	credential := &models.WebAuthnCredential{CredentialID: []byte("cred-1"), Name: "Passkey", Data: []byte(`{}`)}
+
+	err := suite.repo.CreateUserWithCredential(suite.ctx, user, []byte("handle-3"), credential)
+
+	assert.Error(suite.T(), err)
+	stored, _ := suite.userRepo.GetByEmail(suite.ctx, "duplicate-cred@example.com")
+	assert.Nil(suite.T(), stored)
+}
+
+func (suite *WebAuthnRepositoryTestSuite) TestCreateUserWithCredential_DeletedAccountsEmail() {
+	suite.Require().NoError(suite.userRepo.SoftDelete(suite.ctx, suite.user.ID))
+	user := &models.User{Email: suite.user.Email, Name: "Passwordless"}
+	credential := &models.WebAuthnCredential{CredentialID: []byte("cred-2"), Name: "Passkey", Data: []byte(`{}`)}
+
+	err := suite.repo.CreateUserWithCredential(suite.ctx, user, []byte("handle-2"), credential)
+
+	assert.ErrorIs(suite.T(), err, ErrEmailTaken)
+}
+
+func TestWebAuthnRepositoryTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	suite.Run(t, new(WebAuthnRepositoryTestSuite))
+}
@@ -3,13 +3,24 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dwfennell/monorepo-scaffold/internal/api"
+	"github.com/dwfennell/monorepo-scaffold/internal/auth"
 	"github.com/dwfennell/monorepo-scaffold/internal/database"
+	"github.com/dwfennell/monorepo-scaffold/internal/mail"
+	"github.com/dwfennell/monorepo-scaffold/internal/oidc"
+	"github.com/dwfennell/monorepo-scaffold/internal/ratelimit"
+	"github.com/dwfennell/monorepo-scaffold/internal/repository"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -27,18 +38,128 @@ func main() {
 	}
 	defer db.Close()
 
+	// Asymmetric token signing; falls back to HS256 with JWT_SECRET
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		ring, err := auth.LoadKeyRingDir(keysDir)
+		if err != nil {
+			log.Fatalf("Failed to load JWT key ring: %v", err)
+		}
+		auth.SetKeyRing(ring)
+		go reloadKeyRing(keysDir, durationFromEnv("JWT_KEYS_RELOAD_INTERVAL", time.Minute))
+	} else if keyFile := os.Getenv("JWT_SIGNING_KEY_FILE"); keyFile != "" {
+		key, err := auth.LoadPrivateKeyFile(os.Getenv("JWT_KEY_ID"), keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load JWT signing key: %v", err)
+		}
+		auth.SetSigningKey(key)
+		log.Printf("Signing tokens with %s key %s", key.Algorithm, key.ID)
+	}
+
+	// Token lifetimes
+	auth.AccessTokenTTL = durationFromEnv("ACCESS_TOKEN_TTL", auth.AccessTokenTTL)
+	auth.RefreshTokenTTL = durationFromEnv("REFRESH_TOKEN_TTL", auth.RefreshTokenTTL)
+	auth.EmailVerificationTTL = durationFromEnv("EMAIL_VERIFICATION_TTL", auth.EmailVerificationTTL)
+	auth.PasswordResetTTL = durationFromEnv("PASSWORD_RESET_TTL", auth.PasswordResetTTL)
+	auth.MFAPendingTTL = durationFromEnv("MFA_PENDING_TTL", auth.MFAPendingTTL)
+	auth.MagicLinkTTL = durationFromEnv("MAGIC_LINK_TTL", auth.MagicLinkTTL)
+	auth.AccountUnlockTTL = durationFromEnv("ACCOUNT_UNLOCK_TTL", auth.AccountUnlockTTL)
+	auth.OrgInvitationTTL = durationFromEnv("ORG_INVITATION_TTL", auth.OrgInvitationTTL)
+	auth.AuthorizationCodeTTL = durationFromEnv("AUTHORIZATION_CODE_TTL", auth.AuthorizationCodeTTL)
+	auth.AccountDeletionGracePeriod = durationFromEnv("ACCOUNT_DELETION_GRACE_PERIOD", auth.AccountDeletionGracePeriod)
+
+	// Deleted accounts are purged once their grace period is over
+	go purgeDeletedUsers(repository.NewUserRepository(db), durationFromEnv("ACCOUNT_PURGE_INTERVAL", time.Hour))
+
+	// Password hashing; existing hashes are moved to this at the next login
+	auth.PasswordHashing = passwordHasherFromEnv()
+
+	// Email delivery
+	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	mailer, err := mail.NewMailer(mail.Config{
+		Driver:       os.Getenv("MAIL_DRIVER"),
+		From:         os.Getenv("MAIL_FROM"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     smtpPort,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		Dir:          os.Getenv("MAIL_DIR"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+
 	// Initialize Gin router
 	router := gin.Default()
 
+	// Client IP addresses, which failed logins are counted against, are only
+	// taken from X-Forwarded-For when the request came through a trusted proxy
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS configuration
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{os.Getenv("FRONTEND_URL")}
 	config.AllowCredentials = true
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", api.CSRFHeader}
+	config.ExposeHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"}
 	router.Use(cors.New(config))
 
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "Monorepo Scaffold"
+	}
+
+	// Passkeys are bound to the frontend's domain unless configured otherwise
+	webauthnOrigins := []string{os.Getenv("FRONTEND_URL")}
+	if origins := os.Getenv("WEBAUTHN_ORIGINS"); origins != "" {
+		webauthnOrigins = strings.Split(origins, ",")
+	}
+	webauthnRPID := os.Getenv("WEBAUTHN_RP_ID")
+	if webauthnRPID == "" {
+		if u, err := url.Parse(webauthnOrigins[0]); err == nil {
+			webauthnRPID = u.Hostname()
+		}
+	}
+
 	// Initialize API handlers
-	api.SetupRoutes(router, db)
+	err = api.SetupRoutes(router, db, api.Config{
+		AppName:                  appName,
+		FrontendURL:              os.Getenv("FRONTEND_URL"),
+		Mailer:                   mailer,
+		WebAuthnRPID:             webauthnRPID,
+		WebAuthnOrigins:          webauthnOrigins,
+		OIDCProviders:            oidcProvidersFromEnv(os.Getenv("FRONTEND_URL")),
+		Issuer:                   os.Getenv("ISSUER_URL"),
+		RequireEmailVerification: os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
+		MagicLinkSignup:          os.Getenv("MAGIC_LINK_SIGNUP") == "true",
+		PasswordPolicy:           passwordPolicyFromEnv(appName),
+		SessionLocationHeader:    os.Getenv("SESSION_LOCATION_HEADER"),
+		Cookies:                  cookieModeFromEnv(),
+		LoginLimits: api.LoginLimits{
+			Window:          durationFromEnv("LOGIN_FAILURE_WINDOW", api.DefaultLoginLimits.Window),
+			DelayAfter:      intFromEnv("LOGIN_DELAY_AFTER", api.DefaultLoginLimits.DelayAfter),
+			Delay:           durationFromEnv("LOGIN_DELAY", api.DefaultLoginLimits.Delay),
+			LockAfter:       intFromEnv("LOGIN_LOCK_AFTER", api.DefaultLoginLimits.LockAfter),
+			LockoutDuration: durationFromEnv("LOGIN_LOCKOUT_DURATION", api.DefaultLoginLimits.LockoutDuration),
+			IPLockAfter:     intFromEnv("LOGIN_IP_LOCK_AFTER", api.DefaultLoginLimits.IPLockAfter),
+		},
+		RateLimitStore: os.Getenv("RATE_LIMIT_STORE"),
+		RateLimits: api.RateLimits{
+			Auth:     limitFromEnv("RATE_LIMIT_AUTH", api.DefaultRateLimits.Auth),
+			Register: limitFromEnv("RATE_LIMIT_REGISTER", api.DefaultRateLimits.Register),
+			Email:    limitFromEnv("RATE_LIMIT_EMAIL", api.DefaultRateLimits.Email),
+			Token:    limitFromEnv("RATE_LIMIT_TOKEN", api.DefaultRateLimits.Token),
+			API:      limitFromEnv("RATE_LIMIT_API", api.DefaultRateLimits.API),
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up routes: %v", err)
+	}
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -51,3 +172,192 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// durationFromEnv parses an environment variable such as "15m" or "720h",
+// returning fallback when it is unset.
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return d
+}
+
+// intFromEnv parses an integer environment variable, returning fallback when
+// it is unset.
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return n
+}
+
+// passwordHasherFromEnv returns the hasher named by PASSWORD_HASHER, with
+// parameters from the ARGON2_* or BCRYPT_COST variables.
+func passwordHasherFromEnv() auth.PasswordHasher {
+	switch hasher := os.Getenv("PASSWORD_HASHER"); hasher {
+	case "argon2id", "":
+		memory := intFromEnv("ARGON2_MEMORY", int(auth.DefaultArgon2idHasher.Memory))
+		iterations := intFromEnv("ARGON2_ITERATIONS", int(auth.DefaultArgon2idHasher.Iterations))
+		parallelism := intFromEnv("ARGON2_PARALLELISM", int(auth.DefaultArgon2idHasher.Parallelism))
+		if parallelism < 1 || parallelism > 255 {
+			log.Fatalf("Invalid ARGON2_PARALLELISM: must be between 1 and 255")
+		}
+		if memory < 8*parallelism || iterations < 1 {
+			log.Fatalf("Invalid ARGON2_MEMORY or ARGON2_ITERATIONS: need at least 8 KiB per thread and 1 iteration")
+		}
+		return auth.Argon2idHasher{
+			Memory:      uint32(memory),
+			Iterations:  uint32(iterations),
+			Parallelism: uint8(parallelism),
+		}
+	case "bcrypt":
+		cost := intFromEnv("BCRYPT_COST", bcrypt.DefaultCost)
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			log.Fatalf("Invalid BCRYPT_COST: must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return auth.BcryptHasher{Cost: cost}
+	default:
+		log.Fatalf("Invalid PASSWORD_HASHER %q: must be argon2id or bcrypt", hasher)
+		return nil
+	}
+}
+
+// passwordPolicyFromEnv reads the PASSWORD_* variables and opens the breached
+// password corpus at BREACHED_PASSWORDS_PATH, if set. Passwords may not
+// contain the words of the app's name, and may not be longer than the hasher
+// accepts.
+func passwordPolicyFromEnv(appName string) *auth.PasswordPolicy {
+	policy := &auth.PasswordPolicy{
+		MinLength:   intFromEnv("PASSWORD_MIN_LENGTH", auth.DefaultPasswordPolicy.MinLength),
+		MaxBytes:    intFromEnv("PASSWORD_MAX_BYTES", auth.DefaultPasswordPolicy.MaxBytes),
+		MinStrength: intFromEnv("PASSWORD_MIN_STRENGTH", auth.DefaultPasswordPolicy.MinStrength),
+		BannedWords: strings.Fields(appName),
+	}
+	if policy.MinStrength < 0 || policy.MinStrength > 4 {
+		log.Fatalf("Invalid PASSWORD_MIN_STRENGTH: must be between 0 and 4")
+	}
+	if _, ok := auth.PasswordHashing.(auth.BcryptHasher); ok && (policy.MaxBytes <= 0 || policy.MaxBytes > 72) {
+		policy.MaxBytes = 72
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_PATH"); path != "" {
+		breached, err := auth.OpenBreachedPasswords(path)
+		if err != nil {
+			log.Fatalf("Invalid BREACHED_PASSWORDS_PATH: %v", err)
+		}
+		policy.Breached = breached
+	}
+	return policy
+}
+
+// cookieModeFromEnv reads whether tokens are set as cookies, and the cookies'
+// attributes.
+func cookieModeFromEnv() api.CookieMode {
+	mode := api.CookieMode{
+		Enabled: os.Getenv("AUTH_COOKIES") == "true",
+		Domain:  os.Getenv("COOKIE_DOMAIN"),
+	}
+
+	switch sameSite := os.Getenv("COOKIE_SAMESITE"); sameSite {
+	case "", "lax":
+		mode.SameSite = http.SameSiteLaxMode
+	case "strict":
+		mode.SameSite = http.SameSiteStrictMode
+	case "none":
+		mode.SameSite = http.SameSiteNoneMode
+	default:
+		log.Fatalf("Invalid COOKIE_SAMESITE %q: must be lax, strict or none", sameSite)
+	}
+	return mode
+}
+
+// limitFromEnv parses a rate limit such as "10/1m", or "off", returning
+// fallback when it is unset.
+func limitFromEnv(key string, fallback ratelimit.Limit) ratelimit.Limit {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return limit
+}
+
+// oidcProvidersFromEnv reads the providers named in OIDC_PROVIDERS, each
+// configured by OIDC_<NAME>_* variables. Redirects go to the frontend's
+// /auth/callback/<name> page unless OIDC_<NAME>_REDIRECT_URL is set.
+func oidcProvidersFromEnv(frontendURL string) []oidc.Config {
+	var providers []oidc.Config
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			LinkByEmail:  os.Getenv(prefix+"LINK_BY_EMAIL") == "true",
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			cfg.Scopes = strings.Fields(scopes)
+		}
+		if cfg.RedirectURL == "" {
+			cfg.RedirectURL = strings.TrimSuffix(frontendURL, "/") + "/auth/callback/" + name
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			log.Fatalf("OIDC provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+
+		providers = append(providers, cfg)
+	}
+	return providers
+}
+
+// reloadKeyRing picks up keys added or retired by keyctl. A directory that
+// fails to load leaves the previous ring in place.
+func reloadKeyRing(dir string, interval time.Duration) {
+	for range time.Tick(interval) {
+		ring, err := auth.LoadKeyRingDir(dir)
+		if err != nil {
+			log.Printf("Failed to reload JWT key ring: %v", err)
+			continue
+		}
+		auth.SetKeyRing(ring)
+	}
+}
+
+// purgeDeletedUsers permanently removes accounts deleted more than
+// auth.AccountDeletionGracePeriod ago. Running it on several instances at
+// once is harmless.
+func purgeDeletedUsers(users *repository.UserRepository, interval time.Duration) {
+	for range time.Tick(interval) {
+		purged, err := users.PurgeDeleted(context.Background(), auth.AccountDeletionGracePeriod)
+		if err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_webauthn_sessions_expires_at;
+DROP TABLE IF EXISTS webauthn_sessions;
+DROP INDEX IF EXISTS idx_webauthn_credentials_user_id;
+DROP TABLE IF EXISTS webauthn_credentials;
+ALTER TABLE users DROP COLUMN IF EXISTS webauthn_handle;
+UPDATE users SET password_hash = '' WHERE password_hash IS NULL;
+ALTER TABLE users ALTER COLUMN password_hash SET NOT NULL;
@@ -0,0 +1,33 @@
+-- Accounts created with a passkey have no password
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+
+-- The random WebAuthn user handle stored by the user's authenticators
+ALTER TABLE users ADD COLUMN IF NOT EXISTS webauthn_handle BYTEA UNIQUE;
+
+-- Registered passkeys. data holds the credential record (public key, sign
+-- count, flags) as serialized by the WebAuthn library.
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- Challenges issued for registration and login ceremonies that have not
+-- finished yet. Each can be used once.
+CREATE TABLE IF NOT EXISTS webauthn_sessions (
+    id SERIAL PRIMARY KEY,
+    challenge VARCHAR(128) UNIQUE NOT NULL,
+    ceremony VARCHAR(32) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    data JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_expires_at ON webauthn_sessions(expires_at);
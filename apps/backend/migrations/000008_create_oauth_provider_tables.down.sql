@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS oauth_consents;
+DROP INDEX IF EXISTS idx_oauth_authorization_codes_expires_at;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP INDEX IF EXISTS idx_oauth_authorization_requests_expires_at;
+DROP TABLE IF EXISTS oauth_authorization_requests;
+DROP TABLE IF EXISTS oauth_clients;
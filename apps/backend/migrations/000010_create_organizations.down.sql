@@ -0,0 +1,7 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS org_id;
+DROP INDEX IF EXISTS idx_organization_invitations_expires_at;
+DROP INDEX IF EXISTS idx_organization_invitations_org_id;
+DROP TABLE IF EXISTS organization_invitations;
+DROP INDEX IF EXISTS idx_organization_members_user_id;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,14 @@
+DROP POLICY IF EXISTS tenant_isolation ON organization_invitations;
+DROP POLICY IF EXISTS tenant_isolation ON organization_members;
+DROP POLICY IF EXISTS tenant_isolation ON organizations;
+
+ALTER TABLE organization_invitations DISABLE ROW LEVEL SECURITY;
+ALTER TABLE organization_members DISABLE ROW LEVEL SECURITY;
+ALTER TABLE organizations DISABLE ROW LEVEL SECURITY;
+
+DROP FUNCTION IF EXISTS app_current_user();
+DROP FUNCTION IF EXISTS app_current_org();
+
+-- Revokes app_tenant's privileges in this database. The role itself is left
+-- in place because other databases in the cluster may still use it.
+DROP OWNED BY app_tenant;
@@ -0,0 +1,48 @@
+-- Requests scoped to an organization switch to this role, which owns nothing
+-- and so is subject to row-level security even when the application connects
+-- as the tables' owner or a superuser. Roles are shared by every database in
+-- the cluster, so it may already exist.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'app_tenant') THEN
+        CREATE ROLE app_tenant NOLOGIN;
+    END IF;
+END
+$$;
+
+GRANT app_tenant TO CURRENT_USER;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO app_tenant;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO app_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO app_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO app_tenant;
+
+-- The organization and user of the current scope, set with SET LOCAL. Both
+-- are NULL outside one, which matches no rows.
+CREATE OR REPLACE FUNCTION app_current_org() RETURNS INTEGER AS $$
+    SELECT NULLIF(current_setting('app.current_org', true), '')::INTEGER
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE FUNCTION app_current_user() RETURNS INTEGER AS $$
+    SELECT NULLIF(current_setting('app.current_user', true), '')::INTEGER
+$$ LANGUAGE SQL STABLE;
+
+ALTER TABLE organizations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE organization_members ENABLE ROW LEVEL SECURITY;
+ALTER TABLE organization_invitations ENABLE ROW LEVEL SECURITY;
+
+-- The current organization, and only while the current user belongs to it.
+CREATE POLICY tenant_isolation ON organizations TO app_tenant
+    USING (
+        id = app_current_org()
+        AND EXISTS (
+            SELECT 1 FROM organization_members m
+            WHERE m.org_id = organizations.id AND m.user_id = app_current_user()
+        )
+    );
+
+CREATE POLICY tenant_isolation ON organization_members TO app_tenant
+    USING (org_id = app_current_org());
+
+CREATE POLICY tenant_isolation ON organization_invitations TO app_tenant
+    USING (org_id = app_current_org());
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name IN ('service_accounts:read', 'service_accounts:write');
+DROP TABLE IF EXISTS service_accounts;
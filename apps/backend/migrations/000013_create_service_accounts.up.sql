@@ -0,0 +1,24 @@
+-- Non-human clients that obtain tokens with the client_credentials grant.
+-- Scopes are the permissions their tokens may carry.
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    client_secret_hash VARCHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    disabled_at TIMESTAMP,
+    secret_rotated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('service_accounts:read', 'View service accounts'),
+    ('service_accounts:write', 'Create, rotate and disable service accounts')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name LIKE 'service_accounts:%'
+ON CONFLICT DO NOTHING;
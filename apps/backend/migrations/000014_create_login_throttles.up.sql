@@ -0,0 +1,25 @@
+-- Failed password logins, counted per email address and per client IP
+-- address. Keys are "email:<address>" or "ip:<address>". blocked_until is
+-- when the next attempt is allowed, and locked marks a lockout rather than a
+-- short delay.
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMP,
+    locked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- Security events such as lockouts. user_id is the account an event concerns
+-- and actor_id the user who caused it, when there is one.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id SERIAL PRIMARY KEY,
+    event VARCHAR(100) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events(user_id);
@@ -0,0 +1,9 @@
+-- Rate limit buckets shared between instances. tat is when a key's bucket
+-- will be full again; rows with a tat in the past can be deleted.
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key VARCHAR(255) PRIMARY KEY,
+    tat TIMESTAMP NOT NULL,
+    allowed BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limits_tat ON rate_limits(tat);
@@ -0,0 +1,2 @@
+-- The new address an email_change token confirms.
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS email VARCHAR(255);
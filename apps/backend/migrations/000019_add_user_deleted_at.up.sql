@@ -0,0 +1,5 @@
+-- When the user deleted their account. Deleted accounts are hidden until they
+-- are restored or, once the grace period is over, purged.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DELETE FROM user_token_revocations WHERE revoked_before IS NULL;
+ALTER TABLE user_token_revocations DROP COLUMN IF EXISTS sessionless_revoked_before;
+ALTER TABLE user_token_revocations ALTER COLUMN revoked_before SET NOT NULL;
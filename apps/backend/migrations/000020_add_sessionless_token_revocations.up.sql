@@ -0,0 +1,6 @@
+-- Access tokens not tied to a session, such as those issued to OAuth clients
+-- or before sessions were recorded, issued before this time are revoked too.
+-- Ending a user's other sessions sets it without touching revoked_before,
+-- which is now NULL for users who have only ever done that.
+ALTER TABLE user_token_revocations ALTER COLUMN revoked_before DROP NOT NULL;
+ALTER TABLE user_token_revocations ADD COLUMN IF NOT EXISTS sessionless_revoked_before TIMESTAMP;
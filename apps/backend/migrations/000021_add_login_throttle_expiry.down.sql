@@ -0,0 +1,2 @@
+DELETE FROM login_throttles WHERE expires_at IS NOT NULL;
+ALTER TABLE login_throttles DROP COLUMN IF EXISTS expires_at;
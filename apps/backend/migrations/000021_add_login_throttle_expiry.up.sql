@@ -0,0 +1,4 @@
+-- Failed attempts at a credential that expires, such as wrong codes against
+-- an MFA token keyed "mfa:<jti>", are kept until the credential expires
+-- rather than for the login failure window.
+ALTER TABLE login_throttles ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
@@ -2,6 +2,7 @@ export interface User {
   id: number
   email: string
   name: string
+  email_verified_at: string | null
   created_at: string
   updated_at: string
 }
@@ -19,5 +20,281 @@ export interface LoginRequest {
 
 export interface AuthResponse {
   token: string
+  refresh_token: string
   user: User
 }
+
+// Returned instead of an AuthResponse in cookie mode, where the tokens are set
+// as cookies. Send csrf_token in the X-CSRF-Token header.
+export interface CookieAuthResponse {
+  csrf_token: string
+  user: User
+}
+
+export interface MagicLinkRequest {
+  email: string
+}
+
+// Responds like login, with a LoginResponse
+export interface ConsumeMagicLinkRequest {
+  token: string
+}
+
+// Returned by login instead of an AuthResponse when a second factor is needed
+export interface MFAChallengeResponse {
+  mfa_required: true
+  mfa_token: string
+}
+
+export type LoginResponse = AuthResponse | MFAChallengeResponse
+
+export interface MFAVerifyRequest {
+  mfa_token: string
+  code?: string
+  recovery_code?: string
+}
+
+export interface TOTPEnrollmentResponse {
+  secret: string
+  otpauth_url: string
+}
+
+export interface RecoveryCodesResponse {
+  recovery_codes: string[]
+}
+
+export interface MFAStatusResponse {
+  totp_enabled: boolean
+  recovery_codes_remaining: number
+}
+
+export interface WebAuthnSignupRequest {
+  email: string
+  name: string
+}
+
+// credential is the PublicKeyCredential returned by the browser, as JSON
+export interface WebAuthnFinishRequest {
+  credential: unknown
+  name?: string
+}
+
+export interface WebAuthnCredential {
+  id: number
+  user_id: number
+  name: string
+  created_at: string
+  last_used_at: string | null
+}
+
+export interface OIDCProvidersResponse {
+  providers: string[]
+}
+
+export interface OIDCStartResponse {
+  authorization_url: string
+}
+
+// code and state as sent by the provider to the redirect URI
+export interface OIDCCallbackRequest {
+  code: string
+  state: string
+}
+
+export interface UserIdentity {
+  id: number
+  user_id: number
+  provider: string
+  email: string
+  created_at: string
+  last_login_at: string | null
+}
+
+// A pending request from another app to log the user in through this service
+export interface OAuthConsentPrompt {
+  request_id: string
+  client_id: string
+  client_name: string
+  scopes: string[]
+  consent_required: boolean
+}
+
+export interface OAuthRedirectResponse {
+  redirect_to: string
+}
+
+export interface Role {
+  id: number
+  name: string
+  description: string
+  permissions: string[]
+  created_at: string
+}
+
+export interface AssignRoleRequest {
+  role: string
+}
+
+export interface UserRolesResponse {
+  roles: string[]
+  permissions: string[]
+}
+
+export type OrgRole = 'owner' | 'admin' | 'member'
+
+export interface Organization {
+  id: number
+  name: string
+  created_at: string
+  updated_at: string
+}
+
+// An organization as seen by one of its members
+export interface UserOrganization extends Organization {
+  role: OrgRole
+}
+
+export interface OrgMember {
+  org_id: number
+  user_id: number
+  email: string
+  name: string
+  role: OrgRole
+  created_at: string
+}
+
+export interface OrgInvitation {
+  id: number
+  org_id: number
+  email: string
+  role: OrgRole
+  invited_by: number | null
+  expires_at: string
+  created_at: string
+}
+
+export interface CreateOrganizationRequest {
+  name: string
+}
+
+export interface CreateInvitationRequest {
+  email: string
+  role: OrgRole
+}
+
+export interface InvitationTokenRequest {
+  token: string
+}
+
+export interface PersonalAccessToken {
+  id: number
+  name: string
+  prefix: string
+  scopes: string[]
+  expires_at: string | null
+  last_used_at: string | null
+  created_at: string
+}
+
+export interface CreatePersonalAccessTokenRequest {
+  name: string
+  scopes?: string[]
+  expires_at?: string
+}
+
+// Returned once, when the token is created
+export interface CreatePersonalAccessTokenResponse extends PersonalAccessToken {
+  token: string
+}
+
+export interface ServiceAccount {
+  id: number
+  client_id: string
+  name: string
+  scopes: string[]
+  created_by: number | null
+  disabled_at: string | null
+  secret_rotated_at: string
+  created_at: string
+}
+
+export interface CreateServiceAccountRequest {
+  name: string
+  scopes?: string[]
+}
+
+// Returned when a service account is created or its secret rotated
+export interface ServiceAccountCredentialsResponse extends ServiceAccount {
+  client_secret: string
+}
+
+export interface UnlockAccountRequest {
+  token: string
+}
+
+export type AuditEventType = 'account.locked' | 'account.unlocked' | 'login.ip_blocked'
+
+export interface AuditEvent {
+  id: number
+  event: AuditEventType
+  user_id: number | null
+  actor_id: number | null
+  ip_address: string
+  details: Record<string, unknown>
+  created_at: string
+}
+
+export type PasswordViolationCode = 'too_short' | 'too_long' | 'banned_word' | 'too_weak' | 'breached'
+
+export interface PasswordViolation {
+  code: PasswordViolationCode
+  message: string
+}
+
+// Returned with 400 when a new password is refused
+export interface PasswordPolicyError {
+  error: string
+  reasons: PasswordViolation[]
+}
+
+// A login on one device, from GET /me/sessions
+export interface Session {
+  id: string
+  user_agent: string
+  device: string
+  ip_address: string
+  location?: string
+  created_at: string
+  last_seen_at: string
+  expires_at: string
+  current: boolean
+}
+
+// PATCH /me; omitted fields are left unchanged
+export interface UpdateProfileRequest {
+  name?: string
+}
+
+export interface ChangePasswordRequest {
+  current_password: string
+  new_password: string
+}
+
+// password is required for accounts that have one
+export interface ChangeEmailRequest {
+  email: string
+  password?: string
+}
+
+export interface ConfirmEmailChangeRequest {
+  token: string
+}
+
+// DELETE /me; password is required for accounts that have one
+export interface DeleteAccountRequest {
+  password?: string
+}
+
+export interface RestoreAccountRequest {
+  token: string
+}